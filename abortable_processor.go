@@ -0,0 +1,45 @@
+package goetl
+
+import "github.com/teambenny/goetl/logger"
+
+// AbortableProcessor is a Processor that needs to clean up after a failed
+// Pipeline run, e.g. to roll back a transaction or close a connection that
+// would otherwise have been closed in Finish.
+//
+// When a run fails (a Processor sent an error to its killChan, the context
+// was cancelled, or an interrupt signal was received), Abort is called once
+// on every AbortableProcessor in the Pipeline with the error that halted
+// execution. Abort is called after all stages have stopped, whether or not
+// Finish was called on the Processor.
+type AbortableProcessor interface {
+	Processor
+	Abort(err error)
+}
+
+// abortableOf returns the given Processor, or the one it wraps, if it
+// implements AbortableProcessor, or nil.
+func abortableOf(p Processor) AbortableProcessor {
+	for _, p := range unwrapProcessor(p) {
+		if ap, ok := p.(AbortableProcessor); ok {
+			return ap
+		}
+	}
+	return nil
+}
+
+// abortProcessors calls Abort on every AbortableProcessor in the Pipeline.
+func (p *Pipeline) abortProcessors(err error) {
+	for n, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			if ap := abortableOf(dp.Processor); ap != nil {
+				logger.Info(p.Name, "- stage", n+1, dp, "calling Abort:", err)
+				ap.Abort(err)
+			}
+			if dp.errorPolicy != nil {
+				if ap := abortableOf(dp.errorPolicy.DeadLetter); ap != nil {
+					ap.Abort(err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package goetl
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/teambenny/goetl/logger"
+)
+
+// Checkpointer is a Processor that can save and restore its state, so that
+// a Pipeline that fails part-way through can be resumed instead of starting
+// over. For example, a reader can save the keys of the objects it has already
+// read, and skip them once restored.
+//
+// A Checkpointer in the first stage (a reader) is saved along with its
+// position: the number of payloads it has sent that have gone all the way
+// through the Pipeline. Every payload carries the positions of the readers
+// it came from, and the Processors at the end of the Pipeline acknowledge
+// them once the data is written (see Acknowledger). Since stages run
+// concurrently, a reader is only asked for its state while ProcessData and
+// Finish are not running, so that the state describes exactly the data it
+// has sent. The last state taken at or before the position is saved, along
+// with the number of payloads sent after it, which are dropped when the
+// restored reader sends them again. Readers must therefore send their data in
+// the same order on every run, such as a SQLReader with an ORDER BY.
+//
+// A reader's position only moves on as the data is written if the payloads
+// it sends reach each Processor at the end of the Pipeline along a single
+// path, and the Processors in between send the data for each payload while
+// processing it (or from Finish). Otherwise, and for Processors at the end
+// that are not Acknowledgers, the data counts as written once the Processor
+// at the end has finished without error.
+//
+// Checkpointers in later stages are saved as they are, and should save state
+// that lets them cope with receiving data again, as RedshiftWriter does. Their
+// Checkpoint may be called while ProcessData is running (see
+// Pipeline.CheckpointInterval), so implementations must be safe for
+// concurrent use.
+type Checkpointer interface {
+	Processor
+	Checkpoint() ([]byte, error)
+	Restore(state []byte) error
+}
+
+// Acknowledger is a Processor at the end of a Pipeline that reports how much
+// of the data it has received has been written for good, so that checkpoints
+// can save the position of the readers up to that data (see Checkpointer).
+// Acknowledged returns the number of payloads, counted in the order they were
+// received, that have all been written: the first n. It may be called while
+// ProcessData is running, so implementations must be safe for concurrent use.
+type Acknowledger interface {
+	Processor
+	Acknowledged() int
+}
+
+// CheckpointStore persists Pipeline checkpoints. A checkpoint maps a key
+// for each Checkpointer in the Pipeline to its saved state.
+type CheckpointStore interface {
+	// Load returns the last checkpoint saved for the named Pipeline,
+	// or nil if there is none.
+	Load(name string) (map[string][]byte, error)
+	Save(name string, checkpoint map[string][]byte) error
+	Clear(name string) error
+}
+
+// checkpointerOf returns the given Processor, or the one it wraps, if it
+// implements Checkpointer, or nil.
+func checkpointerOf(p Processor) Checkpointer {
+	for _, p := range unwrapProcessor(p) {
+		if c, ok := p.(Checkpointer); ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// acknowledgerOf returns the given Processor, or the one it wraps, if it
+// implements Acknowledger, or nil.
+func acknowledgerOf(p Processor) Acknowledger {
+	for _, p := range unwrapProcessor(p) {
+		if a, ok := p.(Acknowledger); ok {
+			return a
+		}
+	}
+	return nil
+}
+
+// checkpointKey identifies a DataProcessor within the Pipeline's layout.
+// The Processor's type is used rather than its String, which may change
+// along with its state.
+func checkpointKey(stage, position int, dp *DataProcessor) string {
+	return fmt.Sprintf("%d.%d-%T", stage+1, position+1, dp.Processor)
+}
+
+// savedState is what a checkpoint holds for each Checkpointer: its state,
+// and for a reader, the number of payloads it sends once restored that are
+// dropped, since they went through the Pipeline before the checkpoint.
+type savedState struct {
+	State []byte `json:"state,omitempty"`
+	Skip  int    `json:"skip,omitempty"`
+}
+
+// restoreCheckpoint restores every Checkpointer from the last checkpoint
+// saved in the Pipeline's CheckpointStore (if any).
+func (p *Pipeline) restoreCheckpoint() error {
+	if p.Name == "" || p.Name == defaultPipelineName {
+		return errors.New("a Pipeline with a CheckpointStore must be given its own Name, to save its checkpoints under")
+	}
+	checkpoint, err := p.CheckpointStore.Load(p.Name)
+	if err != nil {
+		return err
+	}
+	if checkpoint == nil {
+		return nil
+	}
+	logger.Info(p.Name, ": resuming from checkpoint")
+	for n, stage := range p.layout.stages {
+		for i, dp := range stage.processors {
+			d, ok := checkpoint[checkpointKey(n, i, dp)]
+			c := checkpointerOf(dp.Processor)
+			if !ok || c == nil {
+				continue
+			}
+			var saved savedState
+			if err := json.Unmarshal(d, &saved); err != nil {
+				return fmt.Errorf("%v: restoring checkpoint: %v", dp, err)
+			}
+			if saved.State != nil {
+				if err := c.Restore(saved.State); err != nil {
+					return fmt.Errorf("%v: restoring checkpoint: %v", dp, err)
+				}
+			}
+			dp.checkpoint.restored(saved)
+		}
+	}
+	return nil
+}
+
+// saveCheckpoint saves the state of every Checkpointer, and the position
+// of every reader (see readerPosition), to the Pipeline's CheckpointStore.
+// Nothing is saved if any Checkpointer returns an error, so that the last
+// good checkpoint is kept.
+func (p *Pipeline) saveCheckpoint() error {
+	checkpoint := make(map[string][]byte)
+	for n, stage := range p.layout.stages {
+		for i, dp := range stage.processors {
+			c := checkpointerOf(dp.Processor)
+			if c == nil {
+				continue
+			}
+			var saved savedState
+			if dp.checkpoint.isReader() {
+				saved = dp.checkpoint.savedAt(p.readerPosition(dp))
+			} else {
+				state, err := c.Checkpoint()
+				if err != nil {
+					return fmt.Errorf("%v: saving checkpoint: %v", dp, err)
+				}
+				saved.State = state
+			}
+			d, err := json.Marshal(saved)
+			if err != nil {
+				return fmt.Errorf("%v: saving checkpoint: %v", dp, err)
+			}
+			checkpoint[checkpointKey(n, i, dp)] = d
+		}
+	}
+	return p.CheckpointStore.Save(p.Name, checkpoint)
+}
+
+// finishState records whether a DataProcessor has finished, and whether
+// it has sent an error.
+type finishState struct {
+	finishMutex sync.Mutex
+	finished    bool
+	failed      bool
+}
+
+func (s *finishState) resetFinished() {
+	s.finishMutex.Lock()
+	s.finished, s.failed = false, false
+	s.finishMutex.Unlock()
+}
+
+func (s *finishState) markFinished() {
+	s.finishMutex.Lock()
+	s.finished = true
+	s.finishMutex.Unlock()
+}
+
+func (s *finishState) markFailed() {
+	s.finishMutex.Lock()
+	s.failed = true
+	s.finishMutex.Unlock()
+}
+
+// finishedOK reports whether Finish has been called, and no error has
+// been sent.
+func (s *finishState) finishedOK() bool {
+	s.finishMutex.Lock()
+	defer s.finishMutex.Unlock()
+	return s.finished && !s.failed
+}
+
+// startCheckpoints saves a checkpoint every CheckpointInterval until
+// the returned stop func is called.
+func (p *Pipeline) startCheckpoints() (stop func()) {
+	if p.CheckpointInterval <= 0 {
+		return func() {}
+	}
+	quit := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		ticker := time.NewTicker(p.CheckpointInterval)
+		defer ticker.Stop()
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.saveCheckpoint(); err != nil {
+					logger.Error(p.Name, ": checkpoint failed:", err)
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-stopped
+	}
+}
+
+// finishCheckpoints clears the checkpoint after a successful run, or
+// saves a final checkpoint after a failed one.
+func (p *Pipeline) finishCheckpoints(runErr error) {
+	if runErr == nil {
+		if err := p.CheckpointStore.Clear(p.Name); err != nil {
+			logger.Error(p.Name, ": clearing checkpoint failed:", err)
+		}
+		return
+	}
+	if err := p.saveCheckpoint(); err != nil {
+		logger.Error(p.Name, ": checkpoint failed:", err)
+	}
+}
+
+// FileCheckpointStore is a CheckpointStore that keeps each Pipeline's
+// checkpoint as a JSON file within a local directory.
+type FileCheckpointStore struct {
+	Dir string
+}
+
+// NewFileCheckpointStore returns a new FileCheckpointStore saving
+// checkpoints to the given directory (which must already exist).
+func NewFileCheckpointStore(dir string) *FileCheckpointStore {
+	return &FileCheckpointStore{Dir: dir}
+}
+
+// Load implements CheckpointStore.
+func (s *FileCheckpointStore) Load(name string) (map[string][]byte, error) {
+	d, err := ioutil.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint map[string][]byte
+	err = json.Unmarshal(d, &checkpoint)
+	return checkpoint, err
+}
+
+// Save implements CheckpointStore. The checkpoint is written to a
+// temporary file first, so a crash never leaves a partial checkpoint.
+func (s *FileCheckpointStore) Save(name string, checkpoint map[string][]byte) error {
+	d, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.Dir, ".checkpoint")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(d); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(name))
+}
+
+// Clear implements CheckpointStore.
+func (s *FileCheckpointStore) Clear(name string) error {
+	err := os.Remove(s.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path returns the file for the named Pipeline's checkpoint. Any character
+// of the name that may not be safe in a file name is replaced, and a hash of
+// the whole name is added so that different names never share a file.
+func (s *FileCheckpointStore) path(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_') {
+			return r
+		}
+		return '_'
+	}, name)
+	sum := sha256.Sum256([]byte(name))
+	return filepath.Join(s.Dir, fmt.Sprintf("%s-%x.checkpoint.json", safe, sum[:4]))
+}
@@ -0,0 +1,313 @@
+package goetl
+
+import (
+	"sync"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/logger"
+)
+
+// checkpointMark holds the position of each reader (see Checkpointer) that
+// a payload came from: the number of payloads the reader had sent, up to
+// and including the one the payload came from. Marks are never changed once
+// made, since they are shared by payloads.
+type checkpointMark map[*DataProcessor]int
+
+// merge returns a mark with the highest position of each reader in m or o.
+func (m checkpointMark) merge(o checkpointMark) checkpointMark {
+	return m.combine(o, func(a, b int) bool { return b > a })
+}
+
+// lowest returns a mark with the lowest position of each reader in m or o.
+func (m checkpointMark) lowest(o checkpointMark) checkpointMark {
+	return m.combine(o, func(a, b int) bool { return b < a })
+}
+
+func (m checkpointMark) combine(o checkpointMark, replace func(a, b int) bool) checkpointMark {
+	if len(o) == 0 {
+		return m
+	}
+	if len(m) == 0 {
+		return o
+	}
+	c := make(checkpointMark, len(m)+len(o))
+	for r, n := range m {
+		c[r] = n
+	}
+	for r, n := range o {
+		if a, ok := c[r]; !ok || replace(a, n) {
+			c[r] = n
+		}
+	}
+	return c
+}
+
+// markOf returns the mark of a payload, or nil if it has none.
+func markOf(d etldata.Payload) checkpointMark {
+	if e := envelopeOf(d); e != nil {
+		return e.mark
+	}
+	return nil
+}
+
+// markOutput gives a payload sent while processing another the mark of
+// the one processed.
+func markOutput(mark checkpointMark, d etldata.Payload) etldata.Payload {
+	if mark == nil {
+		return d
+	}
+	e := rewrap(d)
+	e.mark = e.mark.merge(mark)
+	return e
+}
+
+// checkpointTracker is what a DataProcessor keeps track of for the
+// checkpoints of its Pipeline. It is nil when the Pipeline has no
+// CheckpointStore, and its methods do nothing then.
+type checkpointTracker struct {
+	mutex sync.Mutex
+
+	// For a reader: the number of payloads it has sent since its state
+	// was restored, the number of them to drop, and its states taken
+	// while it was at rest.
+	reader bool
+	sent   int
+	skip   int
+	states []restingState
+
+	// The highest position of each reader received, and the lowest
+	// position of each reader in a payload that failed.
+	received checkpointMark
+	failed   checkpointMark
+
+	// For an Acknowledger at the end of the Pipeline: the marks of the
+	// payloads received but not acknowledged yet, and the number of
+	// payloads acknowledged, whose marks are merged into ackedMark.
+	ack       Acknowledger
+	marks     []checkpointMark
+	acked     int
+	ackedMark checkpointMark
+}
+
+// restingState is the state of a reader after it had sent a number of
+// payloads, taken while it was at rest.
+type restingState struct {
+	sent  int
+	state []byte
+}
+
+// restingCheckpoint is sent by a reader's DataProcessor on its own
+// outputChan, with the state of the reader at rest, so that it is lined up
+// with the payloads sent before it. See sendRestingCheckpoint.
+type restingCheckpoint struct {
+	etldata.Payload
+	state []byte
+}
+
+// setupCheckpoints gives every DataProcessor a new checkpointTracker, or
+// none if the Pipeline has no CheckpointStore.
+func (p *Pipeline) setupCheckpoints() {
+	for n, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			if p.CheckpointStore == nil {
+				dp.checkpoint = nil
+				continue
+			}
+			t := &checkpointTracker{}
+			if n == 0 && dp.outputs != nil && checkpointerOf(dp.Processor) != nil {
+				t.reader = true
+				t.states = []restingState{{}}
+			}
+			if dp.outputs == nil {
+				t.ack = acknowledgerOf(dp.Processor)
+			}
+			dp.checkpoint = t
+		}
+	}
+}
+
+func (t *checkpointTracker) isReader() bool {
+	return t != nil && t.reader
+}
+
+// restored sets up a reader to resume from the state it was restored to.
+func (t *checkpointTracker) restored(saved savedState) {
+	if !t.isReader() {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.states = []restingState{{state: saved.State}}
+	t.skip = saved.Skip
+}
+
+// readerOutput counts a payload sent by a reader, and returns it with its
+// mark, or nil if it is to be dropped, since it went through the Pipeline
+// before the checkpoint.
+func (dp *DataProcessor) readerOutput(d etldata.Payload) etldata.Payload {
+	t := dp.checkpoint
+	if !t.isReader() {
+		return d
+	}
+	t.mutex.Lock()
+	t.sent++
+	sent, skip := t.sent, t.skip
+	t.mutex.Unlock()
+	if sent <= skip {
+		return nil
+	}
+	return markOutput(checkpointMark{dp: sent}, d)
+}
+
+// sendRestingCheckpoint sends the state of a reader on its outputChan (see
+// restingCheckpoint). It must only be called while ProcessData and Finish
+// are not running.
+func (dp *DataProcessor) sendRestingCheckpoint() {
+	if !dp.checkpoint.isReader() {
+		return
+	}
+	state, err := checkpointerOf(dp.Processor).Checkpoint()
+	if err != nil {
+		logger.Error("DataProcessor:", dp, "checkpoint failed:", err)
+		return
+	}
+	dp.outputChan <- &restingCheckpoint{state: state}
+}
+
+// rest records the state of a reader sent by sendRestingCheckpoint.
+func (t *checkpointTracker) rest(state []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.states = append(t.states, restingState{sent: t.sent, state: state})
+}
+
+// savedAt returns what is saved for a reader at the given position: the
+// last state taken at or before it, and the number of payloads to drop
+// after restoring it.
+func (t *checkpointTracker) savedAt(position int) savedState {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if position < t.skip {
+		position = t.skip
+	}
+	rs := t.states[0]
+	for _, s := range t.states[1:] {
+		if s.sent <= position {
+			rs = s
+		}
+	}
+	return savedState{State: rs.state, Skip: position - rs.sent}
+}
+
+// receive records the mark of a payload received by the DataProcessor.
+func (t *checkpointTracker) receive(mark checkpointMark) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.received = t.received.merge(mark)
+	if t.ack != nil {
+		t.acknowledge()
+		t.marks = append(t.marks, mark)
+	}
+}
+
+// finishMark returns the mark for the payloads sent by Finish, which may
+// come from any of the payloads received.
+func (t *checkpointTracker) finishMark() checkpointMark {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.received
+}
+
+// acknowledge merges the marks of the payloads acknowledged since the last
+// call into ackedMark. The mutex must be held.
+func (t *checkpointTracker) acknowledge() {
+	n := t.ack.Acknowledged() - t.acked
+	if n <= 0 {
+		return
+	}
+	if n > len(t.marks) {
+		n = len(t.marks)
+	}
+	for _, m := range t.marks[:n] {
+		t.ackedMark = t.ackedMark.merge(m)
+	}
+	t.marks = t.marks[n:]
+	t.acked += n
+}
+
+// killChanFor returns the killChan for processing a payload with the given
+// mark, which records the mark as failed when an error is sent, and a func
+// to call once processing has returned.
+func (t *checkpointTracker) killChanFor(killChan chan error, mark checkpointMark) (chan error, func()) {
+	if t == nil || mark == nil {
+		return killChan, func() {}
+	}
+	kc := make(chan error)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case err := <-kc:
+				t.mutex.Lock()
+				t.failed = t.failed.lowest(mark)
+				t.mutex.Unlock()
+				killChan <- err
+			case <-done:
+				return
+			}
+		}
+	}()
+	return kc, func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// readerPosition returns the number of payloads sent by a reader that have
+// gone all the way through the Pipeline: the lowest position acknowledged
+// by the Processors at the end of the Pipeline its data reaches, and below
+// any payload that failed on the way.
+func (p *Pipeline) readerPosition(reader *DataProcessor) int {
+	reader.checkpoint.mutex.Lock()
+	position := reader.checkpoint.sent
+	reader.checkpoint.mutex.Unlock()
+
+	paths := make(map[*DataProcessor]int)
+	p.countPaths(reader, paths)
+	for dp, n := range paths {
+		t := dp.checkpoint
+		t.mutex.Lock()
+		if failed, ok := t.failed[reader]; ok && failed-1 < position {
+			position = failed - 1
+		}
+		acked := position
+		if dp.outputs == nil && !dp.finishedOK() {
+			acked = 0
+			if t.ack != nil && n == 1 {
+				t.acknowledge()
+				acked = t.ackedMark[reader]
+			}
+		}
+		t.mutex.Unlock()
+		if acked < position {
+			position = acked
+		}
+	}
+	return position
+}
+
+// countPaths counts the paths from dp to every DataProcessor after it.
+func (p *Pipeline) countPaths(dp *DataProcessor, paths map[*DataProcessor]int) {
+	for _, out := range p.dataProcessorOutputs(dp) {
+		paths[out]++
+		p.countPaths(out, paths)
+	}
+}
@@ -0,0 +1,324 @@
+package goetl_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+)
+
+// checkpointSource sends the numbers 0 to 4, skipping those it has sent
+// before being restored, and fails instead of sending failAt (if set), once
+// beforeFail (if set) is closed.
+type checkpointSource struct {
+	failAt     int
+	beforeFail chan struct{}
+	mu         sync.Mutex
+	sent       []int
+}
+
+func (s *checkpointSource) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	for i := 0; i < 5; i++ {
+		s.mu.Lock()
+		done := false
+		for _, n := range s.sent {
+			done = done || n == i
+		}
+		s.mu.Unlock()
+		if done {
+			continue
+		}
+		if s.failAt > 0 && i == s.failAt {
+			if s.beforeFail != nil {
+				<-s.beforeFail
+			}
+			killChan <- errors.New("read failed")
+			return
+		}
+		outputChan <- etldata.JSON(fmt.Sprint(i))
+		s.mu.Lock()
+		s.sent = append(s.sent, i)
+		s.mu.Unlock()
+	}
+}
+
+func (s *checkpointSource) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (s *checkpointSource) String() string {
+	return "checkpointSource"
+}
+
+func (s *checkpointSource) Checkpoint() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Marshal(s.sent)
+}
+
+func (s *checkpointSource) Restore(state []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Unmarshal(state, &s.sent)
+}
+
+// ackSink acknowledges each payload it receives, and fails instead on the
+// failAt'th one (if set). It closes acked (if set) once it has acknowledged
+// ackedAt payloads.
+type ackSink struct {
+	testSink
+	failAt  int
+	ackedAt int
+	acked   chan struct{}
+	mu      sync.Mutex
+	calls   int
+	written int
+}
+
+func (s *ackSink) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.calls == s.failAt {
+		killChan <- errors.New("write failed")
+		return
+	}
+	s.testSink.ProcessData(d, outputChan, killChan)
+	s.written++
+	if s.written == s.ackedAt && s.acked != nil {
+		close(s.acked)
+	}
+}
+
+func (s *ackSink) Acknowledged() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.written
+}
+
+// memoryCheckpointStore keeps checkpoints in memory.
+type memoryCheckpointStore struct {
+	checkpoints map[string]map[string][]byte
+}
+
+func (s *memoryCheckpointStore) Load(name string) (map[string][]byte, error) {
+	return s.checkpoints[name], nil
+}
+
+func (s *memoryCheckpointStore) Save(name string, checkpoint map[string][]byte) error {
+	if s.checkpoints == nil {
+		s.checkpoints = make(map[string]map[string][]byte)
+	}
+	s.checkpoints[name] = checkpoint
+	return nil
+}
+
+func (s *memoryCheckpointStore) Clear(name string) error {
+	delete(s.checkpoints, name)
+	return nil
+}
+
+// finishSignal closes done once its Finish has been called.
+type finishSignal struct {
+	testSink
+	done chan struct{}
+}
+
+func (s *finishSignal) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	s.testSink.Finish(outputChan, killChan)
+	close(s.done)
+}
+
+// failAfter fails once done is closed.
+type failAfter struct {
+	done chan struct{}
+}
+
+func (f *failAfter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	<-f.done
+	killChan <- errors.New("failed elsewhere")
+}
+
+func (f *failAfter) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+const checkpointSourceKey = "1.1-*goetl_test.checkpointSource"
+
+func TestCheckpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		// layout returns the stages of the first run, which reads with
+		// source.
+		layout func(source *checkpointSource) []*goetl.PipelineStage
+		// wantSaved is the checkpoint saved for the source, if any.
+		wantSaved string
+		// wantResumed is what a resumed run sends.
+		wantResumed []string
+	}{
+		{
+			name: "success",
+			layout: func(source *checkpointSource) []*goetl.PipelineStage {
+				sink := &ackSink{}
+				return []*goetl.PipelineStage{
+					goetl.NewPipelineStage(goetl.Do(source).Outputs(sink)),
+					goetl.NewPipelineStage(goetl.Do(sink)),
+				}
+			},
+			wantResumed: []string{"0", "1", "2", "3", "4"},
+		},
+		{
+			name: "writer failed after 2 payloads",
+			layout: func(source *checkpointSource) []*goetl.PipelineStage {
+				sink := &ackSink{failAt: 3}
+				return []*goetl.PipelineStage{
+					goetl.NewPipelineStage(goetl.Do(source).Outputs(sink)),
+					goetl.NewPipelineStage(goetl.Do(sink)),
+				}
+			},
+			wantSaved:   `{"skip":2}`,
+			wantResumed: []string{"2", "3", "4"},
+		},
+		{
+			name: "reader failed after everything it sent was written",
+			layout: func(source *checkpointSource) []*goetl.PipelineStage {
+				sink := &ackSink{ackedAt: 3, acked: make(chan struct{})}
+				source.failAt, source.beforeFail = 3, sink.acked
+				return []*goetl.PipelineStage{
+					goetl.NewPipelineStage(goetl.Do(source).Outputs(sink)),
+					goetl.NewPipelineStage(goetl.Do(sink)),
+				}
+			},
+			wantSaved:   `{"state":"WzAsMSwyXQ=="}`, // [0,1,2]
+			wantResumed: []string{"3", "4"},
+		},
+		{
+			name: "transformer failed before a writer that does not acknowledge",
+			layout: func(source *checkpointSource) []*goetl.PipelineStage {
+				transformer := &testFailer{failAt: 4}
+				sink := &testSink{}
+				return []*goetl.PipelineStage{
+					goetl.NewPipelineStage(goetl.Do(source).Outputs(transformer)),
+					goetl.NewPipelineStage(goetl.Do(transformer).Outputs(sink)),
+					goetl.NewPipelineStage(goetl.Do(sink)),
+				}
+			},
+			wantSaved:   `{}`,
+			wantResumed: []string{"0", "1", "2", "3", "4"},
+		},
+		{
+			name: "writer failed after 1 payload, along two paths",
+			layout: func(source *checkpointSource) []*goetl.PipelineStage {
+				a, b := &testFailer{}, &testFailer{}
+				sink := &ackSink{failAt: 2}
+				return []*goetl.PipelineStage{
+					goetl.NewPipelineStage(goetl.Do(source).Outputs(a, b)),
+					goetl.NewPipelineStage(goetl.Do(a).Outputs(sink), goetl.Do(b).Outputs(sink)),
+					goetl.NewPipelineStage(goetl.Do(sink)),
+				}
+			},
+			wantSaved:   `{}`,
+			wantResumed: []string{"0", "1", "2", "3", "4"},
+		},
+		{
+			name: "another branch failed",
+			layout: func(source *checkpointSource) []*goetl.PipelineStage {
+				sink := &finishSignal{done: make(chan struct{})}
+				other := &failAfter{done: sink.done}
+				otherSink := &testSink{}
+				return []*goetl.PipelineStage{
+					goetl.NewPipelineStage(goetl.Do(source).Outputs(sink), goetl.Do(other).Outputs(otherSink)),
+					goetl.NewPipelineStage(goetl.Do(sink), goetl.Do(otherSink)),
+				}
+			},
+			wantSaved: `{"state":"WzAsMSwyLDMsNF0="}`, // [0,1,2,3,4]
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryCheckpointStore{}
+			layout, err := goetl.NewPipelineLayout(tt.layout(&checkpointSource{})...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := goetl.NewBranchingPipeline(layout)
+			p.Name = "orders"
+			p.CheckpointStore = store
+			r := p.Execute()
+
+			checkpoint, saved := store.checkpoints[p.Name]
+			if saved != (tt.wantSaved != "") {
+				t.Fatalf("checkpoint saved = %v, want %v (run error %v)", saved, tt.wantSaved != "", r.Err)
+			}
+			if got := string(checkpoint[checkpointSourceKey]); got != tt.wantSaved {
+				t.Fatalf("source checkpoint = %s, want %s", got, tt.wantSaved)
+			}
+
+			// Resuming sends whatever was not written.
+			sink := &testSink{}
+			p = goetl.NewPipeline(&checkpointSource{}, sink)
+			p.Name = "orders"
+			p.CheckpointStore = store
+			if r := p.Execute(); r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			if !reflect.DeepEqual(sink.got, tt.wantResumed) {
+				t.Errorf("resumed run sent %v, want %v", sink.got, tt.wantResumed)
+			}
+			if _, ok := store.checkpoints[p.Name]; ok {
+				t.Error("checkpoint not cleared after a successful run")
+			}
+		})
+	}
+
+	p := goetl.NewPipeline(&checkpointSource{}, &testSink{})
+	p.CheckpointStore = &memoryCheckpointStore{}
+	if r := p.Execute(); r.Err == nil {
+		t.Error("no error running a Pipeline with a CheckpointStore and no Name")
+	}
+}
+
+func TestFileCheckpointStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goetl-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := goetl.NewFileCheckpointStore(dir)
+	if c, err := store.Load("p"); err != nil || c != nil {
+		t.Fatalf("Load before Save = %v, %v", c, err)
+	}
+	want := map[string][]byte{"1.1-x": []byte(`["a"]`)}
+	if err := store.Save("p", want); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Load("p"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Load = %q, %v, want %q", got, err, want)
+	}
+	if err := store.Clear("p"); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := store.Load("p"); err != nil || c != nil {
+		t.Fatalf("Load after Clear = %v, %v", c, err)
+	}
+
+	// Names are kept within the directory, and apart.
+	for _, name := range []string{"../p", "a/p", "a_p"} {
+		if err := store.Save(name, map[string][]byte{"name": []byte(name)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"../p", "a/p", "a_p"} {
+		if got, err := store.Load(name); err != nil || string(got["name"]) != name {
+			t.Errorf("Load(%q) = %q, %v", name, got, err)
+		}
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 3 {
+		t.Errorf("%d files saved, want 3", len(files))
+	}
+}
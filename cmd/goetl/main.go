@@ -0,0 +1,248 @@
+// Command goetl runs a pipeline defined in a YAML or JSON config file (see
+// goetl.PipelineConfig).
+//
+// Usage:
+//
+//	goetl [flags] <config file>
+//
+// The flags are:
+//
+//	-graph
+//	        print the resolved stages of the pipeline and exit
+//	-validate
+//	        check the config and the pipeline layout without running it
+//	-dry-run
+//	        run the pipeline with its writers replaced by a LogWriter (the
+//	        writers are never built, so their configs are not checked)
+//	-stats text|json|none
+//	        how to print the pipeline stats once it has run (default text)
+//	-timeout duration
+//	        cancel the pipeline if it runs for longer than this
+//	-log-level debug|info|error|status|silent
+//	        (default info)
+//	-metrics-addr address
+//	        serve Prometheus metrics on http://address/metrics while running
+//	-trace-file filename
+//	        append a span for every ProcessData call to filename, as OTLP/JSON
+//
+// The exit code is 0 when the pipeline succeeds, 1 when it fails, and 2
+// when the config is invalid. Logs are written to stderr, so that stdout
+// only holds the graph or stats.
+//
+// The built-in processors are available, along with the MySQL ("mysql") and
+// PostgreSQL ("postgres") database/sql drivers.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/logger"
+	_ "github.com/teambenny/goetl/processors"
+)
+
+const (
+	exitOK      = 0
+	exitFailed  = 1
+	exitInvalid = 2
+)
+
+var logLevels = map[string]int{
+	"debug":  logger.LevelDebug,
+	"info":   logger.LevelInfo,
+	"error":  logger.LevelError,
+	"status": logger.LevelStatus,
+	"silent": logger.LevelSilent,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("goetl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: goetl [flags] <config file>")
+		flags.PrintDefaults()
+	}
+	graph := flags.Bool("graph", false, "print the resolved stages of the pipeline and exit")
+	validate := flags.Bool("validate", false, "check the config and the pipeline layout without running it")
+	dryRun := flags.Bool("dry-run", false, "run the pipeline with its writers replaced by a LogWriter")
+	stats := flags.String("stats", "text", "how to print the pipeline stats: text, json or none")
+	timeout := flags.Duration("timeout", 0, "cancel the pipeline if it runs for longer than this")
+	logLevel := flags.String("log-level", "info", "debug, info, error, status or silent")
+	metricsAddr := flags.String("metrics-addr", "", "serve Prometheus metrics on http://address/metrics while running")
+	traceFile := flags.String("trace-file", "", "append a span for every ProcessData call to this file, as OTLP/JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitInvalid
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitInvalid
+	}
+	level, ok := logLevels[*logLevel]
+	if !ok {
+		fmt.Fprintf(stderr, "goetl: unknown log level %q\n", *logLevel)
+		return exitInvalid
+	}
+	if *stats != "text" && *stats != "json" && *stats != "none" {
+		fmt.Fprintf(stderr, "goetl: unknown stats format %q\n", *stats)
+		return exitInvalid
+	}
+	logger.LogLevel = level
+	logger.SetOutput(stderr)
+
+	config, err := loadConfig(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, "goetl:", err)
+		return exitInvalid
+	}
+	if *dryRun {
+		config = dryRunConfig(config)
+	}
+	// Building the layout checks every processor's config, and the layout
+	// itself against the NewPipelineLayout rules. The processors are only
+	// built once, so the same layout is then run.
+	layout, err := config.Layout()
+	if err != nil {
+		fmt.Fprintln(stderr, "goetl:", err)
+		return exitInvalid
+	}
+	if *graph {
+		fmt.Fprintln(stdout, layout)
+		return exitOK
+	}
+	if *validate {
+		fmt.Fprintf(stdout, "%s: config is valid\n", config.Name)
+		return exitOK
+	}
+
+	pipeline := config.NewPipeline(layout)
+
+	if *metricsAddr != "" {
+		sink := goetl.NewPrometheusSink()
+		pipeline.Metrics = sink
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", sink)
+		go func() {
+			if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+				logger.Error("goetl: metrics server:", err)
+			}
+		}()
+	}
+
+	if *traceFile != "" {
+		exporter, err := goetl.NewOTLPFileExporter(*traceFile)
+		if err != nil {
+			fmt.Fprintln(stderr, "goetl:", err)
+			return exitInvalid
+		}
+		defer exporter.Close()
+		pipeline.Tracing = exporter
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	cancelOnInterrupt(cancel)
+	pipeline.RunContext(ctx)
+	result := pipeline.Wait()
+
+	switch *stats {
+	case "text":
+		fmt.Fprint(stdout, pipeline.Stats())
+	case "json":
+		if err := writeJSONStats(stdout, pipeline, result); err != nil {
+			fmt.Fprintln(stderr, "goetl:", err)
+		}
+	}
+	if !result.Success() {
+		fmt.Fprintf(stderr, "goetl: %s failed: %v\n", pipeline.Name, result.Err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// cancelOnInterrupt cancels the pipeline when the process is interrupted,
+// so that it stops cleanly and still prints its stats.
+func cancelOnInterrupt(cancel context.CancelFunc) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		signal.Stop(c)
+		cancel()
+	}()
+}
+
+func loadConfig(filename string) (*goetl.PipelineConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config, err := goetl.ParsePipelineConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if config.Name == "" {
+		config.Name = filename
+	}
+	return config, nil
+}
+
+// dryRunConfig returns a copy of config with every writer (that is, every
+// processor without outputs) replaced by a LogWriter.
+func dryRunConfig(config *goetl.PipelineConfig) *goetl.PipelineConfig {
+	dry := *config
+	dry.Processors = make([]*goetl.ProcessorConfig, len(config.Processors))
+	for i, pc := range config.Processors {
+		if len(pc.Outputs) > 0 {
+			dry.Processors[i] = pc
+			continue
+		}
+		prefix, _ := json.Marshal(map[string]string{"prefix": pc.Name + ":"})
+		dry.Processors[i] = &goetl.ProcessorConfig{Name: pc.Name, Type: "LogWriter", Config: prefix}
+	}
+	return &dry
+}
+
+type jsonStats struct {
+	*goetl.StatsSnapshot
+	Success bool     `json:"success"`
+	Error   string   `json:"error,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+func writeJSONStats(w io.Writer, pipeline *goetl.Pipeline, result *goetl.PipelineResult) error {
+	if result == nil {
+		return errors.New("no pipeline result")
+	}
+	s := jsonStats{
+		StatsSnapshot: pipeline.StatsSnapshot(),
+		Success:       result.Success(),
+	}
+	if result.Err != nil {
+		s.Error = result.Err.Error()
+	}
+	for _, err := range result.Errors {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teambenny/goetl/logger"
+)
+
+func TestRun(t *testing.T) {
+	defer func() {
+		logger.LogLevel = logger.LevelInfo
+		logger.SetOutput(os.Stderr)
+	}()
+	dir, err := ioutil.TempDir("", "goetl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "in.json")
+	orders := "{\"id\":1,\"status\":\"shipped\"}\n{\"id\":2,\"status\":\"new\"}\n{\"id\":3,\"status\":\"shipped\"}\n"
+	if err := ioutil.WriteFile(in, []byte(orders), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig := func(name, input, writer string) string {
+		path := filepath.Join(dir, name+".yaml")
+		config := `
+name: orders
+processors:
+  - name: read
+    type: IoReader
+    config: {path: ` + input + `}
+    outputs: [filter]
+  - name: filter
+    type: RegexpMatcher
+    config: {pattern: shipped}
+    outputs: [write]
+  - name: write
+` + writer
+		if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	out := filepath.Join(dir, "out.json")
+	valid := writeConfig("valid", in, "    type: IoWriter\n    config: {path: "+out+", add_newline: true}\n")
+	// The writer's config is missing its dsn, which only a dry run ignores.
+	database := writeConfig("database", in, "    type: PostgreSQLWriter\n    config: {table: orders}\n")
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout []string
+		wantStderr []string
+		wantOut    string // the contents of out, if it is written
+	}{
+		{
+			name:       "print graph",
+			args:       []string{"-graph", valid},
+			wantStdout: []string{"stage 1: read -> filter\nstage 2: filter -> write\nstage 3: write\n"},
+		},
+		{
+			name:       "validate",
+			args:       []string{"-validate", valid},
+			wantStdout: []string{"orders: config is valid\n"},
+		},
+		{
+			name:       "validate an invalid writer",
+			args:       []string{"-validate", database},
+			wantCode:   exitInvalid,
+			wantStderr: []string{`goetl: pipeline config: processor "write" (PostgreSQLWriter): driver and dsn are required`},
+		},
+		{
+			name:       "dry run",
+			args:       []string{"-dry-run", "-stats", "none", database},
+			wantStderr: []string{`write: {"id":1,"status":"shipped"}`, `write: {"id":3,"status":"shipped"}`, "write: received 2 payloads"},
+		},
+		{
+			name:       "dry run does not write",
+			args:       []string{"-dry-run", "-stats", "none", valid},
+			wantStderr: []string{"write: received 2 payloads"},
+		},
+		{
+			name:       "run",
+			args:       []string{"-log-level", "silent", "-stats", "json", valid},
+			wantStdout: []string{`"pipeline": "orders"`, `"processor": "write"`, `"success": true`},
+			wantOut:    "{\"id\":1,\"status\":\"shipped\"}\n{\"id\":3,\"status\":\"shipped\"}\n",
+		},
+		{
+			name:       "failed run",
+			args:       []string{"-log-level", "silent", "-stats", "none", writeConfig("missing", filepath.Join(dir, "missing.json"), "    type: LogWriter\n")},
+			wantCode:   exitFailed,
+			wantStderr: []string{"goetl: orders failed:"},
+		},
+		{
+			name:       "unknown flag value",
+			args:       []string{"-stats", "xml", valid},
+			wantCode:   exitInvalid,
+			wantStderr: []string{`goetl: unknown stats format "xml"`},
+		},
+		{
+			name:       "no config",
+			args:       []string{"-graph"},
+			wantCode:   exitInvalid,
+			wantStderr: []string{"usage: goetl [flags] <config file>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(out)
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.wantCode {
+				t.Fatalf("exit code %d, want %d; stderr:\n%s", code, tt.wantCode, stderr.String())
+			}
+			for _, want := range tt.wantStdout {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout does not contain %q:\n%s", want, stdout.String())
+				}
+			}
+			for _, want := range tt.wantStderr {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr does not contain %q:\n%s", want, stderr.String())
+				}
+			}
+			got, err := ioutil.ReadFile(out)
+			if tt.wantOut == "" {
+				if err == nil {
+					t.Errorf("%v was written", out)
+				}
+			} else if string(got) != tt.wantOut {
+				t.Errorf("%v = %q, want %q", out, got, tt.wantOut)
+			}
+		})
+	}
+}
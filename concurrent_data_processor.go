@@ -2,6 +2,7 @@ package goetl
 
 import (
 	"container/list"
+	"context"
 	"sync"
 
 	"github.com/teambenny/goetl/etldata"
@@ -21,10 +22,15 @@ type ConcurrentProcessor interface {
 	Concurrency() int
 }
 
-// IsConcurrent returns true if the given Processor implements ConcurrentProcessor
-func isConcurrent(p Processor) bool {
-	_, ok := interface{}(p).(ConcurrentProcessor)
-	return ok
+// concurrentProcessorOf returns the given Processor, or the one it wraps, if
+// it implements ConcurrentProcessor, or nil.
+func concurrentProcessorOf(p Processor) ConcurrentProcessor {
+	for _, p := range unwrapProcessor(p) {
+		if cp, ok := p.(ConcurrentProcessor); ok {
+			return cp
+		}
+	}
+	return nil
 }
 
 // DataProcessor embeds concurrentProcessor
@@ -46,22 +52,38 @@ type result struct {
 	open       bool
 }
 
-func (dp *DataProcessor) processData(d etldata.Payload, killChan chan error) chan bool {
+func (dp *DataProcessor) processData(ctx context.Context, d etldata.Payload, killChan chan error) chan bool {
 	logger.Debug("DataProcessor: processData", dp, "with concurrency =", dp.concurrency)
 	exit := make(chan bool, 1)
 	// If no concurrency is needed, simply call stage.ProcessData and return...
 	if dp.concurrency <= 1 {
+		span := dp.startSpan(d)
+		mark, md := markOf(d), metadataOf(d)
+		d = dp.payloadFor(d)
+		outputChan, wait := dp.outputChanFor(span, md, mark)
+		killChan, stop := dp.checkpoint.killChanFor(killChan, mark)
 		dp.recordExecution(func() {
-			dp.ProcessData(d, dp.outputChan, killChan)
-			exit <- true
+			dp.callProcessDataWithPolicy(ctx, d, outputChan, killChan)
 		})
+		wait()
+		stop()
+		dp.endSpan(span)
+		exit <- true
 		return exit
 	}
 	// ... otherwise process the data in a concurrent queue/pool of goroutines
 	logger.Debug("DataProcessor: processData", dp, "waiting for work")
-	// wait for room in the queue
-	dp.workThrottle <- workSignal{}
+	// wait for room in the queue, unless the pipeline is being cancelled
+	select {
+	case dp.workThrottle <- workSignal{}:
+	case <-ctx.Done():
+		exit <- true
+		return exit
+	}
 	logger.Debug("DataProcessor: processData", dp, "work obtained")
+	span := dp.startSpan(d)
+	mark, md := markOf(d), metadataOf(d)
+	d = dp.payloadFor(d)
 	rc := make(chan etldata.Payload)
 	done := make(chan bool)
 	// setup goroutine to handle result
@@ -75,11 +97,18 @@ func (dp *DataProcessor) processData(d etldata.Payload, killChan chan error) cha
 			select {
 			case d, open := <-rc:
 				logger.Debug("DataProcessor: processData", dp, "received data on result chan")
+				if open {
+					d = tagOutput(span, md, mark, d)
+				}
+				dp.Lock()
 				res.data = append(res.data, d)
 				// outputChan will need to be closed if the rc chan was closed
 				res.open = open
+				dp.Unlock()
 			case <-done:
+				dp.Lock()
 				res.done = true
+				dp.Unlock()
 				logger.Debug("DataProcessor: processData", dp, "done, releasing work")
 				<-dp.workThrottle
 				dp.sendResults()
@@ -91,7 +120,10 @@ func (dp *DataProcessor) processData(d etldata.Payload, killChan chan error) cha
 	// do normal data processing, passing in new result chan
 	// instead of the original outputChan
 	go dp.recordExecution(func() {
-		dp.ProcessData(d, rc, killChan)
+		killChan, stop := dp.checkpoint.killChanFor(killChan, mark)
+		dp.callProcessDataWithPolicy(ctx, d, rc, killChan)
+		stop()
+		dp.endSpan(span)
 		done <- true
 	})
 
@@ -99,6 +131,87 @@ func (dp *DataProcessor) processData(d etldata.Payload, killChan chan error) cha
 	return exit
 }
 
+// outputForwarder tags the payloads sent by the ProcessData calls of a
+// DataProcessor without concurrency (and by Finish), and passes them on to
+// its outputChan. A single goroutine does this for all of the calls,
+// tagging with the Span, Metadata and checkpoint mark of the call in
+// progress.
+type outputForwarder struct {
+	forwardChan chan etldata.Payload
+	forwarded   chan bool
+	forwardSpan *Span
+	forwardMd   etldata.Metadata
+	forwardMark checkpointMark
+}
+
+// outputChanFor returns the channel for a single ProcessData call to send
+// on, which tags everything sent on it (see tagOutput) and passes it on to
+// the outputChan, and a func to call once ProcessData has returned. The
+// outputChan itself is returned when there is nothing to tag.
+func (dp *DataProcessor) outputChanFor(span *Span, md etldata.Metadata, mark checkpointMark) (chan etldata.Payload, func()) {
+	if span == nil && md == nil && mark == nil {
+		return dp.outputChan, func() {}
+	}
+	if dp.forwardChan == nil {
+		dp.forwardChan = make(chan etldata.Payload)
+		dp.forwarded = make(chan bool)
+		go dp.forwardOutput()
+	}
+	// The forwarder only reads these while a call is sending, and the
+	// call below waits for it to be done with them.
+	dp.forwardSpan, dp.forwardMd, dp.forwardMark = span, md, mark
+	return dp.forwardChan, func() {
+		dp.forwardChan <- nil
+		<-dp.forwarded
+	}
+}
+
+// forwardOutput passes on the payloads sent on forwardChan until it is
+// closed. A nil payload marks the end of a call.
+func (dp *DataProcessor) forwardOutput() {
+	for d := range dp.forwardChan {
+		if d == nil {
+			dp.forwarded <- true
+			continue
+		}
+		dp.outputChan <- tagOutput(dp.forwardSpan, dp.forwardMd, dp.forwardMark, d)
+	}
+}
+
+// stopForwarding stops the forwarder, once every ProcessData call has
+// returned.
+func (dp *DataProcessor) stopForwarding() {
+	if dp.forwardChan != nil {
+		close(dp.forwardChan)
+		dp.forwardChan = nil
+	}
+}
+
+// callFinish calls Finish, tagging the payloads it sends with the mark of
+// everything the DataProcessor has received, since they may come from any
+// of it.
+func (dp *DataProcessor) callFinish() {
+	mark := dp.checkpoint.finishMark()
+	outputChan, wait := dp.outputChanFor(nil, nil, mark)
+	killChan, stop := dp.checkpoint.killChanFor(dp.killChan, mark)
+	dp.Finish(outputChan, killChan)
+	wait()
+	stop()
+}
+
+// tagOutput prepares a payload sent while processing another, which had
+// the given Span, Metadata and checkpoint mark. It inherits the Metadata
+// unless it carries its own, continues the trace, and keeps the mark.
+func tagOutput(span *Span, md etldata.Metadata, mark checkpointMark, d etldata.Payload) etldata.Payload {
+	d = markOutput(mark, traceOutput(span, d))
+	if md != nil && metadataOf(d) == nil {
+		e := rewrap(d)
+		e.metadata = md
+		d = e
+	}
+	return d
+}
+
 // sendResults handles sending work that is completed, as well as
 // guaranteeing a FIFO order of the resulting data sent over the
 // original outputChan.
@@ -118,9 +231,10 @@ func (dp *DataProcessor) sendResults() {
 		}
 		e = dp.workList.Front()
 	}
+	finished := dp.inputClosed && dp.workList.Len() == 0
 	dp.Unlock()
 
-	if dp.inputClosed && dp.workList.Len() == 0 {
+	if finished {
 		dp.doneChan <- true
 	}
 }
@@ -0,0 +1,37 @@
+package goetl
+
+import (
+	"context"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+// ContextProcessor is a Processor that also accepts the context.Context
+// the Pipeline was started with (see Pipeline.RunContext). When a Processor
+// implements ContextProcessor, ProcessDataContext is called instead of
+// ProcessData, so that long-running or blocking work (SQL queries, HTTP
+// requests, remote file reads, etc.) can be stopped part-way through once
+// the context is done.
+//
+// A ContextProcessor should simply return when it notices the context is
+// done; the Pipeline takes care of reporting the context's error.
+type ContextProcessor interface {
+	Processor
+	ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error)
+}
+
+// isContextAware returns true if the given Processor implements ContextProcessor
+func isContextAware(p Processor) bool {
+	_, ok := interface{}(p).(ContextProcessor)
+	return ok
+}
+
+// callProcessData calls ProcessDataContext for a ContextProcessor, or
+// falls back to the regular ProcessData.
+func (dp *DataProcessor) callProcessData(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	if isContextAware(dp.Processor) {
+		dp.Processor.(ContextProcessor).ProcessDataContext(ctx, d, outputChan, killChan)
+		return
+	}
+	dp.ProcessData(d, outputChan, killChan)
+}
@@ -2,8 +2,10 @@ package goetl
 
 import (
 	"container/list"
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/teambenny/goetl/etldata"
 )
@@ -11,6 +13,14 @@ import (
 // Processor is the interface that should be implemented to perform data-related
 // tasks within a Pipeline. Processors are responsible for receiving, processing,
 // and then sending data on to the next stage of processing.
+//
+// A Processor that wraps another can have an Unwrap() Processor method
+// returning the one it wraps, so that the Pipeline also finds the optional
+// interfaces of the wrapped Processor: AbortableProcessor, Checkpointer,
+// Acknowledger, ConcurrentProcessor and RoutingProcessor. The wrapper's own
+// methods are used first. ContextProcessor is the exception, since the
+// wrapper's ProcessData would be bypassed, so a wrapper must implement
+// ProcessDataContext itself to pass the context on.
 type Processor interface {
 	// ProcessData will be called for each data sent from the previous stage.
 	// ProcessData is called with a etldata.Payload instance, which is the data being received,
@@ -19,12 +29,29 @@ type Processor interface {
 	ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error)
 
 	// Finish will be called after the previous stage has finished sending data,
-	// and no more data will be received by this Processor. Often times
+	// and no more data will be received by this Processor. It is called
+	// exactly once, after the last call to ProcessData has returned, and
+	// this includes the Processors of the first stage, which earlier versions
+	// also called while they were handling the start signal. Often times
 	// Finish can be an empty function implementation, but sometimes it is
 	// necessary to perform final data processing.
 	Finish(outputChan chan etldata.Payload, killChan chan error)
 }
 
+// unwrapProcessor returns p and the Processors it wraps (see Processor),
+// outermost first.
+func unwrapProcessor(p Processor) []Processor {
+	chain := []Processor{p}
+	for {
+		w, ok := p.(interface{ Unwrap() Processor })
+		if !ok || w.Unwrap() == nil {
+			return chain
+		}
+		p = w.Unwrap()
+		chain = append(chain, p)
+	}
+}
+
 // DataProcessor is a type used internally to the Pipeline management
 // code, and wraps a Processor instance. Processor is the main
 // interface that should be implemented to perform work within the data
@@ -33,27 +60,77 @@ type Processor interface {
 type DataProcessor struct {
 	Processor
 	executionStat
+	finishState
 	concurrentProcessor
+	outputForwarder
 	chanBrancher
 	chanMerger
-	outputs    []Processor
-	inputChan  chan etldata.Payload
-	outputChan chan etldata.Payload
+	outputs     []Processor
+	inputChan   chan etldata.Payload
+	outputChan  chan etldata.Payload
+	killChan    chan error
+	errorPolicy *ErrorPolicy
+	router      func(d etldata.Payload) []Processor
+	name        string
+	stage       int
+	tracer      *tracer
+	checkpoint  *checkpointTracker
+
+	// readsMetadata is set for a MetadataProcessor, see setupMetadata.
+	readsMetadata bool
 }
 
 type chanBrancher struct {
 	branchOutChans []chan etldata.Payload
+	branchOutDest  []*DataProcessor
 }
 
-func (dp *DataProcessor) branchOut() {
+// branchOutTo returns the DataProcessor that reads from the given
+// branchOutChan.
+func (dp *DataProcessor) branchOutTo(c chan etldata.Payload) *DataProcessor {
+	for i := range dp.branchOutChans {
+		if dp.branchOutChans[i] == c {
+			return dp.branchOutDest[i]
+		}
+	}
+	return nil
+}
+
+func (dp *DataProcessor) branchOut(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		for d := range dp.outputChan {
-			for _, out := range dp.branchOutChans {
+			if r, ok := d.(*restingCheckpoint); ok {
+				dp.checkpoint.rest(r.state)
+				continue
+			}
+			// Everything a reader sends is counted, even once cancelled,
+			// so that its position lines up with its resting states.
+			if d = dp.readerOutput(d); d == nil {
+				continue
+			}
+			// Once the pipeline is cancelled, keep draining the output
+			// so the Processor never blocks on send, but drop the data.
+			if ctx.Err() != nil {
+				continue
+			}
+			d = dp.startTrace(carryMetadata(d))
+			records := recordCount(d)
+			for _, out := range dp.routeChans(dp.payloadFor(d)) {
 				// Make a copy to ensure concurrent stages
 				// can alter data as needed.
-				out <- d.Clone()
+				c := d.Clone()
+				st := time.Now()
+				select {
+				case out <- c:
+					dp.branchOutTo(out).recordRecordsReceived(records)
+				case <-ctx.Done():
+				}
+				dp.recordBlocked(time.Since(st))
 			}
-			dp.recordDataSent(d.Bytes())
+			dp.recordRecordsSent(records)
+			dp.recordDataSent(payloadSize(d))
 		}
 		// Once all data is received, also close all the outputs
 		for _, out := range dp.branchOutChans {
@@ -64,14 +141,26 @@ func (dp *DataProcessor) branchOut() {
 
 type chanMerger struct {
 	mergeInChans []chan etldata.Payload
+	mergeInFrom  []Processor
 	mergeWait    sync.WaitGroup
+	merger       Merger
 }
 
-func (dp *DataProcessor) mergeIn() {
+func (dp *DataProcessor) mergeIn(ctx context.Context, wg *sync.WaitGroup) {
+	if dp.merger != nil {
+		dp.mergeInWith(ctx, wg)
+		return
+	}
 	// Start a merge goroutine for each input channel.
 	mergeData := func(c chan etldata.Payload) {
 		for d := range c {
-			dp.inputChan <- d
+			if ctx.Err() != nil {
+				continue
+			}
+			select {
+			case dp.inputChan <- d:
+			case <-ctx.Done():
+			}
 		}
 		dp.mergeWait.Done()
 	}
@@ -80,9 +169,13 @@ func (dp *DataProcessor) mergeIn() {
 		go mergeData(in)
 	}
 
+	// The closing goroutine outlives all the merge goroutines,
+	// so it is the only one the pipeline needs to wait on.
+	wg.Add(1)
 	go func() {
 		dp.mergeWait.Wait()
 		close(dp.inputChan)
+		wg.Done()
 	}()
 }
 
@@ -98,8 +191,8 @@ func Do(processor Processor) *DataProcessor {
 	dp.outputChan = make(chan etldata.Payload)
 	dp.inputChan = make(chan etldata.Payload)
 
-	if isConcurrent(processor) {
-		dp.concurrency = processor.(ConcurrentProcessor).Concurrency()
+	if cp := concurrentProcessorOf(processor); cp != nil {
+		dp.concurrency = cp.Concurrency()
 		dp.workThrottle = make(chan workSignal, dp.concurrency)
 		dp.workList = list.New()
 		dp.doneChan = make(chan bool)
@@ -117,7 +210,18 @@ func (dp *DataProcessor) Outputs(processors ...Processor) *DataProcessor {
 	return dp
 }
 
-// pass through String output to the Processor
+// Named sets the name shown for the Processor in log output, errors and
+// Stats, in place of the Processor's own String. This helps tell apart
+// several Processors of the same type.
+func (dp *DataProcessor) Named(name string) *DataProcessor {
+	dp.name = name
+	return dp
+}
+
+// pass through String output to the Processor, unless it is Named
 func (dp *DataProcessor) String() string {
+	if dp.name != "" {
+		return dp.name
+	}
 	return fmt.Sprintf("%v", dp.Processor)
 }
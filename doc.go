@@ -75,6 +75,19 @@ The code to create and run this basic Pipeline would look something like:
         // Finally, run the Pipeline and wait for either an error or nil to be returned
         err := <-pipeline.Run()
 
+Run sends a single start signal to each Processor in the first stage. Every Processor,
+including those, has Finish called exactly once, after its last ProcessData call has
+returned. (Earlier versions also called Finish on the first stage's Processors straight
+after the start signal, while ProcessData could still be running.)
+
+To find out more than the first error, such as which Processor failed or the final
+stats of each stage, use Execute (or Run followed by Wait) to get a PipelineResult:
+
+        result := pipeline.Execute()
+        if !result.Success() {
+                log.Println("stage", result.Stage, result.Processor, "failed:", result.Err)
+        }
+
 Creating and Running a Branching Pipeline
 
 The second way to construct a Pipeline is using a PipelineLayout. This method allows
@@ -149,5 +162,320 @@ This example is only conceptual, the main points being to explain the flexibilit
 you have when designing your Pipeline's layout and to demonstrate the syntax for
 constructing a new PipelineLayout.
 
+Creating a Pipeline from a Graph
+
+Within a PipelineLayout, Outputs must point to a Processor in the very next stage, so
+a Processor that should skip a stage has to be wired through a Passthrough. A Graph
+removes that restriction by working out the stages itself:
+
+        pipeline, err := goetl.NewGraph().
+                Connect(query1, custom1).
+                Connect(custom1, writeCSV).
+                Connect(query1, writeMySQL).
+                Pipeline()
+
+The Graph sorts its Processors topologically, and returns an error if it contains a cycle.
+
+Routing Data
+
+By default, every Processor listed in Outputs receives a copy of each payload. To send
+payloads to only some of the Outputs, use Route (or implement RoutingProcessor):
+
+        goetl.Do(read).Outputs(writeOrders, writeRefunds).Route(func(d etldata.Payload) []goetl.Processor {
+                if isRefund(d) {
+                        return []goetl.Processor{writeRefunds}
+                }
+                return []goetl.Processor{writeOrders}
+        })
+
+Merging and Joining Inputs
+
+A Processor receiving data from several Processors gets payloads in whatever order they
+arrive. Use Merge to combine the inputs differently: NewRoundRobinMerger interleaves them,
+NewOrderedMerger keeps inputs that are each sorted by a key in order, and NewHashJoinMerger
+joins the objects of two inputs on a key, sending one merged object per matching pair:
+
+        goetl.NewGraph().
+                Add(goetl.Do(write).Merge(goetl.NewHashJoinMerger(readCustomers, "id", "customer_id"))).
+                Connect(readCustomers, write).
+                Connect(readOrders, write)
+
+Handling Errors
+
+By default, any error sent to a killChan halts the whole Pipeline. For dirty source data,
+an ErrorPolicy can be set on a DataProcessor to retry failing payloads, skip them, or
+send them to a dead-letter Processor instead:
+
+        deadLetters := processors.NewIoWriter(deadLetterFile)
+        deadLetters.AddNewline = true
+
+        goetl.Do(transform).Outputs(write).OnError(goetl.Retry(3, time.Second).ThenDeadLetter(deadLetters))
+
+The policy only applies to ProcessData calls that fail before sending any data, since
+data is passed on as it is sent: a call that fails part way through still halts the
+Pipeline. The number of retried, skipped and dead-lettered payloads are included in
+Pipeline.Stats.
+
+Cancelling a Pipeline
+
+Pipelines can also be bound to a context.Context by using RunContext instead of Run.
+When the context is cancelled (or its deadline passes), every stage stops processing,
+and the context's error is sent on the returned channel:
+
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+        defer cancel()
+        err := <-pipeline.RunContext(ctx)
+
+Processors that implement ContextProcessor receive the context in ProcessDataContext,
+which allows blocking work like SQL queries or HTTP requests to be aborted part-way through.
+
+Checkpoints
+
+Long-running Pipelines can be made resumable by setting a CheckpointStore. When a run
+fails, the state of every Processor implementing Checkpointer (such as the keys already
+read by an S3Reader, the last key read by a SQLReader with a KeyColumn, or the files
+already uploaded by a RedshiftWriter) is saved, and
+restored at the start of the next run. So that no data is lost, a reader's state is saved
+along with its position: how many of the payloads it sent were written by the Processors
+at the end of the Pipeline, as reported by those implementing Acknowledger (such as
+MySQLWriter). A resumed run drops the payloads the reader sends again up to that position,
+and writers such as RedshiftWriter skip the rows they had already staged. The checkpoint
+is cleared once a run succeeds:
+
+        pipeline.Name = "orders" // checkpoints are saved under the Pipeline's Name
+        pipeline.CheckpointStore = goetl.NewFileCheckpointStore("/var/lib/etl")
+        pipeline.CheckpointInterval = time.Minute // optional, also save periodically
+        err := <-pipeline.Run()
+
+Pipeline Configs
+
+Simple pipelines can also be defined in a YAML or JSON document instead of Go code. Each
+processor is given a name, a registered type, its config and the names of its outputs (see
+PipelineConfig). Importing the processors package registers the built-in processors, and
+custom ones can be added with RegisterProcessor:
+
+        config, err := goetl.ParsePipelineConfig(data)
+        if err != nil {
+                return err // e.g. pipeline config: processor "filter": output "write" is not defined
+        }
+        pipeline, err := config.Pipeline()
+
+Metrics
+
+A MetricsSink set on Pipeline.Metrics receives live metrics while the pipeline runs:
+payloads and bytes in and out, a processing time histogram for each processor, the
+depth of each channel between stages and how many workers are busy. PrometheusSink
+serves them for scraping:
+
+        sink := goetl.NewPrometheusSink()
+        http.Handle("/metrics", sink)
+        pipeline.Metrics = sink
+
+Pipeline.StatsSnapshot returns the stats for each stage and processor as a struct that
+can be marshalled to JSON, including latency percentiles, payload sizes, throughput in
+records per second and the time spent blocked on the next stage, so that the history of
+runs can be kept and compared:
+
+        result := pipeline.Execute()
+        history, _ := json.Marshal(pipeline.StatsSnapshot())
+
+Payload Metadata
+
+Payloads can carry etldata.Metadata alongside their data, such as the file, S3 key or
+SFTP path they were read from and when they were read (and their line number, if
+IoReader.LineNumbers is set). The built-in readers fill it in once per stream or batch,
+and it is kept when payloads are copied between branches. Payloads sent while processing
+a payload with Metadata inherit it, unless they carry their own, so it reaches the
+writers even through transformers that build new payloads:
+
+        table := etldata.MetadataOf(d)[etldata.MetadataTable]
+        outputChan <- etldata.WithMetadata(d, etldata.Metadata{etldata.MetadataTable: "archive"})
+
+Metadata is shared between payloads, so it must not be modified; use WithMetadata
+instead. The Pipeline carries Metadata beside the payloads, so a Processor receives each
+payload as it was sent, and type assertions such as d.(etldata.JSON) keep working. Only a
+MetadataProcessor receives the payloads with their Metadata attached.
+
+MySQLWriter and PostgreSQLWriter write to the table named by etldata.MetadataTable when it
+is set, and S3Writer can name its objects from any Metadata key (see S3Writer.KeyMetadata).
+
+Reading Large JSON Files
+
+IoReader reads line by line with a bufio.Scanner, which cannot read lines over 64KB, and
+FileReader reads whole files. processors.JSONStreamReader instead decodes a top-level JSON
+array, or a stream of objects such as NDJSON, one object at a time, and sends them on as
+JSON arrays of BatchSize objects, so multi-GB exports are read in constant memory:
+
+        reader := processors.NewJSONStreamReader(file)
+        reader.BatchSize = 500
+
+Reading CSV Files
+
+processors.CSVReader parses the CSV data sent by a reader such as IoReader, SftpReader or
+S3Reader into batches of JSON objects keyed by the header row. The data from each source
+is joined back together, so quoted fields can span lines. Its Parser sets the delimiter,
+quote character and escape (use `\` to read what CSVWriter writes by default), and
+InferTypes converts numbers, booleans and SQL times:
+
+        csv := processors.NewCSVReader()
+        csv.Parser.Comma = ';'
+        csv.InferTypes = true
+        pipeline := goetl.NewPipeline(processors.NewSftpReader(server, user, path, auth), csv, writer)
+
+Parquet Files
+
+processors.ParquetWriter writes the records it receives to any io.Writer as a Parquet file,
+in row groups of RowGroupSize records compressed with snappy (or gzip, or not at all). The
+columns come from its Schema, or are inferred from the first row group. To write straight to
+S3, use an etlutil.S3ObjectWriter, and close it once the pipeline is done:
+
+        out := etlutil.NewS3ObjectWriter(awsConfig, "lake", "orders/2024-01-02.parquet")
+        writer := processors.NewParquetWriter(out)
+        writer.Schema = schema
+        writer.Compression = etlutil.ParquetGzip
+
+processors.ParquetReader decodes the Parquet files sent by a reader such as FileReader, or
+an S3Reader with LineByLine set to false, and sends their records on as JSON batches, row
+group by row group. RedshiftWriter can also stage its batches as Parquet by setting Parquet.
+
+Avro Files
+
+processors.AvroWriter writes the records it receives as an Avro object container file, with
+a schema given in Avro's JSON form, converted from an etldata.Schema, or inferred from the
+first block. Blocks are compressed with deflate by default, or snappy. With a nil Writer,
+the file is sent on, so that it can be written by an IoWriter, SftpWriter or S3Writer:
+
+        writer := processors.NewAvroWriter(nil)
+        writer.Schema = schema
+        writer.Codec = etlutil.AvroSnappy
+        upload := processors.NewS3Writer(awsID, awsSecret, awsRegion, "lake", "orders.avro")
+        upload.LineSeparator = ""
+
+processors.AvroReader decodes the Avro files sent by a reader such as FileReader, or an
+SftpReader or S3Reader with LineByLine set to false, block by block as they arrive. Dates
+and timestamps are sent as etldata.SQLTime, and decimals as numbers.
+
+Excel Workbooks
+
+processors.XLSXReader reads a sheet of the .xlsx workbooks sent by a reader such as
+FileReader, or an SftpReader or S3Reader with LineByLine set to false, and sends its rows on
+as JSON batches, keyed by the header row. Dates are sent as etldata.SQLTime.
+processors.XLSXWriter writes the objects it receives into one or more named sheets, with
+the columns in the order of its Header, and like AvroWriter it can send the workbook on:
+
+        reader := processors.NewXLSXReader()
+        reader.Sheet = "Invoices"
+        writer := processors.NewXLSXWriter(nil)
+        writer.SheetMetadata = etldata.MetadataTable
+        upload := processors.NewSftpWriter(server, username, "/outbox/report.xlsx", auth)
+
+Fixed-Width Files
+
+processors.FixedWidthReader parses fixed-width text, such as a legacy bank feed read by an
+IoReader or SftpReader, into JSON batches with the fields of an etlutil.FixedWidthLayout.
+Fields have a start, a length and a type, and decimal and COBOL zoned fields can have
+implied decimal places. Files that mix header, detail and trailer lines are told apart by a
+record code, and trailer counts are checked against the detail lines read:
+
+        layout := &etlutil.FixedWidthLayout{TypeStart: 1, TypeLength: 1, Records: []etlutil.FixedWidthRecord{
+                {Type: "detail", Code: "D", Fields: []etlutil.FixedWidthField{
+                        {Name: "account", Start: 2, Length: 10, Trim: true},
+                        {Name: "amount", Start: 12, Length: 9, Type: etlutil.FixedWidthZoned, Decimals: 2},
+                }},
+                {Type: "trailer", Code: "T", Role: etlutil.FixedWidthTrailer, CountField: "count",
+                        Fields: []etlutil.FixedWidthField{{Name: "count", Start: 2, Length: 6, Type: etlutil.FixedWidthInteger}}},
+        }}
+        reader := processors.NewFixedWidthReader(layout)
+        reader.Types = []string{"detail"}
+
+processors.FixedWidthTransformer parses payloads of whole lines one at a time instead, and
+processors.FixedWidthWriter writes objects back out with the same layout, filling in the
+counts of trailer records.
+
+XML Documents
+
+processors.XMLReader streams the elements at a path, such as /Orders/Order, out of an XML
+document in an io.Reader, and sends them on as JSON batches. Attributes are keyed by their
+name after an "@", child elements by their name, and repeated children become arrays.
+processors.XMLWriter writes objects back out as the Row elements of a Root element:
+
+        reader := processors.NewXMLReader(file, "/Orders/Order")
+        reader.Arrays = []string{"Line"}
+        writer := processors.NewXMLWriter(out)
+        writer.Root, writer.Row = "Orders", "Order"
+
+Compression
+
+Readers of files and objects (IoReader, S3Reader, SftpReader, FileReader, JSONStreamReader
+and XMLReader) decompress their input when Compression is set to a codec: gzip, zstd,
+bzip2, xz, snappy or zip, or any codec added with etlutil.RegisterCodec. "auto" picks the
+codec from the file extension or the first bytes of each stream. Each file of a zip
+archive is read as a separate stream, with its name in the etldata.MetadataArchiveEntry
+Metadata. IoWriter, SftpWriter, FtpWriter, S3Writer and RedshiftWriter compress what they
+write with Compression and CompressionLevel:
+
+        reader := processors.NewS3PrefixReader(id, secret, region, bucket, "exports/")
+        reader.Compression = etlutil.CompressionAuto
+        writer := processors.NewS3Writer(id, secret, region, bucket, "orders.json")
+        writer.Compression, writer.CompressionLevel = etlutil.CodecZstd, 19
+
+Object Stores
+
+An etlutil.ObjectStore lists, opens, creates, deletes and stats objects by key, whether
+they are files in a local directory (LocalObjectStore), in an S3 bucket (S3ObjectStore),
+on an SFTP server (SftpObjectStore) or in memory for tests (MemoryObjectStore).
+processors.ObjectReader reads the objects matching a prefix or glob pattern with the
+options of IoReader, and processors.ObjectWriter writes to a key, so moving a job from
+SFTP to S3 only changes the store they are given, or the "store" of their config:
+
+        store := etlutil.NewSftpObjectStore(server, user, "/exports", auth)
+        reader := processors.NewObjectReader(store, "orders/*.csv")
+        writer := processors.NewObjectWriter(etlutil.NewLocalObjectStore("out"), "orders.json")
+
+Typed Records
+
+etldata.JSON payloads are parsed again by every stage that works with objects. For wide
+or large data, stages can instead send etldata.Records, which hold the rows in memory and
+are only encoded as JSON when Bytes is called. SQLReader sends them when TypedRecords is
+set, and MySQLWriter, PostgreSQLWriter and CSVTransformer use the rows directly:
+
+        reader := processors.NewSQLReader(db, "SELECT * FROM orders")
+        reader.TypedRecords = true
+
+Schemas
+
+An etldata.Schema describes the fields records should have, with their types, nullability
+and formats. It can be inferred from sample payloads with etldata.InferSchema, and
+converted to and from JSON Schema and Avro schemas. A processors.SchemaValidator halts the
+pipeline on the first record that does not conform, or sends such records to its Invalid
+Processor and passes the rest on. MySQLWriter and PostgreSQLWriter also take a Schema, to
+check the destination table before writing to it (BigQueryWriter cannot, as the BigQuery
+client does not expose table schemas, so validate its records instead):
+
+        schema, err := etldata.SchemaFromJSONSchema(jsonSchema)
+        if err != nil {
+                return err
+        }
+        validator := processors.NewSchemaValidator(schema)
+        validator.Invalid = processors.NewIoWriter(rejectsFile)
+        writer := processors.NewPostgreSQLWriter(db, "orders")
+        writer.Schema = schema
+
+Tracing
+
+Setting Pipeline.Tracing records a Span for every ProcessData call, with the processor
+name, stage number and payload size. Each payload sent by the first stage starts a new
+trace, which is carried along by the payloads sent while processing it (including every
+copy made when branching), so a slow or failing row can be followed through the stages.
+Spans are sent to a SpanExporter, such as an InMemorySpanExporter in tests or an
+OTLPFileExporter:
+
+        exporter, err := goetl.NewOTLPFileExporter("traces.json")
+        if err != nil {
+                return err
+        }
+        defer exporter.Close()
+        pipeline.Tracing = exporter
+
 */
 package goetl
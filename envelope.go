@@ -0,0 +1,48 @@
+package goetl
+
+import (
+	"github.com/teambenny/goetl/etldata"
+)
+
+// envelope carries what the Pipeline keeps track of for a payload between
+// stages: its trace (see Span), its Metadata (see MetadataProcessor), and
+// its checkpoint mark (see checkpointMark). Processors are only ever given
+// the Payload it wraps.
+type envelope struct {
+	etldata.Payload
+	traceID  TraceID // zero if the payload is not traced
+	spanID   SpanID  // the Span that sent the payload
+	metadata etldata.Metadata
+	mark     checkpointMark
+}
+
+// Clone keeps the envelope, so that every output of a branch shares it.
+func (e *envelope) Clone() etldata.Payload {
+	c := *e
+	c.Payload = e.Payload.Clone()
+	return &c
+}
+
+// envelopeOf returns the envelope d is in, or nil if it has none.
+func envelopeOf(d etldata.Payload) *envelope {
+	e, _ := d.(*envelope)
+	return e
+}
+
+// unwrapped returns the Payload wrapped by an envelope.
+func unwrapped(d etldata.Payload) etldata.Payload {
+	if e, ok := d.(*envelope); ok {
+		return e.Payload
+	}
+	return d
+}
+
+// rewrap returns d in a new envelope, which starts as a copy of the one it
+// is already in (if any), so that it can be changed.
+func rewrap(d etldata.Payload) *envelope {
+	if e, ok := d.(*envelope); ok {
+		c := *e
+		return &c
+	}
+	return &envelope{Payload: d}
+}
@@ -0,0 +1,222 @@
+package goetl
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+	"github.com/teambenny/goetl/logger"
+)
+
+// ErrorPolicy controls what happens when a Processor sends an error to its
+// killChan while processing a payload. By default any error halts the whole
+// Pipeline; with an ErrorPolicy set (see DataProcessor.OnError), the failing
+// ProcessData call can instead be retried, and the payload can be skipped or
+// sent to a dead-letter Processor once the retries are used up.
+//
+// The data sent by each ProcessData call is passed on to the next stage as
+// it is sent, so the policy only applies to calls that fail before sending
+// any data. A call that fails after sending some data still halts the
+// Pipeline, since retrying it would send that data again, and skipping it
+// would leave the payload half processed. Anything sent by a failing call
+// after its error is dropped. This makes ErrorPolicy a good fit for
+// transformers and writers, which handle one payload per call, but not for
+// readers, which send all of their data from a single call.
+type ErrorPolicy struct {
+	// Retries is the number of times ProcessData is called again for a
+	// payload after it fails.
+	Retries int
+	// Backoff is how long to wait before the first retry. It is doubled
+	// after each retry, up to MaxBackoff (if set).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Skip drops the failing payload (after any retries) instead of
+	// halting the Pipeline.
+	Skip bool
+	// DeadLetter, if set, receives a DeadLetterData payload for every
+	// failing payload (after any retries) instead of halting the Pipeline.
+	// For example, use a processors.IoWriter to write them to a file.
+	DeadLetter Processor
+
+	deadLetterMutex sync.Mutex
+}
+
+// Retry returns an ErrorPolicy that retries a failing ProcessData call up to
+// the given number of times, with exponential backoff starting at backoff.
+// If the payload still fails, the Pipeline is halted unless ThenSkip or
+// ThenDeadLetter is also used.
+func Retry(retries int, backoff time.Duration) *ErrorPolicy {
+	return &ErrorPolicy{Retries: retries, Backoff: backoff}
+}
+
+// SkipErrors returns an ErrorPolicy that drops failing payloads.
+func SkipErrors() *ErrorPolicy {
+	return &ErrorPolicy{Skip: true}
+}
+
+// DeadLetterTo returns an ErrorPolicy that sends failing payloads to the
+// given Processor.
+func DeadLetterTo(p Processor) *ErrorPolicy {
+	return &ErrorPolicy{DeadLetter: p}
+}
+
+// ThenSkip drops payloads that are still failing after all retries.
+func (e *ErrorPolicy) ThenSkip() *ErrorPolicy {
+	e.Skip = true
+	return e
+}
+
+// ThenDeadLetter sends payloads that are still failing after all retries
+// to the given Processor.
+func (e *ErrorPolicy) ThenDeadLetter(p Processor) *ErrorPolicy {
+	e.DeadLetter = p
+	return e
+}
+
+// DeadLetterData is the payload sent to an ErrorPolicy's DeadLetter Processor.
+// Data holds the failing payload, as JSON when it is valid JSON, or as a string
+// otherwise.
+type DeadLetterData struct {
+	Processor string      `json:"processor"`
+	Error     string      `json:"error"`
+	Attempts  int         `json:"attempts"`
+	Data      interface{} `json:"data"`
+}
+
+// OnError sets the ErrorPolicy used when the Processor fails to process a
+// payload. See ErrorPolicy. Each DataProcessor should be given its own
+// ErrorPolicy, since the DeadLetter Processor is finished along with it.
+func (dp *DataProcessor) OnError(policy *ErrorPolicy) *DataProcessor {
+	dp.errorPolicy = policy
+	return dp
+}
+
+// callProcessDataWithPolicy calls ProcessData (see callProcessData), going
+// through processWithPolicy if the DataProcessor has an ErrorPolicy set.
+func (dp *DataProcessor) callProcessDataWithPolicy(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	if dp.errorPolicy == nil {
+		dp.callProcessData(ctx, d, outputChan, killChan)
+		return
+	}
+	dp.processWithPolicy(ctx, d, outputChan, killChan)
+}
+
+// processWithPolicy calls ProcessData for a single payload, applying the
+// DataProcessor's ErrorPolicy to any error that is sent to the killChan.
+func (dp *DataProcessor) processWithPolicy(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	policy := dp.errorPolicy
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		sent, err := dp.attemptProcessData(ctx, d, outputChan)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if sent {
+			logger.Info("DataProcessor:", dp, "cannot apply error policy after sending data, error:", err)
+			killChan <- err
+			return
+		}
+
+		if attempt <= policy.Retries {
+			logger.Info("DataProcessor:", dp, "retrying in", backoff, "after error:", err)
+			dp.recordRetry()
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff *= 2
+			if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+				backoff = policy.MaxBackoff
+			}
+			continue
+		}
+
+		switch {
+		case policy.DeadLetter != nil:
+			logger.Info("DataProcessor:", dp, "sending payload to dead letter after error:", err)
+			dp.recordDeadLetter()
+			policy.sendDeadLetter(dp, d, err, attempt, killChan)
+		case policy.Skip:
+			logger.Info("DataProcessor:", dp, "skipping payload after error:", err)
+			dp.recordSkip()
+		default:
+			killChan <- err
+		}
+		return
+	}
+}
+
+// attemptProcessData calls ProcessData, passing the data it sends on to
+// outputChan until it sends an error to the killChan. It returns the first
+// error, and whether any data was passed on before it.
+func (dp *DataProcessor) attemptProcessData(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload) (sent bool, err error) {
+	rc := make(chan etldata.Payload)
+	kc := make(chan error)
+	done := make(chan bool)
+	go func() {
+		// Each attempt gets its own copy, since ProcessData may alter it.
+		dp.callProcessData(ctx, d.Clone(), rc, kc)
+		close(done)
+	}()
+
+	for {
+		select {
+		case o, open := <-rc:
+			if !open {
+				rc = nil
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			select {
+			case outputChan <- o:
+				sent = true
+			case <-ctx.Done():
+			}
+		case e := <-kc:
+			if err == nil {
+				err = e
+			}
+		case <-done:
+			return sent, err
+		}
+	}
+}
+
+func (e *ErrorPolicy) sendDeadLetter(dp *DataProcessor, d etldata.Payload, err error, attempts int, killChan chan error) {
+	dl := DeadLetterData{Processor: dp.String(), Error: err.Error(), Attempts: attempts}
+	if json.Valid(d.Bytes()) {
+		dl.Data = json.RawMessage(d.Bytes())
+	} else {
+		dl.Data = string(d.Bytes())
+	}
+	dd, jerr := etldata.NewJSON(dl)
+	if jerr != nil {
+		killChan <- jerr
+		return
+	}
+
+	e.deadLetterMutex.Lock()
+	defer e.deadLetterMutex.Unlock()
+	etlutil.CallDetached(func(outputChan chan etldata.Payload) {
+		e.DeadLetter.ProcessData(dd, outputChan, killChan)
+	})
+}
+
+// finish calls Finish on the DeadLetter Processor, once the DataProcessor
+// using the policy is done.
+func (e *ErrorPolicy) finish(killChan chan error) {
+	if e.DeadLetter == nil {
+		return
+	}
+	e.deadLetterMutex.Lock()
+	defer e.deadLetterMutex.Unlock()
+	etlutil.CallDetached(func(outputChan chan etldata.Payload) {
+		e.DeadLetter.Finish(outputChan, killChan)
+	})
+}
@@ -0,0 +1,149 @@
+package goetl_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+)
+
+// flakyProcessor passes its data on, failing the first failures[payload]
+// calls for each payload. With sendFirst set it sends the payload before
+// failing.
+type flakyProcessor struct {
+	failures  map[string]int
+	sendFirst bool
+	calls     map[string]int
+}
+
+func (f *flakyProcessor) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	k := string(d.Bytes())
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[k]++
+	if f.sendFirst {
+		outputChan <- d
+	}
+	if f.calls[k] <= f.failures[k] {
+		killChan <- errors.New("flaky")
+		return
+	}
+	if !f.sendFirst {
+		outputChan <- d
+	}
+}
+
+func (f *flakyProcessor) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (f *flakyProcessor) String() string {
+	return "flaky"
+}
+
+func TestErrorPolicy(t *testing.T) {
+	data := []string{`{"a":1}`, `{"a":2}`, `{"a":3}`}
+	tests := []struct {
+		name       string
+		failures   map[string]int
+		sendFirst  bool
+		policy     func(deadLetter goetl.Processor) *goetl.ErrorPolicy
+		wantErr    bool
+		wantGot    []string
+		wantStats  [3]int // retries, skipped, dead lettered
+		wantLetter *goetl.DeadLetterData
+	}{
+		{
+			name:      "retry succeeds",
+			failures:  map[string]int{`{"a":1}`: 2, `{"a":3}`: 1},
+			policy:    func(goetl.Processor) *goetl.ErrorPolicy { return goetl.Retry(2, time.Millisecond) },
+			wantGot:   data,
+			wantStats: [3]int{3, 0, 0},
+		},
+		{
+			name:     "retries used up",
+			failures: map[string]int{`{"a":2}`: 3},
+			policy:   func(goetl.Processor) *goetl.ErrorPolicy { return goetl.Retry(2, time.Millisecond) },
+			wantErr:  true,
+		},
+		{
+			name:      "skip",
+			failures:  map[string]int{`{"a":2}`: 1},
+			policy:    func(goetl.Processor) *goetl.ErrorPolicy { return goetl.SkipErrors() },
+			wantGot:   []string{`{"a":1}`, `{"a":3}`},
+			wantStats: [3]int{0, 1, 0},
+		},
+		{
+			name:       "dead letter",
+			failures:   map[string]int{`{"a":3}`: 1},
+			policy:     goetl.DeadLetterTo,
+			wantGot:    []string{`{"a":1}`, `{"a":2}`},
+			wantStats:  [3]int{0, 0, 1},
+			wantLetter: &goetl.DeadLetterData{Processor: "flaky", Error: "flaky", Attempts: 1, Data: map[string]interface{}{"a": 3.0}},
+		},
+		{
+			name:     "retry then dead letter",
+			failures: map[string]int{`{"a":1}`: 5},
+			policy: func(dl goetl.Processor) *goetl.ErrorPolicy {
+				return goetl.Retry(1, time.Millisecond).ThenDeadLetter(dl)
+			},
+			wantGot:    []string{`{"a":2}`, `{"a":3}`},
+			wantStats:  [3]int{1, 0, 1},
+			wantLetter: &goetl.DeadLetterData{Processor: "flaky", Error: "flaky", Attempts: 2, Data: map[string]interface{}{"a": 1.0}},
+		},
+		{
+			name:      "error after sending data",
+			failures:  map[string]int{`{"a":2}`: 1},
+			sendFirst: true,
+			policy:    func(goetl.Processor) *goetl.ErrorPolicy { return goetl.SkipErrors() },
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &flakyProcessor{failures: tt.failures, sendFirst: tt.sendFirst}
+			sink, deadLetter := &testSink{}, &testSink{}
+			layout, err := goetl.NewPipelineLayout(
+				goetl.NewPipelineStage(goetl.Do(&testSource{name: "source", data: data}).Outputs(flaky)),
+				goetl.NewPipelineStage(goetl.Do(flaky).Outputs(sink).OnError(tt.policy(deadLetter))),
+				goetl.NewPipelineStage(goetl.Do(sink)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := goetl.NewBranchingPipeline(layout).Execute()
+			if tt.wantErr {
+				if r.Err == nil {
+					t.Fatal("expected the pipeline to fail")
+				}
+				return
+			}
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			if !reflect.DeepEqual(sink.got, tt.wantGot) {
+				t.Errorf("got %v, want %v", sink.got, tt.wantGot)
+			}
+			s := r.Stats[1]
+			if got := [3]int{s.Retries, s.Skipped, s.DeadLettered}; got != tt.wantStats {
+				t.Errorf("retries, skipped, dead lettered = %v, want %v", got, tt.wantStats)
+			}
+			if tt.wantLetter == nil {
+				return
+			}
+			if len(deadLetter.got) != 1 || deadLetter.finished != 1 {
+				t.Fatalf("dead letter got %v and was finished %d times", deadLetter.got, deadLetter.finished)
+			}
+			var letter goetl.DeadLetterData
+			if err := json.Unmarshal([]byte(deadLetter.got[0]), &letter); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&letter, tt.wantLetter) {
+				t.Errorf("dead letter = %+v, want %+v", letter, *tt.wantLetter)
+			}
+		})
+	}
+}
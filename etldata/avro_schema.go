@@ -0,0 +1,204 @@
+package etldata
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// avroName is the pattern Avro requires of the names of records and fields.
+var avroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// avroSchemaField is an Avro record field. Like in JSON Schema, what Avro
+// cannot express is kept in extension attributes: the type of fields held
+// as JSON strings, and time layouts and patterns.
+type avroSchemaField struct {
+	Name        string          `json:"name"`
+	Type        interface{}     `json:"type"`
+	Default     json.RawMessage `json:"default,omitempty"`
+	GoetlType   FieldType       `json:"x-goetl-type,omitempty"`
+	GoetlFormat string          `json:"x-goetl-format,omitempty"`
+	Pattern     string          `json:"x-goetl-pattern,omitempty"`
+}
+
+// avroLogicalType is an Avro primitive type annotated with a logical type.
+type avroLogicalType struct {
+	Type        string `json:"type"`
+	LogicalType string `json:"logicalType"`
+}
+
+// AvroSchema returns the Schema as an Avro record schema with the given
+// name, which may include a namespace. Integers are written as longs,
+// numbers as doubles, timestamps as longs with the timestamp-micros
+// logical type, and dates as ints with the date logical type. Objects,
+// arrays and fields of any type are written as strings holding JSON.
+// Nullable fields are unions with null, which is also their default.
+func (s *Schema) AvroSchema(name string) ([]byte, error) {
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+	for _, part := range strings.Split(name, ".") {
+		if !avroName.MatchString(part) {
+			return nil, fmt.Errorf("avro: invalid record name %q", name)
+		}
+	}
+
+	fields := []avroSchemaField{}
+	for _, f := range s.Fields {
+		if !avroName.MatchString(f.Name) {
+			return nil, fmt.Errorf("avro: invalid field name %q", f.Name)
+		}
+		af := avroSchemaField{Name: f.Name, Pattern: f.Pattern}
+		var t interface{}
+		switch f.Type {
+		case FieldString:
+			t = "string"
+		case FieldInteger:
+			t = "long"
+		case FieldNumber:
+			t = "double"
+		case FieldBoolean:
+			t = "boolean"
+		case FieldTimestamp:
+			t = avroLogicalType{"long", "timestamp-micros"}
+			af.GoetlFormat = f.Format
+		case FieldDate:
+			t = avroLogicalType{"int", "date"}
+			af.GoetlFormat = f.Format
+		default:
+			t, af.GoetlType = "string", f.Type
+		}
+		if f.Nullable {
+			t, af.Default = []interface{}{"null", t}, json.RawMessage("null")
+		}
+		af.Type = t
+		fields = append(fields, af)
+	}
+
+	return json.MarshalIndent(struct {
+		Type   string            `json:"type"`
+		Name   string            `json:"name"`
+		Fields []avroSchemaField `json:"fields"`
+	}{"record", name, fields}, "", "  ")
+}
+
+// SchemaFromAvroSchema converts an Avro record schema into a Schema,
+// keeping the order of its fields. Ints and longs are integers, floats,
+// doubles and decimals are numbers, enums are strings, records and maps
+// are objects, and the date and timestamp logical types are dates and
+// timestamps. Unions with null are Nullable, and fields of bytes, fixed
+// or unions of several types are FieldAny.
+func SchemaFromAvroSchema(data []byte) (*Schema, error) {
+	var record struct {
+		Type      string            `json:"type"`
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		Fields    []avroSchemaField `json:"fields"`
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("avro: invalid schema: %v", err)
+	}
+	if record.Type != "record" {
+		return nil, fmt.Errorf("avro: must describe a record")
+	}
+
+	// The record can refer to itself.
+	named := map[string]FieldType{record.Name: FieldObject}
+	if record.Namespace != "" && !strings.Contains(record.Name, ".") {
+		named[record.Namespace+"."+record.Name] = FieldObject
+	}
+	s := &Schema{}
+	for _, af := range record.Fields {
+		f := Field{Name: af.Name, Format: af.GoetlFormat, Pattern: af.Pattern}
+		f.Type, f.Nullable = avroFieldType(af.Type, named)
+		if af.GoetlType != "" {
+			f.Type = af.GoetlType
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	if err := s.Check(); err != nil {
+		return nil, fmt.Errorf("avro %v", err)
+	}
+	return s, nil
+}
+
+// avroFieldType returns the FieldType of an Avro type, and whether it can
+// be null. Named types are added to named as they are found.
+func avroFieldType(t interface{}, named map[string]FieldType) (FieldType, bool) {
+	switch tt := t.(type) {
+	case string:
+		switch tt {
+		case "null":
+			return FieldAny, true
+		case "boolean":
+			return FieldBoolean, false
+		case "int", "long":
+			return FieldInteger, false
+		case "float", "double":
+			return FieldNumber, false
+		case "string":
+			return FieldString, false
+		case "bytes":
+			return FieldAny, false
+		}
+		if ft, ok := named[tt]; ok {
+			return ft, false
+		}
+		// A name qualified by a namespace can be used without it.
+		for name, ft := range named {
+			if strings.HasSuffix(name, "."+tt) || strings.HasSuffix(tt, "."+name) {
+				return ft, false
+			}
+		}
+	case []interface{}:
+		nullable := false
+		var types []FieldType
+		for _, b := range tt {
+			ft, null := avroFieldType(b, named)
+			if b == "null" {
+				nullable = true
+			} else {
+				types = append(types, ft)
+				nullable = nullable || null
+			}
+		}
+		if len(types) == 1 {
+			return types[0], nullable
+		}
+		return FieldAny, nullable
+	case map[string]interface{}:
+		ft := FieldAny
+		switch tt["logicalType"] {
+		case "date":
+			return FieldDate, false
+		case "timestamp-millis", "timestamp-micros", "timestamp-nanos",
+			"local-timestamp-millis", "local-timestamp-micros", "local-timestamp-nanos":
+			return FieldTimestamp, false
+		case "decimal":
+			return FieldNumber, false
+		case "uuid":
+			return FieldString, false
+		}
+		switch tt["type"] {
+		case "record", "error", "map":
+			ft = FieldObject
+		case "enum":
+			ft = FieldString
+		case "array":
+			ft = FieldArray
+		case "fixed":
+			ft = FieldAny
+		default:
+			return avroFieldType(tt["type"], named)
+		}
+		if name, ok := tt["name"].(string); ok {
+			if ns, ok := tt["namespace"].(string); ok && !strings.Contains(name, ".") {
+				name = ns + "." + name
+			}
+			named[name] = ft
+		}
+		return ft, false
+	}
+	return FieldAny, false
+}
@@ -2,6 +2,7 @@ package etldata_test
 
 import (
 	"fmt"
+	"reflect"
 
 	"github.com/teambenny/goetl/etldata"
 )
@@ -32,3 +33,77 @@ func ExampleJSONFromHeaderAndRows() {
 	fmt.Println(fmt.Sprintf("%+v", string(d)))
 	// Output: [{"A":1,"B":2,"C":3},{"A":4,"B":5,"C":6}]
 }
+
+func ExampleWithMetadata() {
+	d := etldata.WithMetadata(etldata.JSON(`{"A":1}`), etldata.Metadata{etldata.MetadataFileName: "in.json"})
+	c := etldata.WithMetadata(d.Clone(), etldata.Metadata{etldata.MetadataTable: "archive"})
+
+	fmt.Println(string(c.Bytes()), etldata.MetadataOf(d), etldata.MetadataOf(c))
+	// Output: {"A":1} map[file_name:in.json] map[file_name:in.json table:archive]
+}
+
+func ExampleNewRecords() {
+	d := etldata.NewRecords([]map[string]interface{}{{"A": 1, "B": "x"}, {"A": 2, "B": "y"}})
+	objects, _ := d.Objects()
+
+	fmt.Println(objects[1]["A"], d.Size())
+	fmt.Println(string(d.Bytes()), d.Size())
+	// Output:
+	// 2 0
+	// [{"A":1,"B":"x"},{"A":2,"B":"y"}] 33
+}
+
+func ExampleInferSchema() {
+	sample := etldata.JSON(`[{"id":1,"price":9.5,"shipped":"2024-01-02"},{"id":2,"price":10,"shipped":null}]`)
+	schema, _ := etldata.InferSchema(sample)
+	for _, f := range schema.Fields {
+		fmt.Println(f.Name, f.Type, f.Nullable)
+	}
+
+	fmt.Println(schema.Validate(etldata.JSON(`{"id":"3","price":1,"shipped":"soon"}`)))
+
+	js, _ := schema.JSONSchema()
+	imported, _ := etldata.SchemaFromJSONSchema(js)
+	fmt.Println(reflect.DeepEqual(schema, imported))
+	// Output:
+	// id integer false
+	// price number false
+	// shipped date true
+	// record 0 does not match schema: field "id" should be integer, got string, field "shipped" is not a date in the format "2006-01-02"
+	// true
+}
+
+func ExampleSchema_AvroSchema() {
+	schema := etldata.NewSchema(
+		etldata.Field{Name: "id", Type: etldata.FieldInteger},
+		etldata.Field{Name: "shipped", Type: etldata.FieldDate, Nullable: true},
+	)
+	avro, _ := schema.AvroSchema("Order")
+	fmt.Println(string(avro))
+
+	imported, _ := etldata.SchemaFromAvroSchema(avro)
+	fmt.Println(reflect.DeepEqual(schema, imported))
+	// Output:
+	// {
+	//   "type": "record",
+	//   "name": "Order",
+	//   "fields": [
+	//     {
+	//       "name": "id",
+	//       "type": "long"
+	//     },
+	//     {
+	//       "name": "shipped",
+	//       "type": [
+	//         "null",
+	//         {
+	//           "type": "int",
+	//           "logicalType": "date"
+	//         }
+	//       ],
+	//       "default": null
+	//     }
+	//   ]
+	// }
+	// true
+}
@@ -59,7 +59,11 @@ func (d JSON) Objects() ([]map[string]interface{}, error) {
 	switch vv := v.(type) {
 	case []interface{}:
 		for _, o := range vv {
-			objects = append(objects, o.(map[string]interface{}))
+			obj, ok := o.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("JSON.Objects: unsupported data type: []%T", o)
+			}
+			objects = append(objects, obj)
 		}
 	case map[string]interface{}:
 		objects = []map[string]interface{}{vv}
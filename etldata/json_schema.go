@@ -0,0 +1,197 @@
+package etldata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// jsonSchemaDraft is the JSON Schema version written by Schema.JSONSchema.
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// jsonSchemaProperty is the subset of JSON Schema used to describe a Field.
+// Type is either a string or a list of strings. Time layouts other than
+// RFC 3339 are kept in the x-goetl-format extension keyword.
+type jsonSchemaProperty struct {
+	Type        interface{} `json:"type,omitempty"`
+	Format      string      `json:"format,omitempty"`
+	Pattern     string      `json:"pattern,omitempty"`
+	GoetlFormat string      `json:"x-goetl-format,omitempty"`
+}
+
+// JSONSchema returns the Schema as a JSON Schema document describing a
+// single record. Fields that are not Nullable are required, and timestamp
+// and date fields are strings with the date-time and date formats.
+func (s *Schema) JSONSchema() ([]byte, error) {
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+
+	// The properties are written in the order of the Fields, which a map
+	// would not keep.
+	var props bytes.Buffer
+	props.WriteByte('{')
+	required := []string{}
+	for i, f := range s.Fields {
+		p := jsonSchemaProperty{Pattern: f.Pattern}
+		t := string(f.Type)
+		switch f.Type {
+		case FieldTimestamp:
+			t, p.Format = "string", "date-time"
+			if f.Format != "" && f.Format != time.RFC3339 {
+				p.GoetlFormat = f.Format
+			}
+		case FieldDate:
+			t, p.Format = "string", "date"
+			if f.Format != "" && f.Format != dateFormat {
+				p.GoetlFormat = f.Format
+			}
+		}
+		switch {
+		case f.Type == FieldAny:
+			// Any value is valid, including null.
+		case f.Nullable:
+			p.Type = []string{t, "null"}
+		default:
+			p.Type = t
+		}
+		if !f.Nullable {
+			required = append(required, f.Name)
+		}
+
+		name, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		prop, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			props.WriteByte(',')
+		}
+		props.Write(name)
+		props.WriteByte(':')
+		props.Write(prop)
+	}
+	props.WriteByte('}')
+
+	return json.MarshalIndent(struct {
+		Schema               string          `json:"$schema"`
+		Type                 string          `json:"type"`
+		Properties           json.RawMessage `json:"properties"`
+		Required             []string        `json:"required"`
+		AdditionalProperties bool            `json:"additionalProperties"`
+	}{jsonSchemaDraft, "object", props.Bytes(), required, s.AllowExtraFields}, "", "  ")
+}
+
+// SchemaFromJSONSchema converts a JSON Schema document describing a single
+// record (an object) into a Schema, keeping the order of its properties.
+// Properties that are not required are Nullable, and properties with no
+// type, or several types besides null, are FieldAny. Records may have extra
+// fields unless additionalProperties is false. Keywords that a Schema
+// cannot express are ignored.
+func SchemaFromJSONSchema(data []byte) (*Schema, error) {
+	var doc struct {
+		Type                 interface{}     `json:"type"`
+		Properties           json.RawMessage `json:"properties"`
+		Required             []string        `json:"required"`
+		AdditionalProperties interface{}     `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("json schema: %v", err)
+	}
+	if types := jsonSchemaTypes(doc.Type); len(types) > 0 && (len(types) != 1 || types[0] != "object") {
+		return nil, errors.New("json schema: must describe an object")
+	}
+
+	names, err := objectKeys(doc.Properties)
+	if err != nil {
+		return nil, fmt.Errorf("json schema: properties: %v", err)
+	}
+	var props map[string]jsonSchemaProperty
+	if len(doc.Properties) > 0 {
+		if err := json.Unmarshal(doc.Properties, &props); err != nil {
+			return nil, fmt.Errorf("json schema: properties: %v", err)
+		}
+	}
+	required := make(map[string]bool)
+	for _, name := range doc.Required {
+		required[name] = true
+	}
+
+	s := &Schema{AllowExtraFields: doc.AdditionalProperties != false}
+	for _, name := range names {
+		p := props[name]
+		f := Field{Name: name, Type: FieldAny, Nullable: !required[name], Pattern: p.Pattern, Format: p.GoetlFormat}
+		var types []string
+		for _, t := range jsonSchemaTypes(p.Type) {
+			if t == "null" {
+				f.Nullable = true
+			} else {
+				types = append(types, t)
+			}
+		}
+		if len(types) == 1 {
+			f.Type = FieldType(types[0])
+			if f.Type == FieldString {
+				switch p.Format {
+				case "date-time":
+					f.Type = FieldTimestamp
+				case "date":
+					f.Type = FieldDate
+				}
+			}
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	if err := s.Check(); err != nil {
+		return nil, fmt.Errorf("json %v", err)
+	}
+	return s, nil
+}
+
+// jsonSchemaTypes returns the value of a type keyword as a list.
+func jsonSchemaTypes(t interface{}) []string {
+	switch tt := t.(type) {
+	case string:
+		return []string{tt}
+	case []interface{}:
+		types := []string{}
+		for _, v := range tt {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// objectKeys returns the keys of a JSON object in the order they appear.
+func objectKeys(data json.RawMessage) ([]string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil {
+		return nil, err
+	} else if t != json.Delim('{') {
+		return nil, errors.New("must be an object")
+	}
+	var keys []string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, t.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
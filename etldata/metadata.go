@@ -0,0 +1,107 @@
+package etldata
+
+// Metadata describes a payload without being part of its data, such as the
+// file it was read from or when it was read. Readers fill it in using the
+// Metadata* keys, and writers can use it to decide where the data goes.
+//
+// Metadata must not be modified once it is attached to a payload, since it
+// is shared by the payloads read from the same stream. Use WithMetadata to
+// change it.
+type Metadata map[string]string
+
+// The Metadata keys set by the built-in readers and used by the writers.
+const (
+	MetadataFileName     = "file_name"     // the local file the payload was read from
+	MetadataS3Bucket     = "s3_bucket"     // the S3 bucket the payload was read from
+	MetadataS3Key        = "s3_key"        // the S3 key the payload was read from
+	MetadataSftpPath     = "sftp_path"     // the remote path the payload was read from
+	MetadataArchiveEntry = "archive_entry" // the file in an archive, such as a zip file, the payload was read from
+	MetadataLine         = "line"          // the line number, for payloads read line by line with line numbers on
+	MetadataLineByLine   = "line_by_line"  // "true" for payloads holding a single line, read without its line ending
+	MetadataIngestedAt   = "ingested_at"   // when the payload was read, in RFC 3339 format
+	MetadataContentType  = "content_type"  // the MIME type of the data that was read
+	MetadataQuery        = "query"         // the SQL query the payload was read with
+	MetadataTable        = "table"         // the table SQL writers should write the payload to
+)
+
+// Clone returns a copy of the Metadata.
+func (md Metadata) Clone() Metadata {
+	if md == nil {
+		return nil
+	}
+	c := make(Metadata, len(md))
+	for k, v := range md {
+		c[k] = v
+	}
+	return c
+}
+
+// MetadataPayload is a Payload that carries Metadata.
+type MetadataPayload interface {
+	Payload
+	Metadata() Metadata
+}
+
+// WithMetadata returns d carrying the given Metadata, along with any it
+// already carries (the given values take precedence). If d carries none,
+// md itself is attached rather than a copy, so that a reader can attach the
+// same Metadata to every payload of a stream. The Metadata is kept (and
+// shared) when the Payload is cloned.
+//
+// A Records is returned as a Records, but any other Payload is wrapped, so
+// it is no longer of its own type. A goetl Pipeline unwraps it again before
+// it reaches the next Processor, unless that Processor reads the Metadata
+// (see goetl.MetadataProcessor); elsewhere, Unwrap it before a type
+// assertion such as d.(etldata.JSON).
+func WithMetadata(d Payload, md Metadata) Payload {
+	merged := md
+	if existing := MetadataOf(d); existing != nil {
+		merged = existing.Clone()
+		for k, v := range md {
+			merged[k] = v
+		}
+	} else if merged == nil {
+		merged = Metadata{}
+	}
+	// Records carry their own Metadata, so that they are never wrapped.
+	if r, ok := d.(*Records); ok {
+		return &Records{rows: r.rows, metadata: merged, encoded: r.encoded}
+	}
+	if p, ok := d.(*metadataPayload); ok {
+		d = p.Payload
+	}
+	return &metadataPayload{Payload: d, metadata: merged}
+}
+
+// Unwrap returns d without the Metadata attached by WithMetadata, such as
+// the JSON a reader sent. A Records is returned as it is.
+func Unwrap(d Payload) Payload {
+	if p, ok := d.(*metadataPayload); ok {
+		return p.Payload
+	}
+	return d
+}
+
+// MetadataOf returns the Metadata carried by d, or nil if it has none.
+func MetadataOf(d Payload) Metadata {
+	if p, ok := d.(MetadataPayload); ok {
+		return p.Metadata()
+	}
+	return nil
+}
+
+type metadataPayload struct {
+	Payload
+	metadata Metadata
+}
+
+// Metadata implements MetadataPayload.
+func (p *metadataPayload) Metadata() Metadata {
+	return p.metadata
+}
+
+// Clone implements Payload, keeping the Metadata along with a copy of the
+// data.
+func (p *metadataPayload) Clone() Payload {
+	return &metadataPayload{Payload: p.Payload.Clone(), metadata: p.metadata}
+}
@@ -0,0 +1,100 @@
+package etldata
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/teambenny/goetl/logger"
+)
+
+// Records is a Payload holding rows in memory, so that stages working with
+// objects (such as SQLReader, MySQLWriter, PostgreSQLWriter and
+// CSVTransformer in the processors package) can pass them along without
+// encoding and parsing JSON at every stage. The JSON encoding is only made
+// when Bytes (or Parse) is called.
+//
+// Objects returns the rows themselves, with the values as they were stored
+// rather than as decoded from JSON (so numbers are not converted to
+// float64, and times are not converted to strings). Like any Payload, a
+// Records should not be changed once it has been sent on.
+type Records struct {
+	rows     []map[string]interface{}
+	metadata Metadata
+	encoded  JSON // cached by Bytes
+}
+
+// NewRecords returns a new Records payload holding the given rows.
+func NewRecords(rows []map[string]interface{}) *Records {
+	return &Records{rows: rows}
+}
+
+// Len returns the number of rows.
+func (r *Records) Len() int {
+	return len(r.rows)
+}
+
+// Size returns the size of the JSON encoding in bytes if it has already
+// been made, or 0 otherwise. It is used to gather stats without encoding
+// every payload.
+func (r *Records) Size() int {
+	return len(r.encoded)
+}
+
+// Parse implements Payload, by parsing the JSON encoding.
+func (r *Records) Parse(v interface{}) error {
+	return r.json().Parse(v)
+}
+
+// ParseSilent implements Payload, by parsing the JSON encoding.
+func (r *Records) ParseSilent(v interface{}) error {
+	return r.json().ParseSilent(v)
+}
+
+// Objects implements Payload, returning the rows without copying them. Since
+// the caller may change them, the cached JSON encoding is dropped.
+func (r *Records) Objects() ([]map[string]interface{}, error) {
+	r.encoded = nil
+	return r.rows, nil
+}
+
+// Bytes implements Payload, returning the rows as a JSON array of objects.
+func (r *Records) Bytes() []byte {
+	return r.json()
+}
+
+func (r *Records) json() JSON {
+	if r.encoded == nil {
+		d, err := NewJSON(r.rows)
+		if err != nil {
+			logger.Error(fmt.Sprintf("data: failure to marshal Records - error is \"%v\"", err))
+			d = JSON("null")
+		}
+		r.encoded = d
+	}
+	return r.encoded
+}
+
+// Clone implements Payload. Each row is copied, but values such as nested
+// maps or slices are shared, as is the Metadata.
+func (r *Records) Clone() Payload {
+	rows := make([]map[string]interface{}, len(r.rows))
+	for i, row := range r.rows {
+		c := make(map[string]interface{}, len(row))
+		for k, v := range row {
+			c[k] = v
+		}
+		rows[i] = c
+	}
+	return &Records{rows: rows, metadata: r.metadata, encoded: r.encoded}
+}
+
+// Metadata implements MetadataPayload.
+func (r *Records) Metadata() Metadata {
+	return r.metadata
+}
+
+// MarshalJSON encodes the rows, so a Records can be included in other
+// JSON payloads.
+func (r *Records) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.rows)
+}
@@ -0,0 +1,72 @@
+package etldata_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+func TestRecordsPayload(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	md := etldata.Metadata{etldata.MetadataTable: "orders"}
+	newRows := func() []map[string]interface{} {
+		return []map[string]interface{}{{"id": int64(9007199254740993), "at": at}, {"id": int64(2), "at": nil}}
+	}
+	tests := []struct {
+		name   string
+		d      etldata.Payload
+		wantMd etldata.Metadata
+	}{
+		{name: "Records", d: etldata.NewRecords(newRows())},
+		{name: "Records with metadata", d: etldata.WithMetadata(etldata.NewRecords(newRows()), md), wantMd: md},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := tt.d.(*etldata.Records); !ok {
+				t.Fatalf("payload is a %T, want *etldata.Records", tt.d)
+			}
+
+			// Objects returns the values as they were stored.
+			objects, err := tt.d.Objects()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(objects, newRows()) {
+				t.Errorf("Objects = %v", objects)
+			}
+
+			// Bytes encodes the rows once, as a JSON array.
+			if size := tt.d.(*etldata.Records).Size(); size != 0 {
+				t.Errorf("Size before encoding = %d", size)
+			}
+			want := `[{"at":"2024-01-02T03:04:05Z","id":9007199254740993},{"at":null,"id":2}]`
+			if got := string(tt.d.Bytes()); got != want {
+				t.Errorf("Bytes = %s, want %s", got, want)
+			}
+			if size := tt.d.(*etldata.Records).Size(); size != len(want) {
+				t.Errorf("Size after encoding = %d, want %d", size, len(want))
+			}
+			var parsed []struct{ ID int64 }
+			if err := tt.d.Parse(&parsed); err != nil || len(parsed) != 2 || parsed[0].ID != 9007199254740993 {
+				t.Errorf("Parse = %v, %v", parsed, err)
+			}
+
+			// A clone's rows can be changed without changing the original,
+			// and it shares the Metadata.
+			c := tt.d.Clone()
+			cloned, _ := c.Objects()
+			cloned[0]["id"] = 1
+			if got := string(tt.d.Bytes()); got != want {
+				t.Errorf("Bytes after changing a clone = %s", got)
+			}
+			if !reflect.DeepEqual(etldata.MetadataOf(c), tt.wantMd) || !reflect.DeepEqual(etldata.MetadataOf(tt.d), tt.wantMd) {
+				t.Errorf("Metadata = %v and %v for the clone, want %v", etldata.MetadataOf(tt.d), etldata.MetadataOf(c), tt.wantMd)
+			}
+			if etldata.Unwrap(tt.d) != tt.d {
+				t.Error("Unwrap changed a Records")
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package etldata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FieldType is the type of the values of a Schema Field.
+type FieldType string
+
+// The FieldTypes a Schema can use. Values are checked the way they appear
+// in payloads, so JSON numbers are accepted as integers as long as they
+// have no fractional part, and timestamps can be strings or time.Time
+// values (as found in Records).
+const (
+	FieldString    FieldType = "string"
+	FieldInteger   FieldType = "integer"
+	FieldNumber    FieldType = "number"
+	FieldBoolean   FieldType = "boolean"
+	FieldTimestamp FieldType = "timestamp" // a time.Time, or a string in the Field's Format
+	FieldDate      FieldType = "date"      // like FieldTimestamp, with a default Format of 2006-01-02
+	FieldObject    FieldType = "object"
+	FieldArray     FieldType = "array"
+	FieldAny       FieldType = "any"
+)
+
+// Field describes one field of the records a Schema applies to.
+type Field struct {
+	Name string    `json:"name"`
+	Type FieldType `json:"type"`
+	// Nullable fields can be null or missing.
+	Nullable bool `json:"nullable,omitempty"`
+	// Format is the layout (see the time package) of string values of
+	// timestamp and date fields. It defaults to time.RFC3339 for
+	// timestamps, and 2006-01-02 for dates.
+	Format string `json:"format,omitempty"`
+	// Pattern is a regular expression that string values must match.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// Schema describes the records (JSON objects) that payloads are expected to
+// hold: which fields they have, and what type of values. It is used by
+// processors.SchemaValidator to check payloads, and by writers to check the
+// destination before writing. A Schema can be built directly, inferred from
+// sample payloads with InferSchema, or converted from and to JSON Schema.
+type Schema struct {
+	Fields []Field `json:"fields"`
+	// AllowExtraFields allows records to have fields that are not in the
+	// Schema. Otherwise they are reported as errors.
+	AllowExtraFields bool `json:"allow_extra_fields,omitempty"`
+}
+
+// NewSchema returns a new Schema with the given fields.
+func NewSchema(fields ...Field) *Schema {
+	return &Schema{Fields: fields}
+}
+
+// Field returns the Field with the given name.
+func (s *Schema) Field(name string) (Field, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Check returns an error if the Schema itself is not valid, such as when
+// a field is named twice or has an unknown type.
+func (s *Schema) Check() error {
+	names := make(map[string]bool)
+	for _, f := range s.Fields {
+		if f.Name == "" {
+			return errors.New("schema: fields must have a name")
+		}
+		if names[f.Name] {
+			return fmt.Errorf("schema: field %q is defined more than once", f.Name)
+		}
+		names[f.Name] = true
+		switch f.Type {
+		case FieldString, FieldInteger, FieldNumber, FieldBoolean, FieldTimestamp,
+			FieldDate, FieldObject, FieldArray, FieldAny:
+		default:
+			return fmt.Errorf("schema: field %q has unknown type %q", f.Name, f.Type)
+		}
+		if f.Pattern != "" {
+			if _, err := compilePattern(f.Pattern); err != nil {
+				return fmt.Errorf("schema: field %q: %v", f.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// FieldError describes a field of a record that does not conform to a
+// Schema.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("field %q %v", e.Field, e.Message)
+}
+
+// SchemaError is returned by Schema.Validate for a record that does not
+// conform to the Schema. Record is the index of the record in the payload.
+type SchemaError struct {
+	Record int
+	Errors []FieldError
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+	return fmt.Sprintf("record %d does not match schema: %v", e.Record, strings.Join(msgs, ", "))
+}
+
+// Validate checks every record in the payload (a JSON object or an array of
+// objects) against the Schema, returning a *SchemaError for the first one
+// that does not conform.
+func (s *Schema) Validate(d Payload) error {
+	objects, err := d.Objects()
+	if err != nil {
+		return err
+	}
+	for i, o := range objects {
+		if errs := s.ValidateObject(o); errs != nil {
+			return &SchemaError{Record: i, Errors: errs}
+		}
+	}
+	return nil
+}
+
+// ValidateObject checks a single record against the Schema, returning the
+// ways in which it does not conform, or nil if it does.
+func (s *Schema) ValidateObject(o map[string]interface{}) []FieldError {
+	var errs []FieldError
+	for _, f := range s.Fields {
+		v, ok := o[f.Name]
+		if !ok {
+			if !f.Nullable {
+				errs = append(errs, FieldError{f.Name, "is missing"})
+			}
+			continue
+		}
+		if msg := f.check(v); msg != "" {
+			errs = append(errs, FieldError{f.Name, msg})
+		}
+	}
+	if !s.AllowExtraFields {
+		var extra []string
+		for k := range o {
+			if _, ok := s.Field(k); !ok {
+				extra = append(extra, k)
+			}
+		}
+		sort.Strings(extra)
+		for _, k := range extra {
+			errs = append(errs, FieldError{k, "is not in the schema"})
+		}
+	}
+	return errs
+}
+
+// check returns why v is not a valid value for the Field, or "" if it is.
+func (f Field) check(v interface{}) string {
+	if v == nil {
+		if f.Nullable {
+			return ""
+		}
+		return "is null"
+	}
+	ok := false
+	switch f.Type {
+	case FieldString:
+		var s string
+		s, ok = v.(string)
+		if ok && f.Pattern != "" {
+			re, err := compilePattern(f.Pattern)
+			if err != nil {
+				return err.Error()
+			}
+			if !re.MatchString(s) {
+				return fmt.Sprintf("does not match pattern %q", f.Pattern)
+			}
+		}
+	case FieldInteger:
+		ok = isInteger(v)
+	case FieldNumber:
+		ok = isNumber(v)
+	case FieldBoolean:
+		_, ok = v.(bool)
+	case FieldTimestamp, FieldDate:
+		if s, isString := v.(string); isString {
+			if _, err := time.Parse(f.TimeFormat(), s); err != nil {
+				return fmt.Sprintf("is not a %v in the format %q", f.Type, f.TimeFormat())
+			}
+			return ""
+		}
+		_, ok = v.(time.Time)
+	case FieldObject:
+		rv := reflect.ValueOf(v)
+		ok = rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String
+	case FieldArray:
+		rv := reflect.ValueOf(v)
+		_, isBytes := v.([]byte)
+		ok = (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && !isBytes
+	case FieldAny:
+		ok = true
+	}
+	if !ok {
+		return fmt.Sprintf("should be %v, got %v", f.Type, valueType(v))
+	}
+	return ""
+}
+
+// TimeFormat returns the layout of the string values of a timestamp or date
+// Field: its Format, or the default for its type.
+func (f Field) TimeFormat() string {
+	switch {
+	case f.Format != "":
+		return f.Format
+	case f.Type == FieldDate:
+		return dateFormat
+	}
+	return time.RFC3339
+}
+
+const dateFormat = "2006-01-02"
+
+var patterns sync.Map // pattern string -> *regexp.Regexp
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+func isInteger(v interface{}) bool {
+	switch n := v.(type) {
+	case float64:
+		return n == math.Trunc(n) && !math.IsInf(n, 0)
+	case float32:
+		return float64(n) == math.Trunc(float64(n)) && !math.IsInf(float64(n), 0)
+	case json.Number:
+		_, err := n.Int64()
+		return err == nil
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isNumber(v interface{}) bool {
+	if n, ok := v.(json.Number); ok {
+		_, err := n.Float64()
+		return err == nil
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Float32, reflect.Float64:
+		return true
+	}
+	return isInteger(v)
+}
+
+// valueType describes the type of v for error messages, using the JSON
+// names where there is one.
+func valueType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if isNumber(v) {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// InferSchema returns a Schema that the records in the given sample
+// payloads conform to, with the fields sorted by name. Fields that are null
+// or missing in some records are Nullable. Strings in RFC 3339 or
+// 2006-01-02 format are taken as timestamps or dates. When a field holds
+// values of different types, it is given a type covering them all:
+// integers and numbers give a number, strings and timestamps give a
+// string, and anything else gives FieldAny.
+//
+// The inferred Schema is only as good as the sample, so it is worth
+// reviewing (for example as JSON Schema) before using it to validate data.
+func InferSchema(payloads ...Payload) (*Schema, error) {
+	types := make(map[string]FieldType)
+	counts := make(map[string]int)
+	nullable := make(map[string]bool)
+	records := 0
+	for _, d := range payloads {
+		objects, err := d.Objects()
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objects {
+			records++
+			for k, v := range o {
+				counts[k]++
+				if v == nil {
+					nullable[k] = true
+					continue
+				}
+				types[k] = mergeFieldTypes(types[k], inferFieldType(v))
+			}
+		}
+	}
+
+	s := &Schema{}
+	for name, n := range counts {
+		f := Field{Name: name, Type: types[name], Nullable: nullable[name] || n < records}
+		if f.Type == "" {
+			f.Type = FieldAny // only ever null
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	sort.Slice(s.Fields, func(i, j int) bool { return s.Fields[i].Name < s.Fields[j].Name })
+	return s, nil
+}
+
+func inferFieldType(v interface{}) FieldType {
+	switch vv := v.(type) {
+	case string:
+		if _, err := time.Parse(time.RFC3339, vv); err == nil {
+			return FieldTimestamp
+		}
+		if _, err := time.Parse(dateFormat, vv); err == nil {
+			return FieldDate
+		}
+		return FieldString
+	case bool:
+		return FieldBoolean
+	case time.Time:
+		return FieldTimestamp
+	}
+	for _, t := range []FieldType{FieldInteger, FieldNumber, FieldObject, FieldArray} {
+		if (Field{Type: t}).check(v) == "" {
+			return t
+		}
+	}
+	return FieldAny
+}
+
+func mergeFieldTypes(a, b FieldType) FieldType {
+	isString := func(t FieldType) bool {
+		return t == FieldString || t == FieldTimestamp || t == FieldDate
+	}
+	isNumeric := func(t FieldType) bool {
+		return t == FieldInteger || t == FieldNumber
+	}
+	switch {
+	case a == "" || a == b:
+		return b
+	case isNumeric(a) && isNumeric(b):
+		return FieldNumber
+	case isString(a) && isString(b):
+		return FieldString
+	}
+	return FieldAny
+}
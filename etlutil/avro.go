@@ -0,0 +1,655 @@
+package etlutil
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// avroSchema is a parsed Avro schema.
+type avroSchema struct {
+	typ       string // a primitive type name, or record, enum, array, map, fixed or union
+	logical   string
+	name      string // the full name of named types
+	fields    []avroField
+	symbols   []string
+	items     *avroSchema // of arrays, and the values of maps
+	size      int
+	branches  []*avroSchema
+	scale     int
+	precision int
+}
+
+type avroField struct {
+	name       string
+	schema     *avroSchema
+	def        interface{}
+	hasDefault bool
+}
+
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// parseAvroSchema parses an Avro schema in its JSON form.
+func parseAvroSchema(data []byte) (*avroSchema, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("avro: invalid schema: %v", err)
+	}
+	return (&avroSchemaParser{named: make(map[string]*avroSchema)}).parse(v, "")
+}
+
+type avroSchemaParser struct {
+	named map[string]*avroSchema
+}
+
+func (p *avroSchemaParser) parse(v interface{}, namespace string) (*avroSchema, error) {
+	switch s := v.(type) {
+	case string:
+		if avroPrimitives[s] {
+			return &avroSchema{typ: s}, nil
+		}
+		if named, ok := p.named[avroFullName(s, namespace)]; ok {
+			return named, nil
+		}
+		if named, ok := p.named[s]; ok {
+			return named, nil
+		}
+		return nil, fmt.Errorf("avro: unknown type %q", s)
+	case []interface{}:
+		u := &avroSchema{typ: "union"}
+		for _, b := range s {
+			branch, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			u.branches = append(u.branches, branch)
+		}
+		return u, nil
+	case map[string]interface{}:
+		return p.parseObject(s, namespace)
+	}
+	return nil, fmt.Errorf("avro: invalid schema %v", v)
+}
+
+func (p *avroSchemaParser) parseObject(s map[string]interface{}, namespace string) (*avroSchema, error) {
+	typ, _ := s["type"].(string)
+	if typ == "" {
+		// The type can itself be a schema, such as a union.
+		if t, ok := s["type"]; ok {
+			return p.parse(t, namespace)
+		}
+		return nil, errors.New("avro: schema has no type")
+	}
+	logical, _ := s["logicalType"].(string)
+	intProp := func(name string) int {
+		n, _ := s[name].(float64)
+		return int(n)
+	}
+
+	var schema *avroSchema
+	switch typ {
+	case "record", "error", "enum", "fixed":
+		name, _ := s["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("avro: %v has no name", typ)
+		}
+		if ns, ok := s["namespace"].(string); ok {
+			namespace = ns
+		}
+		fullName := avroFullName(name, namespace)
+		if i := strings.LastIndex(fullName, "."); i >= 0 {
+			namespace = fullName[:i]
+		}
+		schema = &avroSchema{typ: typ, name: fullName, logical: logical, size: intProp("size")}
+		if typ == "error" {
+			schema.typ = "record"
+		}
+		// Register the name first, as records can refer to themselves.
+		p.named[fullName] = schema
+	case "array", "map":
+		schema = &avroSchema{typ: typ, logical: logical}
+		key := "items"
+		if typ == "map" {
+			key = "values"
+		}
+		items, err := p.parse(s[key], namespace)
+		if err != nil {
+			return nil, err
+		}
+		schema.items = items
+		return schema, nil
+	default:
+		if !avroPrimitives[typ] {
+			return p.parse(typ, namespace)
+		}
+		schema = &avroSchema{typ: typ, logical: logical}
+	}
+	schema.scale, schema.precision = intProp("scale"), intProp("precision")
+
+	switch schema.typ {
+	case "record":
+		fields, _ := s["fields"].([]interface{})
+		for _, f := range fields {
+			fm, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("avro: record %v has an invalid field", schema.name)
+			}
+			name, _ := fm["name"].(string)
+			fs, err := p.parse(fm["type"], namespace)
+			if err != nil {
+				return nil, fmt.Errorf("avro: field %q: %v", name, err)
+			}
+			def, hasDefault := fm["default"]
+			schema.fields = append(schema.fields, avroField{name: name, schema: fs, def: def, hasDefault: hasDefault})
+		}
+	case "enum":
+		symbols, _ := s["symbols"].([]interface{})
+		for _, sym := range symbols {
+			name, _ := sym.(string)
+			schema.symbols = append(schema.symbols, name)
+		}
+	}
+	return schema, nil
+}
+
+func avroFullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+var errAvroData = errors.New("avro: invalid or truncated data")
+
+// avroDecoder decodes values in the Avro binary encoding.
+type avroDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *avroDecoder) long() (int64, error) {
+	u, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, errAvroData
+	}
+	d.pos += n
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (d *avroDecoder) next(n int64) ([]byte, error) {
+	if n < 0 || int64(len(d.data)-d.pos) < n {
+		return nil, errAvroData
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *avroDecoder) bytes() ([]byte, error) {
+	n, err := d.long()
+	if err != nil {
+		return nil, err
+	}
+	return d.next(n)
+}
+
+// decode decodes a value of the given schema. Records and maps are
+// decoded as map[string]interface{}, and logical types are converted (see
+// AvroOCFReader).
+func (d *avroDecoder) decode(s *avroSchema) (interface{}, error) {
+	v, err := d.decodeType(s)
+	if err != nil || s.logical == "" {
+		return v, err
+	}
+	return avroLogicalValue(s, v), nil
+}
+
+func (d *avroDecoder) decodeType(s *avroSchema) (interface{}, error) {
+	switch s.typ {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case "int":
+		n, err := d.long()
+		return int32(n), err
+	case "long":
+		return d.long()
+	case "float":
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+	case "double":
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "bytes":
+		b, err := d.bytes()
+		return append([]byte{}, b...), err
+	case "string":
+		b, err := d.bytes()
+		return string(b), err
+	case "fixed":
+		b, err := d.next(int64(s.size))
+		return append([]byte{}, b...), err
+	case "enum":
+		n, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n >= int64(len(s.symbols)) {
+			return nil, errAvroData
+		}
+		return s.symbols[n], nil
+	case "union":
+		n, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n >= int64(len(s.branches)) {
+			return nil, errAvroData
+		}
+		return d.decode(s.branches[n])
+	case "record":
+		o := make(map[string]interface{}, len(s.fields))
+		for _, f := range s.fields {
+			v, err := d.decode(f.schema)
+			if err != nil {
+				return nil, err
+			}
+			o[f.name] = v
+		}
+		return o, nil
+	case "array":
+		items := []interface{}{}
+		err := d.blocks(func() error {
+			v, err := d.decode(s.items)
+			items = append(items, v)
+			return err
+		})
+		return items, err
+	case "map":
+		m := make(map[string]interface{})
+		err := d.blocks(func() error {
+			k, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			v, err := d.decode(s.items)
+			m[string(k)] = v
+			return err
+		})
+		return m, err
+	}
+	return nil, fmt.Errorf("avro: unknown type %q", s.typ)
+}
+
+// blocks reads the blocks of an array or map, calling item for each item.
+func (d *avroDecoder) blocks(item func() error) error {
+	for {
+		n, err := d.long()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if n < 0 {
+			n = -n
+			if _, err := d.long(); err != nil { // the size of the block in bytes
+				return err
+			}
+		}
+		if n > int64(len(d.data)) {
+			return errAvroData
+		}
+		for i := int64(0); i < n; i++ {
+			if err := item(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// avroLogicalValue converts a decoded value of a logical type: dates and
+// timestamps to time.Time in UTC, times of day to time.Duration, and
+// decimals to json.Number. Other values are returned as they are.
+func avroLogicalValue(s *avroSchema, v interface{}) interface{} {
+	switch n := v.(type) {
+	case int32:
+		switch s.logical {
+		case "date":
+			return time.Unix(int64(n)*86400, 0).UTC()
+		case "time-millis":
+			return time.Duration(n) * time.Millisecond
+		}
+	case int64:
+		switch s.logical {
+		case "timestamp-millis", "local-timestamp-millis":
+			return time.Unix(0, n*1e6).UTC()
+		case "timestamp-micros", "local-timestamp-micros":
+			return time.Unix(0, n*1e3).UTC()
+		case "timestamp-nanos", "local-timestamp-nanos":
+			return time.Unix(0, n).UTC()
+		case "time-micros":
+			return time.Duration(n) * time.Microsecond
+		}
+	case []byte:
+		if s.logical == "decimal" {
+			return decimalNumber(twosComplement(n), s.scale)
+		}
+	}
+	return v
+}
+
+// twosComplement returns the integer held in big-endian two's complement.
+func twosComplement(b []byte) *big.Int {
+	n := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return n
+}
+
+// decimalNumber returns the unscaled integer n with the given scale as a
+// json.Number.
+func decimalNumber(n *big.Int, scale int) json.Number {
+	s := new(big.Int).Abs(n).String()
+	if scale > 0 {
+		if len(s) <= scale {
+			s = strings.Repeat("0", scale-len(s)+1) + s
+		}
+		s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	}
+	if n.Sign() < 0 {
+		s = "-" + s
+	}
+	return json.Number(s)
+}
+
+// avroEncoder encodes values in the Avro binary encoding.
+type avroEncoder struct {
+	buf []byte
+}
+
+func (e *avroEncoder) long(n int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], uint64(n<<1^n>>63))]...)
+}
+
+func (e *avroEncoder) bytes(b []byte) {
+	e.long(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// encode appends the encoding of v. Values are accepted as decoded by
+// avroDecoder, and as found in JSON payloads and Records: numbers of any
+// type (including json.Number), and times as time.Time, etldata.SQLTime
+// or strings in RFC 3339 or SQL format.
+func (e *avroEncoder) encode(s *avroSchema, v interface{}) error {
+	fail := func() error {
+		return fmt.Errorf("cannot write %T as %v", v, avroTypeName(s))
+	}
+	switch s.typ {
+	case "null":
+		if v != nil {
+			return fail()
+		}
+	case "boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return fail()
+		}
+		if b {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+	case "int", "long":
+		n, ok := avroLogicalInt(s, v)
+		if !ok {
+			return fail()
+		}
+		if s.typ == "int" && (n < math.MinInt32 || n > math.MaxInt32) {
+			return fmt.Errorf("%v is out of range for int", n)
+		}
+		e.long(n)
+	case "float":
+		x, ok := toFloat64(v)
+		if !ok {
+			return fail()
+		}
+		e.buf = appendUint32(e.buf, math.Float32bits(float32(x)))
+	case "double":
+		x, ok := toFloat64(v)
+		if !ok {
+			return fail()
+		}
+		e.buf = appendUint64(e.buf, math.Float64bits(x))
+	case "bytes", "fixed":
+		var b []byte
+		switch {
+		case s.logical == "decimal":
+			n, ok := avroUnscaled(v, s.scale)
+			if !ok {
+				return fail()
+			}
+			if b = twosComplementBytes(n); s.typ == "fixed" {
+				if len(b) > s.size {
+					return fmt.Errorf("%v does not fit in %v bytes", v, s.size)
+				}
+				pad := byte(0)
+				if n.Sign() < 0 {
+					pad = 0xff
+				}
+				for len(b) < s.size {
+					b = append([]byte{pad}, b...)
+				}
+			}
+		default:
+			switch vv := v.(type) {
+			case []byte:
+				b = vv
+			case string:
+				b = []byte(vv)
+			default:
+				return fail()
+			}
+		}
+		if s.typ == "fixed" {
+			if len(b) != s.size {
+				return fmt.Errorf("fixed %v must be %v bytes, got %v", s.name, s.size, len(b))
+			}
+			e.buf = append(e.buf, b...)
+		} else {
+			e.bytes(b)
+		}
+	case "string":
+		switch vv := v.(type) {
+		case string:
+			e.bytes([]byte(vv))
+		case []byte:
+			e.bytes(vv)
+		default:
+			return fail()
+		}
+	case "enum":
+		sym, _ := v.(string)
+		for i, name := range s.symbols {
+			if name == sym {
+				e.long(int64(i))
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not a symbol of enum %v", v, s.name)
+	case "union":
+		// Use the first branch the value can be written as.
+		start := len(e.buf)
+		for i, b := range s.branches {
+			e.long(int64(i))
+			if err := e.encode(b, v); err == nil {
+				return nil
+			}
+			e.buf = e.buf[:start]
+		}
+		return fail()
+	case "record":
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return fail()
+		}
+		for _, f := range s.fields {
+			fv, ok := o[f.name]
+			if !ok && f.hasDefault {
+				fv = f.def
+			}
+			if err := e.encode(f.schema, fv); err != nil {
+				return fmt.Errorf("field %q: %v", f.name, err)
+			}
+		}
+	case "array":
+		rv := reflect.ValueOf(v)
+		if _, isBytes := v.([]byte); isBytes || rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return fail()
+		}
+		if rv.Len() > 0 {
+			e.long(int64(rv.Len()))
+			for i := 0; i < rv.Len(); i++ {
+				if err := e.encode(s.items, rv.Index(i).Interface()); err != nil {
+					return err
+				}
+			}
+		}
+		e.long(0)
+	case "map":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fail()
+		}
+		if len(m) > 0 {
+			e.long(int64(len(m)))
+			for k, mv := range m {
+				e.bytes([]byte(k))
+				if err := e.encode(s.items, mv); err != nil {
+					return fmt.Errorf("key %q: %v", k, err)
+				}
+			}
+		}
+		e.long(0)
+	default:
+		return fmt.Errorf("unknown type %q", s.typ)
+	}
+	return nil
+}
+
+// avroLogicalInt returns the int or long to write for v, converting times
+// for date and timestamp logical types.
+func avroLogicalInt(s *avroSchema, v interface{}) (int64, bool) {
+	var unit time.Duration
+	switch s.logical {
+	case "date":
+		t, ok := toTime(v, "2006-01-02")
+		if !ok {
+			break
+		}
+		days := t.Unix() / 86400
+		if t.Unix() < 0 && t.Unix()%86400 != 0 {
+			days--
+		}
+		return days, true
+	case "timestamp-millis", "local-timestamp-millis":
+		unit = time.Millisecond
+	case "timestamp-micros", "local-timestamp-micros":
+		unit = time.Microsecond
+	case "timestamp-nanos", "local-timestamp-nanos":
+		unit = time.Nanosecond
+	case "time-millis", "time-micros":
+		if d, ok := v.(time.Duration); ok {
+			if s.logical == "time-millis" {
+				return int64(d / time.Millisecond), true
+			}
+			return int64(d / time.Microsecond), true
+		}
+	}
+	if unit != 0 {
+		if t, ok := toTime(v, time.RFC3339Nano); ok {
+			return t.Unix()*int64(time.Second/unit) + int64(t.Nanosecond())/int64(unit), true
+		}
+	}
+	return toInt64(v)
+}
+
+// avroUnscaled returns the unscaled value of a decimal number with the
+// given scale.
+func avroUnscaled(v interface{}, scale int) (*big.Int, bool) {
+	var s string
+	switch n := v.(type) {
+	case json.Number:
+		s = string(n)
+	case string:
+		s = n
+	default:
+		x, ok := toFloat64(v)
+		if !ok {
+			return nil, false
+		}
+		s = fmt.Sprint(x)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, false
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	if !r.IsInt() {
+		return nil, false
+	}
+	return r.Num(), true
+}
+
+// twosComplementBytes returns the shortest big-endian two's complement
+// encoding of n.
+func twosComplementBytes(n *big.Int) []byte {
+	if n.Sign() >= 0 {
+		b := n.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	// -n-1 with every bit inverted.
+	b := new(big.Int).Sub(new(big.Int).Neg(n), big.NewInt(1)).Bytes()
+	for i := range b {
+		b[i] = ^b[i]
+	}
+	if len(b) == 0 || b[0]&0x80 == 0 {
+		b = append([]byte{0xff}, b...)
+	}
+	return b
+}
+
+func avroTypeName(s *avroSchema) string {
+	switch {
+	case s.name != "":
+		return s.name
+	case s.logical != "":
+		return s.logical
+	}
+	return s.typ
+}
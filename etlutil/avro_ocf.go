@@ -0,0 +1,311 @@
+package etlutil
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// AvroCodec is the compression codec of the blocks of an Avro object
+// container file.
+type AvroCodec string
+
+// The Avro codecs supported by AvroOCFReader and AvroOCFWriter.
+const (
+	AvroNull    AvroCodec = "null"
+	AvroDeflate AvroCodec = "deflate"
+	AvroSnappy  AvroCodec = "snappy"
+)
+
+// ParseAvroCodec returns the AvroCodec with the given name: "null" (or
+// "none"), "deflate" or "snappy".
+func ParseAvroCodec(name string) (AvroCodec, error) {
+	switch c := AvroCodec(strings.ToLower(name)); c {
+	case "none":
+		return AvroNull, nil
+	case AvroNull, AvroDeflate, AvroSnappy:
+		return c, nil
+	}
+	return "", fmt.Errorf("avro: unknown codec %q", name)
+}
+
+var avroMagic = []byte("Obj\x01")
+
+// ErrAvroFile is returned for data that is not an Avro object container
+// file.
+var ErrAvroFile = errors.New("avro: not an object container file")
+
+func (c AvroCodec) compress(data []byte, level int) ([]byte, error) {
+	switch c {
+	case AvroNull, "":
+		return data, nil
+	case AvroDeflate:
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return nil, err
+		}
+		err = fw.Close()
+		return buf.Bytes(), err
+	case AvroSnappy:
+		// Each block is followed by the CRC32 of its uncompressed data.
+		out := snappy.Encode(nil, data)
+		crc := make([]byte, 4)
+		binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(data))
+		return append(out, crc...), nil
+	}
+	return nil, fmt.Errorf("avro: unsupported codec %q", c)
+}
+
+func (c AvroCodec) decompress(data []byte) ([]byte, error) {
+	switch c {
+	case AvroNull, "":
+		return data, nil
+	case AvroDeflate:
+		return ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	case AvroSnappy:
+		if len(data) < 4 {
+			return nil, errAvroData
+		}
+		out, err := snappy.Decode(nil, data[:len(data)-4])
+		if err != nil {
+			return nil, err
+		}
+		if crc32.ChecksumIEEE(out) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+			return nil, errors.New("avro: snappy block checksum mismatch")
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("avro: unsupported codec %q", c)
+}
+
+// AvroOCFReader decodes Avro object container files, whose schema must be
+// a record. Data is decoded as it arrives with ReadRecords, a block at a
+// time, so that a file can be split across several reads.
+//
+// Records and maps are decoded as map[string]interface{}, arrays as
+// []interface{}, bytes and fixed as []byte, and enums as their symbol.
+// Dates and timestamps (including local ones) are decoded as time.Time in
+// UTC, times of day as time.Duration, and decimals as json.Number.
+type AvroOCFReader struct {
+	schema    *avroSchema
+	rawSchema []byte
+	codec     AvroCodec
+	sync      []byte
+}
+
+// NewAvroOCFReader returns an AvroOCFReader for a single file.
+func NewAvroOCFReader() *AvroOCFReader {
+	return &AvroOCFReader{}
+}
+
+// Schema returns the schema of the file in its JSON form, once the header
+// has been read.
+func (r *AvroOCFReader) Schema() []byte {
+	return r.rawSchema
+}
+
+// ReadRecords decodes the complete blocks at the start of data, returning
+// their records along with the number of bytes of data they take up,
+// including the header of the file when it is first read. A block that is
+// incomplete is left to be read again once more data has arrived, unless
+// atEOF is true, in which case it is an error.
+func (r *AvroOCFReader) ReadRecords(data []byte, atEOF bool) (records []map[string]interface{}, n int, err error) {
+	if r.schema == nil {
+		size, err := r.readHeader(data)
+		if err == errAvroData && !atEOF {
+			return nil, 0, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		n = size
+	}
+	for n < len(data) {
+		block, size, err := r.readBlock(data[n:])
+		if err == errAvroData && !atEOF {
+			break // incomplete
+		}
+		if err != nil {
+			return records, n, err
+		}
+		records = append(records, block...)
+		n += size
+	}
+	return records, n, nil
+}
+
+func (r *AvroOCFReader) readHeader(data []byte) (int, error) {
+	if len(data) < len(avroMagic) {
+		return 0, errAvroData
+	}
+	if !bytes.Equal(data[:len(avroMagic)], avroMagic) {
+		return 0, ErrAvroFile
+	}
+	d := &avroDecoder{data: data, pos: len(avroMagic)}
+	meta, err := d.decodeType(&avroSchema{typ: "map", items: &avroSchema{typ: "bytes"}})
+	if err != nil {
+		return 0, err
+	}
+	sync, err := d.next(16)
+	if err != nil {
+		return 0, err
+	}
+	m := meta.(map[string]interface{})
+	raw, _ := m["avro.schema"].([]byte)
+	schema, err := parseAvroSchema(raw)
+	if err != nil {
+		return 0, err
+	}
+	if schema.typ != "record" {
+		return 0, fmt.Errorf("avro: the schema of the file is a %v, not a record", schema.typ)
+	}
+	if codec, ok := m["avro.codec"].([]byte); ok {
+		r.codec = AvroCodec(codec)
+	}
+	if _, err := ParseAvroCodec(string(r.codec)); err != nil && r.codec != "" {
+		return 0, err
+	}
+	r.schema, r.rawSchema, r.sync = schema, raw, append([]byte(nil), sync...)
+	return d.pos, nil
+}
+
+// readBlock decodes a block, returning errAvroData if it is incomplete.
+func (r *AvroOCFReader) readBlock(data []byte) ([]map[string]interface{}, int, error) {
+	d := &avroDecoder{data: data}
+	count, err := d.long()
+	if err != nil {
+		return nil, 0, err
+	}
+	compressed, err := d.bytes()
+	if err != nil {
+		return nil, 0, err
+	}
+	sync, err := d.next(16)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(sync, r.sync) {
+		return nil, 0, errors.New("avro: invalid sync marker")
+	}
+	block, err := r.codec.decompress(compressed)
+	if err != nil {
+		return nil, 0, err
+	}
+	records := make([]map[string]interface{}, 0, count)
+	bd := &avroDecoder{data: block}
+	for i := int64(0); i < count; i++ {
+		v, err := bd.decode(r.schema)
+		if err == errAvroData {
+			return nil, 0, errors.New("avro: invalid block")
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, v.(map[string]interface{}))
+	}
+	return records, d.pos, nil
+}
+
+// AvroOCFWriter writes an Avro object container file to an io.Writer, a
+// block at a time. The header of the file is written with the first block.
+//
+// Records are written as map[string]interface{}, with the values accepted
+// for each Avro type including those AvroOCFReader returns. Numbers can be
+// of any Go type, or json.Number, and times can be time.Time,
+// etldata.SQLTime or strings in RFC 3339 or SQL format. Missing fields take
+// their default, and a union is written as its first branch that the value
+// fits.
+type AvroOCFWriter struct {
+	Codec AvroCodec // defaults to AvroDeflate
+	Level int       // the deflate compression level, defaults to flate.DefaultCompression
+
+	w         io.Writer
+	schema    *avroSchema
+	rawSchema []byte
+	sync      []byte
+	started   bool
+}
+
+// NewAvroOCFWriter returns an AvroOCFWriter for the given record schema, in
+// its JSON form.
+func NewAvroOCFWriter(w io.Writer, schema []byte) (*AvroOCFWriter, error) {
+	s, err := parseAvroSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	if s.typ != "record" {
+		return nil, fmt.Errorf("avro: the schema is a %v, not a record", s.typ)
+	}
+	sync := make([]byte, 16)
+	if _, err := rand.Read(sync); err != nil {
+		return nil, err
+	}
+	return &AvroOCFWriter{Codec: AvroDeflate, Level: flate.DefaultCompression,
+		w: w, schema: s, rawSchema: schema, sync: sync}, nil
+}
+
+// WriteBlock writes the records as a single block.
+func (w *AvroOCFWriter) WriteBlock(records []map[string]interface{}) error {
+	if err := w.writeHeader(); err != nil || len(records) == 0 {
+		return err
+	}
+	e := &avroEncoder{}
+	for i, record := range records {
+		if err := e.encode(w.schema, record); err != nil {
+			return fmt.Errorf("avro: record %d: %v", i+1, err)
+		}
+	}
+	compressed, err := w.Codec.compress(e.buf, w.Level)
+	if err != nil {
+		return err
+	}
+	block := &avroEncoder{}
+	block.long(int64(len(records)))
+	block.bytes(compressed)
+	block.buf = append(block.buf, w.sync...)
+	_, err = w.w.Write(block.buf)
+	return err
+}
+
+// Close writes the header if no block has been written, so that the file
+// is valid. It does not close the underlying io.Writer.
+func (w *AvroOCFWriter) Close() error {
+	return w.writeHeader()
+}
+
+func (w *AvroOCFWriter) writeHeader() error {
+	if w.started {
+		return nil
+	}
+	if _, err := w.Codec.compress(nil, w.Level); err != nil {
+		return err
+	}
+	codec := w.Codec
+	if codec == "" {
+		codec = AvroNull
+	}
+	e := &avroEncoder{buf: append([]byte(nil), avroMagic...)}
+	e.long(2)
+	e.bytes([]byte("avro.schema"))
+	e.bytes(w.rawSchema)
+	e.bytes([]byte("avro.codec"))
+	e.bytes([]byte(codec))
+	e.long(0)
+	e.buf = append(e.buf, w.sync...)
+	w.started = true
+	_, err := w.w.Write(e.buf)
+	return err
+}
@@ -0,0 +1,247 @@
+package etlutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const avroTestSchema = `{
+  "type": "record", "name": "Order", "namespace": "shop",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "qty", "type": "int"},
+    {"name": "weight", "type": "float"},
+    {"name": "price", "type": "double"},
+    {"name": "paid", "type": "boolean"},
+    {"name": "note", "type": ["null", "string"], "default": null},
+    {"name": "raw", "type": "bytes"},
+    {"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["NEW", "SHIPPED"]}},
+    {"name": "code", "type": {"type": "fixed", "name": "Code", "size": 2}},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "attrs", "type": {"type": "map", "values": "long"}},
+    {"name": "customer", "type": {"type": "record", "name": "Customer", "fields": [{"name": "name", "type": "string"}]}},
+    {"name": "previous", "type": ["null", "Customer"], "default": null},
+    {"name": "day", "type": {"type": "int", "logicalType": "date"}},
+    {"name": "at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "at_micros", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+    {"name": "time", "type": {"type": "int", "logicalType": "time-millis"}},
+    {"name": "amount", "type": {"type": "bytes", "logicalType": "decimal", "precision": 9, "scale": 2}},
+    {"name": "total", "type": {"type": "fixed", "name": "Total", "size": 4, "logicalType": "decimal", "precision": 9, "scale": 2}},
+    {"name": "region", "type": "string", "default": "eu"}
+  ]
+}`
+
+func TestAvroOCFRoundTrip(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	records := []map[string]interface{}{
+		{
+			"id": 1, "qty": json.Number("2"), "weight": 1.5, "price": json.Number("9.99"), "paid": true,
+			"note": "gift", "raw": []byte{0, 1}, "status": "SHIPPED", "code": "AB",
+			"tags": []interface{}{"a", "b"}, "attrs": map[string]interface{}{"k": 3},
+			"customer": map[string]interface{}{"name": "c"}, "previous": map[string]interface{}{"name": "p"},
+			"day": "2024-01-02", "at": at, "at_micros": "2024-01-02 03:04:05", "time": 90 * time.Second,
+			"amount": json.Number("-12.34"), "total": "5",
+		},
+		{
+			"id": int64(-2), "qty": 0, "weight": float32(0), "price": 0, "paid": false,
+			"raw": "", "status": "NEW", "code": []byte("CD"), "tags": []string{}, "attrs": map[string]interface{}{},
+			"customer": map[string]interface{}{"name": ""}, "previous": nil,
+			"day": time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), "at": 0, "at_micros": 0, "time": time.Duration(0),
+			"amount": 0, "total": -0.01, "region": "us",
+		},
+	}
+	want := []map[string]interface{}{
+		{
+			"id": int64(1), "qty": int32(2), "weight": float32(1.5), "price": 9.99, "paid": true,
+			"note": "gift", "raw": []byte{0, 1}, "status": "SHIPPED", "code": []byte("AB"),
+			"tags": []interface{}{"a", "b"}, "attrs": map[string]interface{}{"k": int64(3)},
+			"customer": map[string]interface{}{"name": "c"}, "previous": map[string]interface{}{"name": "p"},
+			"day": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), "at": at, "at_micros": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			"time": 90 * time.Second, "amount": json.Number("-12.34"), "total": json.Number("5.00"), "region": "eu",
+		},
+		{
+			"id": int64(-2), "qty": int32(0), "weight": float32(0), "price": float64(0), "paid": false,
+			"note": nil, "raw": []byte{}, "status": "NEW", "code": []byte("CD"), "tags": []interface{}{}, "attrs": map[string]interface{}{},
+			"customer": map[string]interface{}{"name": ""}, "previous": nil,
+			"day": time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), "at": time.Unix(0, 0).UTC(), "at_micros": time.Unix(0, 0).UTC(),
+			"time": time.Duration(0), "amount": json.Number("0.00"), "total": json.Number("-0.01"), "region": "us",
+		},
+	}
+	for _, codec := range []AvroCodec{AvroNull, AvroDeflate, AvroSnappy} {
+		t.Run(string(codec), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewAvroOCFWriter(&buf, []byte(avroTestSchema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Codec = codec
+			for _, r := range records {
+				if err := w.WriteBlock([]map[string]interface{}{r}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, got := readAvroOCF(t, buf.Bytes())
+			if string(r.Schema()) != avroTestSchema {
+				t.Errorf("Schema = %s", r.Schema())
+			}
+			if len(got) != len(want) {
+				t.Fatalf("read %d records, want %d", len(got), len(want))
+			}
+			for i := range want {
+				for k, v := range want[i] {
+					if !reflect.DeepEqual(got[i][k], v) {
+						t.Errorf("record %d %v = %#v, want %#v", i, k, got[i][k], v)
+					}
+				}
+			}
+		})
+	}
+}
+
+// readAvroOCF reads an object container file a few bytes at a time, as it
+// would arrive.
+func readAvroOCF(t *testing.T, data []byte) (*AvroOCFReader, []map[string]interface{}) {
+	t.Helper()
+	r := NewAvroOCFReader()
+	var got []map[string]interface{}
+	var pending []byte
+	for i := 0; i < len(data); i += 7 {
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		pending = append(pending, data[i:end]...)
+		records, n, err := r.ReadRecords(pending, end == len(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, records...)
+		pending = pending[n:]
+	}
+	if len(pending) != 0 {
+		t.Errorf("%d bytes left unread", len(pending))
+	}
+	return r, got
+}
+
+// TestAvroOCFReaderFixtures reads files written by another implementation
+// (see testdata/avrogen), so that the reader is not only checked against
+// AvroOCFWriter.
+func TestAvroOCFReaderFixtures(t *testing.T) {
+	want := []map[string]interface{}{
+		{
+			"id": int64(1), "status": "SHIPPED", "note": "gift", "total": 12.5, "ratio": float32(0.5),
+			"qty": int32(2), "paid": true, "placed": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "due": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			"price": json.Number("12.50"), "tags": []interface{}{"a", "b"}, "attrs": map[string]interface{}{"weight": int64(3)}, "code": []byte("AB"),
+		},
+		{
+			"id": int64(-2), "status": "NEW", "note": nil, "total": -0.25, "ratio": float32(-1),
+			"qty": int32(0), "paid": false, "placed": time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC), "due": time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC),
+			"price": json.Number("-0.05"), "tags": []interface{}{}, "attrs": map[string]interface{}{}, "code": []byte{0, 255},
+		},
+	}
+	for _, codec := range []AvroCodec{AvroNull, AvroDeflate, AvroSnappy} {
+		t.Run(string(codec), func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", "orders."+string(codec)+".avro"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, got := readAvroOCF(t, data)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("read %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestAvroOCFWriterErrors(t *testing.T) {
+	const schema = `{"type": "record", "name": "R", "fields": [
+		{"name": "n", "type": "int"},
+		{"name": "e", "type": {"type": "enum", "name": "E", "symbols": ["A"]}, "default": "A"},
+		{"name": "f", "type": {"type": "fixed", "name": "F", "size": 1}, "default": "x"}
+	]}`
+	tests := []struct {
+		name    string
+		schema  string
+		record  map[string]interface{}
+		wantErr string
+	}{
+		{name: "not a record", schema: `"string"`, wantErr: "avro: the schema is a string, not a record"},
+		{name: "invalid schema", schema: `{"type": "record", "name": "R", "fields": [{"name": "x", "type": "Unknown"}]}`, wantErr: `avro: field "x": avro: unknown type "Unknown"`},
+		{name: "wrong type", schema: schema, record: map[string]interface{}{"n": "x"}, wantErr: `avro: record 1: field "n": cannot write string as int`},
+		{name: "out of range", schema: schema, record: map[string]interface{}{"n": 1 << 40}, wantErr: `avro: record 1: field "n": 1099511627776 is out of range for int`},
+		{name: "missing field", schema: schema, record: map[string]interface{}{}, wantErr: `avro: record 1: field "n": cannot write <nil> as int`},
+		{name: "unknown symbol", schema: schema, record: map[string]interface{}{"n": 1, "e": "B"}, wantErr: `avro: record 1: field "e": "B" is not a symbol of enum E`},
+		{name: "wrong fixed size", schema: schema, record: map[string]interface{}{"n": 1, "f": "xy"}, wantErr: `avro: record 1: field "f": fixed F must be 1 bytes, got 2`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewAvroOCFWriter(&bytes.Buffer{}, []byte(tt.schema))
+			if err == nil {
+				err = w.WriteBlock([]map[string]interface{}{tt.record})
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAvroOCFReaderErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewAvroOCFWriter(&buf, []byte(`{"type": "record", "name": "R", "fields": [{"name": "s", "type": "string"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteBlock([]map[string]interface{}{{"s": "abc"}}); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	badSync := append([]byte(nil), file...)
+	badSync[len(badSync)-1] ^= 0xff
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "not Avro", data: []byte("PAR1 not avro"), wantErr: ErrAvroFile.Error()},
+		{name: "truncated", data: file[:len(file)-3], wantErr: errAvroData.Error()},
+		{name: "invalid sync marker", data: badSync, wantErr: "avro: invalid sync marker"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := NewAvroOCFReader().ReadRecords(tt.data, true)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Incomplete data is not an error until the end of the file.
+	records, n, err := NewAvroOCFReader().ReadRecords(file[:len(file)-3], false)
+	if err != nil || len(records) != 0 || n == 0 || n >= len(file) {
+		t.Errorf("ReadRecords of incomplete data = %v, %d, %v", records, n, err)
+	}
+}
+
+func TestParseAvroCodec(t *testing.T) {
+	for name, want := range map[string]AvroCodec{"none": AvroNull, "NULL": AvroNull, "deflate": AvroDeflate, "Snappy": AvroSnappy} {
+		if c, err := ParseAvroCodec(name); err != nil || c != want {
+			t.Errorf("ParseAvroCodec(%q) = %v, %v", name, c, err)
+		}
+	}
+	if _, err := ParseAvroCodec("zstd"); err == nil || !strings.Contains(err.Error(), "unknown codec") {
+		t.Errorf("ParseAvroCodec(zstd) error = %v", err)
+	}
+}
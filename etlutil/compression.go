@@ -0,0 +1,317 @@
+package etlutil
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Codec is a compression format that readers and writers can use, such as
+// "gzip". The built-in codecs are gzip, zstd, bzip2, xz, snappy (in its
+// framed format) and zip, and more can be added with RegisterCodec.
+//
+// Stream formats have NewReader, and NewWriter if they can be written. An
+// archive holding several files, such as zip, has Entries instead, and
+// each of its files is read as a separate stream.
+type Codec struct {
+	Name      string
+	Extension string // the file extension, such as ".gz"
+	Magic     []byte // the bytes a compressed stream starts with, if any
+
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+	// NewWriter compresses what is written to w at the given level, where 0
+	// is the codec's default. Closing the writer does not close w.
+	NewWriter func(w io.Writer, level int) (io.WriteCloser, error)
+	// Entries calls fn with the name and contents of each file of the
+	// archive.
+	Entries func(r io.ReaderAt, size int64, fn func(name string, r io.Reader) error) error
+}
+
+// The names of the built-in codecs.
+const (
+	CodecGzip   = "gzip"
+	CodecZstd   = "zstd"
+	CodecBzip2  = "bzip2"
+	CodecXz     = "xz"
+	CodecSnappy = "snappy"
+	CodecZip    = "zip"
+)
+
+// CompressionAuto can be given to readers instead of a codec name to detect
+// the codec of each stream, from its file extension or its first bytes.
+const CompressionAuto = "auto"
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]*Codec)
+)
+
+// RegisterCodec makes a codec available by its name, replacing any codec
+// registered with the same name.
+func RegisterCodec(c *Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name] = c
+}
+
+// LookupCodec returns the codec with the given name. The empty name and
+// "none" are no codec, for which it returns nil.
+func LookupCodec(name string) (*Codec, error) {
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if c, ok := codecs[strings.ToLower(name)]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown compression codec %q", name)
+}
+
+// CodecNames returns the names of the registered codecs, sorted.
+func CodecNames() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	var names []string
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CodecForFile returns the codec of a file name's extension, or nil.
+func CodecForFile(name string) *Codec {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return nil
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for _, c := range codecs {
+		if c.Extension == ext {
+			return c
+		}
+	}
+	return nil
+}
+
+// DetectCodec returns the codec whose magic bytes the buffered stream
+// starts with, or nil, without consuming anything.
+func DetectCodec(r *bufio.Reader) (*Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	var found *Codec
+	for _, c := range codecs {
+		if len(c.Magic) == 0 || (found != nil && len(found.Magic) >= len(c.Magic)) {
+			continue
+		}
+		head, err := r.Peek(len(c.Magic))
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		if bytes.Equal(head, c.Magic) {
+			found = c
+		}
+	}
+	return found, nil
+}
+
+// ForEachStream calls fn with each stream read from r once decompressed
+// with the named codec: once for a stream format, or once per file for an
+// archive, with the file's name (which is empty otherwise). With no codec,
+// fn is called with r itself.
+//
+// The codec can also be CompressionAuto, in which case it is detected from
+// the extension of fileName if it has a known one, or else from the first
+// bytes of r, and streams that are not compressed are read as they are.
+// Archives are written to a temporary file before their files are read.
+func ForEachStream(r io.Reader, codec, fileName string, fn func(name string, r io.Reader) error) error {
+	var c *Codec
+	if codec == CompressionAuto {
+		if c = CodecForFile(fileName); c == nil {
+			br := bufio.NewReader(r)
+			var err error
+			if c, err = DetectCodec(br); err != nil {
+				return err
+			}
+			r = br
+		}
+	} else {
+		var err error
+		if c, err = LookupCodec(codec); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case c == nil:
+		return fn("", r)
+	case c.Entries != nil:
+		return forEachEntry(c, r, fn)
+	case c.NewReader == nil:
+		return fmt.Errorf("%v cannot be read", c.Name)
+	}
+	dr, err := c.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("%v: %v", c.Name, err)
+	}
+	defer dr.Close()
+	return fn("", dr)
+}
+
+func forEachEntry(c *Codec, r io.Reader, fn func(name string, r io.Reader) error) error {
+	f, err := ioutil.TempFile("", "goetl-"+c.Name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size, err := io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	return c.Entries(f, size, fn)
+}
+
+// NewCompressWriter returns a writer compressing what is written to it to
+// w with the named codec, at the given level (0 being the codec's default).
+// Closing it flushes the compressed stream, but does not close w. With no
+// codec, what is written goes to w as it is.
+func NewCompressWriter(w io.Writer, codec string, level int) (io.WriteCloser, error) {
+	c, err := LookupCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nopWriteCloser{w}, nil
+	}
+	if c.NewWriter == nil {
+		return nil, fmt.Errorf("%v cannot be written", c.Name)
+	}
+	cw, err := c.NewWriter(w, level)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", c.Name, err)
+	}
+	return cw, nil
+}
+
+// CompressedName returns the name of a file once compressed with the
+// named codec, such as "orders.json.gz".
+func CompressedName(name, codec string) string {
+	c, err := LookupCodec(codec)
+	if err != nil || c == nil {
+		return name
+	}
+	return name + c.Extension
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func init() {
+	RegisterCodec(&Codec{
+		Name:      CodecGzip,
+		Extension: ".gz",
+		Magic:     []byte{0x1f, 0x8b},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			return gzip.NewWriterLevel(w, level)
+		},
+	})
+	RegisterCodec(&Codec{
+		Name:      CodecZstd,
+		Extension: ".zst",
+		Magic:     []byte{0x28, 0xb5, 0x2f, 0xfd},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+		NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				return zstd.NewWriter(w)
+			}
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		},
+	})
+	// The standard library can only read bzip2.
+	RegisterCodec(&Codec{
+		Name:      CodecBzip2,
+		Extension: ".bz2",
+		Magic:     []byte("BZh"),
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return ioutil.NopCloser(bzip2.NewReader(r)), nil },
+	})
+	RegisterCodec(&Codec{
+		Name:      CodecXz,
+		Extension: ".xz",
+		Magic:     []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			xr, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(xr), nil
+		},
+		// xz has no levels, only dictionary sizes, so the level is ignored.
+		NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) { return xz.NewWriter(w) },
+	})
+	RegisterCodec(&Codec{
+		Name:      CodecSnappy,
+		Extension: ".sz",
+		Magic:     []byte("\xff\x06\x00\x00sNaPpY"),
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return ioutil.NopCloser(snappy.NewReader(r)), nil },
+		NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) { return snappy.NewBufferedWriter(w), nil },
+	})
+	RegisterCodec(&Codec{
+		Name:      CodecZip,
+		Extension: ".zip",
+		Magic:     []byte("PK\x03\x04"),
+		Entries:   zipEntries,
+	})
+}
+
+// zipEntries reads the files of a zip archive, skipping its directories.
+func zipEntries(r io.ReaderAt, size int64, fn func(name string, r io.Reader) error) error {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("zip: %v", err)
+	}
+	for _, f := range z.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("zip: %v: %v", f.Name, err)
+		}
+		err = fn(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
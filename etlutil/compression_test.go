@@ -0,0 +1,146 @@
+package etlutil_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teambenny/goetl/etlutil"
+	"github.com/teambenny/goetl/etlutil/etlutiltest"
+)
+
+// bzip2Data is "a\nb\n" compressed with bzip2, which cannot be written.
+var bzip2Data = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x3c, 0x85,
+	0x41, 0x12, 0x00, 0x00, 0x01, 0x41, 0x00, 0x00, 0x10, 0x30, 0x00, 0x20,
+	0x00, 0x30, 0xcc, 0x0c, 0x7a, 0x82, 0x71, 0x77, 0x24, 0x53, 0x85, 0x09,
+	0x03, 0xc8, 0x54, 0x11, 0x20,
+}
+
+// readStreams returns the name and contents of each stream ForEachStream
+// reads, as "name: contents".
+func readStreams(data []byte, codec, fileName string) ([]string, error) {
+	var got []string
+	err := etlutil.ForEachStream(bytes.NewReader(data), codec, fileName, func(name string, r io.Reader) error {
+		b, err := ioutil.ReadAll(r)
+		got = append(got, name+": "+string(b))
+		return err
+	})
+	return got, err
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	data := strings.Repeat("a,b,c\n", 1000)
+	tests := []struct {
+		codec string
+		level int
+	}{
+		{codec: ""},
+		{codec: "none"},
+		{codec: etlutil.CodecGzip},
+		{codec: etlutil.CodecGzip, level: 9},
+		{codec: etlutil.CodecZstd},
+		{codec: etlutil.CodecZstd, level: 19},
+		{codec: "XZ"},
+		{codec: etlutil.CodecSnappy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.codec, func(t *testing.T) {
+			compressed := etlutiltest.Compress(t, tt.codec, tt.level, data)
+			c, _ := etlutil.LookupCodec(tt.codec)
+			if c != nil && len(compressed) >= len(data) {
+				t.Errorf("%d bytes compressed to %d", len(data), len(compressed))
+			}
+			for _, codec := range []string{tt.codec, etlutil.CompressionAuto} {
+				got, err := readStreams(compressed, codec, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, []string{": " + data}) {
+					t.Errorf("%q read %d streams", codec, len(got))
+				}
+			}
+		})
+	}
+}
+
+func TestForEachStream(t *testing.T) {
+	archive := etlutiltest.ZipArchive(t, "a.csv", "1\n", "dir/b.json", "{}")
+	gzipped := etlutiltest.Compress(t, etlutil.CodecGzip, 0, "a\nb\n")
+	tests := []struct {
+		name     string
+		data     []byte
+		codec    string
+		fileName string
+		want     []string
+		wantErr  string
+	}{
+		{name: "bzip2", data: bzip2Data, codec: etlutil.CodecBzip2, want: []string{": a\nb\n"}},
+		{name: "bzip2 detected", data: bzip2Data, codec: etlutil.CompressionAuto, want: []string{": a\nb\n"}},
+		{name: "zip", data: archive, codec: etlutil.CodecZip, want: []string{"a.csv: 1\n", "dir/b.json: {}"}},
+		{name: "zip detected", data: archive, codec: etlutil.CompressionAuto, want: []string{"a.csv: 1\n", "dir/b.json: {}"}},
+		{name: "extension", data: gzipped, codec: etlutil.CompressionAuto, fileName: "in/orders.CSV.GZ", want: []string{": a\nb\n"}},
+		{name: "not compressed", data: []byte("a\nb\n"), codec: etlutil.CompressionAuto, fileName: "orders.csv", want: []string{": a\nb\n"}},
+		{name: "short", data: []byte("a"), codec: etlutil.CompressionAuto, want: []string{": a"}},
+		{name: "empty", codec: etlutil.CompressionAuto, want: []string{": "}},
+		{name: "unknown codec", data: gzipped, codec: "lz4", wantErr: `unknown compression codec "lz4"`},
+		{name: "wrong extension", data: []byte("a\n"), codec: etlutil.CompressionAuto, fileName: "a.gz", wantErr: "gzip: unexpected EOF"},
+		{name: "not a zip", data: gzipped, codec: etlutil.CodecZip, wantErr: "zip: zip: not a valid zip file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readStreams(tt.data, tt.codec, tt.fileName)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("streams = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	want := []string{etlutil.CodecBzip2, etlutil.CodecGzip, etlutil.CodecSnappy, etlutil.CodecXz, etlutil.CodecZip, etlutil.CodecZstd}
+	if got := etlutil.CodecNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("CodecNames = %v, want %v", got, want)
+	}
+	for name, codec := range map[string]string{"a.zst": etlutil.CodecZstd, "a.tar.xz": etlutil.CodecXz, "a.SZ": etlutil.CodecSnappy, "a.csv": "", "gz": ""} {
+		c := etlutil.CodecForFile(name)
+		if (c == nil && codec != "") || (c != nil && c.Name != codec) {
+			t.Errorf("CodecForFile(%q) = %v, want %q", name, c, codec)
+		}
+	}
+	for codec, want := range map[string]string{etlutil.CodecGzip: "a.json.gz", etlutil.CodecZip: "a.json.zip", "": "a.json", "lz4": "a.json"} {
+		if got := etlutil.CompressedName("a.json", codec); got != want {
+			t.Errorf("CompressedName(%q) = %v, want %v", codec, got, want)
+		}
+	}
+
+	br := bufio.NewReader(bytes.NewReader(bzip2Data))
+	if c, err := etlutil.DetectCodec(br); err != nil || c == nil || c.Name != etlutil.CodecBzip2 {
+		t.Errorf("DetectCodec = %v, %v", c, err)
+	}
+	if b, _ := ioutil.ReadAll(br); !bytes.Equal(b, bzip2Data) {
+		t.Error("DetectCodec consumed the stream")
+	}
+
+	for _, codec := range []string{etlutil.CodecBzip2, etlutil.CodecZip} {
+		if _, err := etlutil.NewCompressWriter(ioutil.Discard, codec, 0); err == nil || err.Error() != codec+" cannot be written" {
+			t.Errorf("NewCompressWriter(%q) error = %v", codec, err)
+		}
+	}
+	if _, err := etlutil.NewCompressWriter(ioutil.Discard, etlutil.CodecGzip, 10); err == nil || !strings.HasPrefix(err.Error(), "gzip: ") {
+		t.Errorf("NewCompressWriter at an invalid level error = %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package etlutil
+
+import (
+	"context"
+	"io"
+)
+
+// ContextReader wraps an io.Reader and stops reading once the given context
+// is done. It is useful for making blocking reads from remote files abort
+// between calls to Read.
+//
+// Once the context is done, Read reports io.EOF so that consumers such as
+// bufio.Scanner simply stop. Callers should check ctx.Err() afterwards to
+// tell a cancelled read apart from a complete one.
+type ContextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// NewContextReader returns a new ContextReader wrapping the given io.Reader.
+func NewContextReader(ctx context.Context, reader io.Reader) *ContextReader {
+	return &ContextReader{ctx: ctx, reader: reader}
+}
+
+// Read implements io.Reader.
+func (r *ContextReader) Read(p []byte) (int, error) {
+	if r.ctx.Err() != nil {
+		return 0, io.EOF
+	}
+	return r.reader.Read(p)
+}
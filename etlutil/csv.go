@@ -5,16 +5,20 @@ import (
 	"bytes"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/teambenny/goetl/etldata"
 )
 
 // CSVString returns an empty string for nil values to make sure that the
-// text "null" is not written to a file
+// text "null" is not written to a file. Times are written the way they are
+// encoded in JSON, so etldata.Records give the same output as etldata.JSON.
 func CSVString(v interface{}) string {
-	switch v.(type) {
+	switch vv := v.(type) {
 	case nil:
 		return ""
+	case time.Time:
+		return vv.Format(time.RFC3339Nano)
 	default:
 		return fmt.Sprintf("%v", v)
 	}
@@ -0,0 +1,147 @@
+package etlutil
+
+import (
+	"bytes"
+	"errors"
+	"unicode/utf8"
+)
+
+// CSVReader reimplements the parsing of the standard library csv.Reader
+// adding Quote and QuoteEscape, so that it can read what CSVWriter writes.
+// Data is parsed as it arrives with ReadRecords, so that a record can be
+// split across several reads.
+type CSVReader struct {
+	Comma       rune
+	Quote       rune   // the character used to encapsulate fields
+	QuoteEscape string // String used to escape a quote character within a quoted field
+}
+
+// NewCSVReader instantiates a new instance of CSVReader, reading quotes
+// escaped by doubling them, as in RFC 4180. Set QuoteEscape to `\` to read
+// CSVWriter's default output.
+func NewCSVReader() *CSVReader {
+	return &CSVReader{
+		Comma:       ',',
+		Quote:       '"',
+		QuoteEscape: `"`,
+	}
+}
+
+// ErrCSVQuote is returned by ReadRecords for a quoted field that is not
+// terminated, or that is followed by something other than a Comma or the
+// end of the line.
+var ErrCSVQuote = errors.New("csv: badly quoted field")
+
+// ReadRecords parses the complete records at the start of data, returning
+// them along with the number of bytes of data they take up. Unless atEOF is
+// true, a record that is not yet followed by a newline is left unparsed, to
+// be read again once more data has arrived. Empty lines are skipped, and
+// quoted fields can contain newlines.
+func (r *CSVReader) ReadRecords(data []byte, atEOF bool) (records [][]string, n int, err error) {
+	for n < len(data) {
+		record, size, err := r.readRecord(data[n:], atEOF)
+		if err != nil {
+			return records, n, err
+		}
+		if size == 0 {
+			break // incomplete
+		}
+		n += size
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+	return records, n, nil
+}
+
+// readRecord parses a single record, returning a nil record for an empty
+// line, and a size of 0 if the record is incomplete.
+func (r *CSVReader) readRecord(data []byte, atEOF bool) ([]string, int, error) {
+	quote := string(r.Quote)
+	escapedQuote := r.QuoteEscape + quote
+	var record []string
+	var field bytes.Buffer
+	i := 0
+
+	if data[0] == '\n' {
+		return nil, 1, nil
+	}
+	if data[0] == '\r' && len(data) > 1 && data[1] == '\n' {
+		return nil, 2, nil
+	}
+
+	for {
+		field.Reset()
+		if c, size := utf8.DecodeRune(data[i:]); i < len(data) && c == r.Quote {
+			i += size
+			for {
+				if i >= len(data) {
+					if atEOF {
+						return nil, 0, ErrCSVQuote
+					}
+					return nil, 0, nil
+				}
+				if r.QuoteEscape != quote && bytes.HasPrefix(data[i:], []byte(escapedQuote)) {
+					field.WriteString(quote)
+					i += len(escapedQuote)
+					continue
+				}
+				c, size := utf8.DecodeRune(data[i:])
+				if c != r.Quote {
+					field.WriteRune(c)
+					i += size
+					continue
+				}
+				// A doubled quote cannot be told from a closing quote
+				// until the next character is known.
+				if r.QuoteEscape == quote && i+size >= len(data) && !atEOF {
+					return nil, 0, nil
+				}
+				if r.QuoteEscape == quote && bytes.HasPrefix(data[i+size:], []byte(quote)) {
+					field.WriteString(quote)
+					i += 2 * size
+					continue
+				}
+				i += size
+				break
+			}
+		} else {
+			for i < len(data) {
+				c, size := utf8.DecodeRune(data[i:])
+				if c == r.Comma || c == '\n' {
+					break
+				}
+				field.WriteRune(c)
+				i += size
+			}
+			if i >= len(data) && !atEOF {
+				return nil, 0, nil
+			}
+		}
+
+		s := field.String()
+		record = append(record, s)
+		if i >= len(data) {
+			if len(s) > 0 && s[len(s)-1] == '\r' {
+				record[len(record)-1] = s[:len(s)-1]
+			}
+			return record, i, nil
+		}
+		c, size := utf8.DecodeRune(data[i:])
+		switch {
+		case c == r.Comma:
+			i += size
+		case c == '\n':
+			if len(s) > 0 && s[len(s)-1] == '\r' {
+				record[len(record)-1] = s[:len(s)-1]
+			}
+			return record, i + size, nil
+		case c == '\r' && i+1 < len(data) && data[i+1] == '\n':
+			return record, i + 2, nil
+		case c == '\r' && i+1 >= len(data) && !atEOF:
+			return nil, 0, nil
+		default:
+			return nil, 0, ErrCSVQuote
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package etlutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCSVReaderReadRecords(t *testing.T) {
+	tests := []struct {
+		name        string
+		quoteEscape string
+		data        string
+		atEOF       bool
+		want        [][]string
+		wantN       int
+		wantErr     error
+	}{
+		{name: "complete records", data: "a,b\n\n1,2\r\n", want: [][]string{{"a", "b"}, {"1", "2"}}, wantN: 10},
+		{name: "incomplete record", data: "a,b\n1,", want: [][]string{{"a", "b"}}, wantN: 4},
+		{name: "incomplete record at EOF", data: "a,b\n1,", atEOF: true, want: [][]string{{"a", "b"}, {"1", ""}}, wantN: 6},
+		{name: "quoted newline", data: "\"a\nb\",c\n", want: [][]string{{"a\nb", "c"}}, wantN: 8},
+		{name: "doubled quote", data: `"a""b"` + "\n", want: [][]string{{`a"b`}}, wantN: 7},
+		{name: "quote that may be doubled", data: `"a"`, wantN: 0},
+		{name: "backslash escape", quoteEscape: `\`, data: `"a\"b",c` + "\n", want: [][]string{{`a"b`, "c"}}, wantN: 9},
+		{name: "unterminated quote", data: `"a`, atEOF: true, wantErr: ErrCSVQuote},
+		{name: "data after a quote", data: "\"a\"b\n", wantErr: ErrCSVQuote},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewCSVReader()
+			if tt.quoteEscape != "" {
+				r.QuoteEscape = tt.quoteEscape
+			}
+			records, n, err := r.ReadRecords([]byte(tt.data), tt.atEOF)
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(records, tt.want) || n != tt.wantN {
+				t.Errorf("ReadRecords = %q, %d, want %q, %d", records, n, tt.want, tt.wantN)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package etlutil
+
+import "github.com/teambenny/goetl/etldata"
+
+// CallDetached calls foo with an outputChan that nothing downstream is
+// reading from, discarding anything sent on it. It is used to call a
+// Processor that is not part of the Pipeline's stages, such as a
+// dead-letter Processor, from within another Processor.
+func CallDetached(foo func(outputChan chan etldata.Payload)) {
+	outputChan := make(chan etldata.Payload)
+	drained := make(chan bool)
+	go func() {
+		for range outputChan {
+		}
+		close(drained)
+	}()
+	foo(outputChan)
+	close(outputChan)
+	<-drained
+}
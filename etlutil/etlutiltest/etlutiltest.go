@@ -0,0 +1,73 @@
+// Package etlutiltest provides fixtures for testing code that uses etlutil.
+package etlutiltest
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// FixedWidthLayout returns a layout of header, order and trailer records:
+//
+//	H20240102         header: date
+//	D0001café  0012C  order: id, name (trimmed), amount (zoned, 2 decimals)
+//	T002              trailer: count of the orders since the last trailer
+func FixedWidthLayout() *etlutil.FixedWidthLayout {
+	return &etlutil.FixedWidthLayout{
+		TypeStart: 1, TypeLength: 1,
+		Records: []etlutil.FixedWidthRecord{
+			{Type: "header", Code: "H", Role: etlutil.FixedWidthHeader, Fields: []etlutil.FixedWidthField{{Name: "date", Start: 2, Length: 8, Type: etlutil.FixedWidthDate}}},
+			{Type: "order", Code: "D", Fields: []etlutil.FixedWidthField{
+				{Name: "id", Start: 2, Length: 4, Type: etlutil.FixedWidthInteger},
+				{Name: "name", Start: 6, Length: 6, Trim: true},
+				{Name: "amount", Start: 12, Length: 5, Type: etlutil.FixedWidthZoned, Decimals: 2},
+			}},
+			{Type: "trailer", Code: "T", Role: etlutil.FixedWidthTrailer, CountField: "count", Fields: []etlutil.FixedWidthField{{Name: "count", Start: 2, Length: 3, Type: etlutil.FixedWidthInteger}}},
+		},
+	}
+}
+
+// Compress returns data compressed with the given codec and level, failing
+// the test if it cannot be.
+func Compress(t testing.TB, codec string, level int, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := etlutil.NewCompressWriter(&buf, codec, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// ZipArchive returns a zip archive of the given files, given as pairs of
+// name and contents, after an entry for the directory "dir/".
+func ZipArchive(t testing.TB, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if _, err := zw.Create("dir/"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(files); i += 2 {
+		f, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, files[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,477 @@
+package etlutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FixedWidthType is the type of a FixedWidthField.
+type FixedWidthType string
+
+// The types of the fields of a fixed-width record. Integer and decimal
+// fields may have a leading or trailing sign, and zoned fields are COBOL
+// signed zoned decimals (PIC S9 DISPLAY), whose last digit carries the
+// sign as an overpunched character.
+const (
+	FixedWidthString  FixedWidthType = "string"
+	FixedWidthInteger FixedWidthType = "integer"
+	FixedWidthDecimal FixedWidthType = "decimal"
+	FixedWidthZoned   FixedWidthType = "zoned"
+	FixedWidthDate    FixedWidthType = "date"
+)
+
+// FixedWidthField is a field of a fixed-width record.
+type FixedWidthField struct {
+	Name     string         `json:"name"`
+	Start    int            `json:"start"` // the position of the first character of the field, counting from 1
+	Length   int            `json:"length"`
+	Type     FixedWidthType `json:"type"`     // defaults to FixedWidthString
+	Trim     bool           `json:"trim"`     // trim the spaces around strings, which are otherwise kept
+	Decimals int            `json:"decimals"` // the implied decimal places of decimal and zoned fields
+	Format   string         `json:"format"`   // the time layout of date fields, defaults to "20060102"
+}
+
+// FixedWidthRole is the role of a kind of record in a file.
+type FixedWidthRole string
+
+// The roles of FixedWidthRecords. The detail records are the data, which
+// header and trailer records surround.
+const (
+	FixedWidthDetail  FixedWidthRole = "detail"
+	FixedWidthHeader  FixedWidthRole = "header"
+	FixedWidthTrailer FixedWidthRole = "trailer"
+)
+
+// FixedWidthRecord is a kind of record in a file that mixes several, told
+// apart by the code at the position of the layout's discriminator.
+//
+// A trailer record can give the number of detail records it closes in its
+// CountField, which a FixedWidthCounter checks.
+type FixedWidthRecord struct {
+	Type       string            `json:"type"` // the name of the kind of record
+	Code       string            `json:"code"`
+	Role       FixedWidthRole    `json:"role"` // defaults to FixedWidthDetail
+	CountField string            `json:"count_field"`
+	Fields     []FixedWidthField `json:"fields"`
+}
+
+// FixedWidthLayout describes the lines of a fixed-width file. Files with a
+// single kind of record only need Fields. For files that mix several kinds,
+// such as header, detail and trailer lines, TypeStart and TypeLength give
+// the position of the code that identifies the kind of each line, and
+// Records the kinds.
+//
+// Positions and lengths count characters, rather than bytes.
+type FixedWidthLayout struct {
+	Fields     []FixedWidthField  `json:"fields"`
+	TypeStart  int                `json:"type_start"`
+	TypeLength int                `json:"type_length"`
+	Records    []FixedWidthRecord `json:"records"`
+}
+
+// Check returns an error if the layout is not valid, such as when a field
+// has an unknown type, or two kinds of records have the same code.
+func (l *FixedWidthLayout) Check() error {
+	if len(l.Records) == 0 {
+		return checkFixedWidthFields(l.Fields)
+	}
+	if len(l.Fields) > 0 {
+		return errors.New("fixed width: only one of fields or records can be given")
+	}
+	if l.TypeStart < 1 || l.TypeLength < 1 {
+		return errors.New("fixed width: the position of the record type is required")
+	}
+	codes := make(map[string]bool)
+	types := make(map[string]bool)
+	for _, r := range l.Records {
+		switch {
+		case r.Type == "":
+			return errors.New("fixed width: a record has no type")
+		case types[r.Type]:
+			return fmt.Errorf("fixed width: record type %q is given twice", r.Type)
+		case codes[r.Code]:
+			return fmt.Errorf("fixed width: record code %q is given twice", r.Code)
+		case utf8.RuneCountInString(r.Code) != l.TypeLength:
+			return fmt.Errorf("fixed width: record code %q is not %d characters long", r.Code, l.TypeLength)
+		}
+		switch r.Role {
+		case "", FixedWidthDetail, FixedWidthHeader, FixedWidthTrailer:
+		default:
+			return fmt.Errorf("fixed width: record %q has unknown role %q", r.Type, r.Role)
+		}
+		types[r.Type], codes[r.Code] = true, true
+		if err := checkFixedWidthFields(r.Fields); err != nil {
+			return fmt.Errorf("%v in record %q", err, r.Type)
+		}
+		if r.CountField != "" {
+			found := false
+			for _, f := range r.Fields {
+				found = found || f.Name == r.CountField
+			}
+			if !found || r.Role != FixedWidthTrailer {
+				return fmt.Errorf("fixed width: count field %q must be a field of a trailer record", r.CountField)
+			}
+		}
+	}
+	return nil
+}
+
+func checkFixedWidthFields(fields []FixedWidthField) error {
+	names := make(map[string]bool)
+	for _, f := range fields {
+		switch {
+		case f.Name == "":
+			return errors.New("fixed width: a field has no name")
+		case names[f.Name]:
+			return fmt.Errorf("fixed width: field %q is given twice", f.Name)
+		case f.Start < 1 || f.Length < 1:
+			return fmt.Errorf("fixed width: field %q must have a start and length of at least 1", f.Name)
+		case f.Decimals < 0:
+			return fmt.Errorf("fixed width: field %q has negative decimals", f.Name)
+		}
+		switch f.Type {
+		case "", FixedWidthString, FixedWidthInteger, FixedWidthDecimal, FixedWidthZoned, FixedWidthDate:
+		default:
+			return fmt.Errorf("fixed width: field %q has unknown type %q", f.Name, f.Type)
+		}
+		names[f.Name] = true
+	}
+	return nil
+}
+
+// Record returns the kind of record of the given type, or nil if there is
+// none.
+func (l *FixedWidthLayout) Record(recordType string) *FixedWidthRecord {
+	for i := range l.Records {
+		if l.Records[i].Type == recordType {
+			return &l.Records[i]
+		}
+	}
+	return nil
+}
+
+// Parse parses a line (without its line ending) into an object, returning
+// the kind of record it is, which is nil for layouts with a single kind.
+// Blank numbers and dates are nil, and dates are time.Time. Parts of the
+// line that no field covers are ignored, and fields past the end of a
+// short line are blank.
+func (l *FixedWidthLayout) Parse(line string) (*FixedWidthRecord, map[string]interface{}, error) {
+	var chars []rune
+	if !isASCII(line) {
+		chars = []rune(line)
+	}
+	slice := func(start, length int) string {
+		n := len(line)
+		if chars != nil {
+			n = len(chars)
+		}
+		from, to := start-1, start-1+length
+		if from >= n {
+			return ""
+		}
+		if to > n {
+			to = n
+		}
+		if chars != nil {
+			return string(chars[from:to])
+		}
+		return line[from:to]
+	}
+
+	fields, record := l.Fields, (*FixedWidthRecord)(nil)
+	if len(l.Records) > 0 {
+		code := slice(l.TypeStart, l.TypeLength)
+		for i := range l.Records {
+			if l.Records[i].Code == code {
+				record = &l.Records[i]
+			}
+		}
+		if record == nil {
+			return nil, nil, fmt.Errorf("unknown record code %q", code)
+		}
+		fields = record.Fields
+	}
+
+	o := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		v, err := f.parse(slice(f.Start, f.Length))
+		if err != nil {
+			return record, nil, fmt.Errorf("field %q: %v", f.Name, err)
+		}
+		o[f.Name] = v
+	}
+	return record, o, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func (f FixedWidthField) parse(s string) (interface{}, error) {
+	if f.Type == "" || f.Type == FixedWidthString {
+		if f.Trim {
+			s = strings.Trim(s, " ")
+		}
+		return s, nil
+	}
+	s = strings.Trim(s, " ")
+	if s == "" {
+		return nil, nil
+	}
+	switch f.Type {
+	case FixedWidthDate:
+		if strings.Trim(s, "0") == "" {
+			return nil, nil // COBOL programs often write zeros for no date
+		}
+		t, err := time.Parse(f.timeFormat(), s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", s)
+		}
+		return t, nil
+	case FixedWidthZoned:
+		digits, negative, err := unzone(s)
+		if err != nil {
+			return nil, err
+		}
+		return fixedWidthNumber(digits, negative, f.Decimals), nil
+	}
+
+	negative := false
+	switch {
+	case s[0] == '-' || s[0] == '+':
+		negative, s = s[0] == '-', strings.TrimLeft(s[1:], " ")
+	case s[len(s)-1] == '-' || s[len(s)-1] == '+':
+		negative, s = s[len(s)-1] == '-', strings.TrimRight(s[:len(s)-1], " ")
+	}
+	if f.Type == FixedWidthInteger {
+		if !isDigits(s) {
+			return nil, fmt.Errorf("invalid integer %q", s)
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if negative {
+			n = -n
+		}
+		return n, nil
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		// An explicit decimal point overrides the implied one.
+		if !isDigits(s[:i]+s[i+1:]) || len(s) == 1 {
+			return nil, fmt.Errorf("invalid decimal %q", s)
+		}
+		return fixedWidthNumber(s[:i]+s[i+1:], negative, len(s)-i-1), nil
+	}
+	if !isDigits(s) {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	return fixedWidthNumber(s, negative, f.Decimals), nil
+}
+
+func (f FixedWidthField) timeFormat() string {
+	if f.Format != "" {
+		return f.Format
+	}
+	return "20060102"
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// fixedWidthNumber returns the number with the given digits, of which the
+// last decimals are after the decimal point.
+func fixedWidthNumber(digits string, negative bool, decimals int) json.Number {
+	n, _ := new(big.Int).SetString(digits, 10)
+	if negative {
+		n.Neg(n)
+	}
+	return decimalNumber(n, decimals)
+}
+
+// The overpunched last characters of zoned decimals, for the digits 0 to 9.
+const (
+	zonedPositive = "{ABCDEFGHI"
+	zonedNegative = "}JKLMNOPQR"
+)
+
+// unzone returns the digits of a zoned decimal, and whether it is negative.
+// A plain digit at the end is taken as unsigned.
+func unzone(s string) (string, bool, error) {
+	last := s[len(s)-1]
+	digits, negative := s[:len(s)-1], false
+	switch {
+	case last >= '0' && last <= '9':
+		digits += string(last)
+	case strings.IndexByte(zonedPositive, last) >= 0:
+		digits += strconv.Itoa(strings.IndexByte(zonedPositive, last))
+	case strings.IndexByte(zonedNegative, last) >= 0:
+		digits += strconv.Itoa(strings.IndexByte(zonedNegative, last))
+		negative = true
+	default:
+		return "", false, fmt.Errorf("invalid zoned decimal %q", s)
+	}
+	if !isDigits(digits) {
+		return "", false, fmt.Errorf("invalid zoned decimal %q", s)
+	}
+	return digits, negative, nil
+}
+
+// Format formats an object as a line (without a line ending) of the kind of
+// record with the given type, or of the only kind if the layout has no
+// Records. Strings are padded with spaces on the right, and numbers with
+// zeros on the left, with a leading minus sign unless they are zoned.
+// Values that are nil or missing are left blank, and values too long for
+// their field are an error.
+func (l *FixedWidthLayout) Format(recordType string, o map[string]interface{}) (string, error) {
+	fields := l.Fields
+	var line []rune
+	if len(l.Records) > 0 {
+		record := l.Record(recordType)
+		if record == nil {
+			return "", fmt.Errorf("unknown record type %q", recordType)
+		}
+		fields = record.Fields
+		line = putFixedWidth(line, l.TypeStart, []rune(record.Code))
+	}
+	for _, f := range fields {
+		s, err := f.format(o[f.Name])
+		if err != nil {
+			return "", fmt.Errorf("field %q: %v", f.Name, err)
+		}
+		chars := []rune(s)
+		if len(chars) > f.Length {
+			return "", fmt.Errorf("field %q: %q is longer than %d characters", f.Name, s, f.Length)
+		}
+		for len(chars) < f.Length {
+			chars = append(chars, ' ')
+		}
+		line = putFixedWidth(line, f.Start, chars)
+	}
+	return string(line), nil
+}
+
+// putFixedWidth copies chars into line at the given position, growing it
+// with spaces if need be.
+func putFixedWidth(line []rune, start int, chars []rune) []rune {
+	for len(line) < start-1+len(chars) {
+		line = append(line, ' ')
+	}
+	copy(line[start-1:], chars)
+	return line
+}
+
+func (f FixedWidthField) format(v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	switch f.Type {
+	case "", FixedWidthString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(v), nil
+	case FixedWidthDate:
+		t, ok := toTime(v, f.timeFormat())
+		if !ok {
+			return "", fmt.Errorf("cannot write %T as a date", v)
+		}
+		return t.Format(f.timeFormat()), nil
+	}
+
+	decimals := f.Decimals
+	if f.Type == FixedWidthInteger {
+		decimals = 0
+	}
+	n, ok := avroUnscaled(fixedWidthValue(v), decimals)
+	if !ok {
+		return "", fmt.Errorf("cannot write %v as a number with %d decimals", v, decimals)
+	}
+	digits := new(big.Int).Abs(n).String()
+	if f.Type == FixedWidthZoned {
+		for len(digits) < f.Length {
+			digits = "0" + digits
+		}
+		last := digits[len(digits)-1] - '0'
+		if n.Sign() < 0 {
+			return digits[:len(digits)-1] + string(zonedNegative[last]), nil
+		}
+		return digits[:len(digits)-1] + string(zonedPositive[last]), nil
+	}
+	width := f.Length
+	if n.Sign() < 0 {
+		width--
+	}
+	for len(digits) < width {
+		digits = "0" + digits
+	}
+	if n.Sign() < 0 {
+		digits = "-" + digits
+	}
+	return digits, nil
+}
+
+// fixedWidthValue converts strings and integers to json.Number, so that
+// they are formatted without going through float64.
+func fixedWidthValue(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return json.Number(strings.TrimSpace(s))
+	}
+	if n, ok := toInt64(v); ok {
+		return json.Number(strconv.FormatInt(n, 10))
+	}
+	return v
+}
+
+// FixedWidthCounter checks the counts of trailer records against the
+// number of detail records they close, which are the detail records since
+// the previous trailer (or the start of the file).
+type FixedWidthCounter struct {
+	details int64
+}
+
+// Add counts a parsed record, returning an error if it is a trailer whose
+// count does not match.
+func (c *FixedWidthCounter) Add(record *FixedWidthRecord, o map[string]interface{}) error {
+	if record == nil {
+		return nil
+	}
+	switch record.Role {
+	case "", FixedWidthDetail:
+		c.details++
+	case FixedWidthTrailer:
+		details := c.details
+		c.details = 0
+		if record.CountField == "" {
+			return nil
+		}
+		if o[record.CountField] == nil {
+			return fmt.Errorf("%v has no count", record.Type)
+		}
+		count, ok := toInt64(o[record.CountField])
+		if !ok {
+			return fmt.Errorf("%v count %v is not a whole number", record.Type, o[record.CountField])
+		}
+		if count != details {
+			return fmt.Errorf("%v counts %d detail records, found %d", record.Type, count, details)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package etlutil_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl/etlutil"
+	"github.com/teambenny/goetl/etlutil/etlutiltest"
+)
+
+func TestFixedWidthLayout(t *testing.T) {
+	l := etlutiltest.FixedWidthLayout()
+	if err := l.Check(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		line       string
+		recordType string
+		o          map[string]interface{}
+	}{
+		{line: "H20240102", recordType: "header", o: map[string]interface{}{"date": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}},
+		{line: "D0001café  0012C", recordType: "order", o: map[string]interface{}{"id": int64(1), "name": "café", "amount": json.Number("1.23")}},
+		{line: "D0002      0123}", recordType: "order", o: map[string]interface{}{"id": int64(2), "name": "", "amount": json.Number("-12.30")}},
+		{line: "T002", recordType: "trailer", o: map[string]interface{}{"count": int64(2)}},
+	}
+	var counter etlutil.FixedWidthCounter
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			record, o, err := l.Parse(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.Type != tt.recordType || !reflect.DeepEqual(o, tt.o) {
+				t.Errorf("Parse = %v, %v, want %v, %v", record.Type, o, tt.recordType, tt.o)
+			}
+			if err := counter.Add(record, o); err != nil {
+				t.Error(err)
+			}
+			line, err := l.Format(tt.recordType, o)
+			if err != nil || line != tt.line {
+				t.Errorf("Format = %q, %v, want %q", line, err, tt.line)
+			}
+		})
+	}
+
+	// A short line has blank fields.
+	if _, o, err := l.Parse("D0003"); err != nil || o["name"] != "" || o["amount"] != nil {
+		t.Errorf("Parse of a short line = %v, %v", o, err)
+	}
+	if _, _, err := l.Parse("X"); err == nil || err.Error() != `unknown record code "X"` {
+		t.Errorf("Parse of an unknown code error = %v", err)
+	}
+	if _, err := l.Format("order", map[string]interface{}{"name": "too long"}); err == nil || err.Error() != `field "name": "too long" is longer than 6 characters` {
+		t.Errorf("Format of a long value error = %v", err)
+	}
+	if _, err := l.Format("other", nil); err == nil || err.Error() != `unknown record type "other"` {
+		t.Errorf("Format of an unknown type error = %v", err)
+	}
+}
+
+func TestFixedWidthCounter(t *testing.T) {
+	l := etlutiltest.FixedWidthLayout()
+	tests := []struct {
+		name    string
+		lines   []string
+		wantErr string
+	}{
+		{name: "matching counts", lines: []string{"H20240102", "D0001", "T001", "D0002", "D0003", "T002"}},
+		{name: "too few details", lines: []string{"D0001", "T002"}, wantErr: "trailer counts 2 detail records, found 1"},
+		{name: "count reset by a trailer", lines: []string{"D0001", "T001", "T001"}, wantErr: "trailer counts 1 detail records, found 0"},
+		{name: "blank count", lines: []string{"T   "}, wantErr: "trailer has no count"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var counter etlutil.FixedWidthCounter
+			var err error
+			for _, line := range tt.lines {
+				record, o, perr := l.Parse(line)
+				if perr != nil {
+					t.Fatal(perr)
+				}
+				if err = counter.Add(record, o); err != nil {
+					break
+				}
+			}
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package etlutil
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFixedWidthFieldParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   FixedWidthField
+		s       string
+		want    interface{}
+		wantErr string
+	}{
+		{name: "string", field: FixedWidthField{}, s: " a b ", want: " a b "},
+		{name: "trimmed string", field: FixedWidthField{Trim: true}, s: " a b ", want: "a b"},
+		{name: "integer", field: FixedWidthField{Type: FixedWidthInteger}, s: "  0042", want: int64(42)},
+		{name: "leading sign", field: FixedWidthField{Type: FixedWidthInteger}, s: "- 42", want: int64(-42)},
+		{name: "trailing sign", field: FixedWidthField{Type: FixedWidthInteger}, s: "42-", want: int64(-42)},
+		{name: "blank integer", field: FixedWidthField{Type: FixedWidthInteger}, s: "    ", want: nil},
+		{name: "invalid integer", field: FixedWidthField{Type: FixedWidthInteger}, s: "4 2", wantErr: `invalid integer "4 2"`},
+		{name: "implied decimals", field: FixedWidthField{Type: FixedWidthDecimal, Decimals: 2}, s: "012345", want: json.Number("123.45")},
+		{name: "explicit decimal point", field: FixedWidthField{Type: FixedWidthDecimal, Decimals: 2}, s: "+1.5", want: json.Number("1.5")},
+		{name: "small negative decimal", field: FixedWidthField{Type: FixedWidthDecimal, Decimals: 3}, s: "5-", want: json.Number("-0.005")},
+		{name: "invalid decimal", field: FixedWidthField{Type: FixedWidthDecimal}, s: ".", wantErr: `invalid decimal "."`},
+		{name: "zoned positive", field: FixedWidthField{Type: FixedWidthZoned, Decimals: 2}, s: "0012C", want: json.Number("1.23")},
+		{name: "zoned negative", field: FixedWidthField{Type: FixedWidthZoned}, s: "12}", want: json.Number("-120")},
+		{name: "zoned unsigned", field: FixedWidthField{Type: FixedWidthZoned}, s: "120", want: json.Number("120")},
+		{name: "invalid zoned", field: FixedWidthField{Type: FixedWidthZoned}, s: "1Z", wantErr: `invalid zoned decimal "1Z"`},
+		{name: "date", field: FixedWidthField{Type: FixedWidthDate}, s: "20240102", want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "date format", field: FixedWidthField{Type: FixedWidthDate, Format: "02/01/06"}, s: "02/01/24", want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "zero date", field: FixedWidthField{Type: FixedWidthDate}, s: "00000000", want: nil},
+		{name: "invalid date", field: FixedWidthField{Type: FixedWidthDate}, s: "20241350", wantErr: `invalid date "20241350"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.field.parse(tt.s)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parse(%q) = %#v, %v, want %#v", tt.s, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixedWidthFieldFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   FixedWidthField
+		v       interface{}
+		want    string
+		wantErr string
+	}{
+		{name: "string", field: FixedWidthField{Length: 5}, v: "ab", want: "ab"},
+		{name: "other value as string", field: FixedWidthField{Length: 5}, v: 12, want: "12"},
+		{name: "null", field: FixedWidthField{Type: FixedWidthInteger, Length: 5}, v: nil, want: ""},
+		{name: "integer", field: FixedWidthField{Type: FixedWidthInteger, Length: 5}, v: 42, want: "00042"},
+		{name: "negative integer", field: FixedWidthField{Type: FixedWidthInteger, Length: 5}, v: json.Number("-42"), want: "-0042"},
+		{name: "large integer", field: FixedWidthField{Type: FixedWidthInteger, Length: 20}, v: int64(9007199254740993), want: "00009007199254740993"},
+		{name: "decimal", field: FixedWidthField{Type: FixedWidthDecimal, Length: 6, Decimals: 2}, v: "1.5", want: "000150"},
+		{name: "too many decimals", field: FixedWidthField{Type: FixedWidthDecimal, Length: 6, Decimals: 1}, v: 1.25, wantErr: "cannot write 1.25 as a number with 1 decimals"},
+		{name: "zoned", field: FixedWidthField{Type: FixedWidthZoned, Length: 5, Decimals: 2}, v: -1.23, want: "0012L"},
+		{name: "date", field: FixedWidthField{Type: FixedWidthDate, Length: 8}, v: "2024-01-02 00:00:00", want: "20240102"},
+		{name: "not a date", field: FixedWidthField{Type: FixedWidthDate, Length: 8}, v: true, wantErr: "cannot write bool as a date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.field.format(tt.v)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("format(%v) = %q, %v, want %q", tt.v, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixedWidthLayoutCheck(t *testing.T) {
+	field := func(name string) FixedWidthField {
+		return FixedWidthField{Name: name, Start: 1, Length: 1}
+	}
+	tests := []struct {
+		name    string
+		layout  FixedWidthLayout
+		wantErr string
+	}{
+		{name: "no name", layout: FixedWidthLayout{Fields: []FixedWidthField{{Start: 1, Length: 1}}}, wantErr: "a field has no name"},
+		{name: "duplicate field", layout: FixedWidthLayout{Fields: []FixedWidthField{field("a"), field("a")}}, wantErr: `field "a" is given twice`},
+		{name: "no length", layout: FixedWidthLayout{Fields: []FixedWidthField{{Name: "a", Start: 1}}}, wantErr: `field "a" must have a start and length of at least 1`},
+		{name: "unknown type", layout: FixedWidthLayout{Fields: []FixedWidthField{{Name: "a", Start: 1, Length: 1, Type: "float"}}}, wantErr: `field "a" has unknown type "float"`},
+		{name: "fields and records", layout: FixedWidthLayout{Fields: []FixedWidthField{field("a")}, Records: []FixedWidthRecord{{Type: "r"}}}, wantErr: "only one of fields or records can be given"},
+		{name: "no type position", layout: FixedWidthLayout{Records: []FixedWidthRecord{{Type: "r", Code: "R"}}}, wantErr: "the position of the record type is required"},
+		{name: "duplicate code", layout: FixedWidthLayout{TypeStart: 1, TypeLength: 1, Records: []FixedWidthRecord{{Type: "a", Code: "R"}, {Type: "b", Code: "R"}}}, wantErr: `record code "R" is given twice`},
+		{name: "code length", layout: FixedWidthLayout{TypeStart: 1, TypeLength: 2, Records: []FixedWidthRecord{{Type: "a", Code: "R"}}}, wantErr: `record code "R" is not 2 characters long`},
+		{name: "unknown role", layout: FixedWidthLayout{TypeStart: 1, TypeLength: 1, Records: []FixedWidthRecord{{Type: "a", Code: "R", Role: "footer"}}}, wantErr: `record "a" has unknown role "footer"`},
+		{name: "count of a detail", layout: FixedWidthLayout{TypeStart: 1, TypeLength: 1, Records: []FixedWidthRecord{{Type: "a", Code: "R", CountField: "n", Fields: []FixedWidthField{field("n")}}}}, wantErr: `count field "n" must be a field of a trailer record`},
+		{name: "field of a record", layout: FixedWidthLayout{TypeStart: 1, TypeLength: 1, Records: []FixedWidthRecord{{Type: "a", Code: "R", Fields: []FixedWidthField{{Name: "n"}}}}}, wantErr: `field "n" must have a start and length of at least 1 in record "a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.layout.Check()
+			if err == nil || strings.TrimPrefix(err.Error(), "fixed width: ") != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
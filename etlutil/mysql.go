@@ -17,6 +17,16 @@ import (
 // where the keys are column names and the
 // the values are SQL values to be inserted into those columns.
 func MySQLInsertData(db *sql.DB, d etldata.Payload, tableName string, onDupKeyUpdate bool, onDupKeyFields []string, batchSize int) error {
+	return mysqlInsertData(db, d, tableName, onDupKeyUpdate, onDupKeyFields, batchSize)
+}
+
+// MySQLInsertDataTx is the same as MySQLInsertData, but the INSERT is
+// executed within the given transaction.
+func MySQLInsertDataTx(tx *sql.Tx, d etldata.Payload, tableName string, onDupKeyUpdate bool, onDupKeyFields []string, batchSize int) error {
+	return mysqlInsertData(tx, d, tableName, onDupKeyUpdate, onDupKeyFields, batchSize)
+}
+
+func mysqlInsertData(db preparer, d etldata.Payload, tableName string, onDupKeyUpdate bool, onDupKeyFields []string, batchSize int) error {
 	objects, err := d.Objects()
 	if err != nil {
 		return err
@@ -39,7 +49,7 @@ func MySQLInsertData(db *sql.DB, d etldata.Payload, tableName string, onDupKeyUp
 	return mysqlInsertObjects(db, objects, tableName, onDupKeyUpdate, onDupKeyFields)
 }
 
-func mysqlInsertObjects(db *sql.DB, objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyFields []string) error {
+func mysqlInsertObjects(db preparer, objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyFields []string) error {
 	logger.Info("MySQLInsertData: building INSERT for len(objects) =", len(objects))
 	insertSQL, vals := buildMySQLInsertSQL(objects, tableName, onDupKeyUpdate, onDupKeyFields)
 
@@ -0,0 +1,267 @@
+package etlutil
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ObjectStore is somewhere objects (files) are kept under slash-separated
+// keys, such as a directory, an S3 bucket or an SFTP server, so that
+// readers and writers can move between them by configuration alone.
+//
+// Open, Stat and Delete return an error for which os.IsNotExist is true
+// when there is no object with the key.
+type ObjectStore interface {
+	// List returns the objects whose keys start with pattern, or match it
+	// if it is a glob pattern (see path.Match, in which "*" does not match
+	// "/"), sorted by key.
+	List(pattern string) ([]ObjectInfo, error)
+	Open(key string) (io.ReadCloser, error)
+	// Create returns a writer to the object, replacing any object with the
+	// key. The object is only complete once the writer is closed.
+	Create(key string) (io.WriteCloser, error)
+	Delete(key string) error
+	Stat(key string) (ObjectInfo, error)
+}
+
+// ObjectInfo describes an object in an ObjectStore.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// IsGlob reports whether the pattern given to ObjectStore.List is a glob
+// pattern rather than a prefix.
+func IsGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// listPrefix returns the prefix of the keys a pattern can match.
+func listPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// matchKey reports whether a key is listed by the pattern.
+func matchKey(pattern, key string) (bool, error) {
+	if !IsGlob(pattern) {
+		return strings.HasPrefix(key, pattern), nil
+	}
+	return path.Match(pattern, key)
+}
+
+// filterObjects keeps the objects the pattern matches, and sorts them.
+func filterObjects(pattern string, objects []ObjectInfo) ([]ObjectInfo, error) {
+	var matched []ObjectInfo
+	for _, o := range objects {
+		ok, err := matchKey(pattern, o.Key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, o)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Key < matched[j].Key })
+	return matched, nil
+}
+
+// notExist returns the error for a key with no object.
+func notExist(op, key string) error {
+	return &os.PathError{Op: op, Path: key, Err: os.ErrNotExist}
+}
+
+// LocalObjectStore keeps objects as files under the Root directory, with
+// their keys as paths relative to it. Directories are created as needed.
+type LocalObjectStore struct {
+	Root string
+}
+
+// NewLocalObjectStore returns a new LocalObjectStore for the given
+// directory.
+func NewLocalObjectStore(root string) *LocalObjectStore {
+	return &LocalObjectStore{Root: root}
+}
+
+// List walks the directories the pattern can match files in.
+func (s *LocalObjectStore) List(pattern string) ([]ObjectInfo, error) {
+	dir := path.Dir(listPrefix(pattern) + "x")
+	var objects []ObjectInfo
+	err := filepath.Walk(s.path(dir), func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root(), p)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filterObjects(pattern, objects)
+}
+
+// Open opens the file.
+func (s *LocalObjectStore) Open(key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+// Create creates the file, and the directories it is in.
+func (s *LocalObjectStore) Create(key string) (io.WriteCloser, error) {
+	p := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(p)
+}
+
+// Delete removes the file.
+func (s *LocalObjectStore) Delete(key string) error {
+	return os.Remove(s.path(key))
+}
+
+// Stat returns the size and modification time of the file.
+func (s *LocalObjectStore) Stat(key string) (ObjectInfo, error) {
+	info, err := os.Stat(s.path(key))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, notExist("stat", key)
+	}
+	return ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalObjectStore) root() string {
+	if s.Root == "" {
+		return "."
+	}
+	return s.Root
+}
+
+// path returns the path of the file with the given key, which cannot be
+// outside of Root.
+func (s *LocalObjectStore) path(key string) string {
+	return filepath.Join(s.root(), filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// MemoryObjectStore keeps objects in memory, for tests and small jobs. It
+// is safe for concurrent use.
+type MemoryObjectStore struct {
+	mu      sync.Mutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryObjectStore returns a new, empty MemoryObjectStore.
+func NewMemoryObjectStore() *MemoryObjectStore {
+	return &MemoryObjectStore{objects: make(map[string]memoryObject)}
+}
+
+// Put stores the object.
+func (s *MemoryObjectStore) Put(key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.objects == nil {
+		s.objects = make(map[string]memoryObject)
+	}
+	s.objects[key] = memoryObject{data: append([]byte(nil), data...), modTime: time.Now()}
+}
+
+// Get returns the contents of the object, and whether there is one.
+func (s *MemoryObjectStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	return o.data, ok
+}
+
+// List returns the objects the pattern matches.
+func (s *MemoryObjectStore) List(pattern string) ([]ObjectInfo, error) {
+	s.mu.Lock()
+	var objects []ObjectInfo
+	for key, o := range s.objects {
+		objects = append(objects, ObjectInfo{Key: key, Size: int64(len(o.data)), ModTime: o.modTime})
+	}
+	s.mu.Unlock()
+	return filterObjects(pattern, objects)
+}
+
+// Open returns a reader of the object as it is now.
+func (s *MemoryObjectStore) Open(key string) (io.ReadCloser, error) {
+	data, ok := s.Get(key)
+	if !ok {
+		return nil, notExist("open", key)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Create returns a writer storing the object when it is closed.
+func (s *MemoryObjectStore) Create(key string) (io.WriteCloser, error) {
+	return &memoryObjectWriter{store: s, key: key}, nil
+}
+
+// Delete removes the object.
+func (s *MemoryObjectStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[key]; !ok {
+		return notExist("delete", key)
+	}
+	delete(s.objects, key)
+	return nil
+}
+
+// Stat returns the size and modification time of the object.
+func (s *MemoryObjectStore) Stat(key string) (ObjectInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	if !ok {
+		return ObjectInfo{}, notExist("stat", key)
+	}
+	return ObjectInfo{Key: key, Size: int64(len(o.data)), ModTime: o.modTime}, nil
+}
+
+type memoryObjectWriter struct {
+	store *MemoryObjectStore
+	key   string
+	buf   bytes.Buffer
+}
+
+func (w *memoryObjectWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memoryObjectWriter) Close() error {
+	w.store.Put(w.key, w.buf.Bytes())
+	return nil
+}
+
+// CloseWithError drops the object instead of storing it.
+func (w *memoryObjectWriter) CloseWithError(err error) error {
+	return nil
+}
@@ -0,0 +1,147 @@
+package etlutil
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestObjectStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goetl-objects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stores := []struct {
+		name  string
+		store ObjectStore
+	}{
+		{name: "local", store: NewLocalObjectStore(dir)},
+		{name: "memory", store: NewMemoryObjectStore()},
+	}
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			store := s.store
+			for _, key := range []string{"exports/b.csv", "exports/a.csv", "exports/2024/c.csv", "exports.json", "other/a.csv"} {
+				w, err := store.Create(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.WriteString(w, "data of "+key)
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			lists := []struct {
+				pattern string
+				want    []string
+				wantErr string
+			}{
+				{pattern: "exports/", want: []string{"exports/2024/c.csv", "exports/a.csv", "exports/b.csv"}},
+				{pattern: "exports", want: []string{"exports.json", "exports/2024/c.csv", "exports/a.csv", "exports/b.csv"}},
+				{pattern: "exports/a", want: []string{"exports/a.csv"}},
+				{pattern: "exports/*.csv", want: []string{"exports/a.csv", "exports/b.csv"}},
+				{pattern: "*/a.csv", want: []string{"exports/a.csv", "other/a.csv"}},
+				{pattern: "exports/[ab].csv", want: []string{"exports/a.csv", "exports/b.csv"}},
+				{pattern: "", want: []string{"exports.json", "exports/2024/c.csv", "exports/a.csv", "exports/b.csv", "other/a.csv"}},
+				{pattern: "missing/"},
+				{pattern: "exports/[", wantErr: "syntax error in pattern"},
+			}
+			for _, l := range lists {
+				objects, err := store.List(l.pattern)
+				if l.wantErr != "" {
+					if err == nil || err.Error() != l.wantErr {
+						t.Errorf("List(%q) error = %v, want %q", l.pattern, err, l.wantErr)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []string
+				for _, o := range objects {
+					got = append(got, o.Key)
+					if o.Size != int64(len("data of "+o.Key)) || o.ModTime.IsZero() {
+						t.Errorf("List(%q) = %+v", l.pattern, o)
+					}
+				}
+				if !reflect.DeepEqual(got, l.want) {
+					t.Errorf("List(%q) = %v, want %v", l.pattern, got, l.want)
+				}
+			}
+
+			r, err := store.Open("exports/a.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(r)
+			r.Close()
+			if err != nil || string(b) != "data of exports/a.csv" {
+				t.Errorf("Open read %q, %v", b, err)
+			}
+			if info, err := store.Stat("exports/a.csv"); err != nil || info.Key != "exports/a.csv" || info.Size != 21 {
+				t.Errorf("Stat = %+v, %v", info, err)
+			}
+
+			// Objects are replaced.
+			w, err := store.Create("exports/a.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, "new")
+			w.Close()
+			if info, err := store.Stat("exports/a.csv"); err != nil || info.Size != 3 {
+				t.Errorf("Stat after Create = %+v, %v", info, err)
+			}
+
+			if err := store.Delete("exports/a.csv"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Open("exports/a.csv"); !os.IsNotExist(err) {
+				t.Errorf("Open of a deleted object error = %v", err)
+			}
+			if _, err := store.Stat("exports/a.csv"); !os.IsNotExist(err) {
+				t.Errorf("Stat of a deleted object error = %v", err)
+			}
+			if err := store.Delete("exports/a.csv"); !os.IsNotExist(err) {
+				t.Errorf("Delete of a deleted object error = %v", err)
+			}
+			if _, err := store.Stat("exports"); !os.IsNotExist(err) {
+				t.Errorf("Stat of a directory error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLocalObjectStorePath(t *testing.T) {
+	s := NewLocalObjectStore("/data")
+	for key, want := range map[string]string{"a/b.csv": "/data/a/b.csv", "/a.csv": "/data/a.csv", "../../etc/passwd": "/data/etc/passwd"} {
+		if got := s.path(key); got != want {
+			t.Errorf("path(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestMemoryObjectStoreAbort(t *testing.T) {
+	s := &MemoryObjectStore{}
+	w, err := s.Create("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "partial")
+	if _, ok := s.Get("a"); ok {
+		t.Error("the object exists before it is closed")
+	}
+	w.(interface{ CloseWithError(error) error }).CloseWithError(io.ErrUnexpectedEOF)
+	if _, ok := s.Get("a"); ok {
+		t.Error("the object exists once abandoned")
+	}
+	s.Put("b", []byte("b"))
+	if data, ok := s.Get("b"); !ok || string(data) != "b" {
+		t.Errorf("Get = %q, %v", data, ok)
+	}
+}
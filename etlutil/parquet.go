@@ -0,0 +1,252 @@
+package etlutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// ParquetCompression is the codec used to compress the pages of a Parquet
+// file. The values are those of the Parquet format.
+type ParquetCompression int32
+
+// The ParquetCompressions that can be written and read.
+const (
+	ParquetUncompressed ParquetCompression = 0
+	ParquetSnappy       ParquetCompression = 1
+	ParquetGzip         ParquetCompression = 2
+)
+
+// ParseParquetCompression returns the ParquetCompression with the given
+// name: "none", "snappy" or "gzip".
+func ParseParquetCompression(name string) (ParquetCompression, error) {
+	switch strings.ToLower(name) {
+	case "none", "uncompressed":
+		return ParquetUncompressed, nil
+	case "snappy":
+		return ParquetSnappy, nil
+	case "gzip":
+		return ParquetGzip, nil
+	}
+	return 0, fmt.Errorf("parquet: unknown compression %q", name)
+}
+
+func (c ParquetCompression) String() string {
+	switch c {
+	case ParquetUncompressed:
+		return "none"
+	case ParquetSnappy:
+		return "snappy"
+	case ParquetGzip:
+		return "gzip"
+	case 3:
+		return "lzo"
+	case 4:
+		return "brotli"
+	case 5, 7:
+		return "lz4"
+	case 6:
+		return "zstd"
+	}
+	return fmt.Sprintf("ParquetCompression(%d)", int32(c))
+}
+
+func (c ParquetCompression) compress(data []byte) ([]byte, error) {
+	switch c {
+	case ParquetUncompressed:
+		return data, nil
+	case ParquetSnappy:
+		return snappy.Encode(nil, data), nil
+	case ParquetGzip:
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		if _, err := gw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := gw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("parquet: %v compression is not supported", c)
+}
+
+func (c ParquetCompression) decompress(data []byte, size int) ([]byte, error) {
+	switch c {
+	case ParquetUncompressed:
+		return data, nil
+	case ParquetSnappy:
+		return snappy.Decode(make([]byte, size), data)
+	case ParquetGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		return ioutil.ReadAll(gr)
+	}
+	return nil, fmt.Errorf("parquet: %v compression is not supported", c)
+}
+
+var parquetMagic = []byte("PAR1")
+
+// The physical types of Parquet columns.
+const (
+	parquetBoolean           = 0
+	parquetInt32             = 1
+	parquetInt64             = 2
+	parquetInt96             = 3
+	parquetFloat             = 4
+	parquetDouble            = 5
+	parquetByteArray         = 6
+	parquetFixedLenByteArray = 7
+)
+
+// The converted types (the original annotations of logical types) used
+// here.
+const (
+	parquetNoConvertedType = -1
+	parquetUTF8            = 0
+	parquetEnum            = 4
+	parquetDecimal         = 5
+	parquetDate            = 6
+	parquetTimestampMillis = 9
+	parquetTimestampMicros = 10
+	parquetJSON            = 19
+)
+
+// The repetition types of fields.
+const (
+	parquetRequired = 0
+	parquetOptional = 1
+	parquetRepeated = 2
+)
+
+// The encodings and page types used here.
+const (
+	parquetPlain           = 0
+	parquetPlainDictionary = 2
+	parquetRLE             = 3
+	parquetBitPacked       = 4
+	parquetRLEDictionary   = 8
+
+	parquetDataPage       = 0
+	parquetDictionaryPage = 2
+	parquetDataPageV2     = 3
+)
+
+// parquetEncodingNames names the encodings of the Parquet format, for
+// errors about the ones that cannot be read.
+var parquetEncodingNames = map[int64]string{
+	parquetPlain:           "PLAIN",
+	parquetPlainDictionary: "PLAIN_DICTIONARY",
+	parquetRLE:             "RLE",
+	parquetBitPacked:       "BIT_PACKED",
+	5:                      "DELTA_BINARY_PACKED",
+	6:                      "DELTA_LENGTH_BYTE_ARRAY",
+	7:                      "DELTA_BYTE_ARRAY",
+	parquetRLEDictionary:   "RLE_DICTIONARY",
+	9:                      "BYTE_STREAM_SPLIT",
+}
+
+func parquetEncodingName(encoding int64) string {
+	if name, ok := parquetEncodingNames[encoding]; ok {
+		return name
+	}
+	return fmt.Sprintf("encoding %d", encoding)
+}
+
+// parquetColumn describes a column of a flat Parquet schema.
+type parquetColumn struct {
+	name       string
+	physical   int32
+	typeLength int
+	optional   bool
+	converted  int32
+	logical    thriftStruct // the LogicalType union, if any
+	scale      int
+}
+
+// bitWidth returns the number of bits needed to store values up to max.
+func bitWidth(max uint64) int {
+	return bits.Len64(max)
+}
+
+// appendRLE appends the RLE/bit-packing hybrid encoding of the values,
+// using RLE runs only.
+func appendRLE(buf []byte, values []int32, width int) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	for i := 0; i < len(values); {
+		j := i + 1
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(j-i)<<1)]...)
+		v := uint32(values[i])
+		for b := 0; b < (width+7)/8; b++ {
+			buf = append(buf, byte(v>>(8*b)))
+		}
+		i = j
+	}
+	return buf
+}
+
+var errParquetLevels = errors.New("parquet: invalid RLE/bit-packed data")
+
+// decodeRLE decodes n values encoded with the RLE/bit-packing hybrid
+// encoding.
+func decodeRLE(data []byte, width, n int) ([]int32, error) {
+	if width > 32 {
+		return nil, errParquetLevels
+	}
+	values := make([]int32, 0, n)
+	r := &sliceByteReader{data: data}
+	byteWidth := (width + 7) / 8
+	for len(values) < n {
+		header, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errParquetLevels
+		}
+		if header&1 == 0 {
+			count := int(header >> 1)
+			if r.pos+byteWidth > len(data) {
+				return nil, errParquetLevels
+			}
+			if count > n-len(values) {
+				count = n - len(values)
+			}
+			var v uint32
+			for b := 0; b < byteWidth; b++ {
+				v |= uint32(data[r.pos+b]) << (8 * b)
+			}
+			r.pos += byteWidth
+			for i := 0; i < count; i++ {
+				values = append(values, int32(v))
+			}
+			continue
+		}
+		count := int(header>>1) * 8
+		size := int(header>>1) * width
+		if r.pos+size > len(data) {
+			return nil, errParquetLevels
+		}
+		packed := data[r.pos : r.pos+size]
+		r.pos += size
+		for i := 0; i < count && len(values) < n; i++ {
+			var v uint32
+			for b := 0; b < width; b++ {
+				bit := i*width + b
+				v |= uint32(packed[bit/8]>>(bit%8)&1) << b
+			}
+			values = append(values, int32(v))
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,465 @@
+package etlutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+	"unicode/utf8"
+)
+
+// ParquetReader reads the records of a Parquet file one row group at a
+// time. Only flat schemas are supported: every column must be a required
+// or optional primitive field. Data pages (version 1 or 2) can use the
+// PLAIN or dictionary encodings, and be uncompressed or compressed with
+// snappy or gzip. NewParquetReader returns an error saying what is not
+// supported for files with nested or repeated columns, or with columns
+// that use other compression codecs (such as zstd) or encodings (such as
+// DELTA_BINARY_PACKED).
+//
+// Values are returned as string (UTF8 and ENUM annotations, and other byte
+// arrays holding valid UTF-8), json.RawMessage (JSON), json.Number
+// (DECIMAL), time.Time in UTC (DATE, TIMESTAMP and INT96 timestamps),
+// []byte, bool, int32, int64, float32 or float64. Nulls are returned as
+// nil.
+type ParquetReader struct {
+	r         io.ReaderAt
+	columns   []parquetColumn
+	rowGroups []thriftStruct
+	numRows   int64
+}
+
+// ErrParquetFile is returned by NewParquetReader for data that is not a
+// Parquet file.
+var ErrParquetFile = errors.New("parquet: not a Parquet file")
+
+// NewParquetReader reads the metadata of the Parquet file of the given size.
+func NewParquetReader(r io.ReaderAt, size int64) (*ParquetReader, error) {
+	if size < 12 {
+		return nil, ErrParquetFile
+	}
+	tail := make([]byte, 8)
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tail[4:], parquetMagic) {
+		return nil, ErrParquetFile
+	}
+	footerSize := int64(binary.LittleEndian.Uint32(tail))
+	if footerSize > size-12 {
+		return nil, ErrParquetFile
+	}
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-8-footerSize); err != nil {
+		return nil, err
+	}
+	meta, _, err := readThriftStruct(footer)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: reading footer: %v", err)
+	}
+
+	pr := &ParquetReader{r: r, rowGroups: meta.structList(4), numRows: meta.int(3)}
+	schema := meta.structList(2)
+	if len(schema) == 0 {
+		return nil, errors.New("parquet: the file has no schema")
+	}
+	for _, el := range schema[1:] {
+		if el.has(5) {
+			return nil, fmt.Errorf("parquet: column %q: nested columns are not supported", el.string(4))
+		}
+		if el.int(3) == parquetRepeated {
+			return nil, fmt.Errorf("parquet: column %q: repeated columns are not supported", el.string(4))
+		}
+		c := parquetColumn{
+			name:       el.string(4),
+			physical:   int32(el.int(1)),
+			typeLength: int(el.int(2)),
+			optional:   el.int(3) == parquetOptional,
+			converted:  parquetNoConvertedType,
+			logical:    el.structField(10),
+			scale:      int(el.int(7)),
+		}
+		if el.has(6) {
+			c.converted = int32(el.int(6))
+		}
+		if d := c.logical.structField(5); d != nil {
+			c.scale = int(d.int(1))
+		}
+		pr.columns = append(pr.columns, c)
+	}
+	if err := pr.checkColumnChunks(); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// checkColumnChunks returns an error for the first column chunk that is
+// compressed with a codec, or uses an encoding, that cannot be read.
+func (r *ParquetReader) checkColumnChunks() error {
+	for _, rg := range r.rowGroups {
+		for j, chunk := range rg.structList(1) {
+			if j >= len(r.columns) {
+				break
+			}
+			meta := chunk.structField(3)
+			switch codec := ParquetCompression(meta.int(4)); codec {
+			case ParquetUncompressed, ParquetSnappy, ParquetGzip:
+			default:
+				return fmt.Errorf("parquet: column %q: %v compression is not supported", r.columns[j].name, codec)
+			}
+			for _, e := range meta.list(2) {
+				switch e, _ := e.(int64); e {
+				case parquetPlain, parquetPlainDictionary, parquetRLE, parquetBitPacked, parquetRLEDictionary:
+				default:
+					return fmt.Errorf("parquet: column %q: %v encoding is not supported", r.columns[j].name, parquetEncodingName(e))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// NumRows returns the number of records in the file.
+func (r *ParquetReader) NumRows() int64 {
+	return r.numRows
+}
+
+// NumRowGroups returns the number of row groups in the file.
+func (r *ParquetReader) NumRowGroups() int {
+	return len(r.rowGroups)
+}
+
+// Columns returns the names of the columns, in order.
+func (r *ParquetReader) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// ReadRowGroup returns the records of the i-th row group.
+func (r *ParquetReader) ReadRowGroup(i int) ([]map[string]interface{}, error) {
+	if i < 0 || i >= len(r.rowGroups) {
+		return nil, fmt.Errorf("parquet: no row group %d", i)
+	}
+	rg := r.rowGroups[i]
+	numRows := int(rg.int(3))
+	chunks := rg.structList(1)
+	if len(chunks) != len(r.columns) {
+		return nil, fmt.Errorf("parquet: row group %d has %d columns, expected %d", i, len(chunks), len(r.columns))
+	}
+	rows := make([]map[string]interface{}, numRows)
+	for j := range rows {
+		rows[j] = make(map[string]interface{}, len(r.columns))
+	}
+	for j, c := range r.columns {
+		values, err := r.readColumn(c, chunks[j].structField(3), numRows)
+		if err != nil {
+			return nil, fmt.Errorf("parquet: row group %d: column %q: %v", i, c.name, err)
+		}
+		for k, v := range values {
+			rows[k][c.name] = v
+		}
+	}
+	return rows, nil
+}
+
+// readColumn returns the values of a column chunk.
+func (r *ParquetReader) readColumn(c parquetColumn, meta thriftStruct, numRows int) ([]interface{}, error) {
+	if meta == nil {
+		return nil, errors.New("missing column metadata")
+	}
+	codec := ParquetCompression(meta.int(4))
+	start := meta.int(9)
+	if meta.has(11) && meta.int(11) > 0 && meta.int(11) < start {
+		start = meta.int(11)
+	}
+	data := make([]byte, meta.int(7))
+	if _, err := r.r.ReadAt(data, start); err != nil {
+		return nil, err
+	}
+
+	var dict []interface{}
+	values := make([]interface{}, 0, numRows)
+	for len(values) < numRows {
+		header, n, err := readThriftStruct(data)
+		if err != nil {
+			return nil, fmt.Errorf("reading page header: %v", err)
+		}
+		size := int(header.int(3))
+		if size < 0 || n+size > len(data) {
+			return nil, errors.New("page is truncated")
+		}
+		page := data[n : n+size]
+		data = data[n+size:]
+		uncompressedSize := int(header.int(2))
+
+		switch header.int(1) {
+		case parquetDictionaryPage:
+			dh := header.structField(7)
+			body, err := codec.decompress(page, uncompressedSize)
+			if err != nil {
+				return nil, err
+			}
+			if dict, _, err = c.decodePlain(body, int(dh.int(1))); err != nil {
+				return nil, err
+			}
+		case parquetDataPage:
+			dh := header.structField(5)
+			body, err := codec.decompress(page, uncompressedSize)
+			if err != nil {
+				return nil, err
+			}
+			numValues := int(dh.int(1))
+			var levels []int32
+			if c.optional {
+				if len(body) < 4 {
+					return nil, errParquetLevels
+				}
+				size := int(binary.LittleEndian.Uint32(body))
+				if 4+size > len(body) {
+					return nil, errParquetLevels
+				}
+				if levels, err = decodeRLE(body[4:4+size], 1, numValues); err != nil {
+					return nil, err
+				}
+				body = body[4+size:]
+			}
+			if values, err = c.decodePage(values, body, int(dh.int(2)), numValues, levels, dict); err != nil {
+				return nil, err
+			}
+		case parquetDataPageV2:
+			dh := header.structField(8)
+			numValues := int(dh.int(1))
+			defSize, repSize := int(dh.int(5)), int(dh.int(6))
+			if defSize < 0 || repSize < 0 || repSize+defSize > len(page) {
+				return nil, errParquetLevels
+			}
+			var levels []int32
+			if c.optional {
+				if levels, err = decodeRLE(page[repSize:repSize+defSize], 1, numValues); err != nil {
+					return nil, err
+				}
+			}
+			body := page[repSize+defSize:]
+			if !dh.has(7) || dh.bool(7) {
+				if body, err = codec.decompress(body, uncompressedSize-repSize-defSize); err != nil {
+					return nil, err
+				}
+			}
+			if values, err = c.decodePage(values, body, int(dh.int(4)), numValues, levels, dict); err != nil {
+				return nil, err
+			}
+		}
+		if len(data) == 0 && len(values) < numRows {
+			return nil, fmt.Errorf("expected %d values, found %d", numRows, len(values))
+		}
+	}
+	return values, nil
+}
+
+// decodePage appends the values of a data page to values. levels holds
+// the definition levels of an optional column.
+func (c parquetColumn) decodePage(values []interface{}, body []byte, encoding, numValues int, levels []int32, dict []interface{}) ([]interface{}, error) {
+	nonNull := numValues
+	if levels != nil {
+		nonNull = 0
+		for _, l := range levels {
+			if l == 1 {
+				nonNull++
+			}
+		}
+	}
+
+	var decoded []interface{}
+	switch encoding {
+	case parquetPlain:
+		var err error
+		if decoded, _, err = c.decodePlain(body, nonNull); err != nil {
+			return nil, err
+		}
+	case parquetPlainDictionary, parquetRLEDictionary:
+		if dict == nil {
+			return nil, errors.New("dictionary page is missing")
+		}
+		if len(body) == 0 {
+			if nonNull > 0 {
+				return nil, errParquetLevels
+			}
+			break
+		}
+		indices, err := decodeRLE(body[1:], int(body[0]), nonNull)
+		if err != nil {
+			return nil, err
+		}
+		decoded = make([]interface{}, len(indices))
+		for i, idx := range indices {
+			if idx < 0 || int(idx) >= len(dict) {
+				return nil, fmt.Errorf("dictionary index %d out of range", idx)
+			}
+			decoded[i] = dict[idx]
+		}
+	default:
+		return nil, fmt.Errorf("%v encoding is not supported", parquetEncodingName(int64(encoding)))
+	}
+
+	if levels == nil {
+		return append(values, decoded...), nil
+	}
+	for _, l := range levels {
+		if l == 1 {
+			values = append(values, decoded[0])
+			decoded = decoded[1:]
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values, nil
+}
+
+// decodePlain decodes n PLAIN encoded values, returning them along with
+// the number of bytes they take up.
+func (c parquetColumn) decodePlain(data []byte, n int) ([]interface{}, int, error) {
+	values := make([]interface{}, 0, n)
+	pos := 0
+	need := func(size int) error {
+		if size < 0 || pos+size > len(data) {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		var v interface{}
+		switch c.physical {
+		case parquetBoolean:
+			if err := need((i+8)/8 - pos); err != nil {
+				return nil, 0, err
+			}
+			v = data[i/8]>>(i%8)&1 == 1
+			pos = (i + 8) / 8
+		case parquetInt32:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			v = int32(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+		case parquetInt64:
+			if err := need(8); err != nil {
+				return nil, 0, err
+			}
+			v = int64(binary.LittleEndian.Uint64(data[pos:]))
+			pos += 8
+		case parquetInt96:
+			if err := need(12); err != nil {
+				return nil, 0, err
+			}
+			nanos := int64(binary.LittleEndian.Uint64(data[pos:]))
+			julianDay := int64(binary.LittleEndian.Uint32(data[pos+8:]))
+			v = time.Unix((julianDay-2440588)*86400, nanos).UTC()
+			pos += 12
+		case parquetFloat:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			v = math.Float32frombits(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+		case parquetDouble:
+			if err := need(8); err != nil {
+				return nil, 0, err
+			}
+			v = math.Float64frombits(binary.LittleEndian.Uint64(data[pos:]))
+			pos += 8
+		case parquetByteArray:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			size := int(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+			if err := need(size); err != nil {
+				return nil, 0, err
+			}
+			v = append([]byte(nil), data[pos:pos+size]...)
+			pos += size
+		case parquetFixedLenByteArray:
+			if err := need(c.typeLength); err != nil {
+				return nil, 0, err
+			}
+			v = append([]byte(nil), data[pos:pos+c.typeLength]...)
+			pos += c.typeLength
+		default:
+			return nil, 0, fmt.Errorf("unknown physical type %d", c.physical)
+		}
+		values = append(values, c.convert(v))
+	}
+	return values, pos, nil
+}
+
+// convert applies the column's logical type to a decoded value.
+func (c parquetColumn) convert(v interface{}) interface{} {
+	logical := func(id int16) thriftStruct {
+		return c.logical.structField(id)
+	}
+	switch {
+	case c.converted == parquetDecimal || logical(5) != nil:
+		return parquetDecimalValue(v, c.scale)
+	case c.converted == parquetDate || logical(6) != nil:
+		if days, ok := v.(int32); ok {
+			return time.Unix(int64(days)*86400, 0).UTC()
+		}
+	case c.converted == parquetTimestampMillis:
+		if n, ok := v.(int64); ok {
+			return time.Unix(0, n*1e6).UTC()
+		}
+	case c.converted == parquetTimestampMicros:
+		if n, ok := v.(int64); ok {
+			return time.Unix(0, n*1e3).UTC()
+		}
+	case logical(8) != nil:
+		if n, ok := v.(int64); ok {
+			unit := logical(8).structField(2)
+			switch {
+			case unit.has(1):
+				return time.Unix(0, n*1e6).UTC()
+			case unit.has(2):
+				return time.Unix(0, n*1e3).UTC()
+			}
+			return time.Unix(0, n).UTC()
+		}
+	case c.converted == parquetJSON || logical(12) != nil:
+		if b, ok := v.([]byte); ok {
+			return json.RawMessage(b)
+		}
+	case c.converted == parquetUTF8 || c.converted == parquetEnum || logical(1) != nil || logical(4) != nil:
+		if b, ok := v.([]byte); ok {
+			return string(b)
+		}
+	case c.physical == parquetByteArray:
+		if b := v.([]byte); utf8.Valid(b) {
+			return string(b)
+		}
+	}
+	return v
+}
+
+// parquetDecimalValue returns a DECIMAL value (an integer, or a big-endian
+// two's complement byte array) as a json.Number with the given scale.
+func parquetDecimalValue(v interface{}, scale int) interface{} {
+	n := new(big.Int)
+	switch vv := v.(type) {
+	case int32:
+		n.SetInt64(int64(vv))
+	case int64:
+		n.SetInt64(vv)
+	case []byte:
+		n = twosComplement(vv)
+	default:
+		return v
+	}
+	return decimalNumber(n, scale)
+}
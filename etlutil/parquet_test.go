@@ -0,0 +1,283 @@
+package etlutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+func TestParquetRoundTrip(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	schema := etldata.NewSchema(
+		etldata.Field{Name: "id", Type: etldata.FieldInteger},
+		etldata.Field{Name: "name", Type: etldata.FieldString, Nullable: true},
+		etldata.Field{Name: "price", Type: etldata.FieldNumber, Nullable: true},
+		etldata.Field{Name: "ok", Type: etldata.FieldBoolean, Nullable: true},
+		etldata.Field{Name: "at", Type: etldata.FieldTimestamp, Nullable: true},
+		etldata.Field{Name: "day", Type: etldata.FieldDate, Nullable: true},
+		etldata.Field{Name: "tags", Type: etldata.FieldArray, Nullable: true},
+	)
+	var rows, want []map[string]interface{}
+	for i := 0; i < 100; i++ {
+		rows = append(rows, map[string]interface{}{
+			"id": i, "name": fmt.Sprint("n", i), "price": json.Number("1.5"), "ok": i%3 == 0,
+			"at": at, "day": "1969-12-31", "tags": []interface{}{"a"}, "ignored": true,
+		})
+		want = append(want, map[string]interface{}{
+			"id": int64(i), "name": fmt.Sprint("n", i), "price": 1.5, "ok": i%3 == 0,
+			"at": at, "day": time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), "tags": json.RawMessage(`["a"]`),
+		})
+	}
+	// Missing and null values are read back as nulls.
+	rows = append(rows, map[string]interface{}{"id": int64(100), "name": nil})
+	want = append(want, map[string]interface{}{"id": int64(100), "name": nil, "price": nil, "ok": nil, "at": nil, "day": nil, "tags": nil})
+
+	tests := []struct {
+		compression ParquetCompression
+		pageSize    int
+	}{
+		{compression: ParquetUncompressed, pageSize: 1 << 20},
+		{compression: ParquetSnappy, pageSize: 1 << 20},
+		{compression: ParquetGzip, pageSize: 1 << 20},
+		{compression: ParquetSnappy, pageSize: 64},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.compression, "/", tt.pageSize), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewParquetWriter(&buf, schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Compression = tt.compression
+			w.PageSize = tt.pageSize
+			if err := w.WriteRowGroup(rows[:60]); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteRowGroup(rows[60:]); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewParquetReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.NumRows() != int64(len(rows)) || r.NumRowGroups() != 2 {
+				t.Fatalf("NumRows = %d, NumRowGroups = %d", r.NumRows(), r.NumRowGroups())
+			}
+			if got := r.Columns(); !reflect.DeepEqual(got, []string{"id", "name", "price", "ok", "at", "day", "tags"}) {
+				t.Errorf("Columns = %v", got)
+			}
+			var got []map[string]interface{}
+			for i := 0; i < r.NumRowGroups(); i++ {
+				rg, err := r.ReadRowGroup(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, rg...)
+			}
+			if !reflect.DeepEqual(got, want) {
+				for i := range want {
+					if !reflect.DeepEqual(got[i], want[i]) {
+						t.Fatalf("row %d = %v, want %v", i, got[i], want[i])
+					}
+				}
+				t.Fatalf("read %d rows, want %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+// TestParquetReaderFixtures reads files written by another implementation
+// (see testdata/parquetgen), so that the reader is not only checked against
+// ParquetWriter.
+func TestParquetReaderFixtures(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	orders := []map[string]interface{}{
+		{"id": int64(1), "status": "shipped", "total": 12.5, "paid": true, "placed": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "due": day(2024, 1, 2), "cents": json.Number("12.50"), "qty": int32(2)},
+		{"id": int64(2), "status": "new", "total": nil, "paid": false, "placed": nil, "due": nil, "cents": json.Number("-0.05"), "qty": int32(1)},
+		{"id": int64(3), "status": "shipped", "total": 0.25, "paid": nil, "placed": time.Unix(0, 0).UTC(), "due": day(1969, 12, 31), "cents": json.Number("0.00"), "qty": int32(10)},
+		{"id": int64(4), "status": nil, "total": -3.0, "paid": true, "placed": time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC), "due": day(1970, 1, 1), "cents": json.Number("0.99"), "qty": int32(0)},
+	}
+	tests := []struct {
+		file    string
+		want    []map[string]interface{}
+		wantErr string
+	}{
+		{file: "orders.snappy.parquet", want: orders},
+		{file: "orders.gzip.parquet", want: orders},
+		{file: "orders.zstd.parquet", wantErr: `parquet: column "id": zstd compression is not supported`},
+		{file: "delta.parquet", wantErr: `parquet: row group 0: column "id": DELTA_BINARY_PACKED encoding is not supported`},
+		{file: "nested.parquet", wantErr: `parquet: column "address": nested columns are not supported`},
+		{file: "repeated.parquet", wantErr: `parquet: column "tags": repeated columns are not supported`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []map[string]interface{}
+			r, err := NewParquetReader(bytes.NewReader(data), int64(len(data)))
+			for i := 0; err == nil && i < r.NumRowGroups(); i++ {
+				var rg []map[string]interface{}
+				rg, err = r.ReadRowGroup(i)
+				got = append(got, rg...)
+			}
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParquetWriterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  *etldata.Schema
+		rows    []map[string]interface{}
+		wantErr string
+	}{
+		{name: "no fields", schema: etldata.NewSchema(), wantErr: "parquet: schema has no fields"},
+		{
+			name:    "wrong type",
+			schema:  etldata.NewSchema(etldata.Field{Name: "id", Type: etldata.FieldInteger}),
+			rows:    []map[string]interface{}{{"id": 1}, {"id": "x"}},
+			wantErr: `parquet: record 1: field "id": cannot write string as integer`,
+		},
+		{
+			name:    "missing required field",
+			schema:  etldata.NewSchema(etldata.Field{Name: "id", Type: etldata.FieldInteger}),
+			rows:    []map[string]interface{}{{}},
+			wantErr: `parquet: record 0: field "id" is null`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewParquetWriter(&bytes.Buffer{}, tt.schema)
+			if err == nil {
+				err = w.WriteRowGroup(tt.rows)
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParquetReaderNotParquet(t *testing.T) {
+	for _, data := range []string{"", "PAR1PAR1", "PAR1\x00\x00\x00\x00\xff\xff\x00\x00PAR1", "not a parquet file"} {
+		if _, err := NewParquetReader(bytes.NewReader([]byte(data)), int64(len(data))); err != ErrParquetFile {
+			t.Errorf("NewParquetReader(%q) error = %v", data, err)
+		}
+	}
+}
+
+func TestDecodeRLE(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		width int
+		n     int
+		want  []int32
+	}{
+		{name: "RLE runs", data: appendRLE(nil, []int32{1, 1, 1, 0, 2}, 2), width: 2, n: 5, want: []int32{1, 1, 1, 0, 2}},
+		{name: "bit-packed", data: []byte{3, 0xb1}, width: 1, n: 5, want: []int32{1, 0, 0, 0, 1}},
+		{name: "bit-packed width 3", data: []byte{3, 0x88, 0xc6, 0xfa}, width: 3, n: 8, want: []int32{0, 1, 2, 3, 4, 5, 6, 7}},
+		{name: "long run cut short", data: appendRLE(nil, []int32{5, 5, 5}, 3), width: 3, n: 2, want: []int32{5, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeRLE(tt.data, tt.width, tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeRLE = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := decodeRLE([]byte{3}, 8, 8); err != errParquetLevels {
+		t.Errorf("truncated data error = %v", err)
+	}
+}
+
+func TestParquetDecimalValue(t *testing.T) {
+	tests := []struct {
+		v     interface{}
+		scale int
+		want  interface{}
+	}{
+		{v: int32(12345), scale: 2, want: json.Number("123.45")},
+		{v: int64(-5), scale: 3, want: json.Number("-0.005")},
+		{v: big.NewInt(1234).Bytes(), scale: 0, want: json.Number("1234")},
+		{v: []byte{0xfb, 0x2e}, scale: 1, want: json.Number("-123.4")},
+		{v: "x", scale: 1, want: "x"},
+	}
+	for _, tt := range tests {
+		if got := parquetDecimalValue(tt.v, tt.scale); got != tt.want {
+			t.Errorf("parquetDecimalValue(%v, %d) = %#v, want %#v", tt.v, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestThriftRoundTrip(t *testing.T) {
+	w := &thriftWriter{}
+	w.writeStruct(func() {
+		w.i32(1, -7)
+		w.i64(2, 1<<40)
+		w.bool(3, true)
+		w.bool(4, false)
+		w.string(5, "name")
+		w.i32List(30, []int32{1, 2, 3})
+		w.stringList(31, make([]string, 20))
+		w.structField(32, func() { w.i32(1, 9) })
+		w.structList(33, 2, func(i int) { w.i64(7, int64(i)) })
+	})
+	w.buf = append(w.buf, "trailing"...)
+
+	s, n, err := readThriftStruct(w.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(w.buf)-len("trailing") {
+		t.Errorf("read %d bytes, want %d", n, len(w.buf)-len("trailing"))
+	}
+	if s.int(1) != -7 || s.int(2) != 1<<40 || !s.bool(3) || !s.has(4) || s.bool(4) || s.string(5) != "name" {
+		t.Errorf("fields = %v", s)
+	}
+	if l := s.list(30); !reflect.DeepEqual(l, []interface{}{int64(1), int64(2), int64(3)}) {
+		t.Errorf("i32 list = %v", l)
+	}
+	if l := s.list(31); len(l) != 20 {
+		t.Errorf("string list has %d elements", len(l))
+	}
+	if s.structField(32).int(1) != 9 {
+		t.Errorf("struct field = %v", s.structField(32))
+	}
+	if l := s.structList(33); len(l) != 2 || l[1].int(7) != 1 {
+		t.Errorf("struct list = %v", l)
+	}
+	if _, _, err := readThriftStruct(w.buf[:10]); err == nil {
+		t.Error("no error reading truncated data")
+	}
+}
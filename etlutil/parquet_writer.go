@@ -0,0 +1,429 @@
+package etlutil
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+// ParquetWriter writes records to an io.Writer as a Parquet file, with one
+// column per field of an etldata.Schema. Each call to WriteRowGroup writes a
+// row group, and Close writes the file footer. Fields are mapped to Parquet
+// types as follows:
+//
+//	string            BYTE_ARRAY (UTF8)
+//	integer           INT64
+//	number            DOUBLE
+//	boolean           BOOLEAN
+//	timestamp         INT64 (TIMESTAMP_MICROS, in UTC)
+//	date              INT32 (DATE)
+//	object/array/any  BYTE_ARRAY (JSON)
+//
+// Nullable fields are optional columns, and the others are required.
+// Values are written as PLAIN data pages, compressed with Compression.
+type ParquetWriter struct {
+	Compression ParquetCompression // defaults to ParquetSnappy
+	// PageSize is the size in bytes after which a new data page is started.
+	// It defaults to 1MB.
+	PageSize int
+
+	w         io.Writer
+	offset    int64
+	fields    []etldata.Field
+	columns   []parquetColumn
+	rowGroups []parquetRowGroup
+	numRows   int64
+	closed    bool
+}
+
+// parquetRowGroup is the metadata of a row group that has been written.
+type parquetRowGroup struct {
+	chunks          []parquetChunk
+	numRows         int64
+	totalSize       int64
+	totalCompressed int64
+}
+
+// parquetChunk is the metadata of a column chunk that has been written.
+type parquetChunk struct {
+	dataPageOffset   int64
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+// NewParquetWriter returns a ParquetWriter writing records that conform to
+// the given Schema to w.
+func NewParquetWriter(w io.Writer, schema *etldata.Schema) (*ParquetWriter, error) {
+	if err := schema.Check(); err != nil {
+		return nil, err
+	}
+	if len(schema.Fields) == 0 {
+		return nil, fmt.Errorf("parquet: schema has no fields")
+	}
+	pw := &ParquetWriter{Compression: ParquetSnappy, PageSize: 1 << 20, w: w, fields: schema.Fields}
+	for _, f := range schema.Fields {
+		pw.columns = append(pw.columns, parquetColumnFor(f))
+	}
+	return pw, nil
+}
+
+func parquetColumnFor(f etldata.Field) parquetColumn {
+	c := parquetColumn{name: f.Name, optional: f.Nullable, converted: parquetNoConvertedType}
+	switch f.Type {
+	case etldata.FieldString:
+		c.physical, c.converted = parquetByteArray, parquetUTF8
+	case etldata.FieldInteger:
+		c.physical = parquetInt64
+	case etldata.FieldNumber:
+		c.physical = parquetDouble
+	case etldata.FieldBoolean:
+		c.physical = parquetBoolean
+	case etldata.FieldTimestamp:
+		c.physical, c.converted = parquetInt64, parquetTimestampMicros
+	case etldata.FieldDate:
+		c.physical, c.converted = parquetInt32, parquetDate
+	default:
+		c.physical, c.converted = parquetByteArray, parquetJSON
+	}
+	return c
+}
+
+// Schema returns the Schema of the records being written.
+func (w *ParquetWriter) Schema() *etldata.Schema {
+	return etldata.NewSchema(w.fields...)
+}
+
+// WriteRowGroup writes the records as a row group. Fields missing from a
+// record are written as nulls, and fields not in the Schema are ignored.
+func (w *ParquetWriter) WriteRowGroup(rows []map[string]interface{}) error {
+	if w.closed {
+		return fmt.Errorf("parquet: writer is closed")
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if w.offset == 0 {
+		if err := w.write(parquetMagic); err != nil {
+			return err
+		}
+	}
+	rg := parquetRowGroup{numRows: int64(len(rows))}
+	for i, f := range w.fields {
+		chunk, err := w.writeColumn(f, w.columns[i], rows)
+		if err != nil {
+			return err
+		}
+		rg.chunks = append(rg.chunks, chunk)
+		rg.totalSize += chunk.uncompressedSize
+		rg.totalCompressed += chunk.compressedSize
+	}
+	w.rowGroups = append(w.rowGroups, rg)
+	w.numRows += rg.numRows
+	return nil
+}
+
+// Close writes the footer of the file. It does not close the underlying
+// io.Writer.
+func (w *ParquetWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.offset == 0 {
+		if err := w.write(parquetMagic); err != nil {
+			return err
+		}
+	}
+	footer := w.footer()
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	for _, b := range [][]byte{footer, size[:], parquetMagic} {
+		if err := w.write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *ParquetWriter) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	return err
+}
+
+// writeColumn writes the values of a field as a column chunk, split into
+// pages of about PageSize bytes.
+func (w *ParquetWriter) writeColumn(f etldata.Field, c parquetColumn, rows []map[string]interface{}) (parquetChunk, error) {
+	chunk := parquetChunk{dataPageOffset: w.offset, numValues: int64(len(rows))}
+	var levels []int32
+	var values []byte
+	var bools []bool
+	n := 0
+	flush := func() error {
+		if n == 0 {
+			return nil
+		}
+		if c.physical == parquetBoolean {
+			values = appendBitPacked(values, bools)
+		}
+		var body []byte
+		if c.optional {
+			levelData := appendRLE(nil, levels, 1)
+			body = make([]byte, 4, 4+len(levelData)+len(values))
+			binary.LittleEndian.PutUint32(body, uint32(len(levelData)))
+			body = append(body, levelData...)
+		}
+		body = append(body, values...)
+		compressed, err := w.Compression.compress(body)
+		if err != nil {
+			return err
+		}
+		var header thriftWriter
+		header.writeStruct(func() {
+			header.i32(1, parquetDataPage)
+			header.i32(2, int32(len(body)))
+			header.i32(3, int32(len(compressed)))
+			header.structField(5, func() {
+				header.i32(1, int32(n))
+				header.i32(2, parquetPlain)
+				header.i32(3, parquetRLE)
+				header.i32(4, parquetRLE)
+			})
+		})
+		if err := w.write(header.buf); err != nil {
+			return err
+		}
+		if err := w.write(compressed); err != nil {
+			return err
+		}
+		chunk.uncompressedSize += int64(len(header.buf) + len(body))
+		chunk.compressedSize += int64(len(header.buf) + len(compressed))
+		levels, values, bools, n = levels[:0], values[:0], bools[:0], 0
+		return nil
+	}
+
+	for i, row := range rows {
+		v := row[f.Name]
+		if v == nil {
+			if !c.optional {
+				return chunk, fmt.Errorf("parquet: record %d: field %q is null", i, f.Name)
+			}
+			levels = append(levels, 0)
+		} else {
+			var err error
+			if c.physical == parquetBoolean {
+				b, ok := v.(bool)
+				if !ok {
+					return chunk, parquetValueError(i, f, v)
+				}
+				bools = append(bools, b)
+			} else if values, err = appendParquetValue(values, f, c, v); err != nil {
+				return chunk, fmt.Errorf("parquet: record %d: %v", i, err)
+			}
+			levels = append(levels, 1)
+		}
+		n++
+		if len(values)+len(bools)/8 >= w.PageSize {
+			if err := flush(); err != nil {
+				return chunk, err
+			}
+		}
+	}
+	return chunk, flush()
+}
+
+func parquetValueError(record int, f etldata.Field, v interface{}) error {
+	return fmt.Errorf("parquet: record %d: field %q: cannot write %T as %v", record, f.Name, v, f.Type)
+}
+
+// appendParquetValue appends the PLAIN encoding of v to buf.
+func appendParquetValue(buf []byte, f etldata.Field, c parquetColumn, v interface{}) ([]byte, error) {
+	fail := func() ([]byte, error) {
+		return nil, fmt.Errorf("field %q: cannot write %T as %v", f.Name, v, f.Type)
+	}
+	switch c.converted {
+	case parquetUTF8:
+		var s string
+		switch vv := v.(type) {
+		case string:
+			s = vv
+		case []byte:
+			s = string(vv)
+		default:
+			return fail()
+		}
+		buf = appendUint32(buf, uint32(len(s)))
+		return append(buf, s...), nil
+	case parquetJSON:
+		js, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", f.Name, err)
+		}
+		buf = appendUint32(buf, uint32(len(js)))
+		return append(buf, js...), nil
+	case parquetTimestampMicros, parquetDate:
+		t, ok := toTime(v, f.TimeFormat())
+		if !ok {
+			return fail()
+		}
+		if c.converted == parquetDate {
+			days := t.Unix() / 86400
+			if t.Unix() < 0 && t.Unix()%86400 != 0 {
+				days--
+			}
+			return appendUint32(buf, uint32(int32(days))), nil
+		}
+		return appendUint64(buf, uint64(t.Unix()*1e6+int64(t.Nanosecond()/1e3))), nil
+	}
+
+	switch c.physical {
+	case parquetInt64:
+		n, ok := toInt64(v)
+		if !ok {
+			return fail()
+		}
+		return appendUint64(buf, uint64(n)), nil
+	case parquetDouble:
+		x, ok := toFloat64(v)
+		if !ok {
+			return fail()
+		}
+		return appendUint64(buf, math.Float64bits(x)), nil
+	}
+	return fail()
+}
+
+// toTime returns the time held by v: a time.Time, an etldata.SQLTime, or a
+// string in the given layout or the format of etldata.SQLTime.
+func toTime(v interface{}, layout string) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case etldata.SQLTime:
+		return t.Time, true
+	case *etldata.SQLTime:
+		return t.Time, t != nil
+	case string:
+		if parsed, err := time.Parse(layout, t); err == nil {
+			return parsed, true
+		}
+		var st etldata.SQLTime
+		if err := st.UnmarshalJSON([]byte(`"` + t + `"`)); err == nil {
+			return st.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int64(n), n == math.Trunc(n) && math.Abs(n) < 1<<63
+	case float32:
+		return int64(n), float64(n) == math.Trunc(float64(n)) && math.Abs(float64(n)) < 1<<63
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), rv.Uint() <= math.MaxInt64
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	if n, ok := v.(json.Number); ok {
+		x, err := n.Float64()
+		return x, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	n, ok := toInt64(v)
+	return float64(n), ok
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v)), uint32(v>>32))
+}
+
+// appendBitPacked appends booleans packed one per bit, least significant
+// bit first.
+func appendBitPacked(buf []byte, bools []bool) []byte {
+	for i := 0; i < len(bools); i += 8 {
+		var b byte
+		for j := 0; j < 8 && i+j < len(bools); j++ {
+			if bools[i+j] {
+				b |= 1 << j
+			}
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
+
+// footer returns the encoded FileMetaData.
+func (w *ParquetWriter) footer() []byte {
+	var t thriftWriter
+	t.writeStruct(func() {
+		t.i32(1, 1)
+		t.structList(2, len(w.columns)+1, func(i int) {
+			if i == 0 {
+				t.string(4, "schema")
+				t.i32(5, int32(len(w.columns)))
+				return
+			}
+			c := w.columns[i-1]
+			t.i32(1, c.physical)
+			if c.optional {
+				t.i32(3, parquetOptional)
+			} else {
+				t.i32(3, parquetRequired)
+			}
+			t.string(4, c.name)
+			if c.converted != parquetNoConvertedType {
+				t.i32(6, c.converted)
+			}
+		})
+		t.i64(3, w.numRows)
+		t.structList(4, len(w.rowGroups), func(i int) {
+			rg := w.rowGroups[i]
+			t.structList(1, len(rg.chunks), func(j int) {
+				chunk, c := rg.chunks[j], w.columns[j]
+				t.i64(2, chunk.dataPageOffset)
+				t.structField(3, func() {
+					t.i32(1, c.physical)
+					t.i32List(2, []int32{parquetPlain, parquetRLE})
+					t.stringList(3, []string{c.name})
+					t.i32(4, int32(w.Compression))
+					t.i64(5, chunk.numValues)
+					t.i64(6, chunk.uncompressedSize)
+					t.i64(7, chunk.compressedSize)
+					t.i64(9, chunk.dataPageOffset)
+				})
+			})
+			t.i64(2, rg.totalSize)
+			t.i64(3, rg.numRows)
+			t.i64(6, rg.totalCompressed)
+		})
+		t.string(6, "goetl")
+	})
+	return t.buf
+}
@@ -20,6 +20,16 @@ import (
 // If onDupKeyUpdate is true, you must set an onDupKeyIndex. This translates
 // to the conflict_target as specified in https://www.postgresql.org/docs/9.5/static/sql-insert.html
 func PostgreSQLInsertData(db *sql.DB, d etldata.Payload, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string, batchSize int) error {
+	return postgresInsertData(db, d, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields, batchSize)
+}
+
+// PostgreSQLInsertDataTx is the same as PostgreSQLInsertData, but the INSERT is
+// executed within the given transaction.
+func PostgreSQLInsertDataTx(tx *sql.Tx, d etldata.Payload, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string, batchSize int) error {
+	return postgresInsertData(tx, d, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields, batchSize)
+}
+
+func postgresInsertData(db preparer, d etldata.Payload, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string, batchSize int) error {
 	objects, err := d.Objects()
 	if err != nil {
 		return err
@@ -42,7 +52,7 @@ func PostgreSQLInsertData(db *sql.DB, d etldata.Payload, tableName string, onDup
 	return postgresInsertObjects(db, objects, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields)
 }
 
-func postgresInsertObjects(db *sql.DB, objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string) error {
+func postgresInsertObjects(db preparer, objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string) error {
 	logger.Info("PostgreSQLInsertData: building INSERT for len(objects) =", len(objects))
 	insertSQL, vals := buildPostgreSQLInsertSQL(objects, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields)
 
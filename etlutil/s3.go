@@ -1,13 +1,13 @@
 package etlutil
 
 import (
-	"compress/gzip"
 	"fmt"
 	"io"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -104,30 +104,51 @@ func DeleteS3Objects(client *s3.S3, bucket string, objKeys []string) (*s3.Delete
 }
 
 // WriteS3Object writes the data to the given key, optionally compressing it first
+// with gzip (see WriteCompressedS3Object)
 func WriteS3Object(data []string, config *aws.Config, bucket string, key string, lineSeparator string, compress bool) (string, error) {
-	var reader io.Reader
-
-	byteReader := strings.NewReader(strings.Join(data, lineSeparator))
-
+	codec := ""
 	if compress {
-		key = fmt.Sprintf("%v.gz", key)
+		codec = CodecGzip
+	}
+	return WriteCompressedS3Object(data, config, bucket, key, lineSeparator, codec, 0)
+}
+
+// WriteCompressedS3Object writes the data to the given key, compressed with
+// the named codec (see Codec) at the given level, 0 being the codec's
+// default. The codec's extension, such as ".gz", is added to the key.
+func WriteCompressedS3Object(data []string, config *aws.Config, bucket, key, lineSeparator, codec string, level int) (string, error) {
+	var reader io.Reader = strings.NewReader(strings.Join(data, lineSeparator))
+	if c, err := LookupCodec(codec); err != nil {
+		return "", err
+	} else if c != nil {
 		pipeReader, pipeWriter := io.Pipe()
+		cw, err := NewCompressWriter(pipeWriter, codec, level)
+		if err != nil {
+			return "", err
+		}
+		key += c.Extension
+		byteReader := reader
 		reader = pipeReader
 
 		go func() {
-			gw := gzip.NewWriter(pipeWriter)
-			io.Copy(gw, byteReader)
-			gw.Close()
-			pipeWriter.Close()
+			_, err := io.Copy(cw, byteReader)
+			if err == nil {
+				err = cw.Close()
+			}
+			pipeWriter.CloseWithError(err)
 		}()
-	} else {
-		reader = byteReader
 	}
 
+	return UploadS3Object(reader, config, bucket, key)
+}
+
+// UploadS3Object uploads everything read from body to the given key,
+// returning the location of the object.
+func UploadS3Object(body io.Reader, config *aws.Config, bucket, key string) (string, error) {
 	uploader := s3manager.NewUploader(session.New(config))
 
 	result, err := uploader.Upload(&s3manager.UploadInput{
-		Body:   reader,
+		Body:   body,
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
@@ -142,3 +163,136 @@ func WriteS3Object(data []string, config *aws.Config, bucket string, key string,
 
 	return result.Location, err
 }
+
+// S3ObjectWriter is an io.WriteCloser uploading what is written to it to
+// an S3 object as it goes, so that writers such as processors.ParquetWriter
+// can write straight to S3. The upload is completed by Close, which returns
+// any error from it.
+type S3ObjectWriter struct {
+	pipe     *io.PipeWriter
+	done     chan struct{}
+	location string
+	err      error
+}
+
+// NewS3ObjectWriter starts uploading to the given key.
+func NewS3ObjectWriter(config *aws.Config, bucket, key string) *S3ObjectWriter {
+	pipeReader, pipeWriter := io.Pipe()
+	w := &S3ObjectWriter{pipe: pipeWriter, done: make(chan struct{})}
+	go func() {
+		w.location, w.err = UploadS3Object(pipeReader, config, bucket, key)
+		pipeReader.CloseWithError(w.err)
+		close(w.done)
+	}()
+	return w
+}
+
+// Write implements io.Writer.
+func (w *S3ObjectWriter) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+// Close finishes the upload.
+func (w *S3ObjectWriter) Close() error {
+	w.pipe.Close()
+	<-w.done
+	return w.err
+}
+
+// Location returns the location of the object once it has been uploaded.
+func (w *S3ObjectWriter) Location() string {
+	<-w.done
+	return w.location
+}
+
+// CloseWithError abandons the upload, so that no object is created.
+func (w *S3ObjectWriter) CloseWithError(err error) error {
+	w.pipe.CloseWithError(err)
+	<-w.done
+	return nil
+}
+
+// S3ObjectStore is an ObjectStore keeping objects in an S3 bucket.
+type S3ObjectStore struct {
+	Bucket string
+	config *aws.Config
+	client *s3.S3
+}
+
+// NewS3ObjectStore returns a new S3ObjectStore for the given bucket.
+func NewS3ObjectStore(config *aws.Config, bucket string) *S3ObjectStore {
+	return &S3ObjectStore{Bucket: bucket, config: config, client: s3.New(session.New(config))}
+}
+
+// List lists the objects under the prefix of the pattern, across all
+// "directories".
+func (s *S3ObjectStore) List(pattern string) ([]ObjectInfo, error) {
+	logger.Debug("S3ObjectStore.List: ", s.Bucket, "-", pattern)
+	params := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(listPrefix(pattern)),
+	}
+	var objects []ObjectInfo
+	err := s.client.ListObjectsV2Pages(params, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:     aws.StringValue(o.Key),
+				Size:    aws.Int64Value(o.Size),
+				ModTime: aws.TimeValue(o.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filterObjects(pattern, objects)
+}
+
+// Open returns the body of the object.
+func (s *S3ObjectStore) Open(key string) (io.ReadCloser, error) {
+	obj, err := GetS3Object(s.client, s.Bucket, key)
+	if err != nil {
+		return nil, s3Error("open", key, err)
+	}
+	return obj.Body, nil
+}
+
+// Create returns an S3ObjectWriter uploading to the object.
+func (s *S3ObjectStore) Create(key string) (io.WriteCloser, error) {
+	return NewS3ObjectWriter(s.config, s.Bucket, key), nil
+}
+
+// Delete deletes the object. S3 does not tell whether there was one.
+func (s *S3ObjectStore) Delete(key string) error {
+	logger.Debug("S3ObjectStore.Delete: ", s.Bucket, "-", key)
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	return s3Error("delete", key, err)
+}
+
+// Stat returns the size and modification time of the object.
+func (s *S3ObjectStore) Stat(key string) (ObjectInfo, error) {
+	head, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectInfo{}, s3Error("stat", key, err)
+	}
+	return ObjectInfo{Key: key, Size: aws.Int64Value(head.ContentLength), ModTime: aws.TimeValue(head.LastModified)}, nil
+}
+
+// s3Error turns the errors S3 returns for missing objects into errors for
+// which os.IsNotExist is true.
+func s3Error(op, key string, err error) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return notExist(op, key)
+		}
+	}
+	return err
+}
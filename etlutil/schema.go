@@ -0,0 +1,147 @@
+package etlutil
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+// TableColumn describes a column of a database table, as returned by
+// MySQLTableColumns and PostgreSQLTableColumns.
+type TableColumn struct {
+	Name     string
+	DataType string // as named by the database's information_schema
+	Nullable bool
+	// HasDefault is true for columns that are filled in when no value is
+	// given, such as auto increment columns.
+	HasDefault bool
+}
+
+// MySQLTableColumns returns the columns of the given table in the current
+// database.
+func MySQLTableColumns(db *sql.DB, tableName string) ([]TableColumn, error) {
+	return tableColumns(db, `SELECT column_name, data_type, is_nullable = 'YES',
+		column_default IS NOT NULL OR extra LIKE '%auto_increment%'
+		FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ?
+		ORDER BY ordinal_position`, tableName)
+}
+
+// PostgreSQLTableColumns returns the columns of the given table, which can
+// be qualified with its schema (otherwise the current schema is used).
+func PostgreSQLTableColumns(db *sql.DB, tableName string) ([]TableColumn, error) {
+	schema, table := "", tableName
+	if i := strings.Index(tableName, "."); i >= 0 {
+		schema, table = tableName[:i], tableName[i+1:]
+	}
+	return tableColumns(db, `SELECT column_name, data_type, is_nullable = 'YES',
+		column_default IS NOT NULL OR is_identity = 'YES'
+		FROM information_schema.columns
+		WHERE table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND table_name = $2
+		ORDER BY ordinal_position`, schema, table)
+}
+
+func tableColumns(db *sql.DB, query string, args ...interface{}) ([]TableColumn, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []TableColumn
+	for rows.Next() {
+		var c TableColumn
+		if err := rows.Scan(&c.Name, &c.DataType, &c.Nullable, &c.HasDefault); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// CheckTableSchema returns an error describing how the given table columns
+// do not fit the records described by the Schema: a field with no column,
+// a field whose type cannot be stored in its column, a nullable field for
+// a NOT NULL column, or a NOT NULL column (without a default) that is not
+// in the Schema. Column types that are not recognised are not checked.
+func CheckTableSchema(schema *etldata.Schema, tableName string, columns []TableColumn) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("table %v does not exist", tableName)
+	}
+	byName := make(map[string]TableColumn)
+	for _, c := range columns {
+		byName[strings.ToLower(c.Name)] = c
+	}
+
+	var problems []string
+	for _, f := range schema.Fields {
+		c, ok := byName[strings.ToLower(f.Name)]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("field %q has no column", f.Name))
+		case !columnAccepts(c.DataType, f.Type):
+			problems = append(problems, fmt.Sprintf("field %q of type %v cannot be stored in column %v of type %v", f.Name, f.Type, c.Name, c.DataType))
+		case f.Nullable && !c.Nullable && !c.HasDefault:
+			problems = append(problems, fmt.Sprintf("field %q is nullable but column %v is NOT NULL", f.Name, c.Name))
+		}
+	}
+	for _, c := range columns {
+		if c.Nullable || c.HasDefault {
+			continue
+		}
+		found := false
+		for _, f := range schema.Fields {
+			if strings.EqualFold(f.Name, c.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("column %v is NOT NULL but has no field", c.Name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("schema does not match table %v: %v", tableName, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// columnAccepts reports whether values of the given field type can be
+// stored in a column of the given data type.
+func columnAccepts(dataType string, t etldata.FieldType) bool {
+	if t == etldata.FieldAny {
+		return true
+	}
+	var accepted []etldata.FieldType
+	switch dt := strings.ToLower(dataType); {
+	case dt == "tinyint" || dt == "smallint" || dt == "mediumint" || dt == "int" ||
+		dt == "integer" || dt == "bigint" || dt == "bit":
+		accepted = []etldata.FieldType{etldata.FieldInteger, etldata.FieldBoolean}
+	case dt == "decimal" || dt == "numeric" || dt == "float" || dt == "double" ||
+		dt == "real" || dt == "double precision" || dt == "money":
+		accepted = []etldata.FieldType{etldata.FieldInteger, etldata.FieldNumber}
+	case dt == "boolean":
+		accepted = []etldata.FieldType{etldata.FieldBoolean}
+	case strings.Contains(dt, "char") || strings.Contains(dt, "text") || dt == "enum" || dt == "set" || dt == "uuid":
+		accepted = []etldata.FieldType{etldata.FieldString, etldata.FieldTimestamp, etldata.FieldDate}
+	case dt == "date":
+		accepted = []etldata.FieldType{etldata.FieldDate, etldata.FieldTimestamp}
+	case strings.HasPrefix(dt, "timestamp") || dt == "datetime":
+		accepted = []etldata.FieldType{etldata.FieldTimestamp, etldata.FieldDate}
+	case dt == "json" || dt == "jsonb":
+		accepted = []etldata.FieldType{etldata.FieldObject, etldata.FieldArray, etldata.FieldString}
+	case dt == "array":
+		accepted = []etldata.FieldType{etldata.FieldArray}
+	default:
+		return true
+	}
+	for _, a := range accepted {
+		if a == t {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,13 @@
 package etlutil
 
 import (
+	"io"
 	"io/ioutil"
+	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
@@ -59,3 +64,143 @@ func SftpKeyAuth(privateKeyPath string) (auth ssh.AuthMethod, err error) {
 
 	return
 }
+
+// SftpObjectStore is an ObjectStore keeping objects as files under the
+// Root directory of an SFTP server, with their keys as paths relative to
+// it. It connects to the server when first used, and Close closes the
+// connection.
+type SftpObjectStore struct {
+	Root       string
+	parameters *SftpParameters
+	client     *sftp.Client
+	ownClient  bool // whether Close closes client
+	mu         sync.Mutex
+}
+
+// NewSftpObjectStore returns a new SftpObjectStore for the given directory
+// of the server.
+func NewSftpObjectStore(server, username, root string, authMethods ...ssh.AuthMethod) *SftpObjectStore {
+	return &SftpObjectStore{
+		Root: root,
+		parameters: &SftpParameters{
+			Server:      server,
+			Username:    username,
+			Path:        root,
+			AuthMethods: authMethods,
+		},
+		ownClient: true,
+	}
+}
+
+// NewSftpObjectStoreByClient returns a new SftpObjectStore using a client
+// that is already connected, which Close leaves open.
+func NewSftpObjectStoreByClient(client *sftp.Client, root string) *SftpObjectStore {
+	return &SftpObjectStore{Root: root, client: client}
+}
+
+// List walks the directories the pattern can match files in.
+func (s *SftpObjectStore) List(pattern string) ([]ObjectInfo, error) {
+	client, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	root := strings.TrimSuffix(s.path("."), "/") + "/"
+	dir := path.Dir(listPrefix(pattern) + "x")
+	var objects []ObjectInfo
+	walker := client.Walk(s.path(dir))
+	for walker.Step() {
+		if err := walker.Err(); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if walker.Stat().IsDir() {
+			continue
+		}
+		key := strings.TrimPrefix(walker.Path(), root)
+		objects = append(objects, ObjectInfo{Key: key, Size: walker.Stat().Size(), ModTime: walker.Stat().ModTime()})
+	}
+	return filterObjects(pattern, objects)
+}
+
+// Open opens the file.
+func (s *SftpObjectStore) Open(key string) (io.ReadCloser, error) {
+	client, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	return client.Open(s.path(key))
+}
+
+// Create creates the file, and the directories it is in.
+func (s *SftpObjectStore) Create(key string) (io.WriteCloser, error) {
+	client, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	p := s.path(key)
+	if err := client.MkdirAll(path.Dir(p)); err != nil {
+		return nil, err
+	}
+	return client.Create(p)
+}
+
+// Delete removes the file.
+func (s *SftpObjectStore) Delete(key string) error {
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	return client.Remove(s.path(key))
+}
+
+// Stat returns the size and modification time of the file.
+func (s *SftpObjectStore) Stat(key string) (ObjectInfo, error) {
+	client, err := s.connect()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := client.Stat(s.path(key))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, notExist("stat", key)
+	}
+	return ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Close closes the connection to the server, if the store opened it.
+func (s *SftpObjectStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ownClient || s.client == nil {
+		return nil
+	}
+	err := s.client.Close()
+	s.client = nil
+	return err
+}
+
+func (s *SftpObjectStore) connect() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		client, err := SftpClient(s.parameters.Server, s.parameters.Username, s.parameters.AuthMethods)
+		if err != nil {
+			return nil, err
+		}
+		s.client = client
+	}
+	return s.client, nil
+}
+
+// path returns the path of the file with the given key, which cannot be
+// outside of Root.
+func (s *SftpObjectStore) path(key string) string {
+	root := s.Root
+	if root == "" {
+		root = "."
+	}
+	return path.Join(root, path.Clean("/"+key))
+}
@@ -1,8 +1,10 @@
 package etlutil
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 
@@ -18,13 +20,33 @@ import (
 // is retrieved from the query. If this happens, the object returned will be a JSON
 // object in the form of {"Error": "description"}.
 func GetDataFromSQLQuery(db *sql.DB, query string, batchSize int, structDest interface{}) (chan etldata.Payload, error) {
-	stmt, err := db.Prepare(query)
+	return GetDataFromSQLQueryContext(context.Background(), db, query, batchSize, structDest)
+}
+
+// GetDataFromSQLQueryContext is the same as GetDataFromSQLQuery, but the query
+// is bound to the given context. Cancelling ctx stops the query and closes the
+// returned data channel. Any args are passed on to the query, for its
+// placeholders.
+func GetDataFromSQLQueryContext(ctx context.Context, db *sql.DB, query string, batchSize int, structDest interface{}, args ...interface{}) (chan etldata.Payload, error) {
+	return getDataFromSQLQuery(ctx, db, query, batchSize, structDest, false, args)
+}
+
+// GetRecordsFromSQLQueryContext is the same as GetDataFromSQLQueryContext,
+// but each batch of rows is sent as an etldata.Records payload holding the
+// scanned values, instead of being encoded as etldata.JSON. Errors are still
+// sent as JSON objects.
+func GetRecordsFromSQLQueryContext(ctx context.Context, db *sql.DB, query string, batchSize int, structDest interface{}, args ...interface{}) (chan etldata.Payload, error) {
+	return getDataFromSQLQuery(ctx, db, query, batchSize, structDest, true, args)
+}
+
+func getDataFromSQLQuery(ctx context.Context, db *sql.DB, query string, batchSize int, structDest interface{}, records bool, args []interface{}) (chan etldata.Payload, error) {
+	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query()
+	rows, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -37,15 +59,15 @@ func GetDataFromSQLQuery(db *sql.DB, query string, batchSize int, structDest int
 	dataChan := make(chan etldata.Payload)
 
 	if structDest != nil {
-		go scanRowsUsingStruct(rows, columns, structDest, batchSize, dataChan)
+		go scanRowsUsingStruct(rows, columns, structDest, batchSize, records, dataChan)
 	} else {
-		go scanDataGeneric(rows, columns, batchSize, dataChan)
+		go scanDataGeneric(rows, columns, batchSize, records, dataChan)
 	}
 
 	return dataChan, nil
 }
 
-func scanRowsUsingStruct(rows *sql.Rows, columns []string, structDest interface{}, batchSize int, dataChan chan etldata.Payload) {
+func scanRowsUsingStruct(rows *sql.Rows, columns []string, structDest interface{}, batchSize int, records bool, dataChan chan etldata.Payload) {
 	defer rows.Close()
 
 	tableData := []map[string]interface{}{}
@@ -56,21 +78,28 @@ func scanRowsUsingStruct(rows *sql.Rows, columns []string, structDest interface{
 			sendErr(err, dataChan)
 		}
 
-		d, err := etldata.NewJSON(structDest)
-		if err != nil {
-			sendErr(err, dataChan)
-		}
+		var entry map[string]interface{}
+		if records {
+			// Records hold the values as they are, so there is no need to
+			// round-trip them through JSON.
+			entry = structToMap(structDest)
+		} else {
+			d, err := etldata.NewJSON(structDest)
+			if err != nil {
+				sendErr(err, dataChan)
+			}
 
-		entry := make(map[string]interface{})
-		err = d.Parse(&entry)
-		if err != nil {
-			sendErr(err, dataChan)
+			entry = make(map[string]interface{})
+			err = d.Parse(&entry)
+			if err != nil {
+				sendErr(err, dataChan)
+			}
 		}
 
 		tableData = append(tableData, entry)
 
 		if batchSize > 0 && len(tableData) >= batchSize {
-			sendTableData(tableData, dataChan)
+			sendTableData(tableData, records, dataChan)
 			tableData = []map[string]interface{}{}
 		}
 	}
@@ -80,13 +109,13 @@ func scanRowsUsingStruct(rows *sql.Rows, columns []string, structDest interface{
 
 	// Flush remaining tableData
 	if len(tableData) > 0 {
-		sendTableData(tableData, dataChan)
+		sendTableData(tableData, records, dataChan)
 	}
 
 	close(dataChan) // signal completion to caller
 }
 
-func scanDataGeneric(rows *sql.Rows, columns []string, batchSize int, dataChan chan etldata.Payload) {
+func scanDataGeneric(rows *sql.Rows, columns []string, batchSize int, records bool, dataChan chan etldata.Payload) {
 	defer rows.Close()
 
 	tableData := []map[string]interface{}{}
@@ -118,7 +147,7 @@ func scanDataGeneric(rows *sql.Rows, columns []string, batchSize int, dataChan c
 		tableData = append(tableData, entry)
 
 		if batchSize > 0 && len(tableData) >= batchSize {
-			sendTableData(tableData, dataChan)
+			sendTableData(tableData, records, dataChan)
 			tableData = []map[string]interface{}{}
 		}
 	}
@@ -128,7 +157,7 @@ func scanDataGeneric(rows *sql.Rows, columns []string, batchSize int, dataChan c
 
 	// Flush remaining tableData
 	if len(tableData) > 0 {
-		sendTableData(tableData, dataChan)
+		sendTableData(tableData, records, dataChan)
 	}
 
 	close(dataChan) // signal completion to caller
@@ -154,7 +183,11 @@ func determineBytesValue(b []byte) (interface{}, error) {
 	}
 }
 
-func sendTableData(tableData []map[string]interface{}, dataChan chan etldata.Payload) {
+func sendTableData(tableData []map[string]interface{}, records bool, dataChan chan etldata.Payload) {
+	if records {
+		dataChan <- etldata.NewRecords(tableData)
+		return
+	}
 	d, err := etldata.NewJSON(tableData)
 	if err != nil {
 		sendErr(err, dataChan)
@@ -163,13 +196,57 @@ func sendTableData(tableData []map[string]interface{}, dataChan chan etldata.Pay
 	}
 }
 
+// structToMap returns the fields of a struct (or a pointer to one) keyed the
+// same way encoding/json would name them, without encoding it.
+func structToMap(v interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	addStructFields(m, reflect.Indirect(reflect.ValueOf(v)))
+	return m
+}
+
+func addStructFields(m map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if n := strings.Index(tag, ","); n >= 0 {
+			name, opts = tag[:n], tag[n:]
+		}
+		fv := v.Field(i)
+		if name == "" && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			addStructFields(m, fv)
+			continue
+		}
+		if f.PkgPath != "" || !fv.CanInterface() {
+			continue // unexported
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(opts, "omitempty") && fv.IsZero() {
+			continue
+		}
+		m[name] = fv.Interface()
+	}
+}
+
 func sendErr(err error, dataChan chan etldata.Payload) {
 	dataChan <- etldata.JSON([]byte(`{"Error":"` + err.Error() + `"}`))
 }
 
 // ExecuteSQLQuery allows you to execute arbitrary SQL statements
 func ExecuteSQLQuery(db *sql.DB, query string) error {
-	_, err := db.Exec(query)
+	return ExecuteSQLQueryContext(context.Background(), db, query)
+}
+
+// ExecuteSQLQueryContext allows you to execute arbitrary SQL statements
+// that are cancelled along with the given context.
+func ExecuteSQLQueryContext(ctx context.Context, db *sql.DB, query string) error {
+	_, err := db.ExecContext(ctx, query)
 	return err
 }
 
@@ -180,6 +257,11 @@ func ExecuteSQLQueryTx(tx *sql.Tx, query string) error {
 	return err
 }
 
+// preparer is implemented by both *sql.DB and *sql.Tx.
+type preparer interface {
+	Prepare(query string) (*sql.Stmt, error)
+}
+
 func sortedColumns(objects []map[string]interface{}) []string {
 	// Since we don't know if all objects have the same keys, we need to
 	// iterate over all the objects to gather all possible keys/columns
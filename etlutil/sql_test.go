@@ -0,0 +1,49 @@
+package etlutil
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type structToMapBase struct {
+	ID int64 `json:"id"`
+}
+
+type structToMapRow struct {
+	structToMapBase
+	Name    string     `json:"name"`
+	Email   string     `json:"email,omitempty"`
+	Secret  string     `json:"-"`
+	Created time.Time  `json:"created_at"`
+	Deleted *time.Time `json:",omitempty"`
+	Plain   int
+	hidden  int
+}
+
+func TestStructToMap(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name string
+		v    interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "tags, embedded and unexported fields",
+			v:    structToMapRow{structToMapBase: structToMapBase{ID: 7}, Name: "a", Secret: "s", Created: at, Plain: 1, hidden: 2},
+			want: map[string]interface{}{"id": int64(7), "name": "a", "created_at": at, "Plain": 1},
+		},
+		{
+			name: "pointer with omitempty fields set",
+			v:    &structToMapRow{Email: "a@b.c", Deleted: &at},
+			want: map[string]interface{}{"id": int64(0), "name": "", "email": "a@b.c", "created_at": time.Time{}, "Deleted": &at, "Plain": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := structToMap(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("structToMap = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Command avrogen writes the Avro fixtures in etlutil/testdata with
+// github.com/linkedin/goavro/v2 v2.12.0, so that AvroOCFReader is tested
+// against files it did not write. It is not part of the goetl module; run
+// it from a module that requires goavro, in the testdata directory.
+package main
+
+import (
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+const schema = `{"type": "record", "name": "Order", "namespace": "com.example", "fields": [
+	{"name": "id", "type": "long"},
+	{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["NEW", "SHIPPED"]}},
+	{"name": "note", "type": ["null", "string"], "default": null},
+	{"name": "total", "type": "double"},
+	{"name": "ratio", "type": "float"},
+	{"name": "qty", "type": "int"},
+	{"name": "paid", "type": "boolean"},
+	{"name": "placed", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+	{"name": "due", "type": {"type": "int", "logicalType": "date"}},
+	{"name": "price", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}},
+	{"name": "tags", "type": {"type": "array", "items": "string"}},
+	{"name": "attrs", "type": {"type": "map", "values": "long"}},
+	{"name": "code", "type": {"type": "fixed", "name": "Code", "size": 2}}
+]}`
+
+func main() {
+	orders := []map[string]interface{}{
+		{
+			"id": int64(1), "status": "SHIPPED", "note": goavro.Union("string", "gift"), "total": 12.5, "ratio": float32(0.5),
+			"qty": int32(2), "paid": true, "placed": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "due": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			"price": big.NewRat(1250, 100), "tags": []interface{}{"a", "b"}, "attrs": map[string]interface{}{"weight": int64(3)}, "code": []byte("AB"),
+		},
+		{
+			"id": int64(-2), "status": "NEW", "note": nil, "total": -0.25, "ratio": float32(-1),
+			"qty": int32(0), "paid": false, "placed": time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC), "due": time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC),
+			"price": big.NewRat(-5, 100), "tags": []interface{}{}, "attrs": map[string]interface{}{}, "code": []byte{0, 255},
+		},
+	}
+	for _, codec := range []string{"null", "deflate", "snappy"} {
+		f, err := os.Create("orders." + codec + ".avro")
+		if err != nil {
+			log.Fatal(err)
+		}
+		w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: f, Schema: schema, CompressionName: codec})
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Each Append writes a block.
+		for _, o := range orders {
+			if err := w.Append([]interface{}{o}); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Command parquetgen writes the Parquet fixtures in etlutil/testdata with
+// github.com/xitongsys/parquet-go v1.6.2, so that ParquetReader is tested
+// against files it did not write. It is not part of the goetl module; run
+// it from a module that requires parquet-go, in the testdata directory.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type Order struct {
+	ID     int64    `parquet:"name=id, type=INT64"`
+	Status *string  `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL"`
+	Total  *float64 `parquet:"name=total, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Paid   *bool    `parquet:"name=paid, type=BOOLEAN, repetitiontype=OPTIONAL"`
+	Placed *int64   `parquet:"name=placed, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	Due    *int32   `parquet:"name=due, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	Cents  int64    `parquet:"name=cents, type=INT64, convertedtype=DECIMAL, scale=2, precision=10"`
+	Qty    int32    `parquet:"name=qty, type=INT32"`
+}
+
+type Delta struct {
+	ID int64 `parquet:"name=id, type=INT64, encoding=DELTA_BINARY_PACKED"`
+}
+
+type Address struct {
+	City string `parquet:"name=city, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type Nested struct {
+	ID      int64   `parquet:"name=id, type=INT64"`
+	Address Address `parquet:"name=address"`
+}
+
+type Repeated struct {
+	ID   int64    `parquet:"name=id, type=INT64"`
+	Tags []string `parquet:"name=tags, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REPEATED"`
+}
+
+func str(s string) *string   { return &s }
+func f64(f float64) *float64 { return &f }
+func b(v bool) *bool         { return &v }
+func i64(v int64) *int64     { return &v }
+func i32(v int32) *int32     { return &v }
+
+func write(name string, obj interface{}, codec parquet.CompressionCodec, rows ...interface{}) {
+	f, err := os.Create(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pw, err := writer.NewParquetWriterFromWriter(f, obj, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pw.CompressionType = codec
+	for _, r := range rows {
+		if err := pw.Write(r); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	orders := []interface{}{
+		Order{ID: 1, Status: str("shipped"), Total: f64(12.5), Paid: b(true), Placed: i64(1704164645000), Due: i32(19724), Cents: 1250, Qty: 2},
+		Order{ID: 2, Status: str("new"), Total: nil, Paid: b(false), Placed: nil, Due: nil, Cents: -5, Qty: 1},
+		Order{ID: 3, Status: str("shipped"), Total: f64(0.25), Paid: nil, Placed: i64(0), Due: i32(-1), Cents: 0, Qty: 10},
+		Order{ID: 4, Status: nil, Total: f64(-3), Paid: b(true), Placed: i64(-1000), Due: i32(0), Cents: 99, Qty: 0},
+	}
+	write("orders.snappy.parquet", new(Order), parquet.CompressionCodec_SNAPPY, orders...)
+	write("orders.gzip.parquet", new(Order), parquet.CompressionCodec_GZIP, orders...)
+	write("orders.zstd.parquet", new(Order), parquet.CompressionCodec_ZSTD, orders...)
+	write("delta.parquet", new(Delta), parquet.CompressionCodec_UNCOMPRESSED, Delta{ID: 1}, Delta{ID: 2})
+	write("nested.parquet", new(Nested), parquet.CompressionCodec_UNCOMPRESSED, Nested{ID: 1, Address: Address{City: "Paris"}})
+	write("repeated.parquet", new(Repeated), parquet.CompressionCodec_UNCOMPRESSED, Repeated{ID: 1, Tags: []string{"a", "b"}})
+}
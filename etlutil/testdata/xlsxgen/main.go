@@ -0,0 +1,59 @@
+// Command xlsxgen writes dates.xlsx in etlutil/testdata with
+// github.com/xuri/excelize/v2 v2.8.1, so that XLSXReader is tested against
+// date and time formats written by another implementation. It is not part
+// of the goetl module; run it from a module that requires excelize, in the
+// testdata directory.
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func main() {
+	f := excelize.NewFile()
+	const sheet = "Dates"
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		log.Fatal(err)
+	}
+	style := func(s *excelize.Style) int {
+		id, err := f.NewStyle(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return id
+	}
+	date := style(&excelize.Style{NumFmt: 14})
+	dateTime := style(&excelize.Style{CustomNumFmt: strPtr("yyyy-mm-dd hh:mm:ss")})
+	timeOfDay := style(&excelize.Style{NumFmt: 21})
+	decimal := style(&excelize.Style{NumFmt: 2})
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := [][]interface{}{
+		{"name", "date", "date time", "time", "amount"},
+		{"first", at, at, at, 12.5},
+		{"leap", time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC), time.Date(1899, 12, 30, 18, 30, 0, 0, time.UTC), -1},
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			log.Fatal(err)
+		}
+		if i == 0 {
+			continue
+		}
+		for col, s := range []int{date, dateTime, timeOfDay, decimal} {
+			cell, _ := excelize.CoordinatesToCellName(col+2, i+1)
+			if err := f.SetCellStyle(sheet, cell, cell, s); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if err := f.SaveAs("dates.xlsx"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func strPtr(s string) *string { return &s }
@@ -0,0 +1,345 @@
+package etlutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The Thrift compact protocol is used to encode the metadata of Parquet
+// files. Only what Parquet needs is implemented: structs are written field
+// by field with a thriftWriter, and read into a generic thriftStruct.
+
+// The compact protocol type ids.
+const (
+	thriftTypeStop   = 0
+	thriftTypeTrue   = 1
+	thriftTypeFalse  = 2
+	thriftTypeByte   = 3
+	thriftTypeI16    = 4
+	thriftTypeI32    = 5
+	thriftTypeI64    = 6
+	thriftTypeDouble = 7
+	thriftTypeBinary = 8
+	thriftTypeList   = 9
+	thriftTypeSet    = 10
+	thriftTypeMap    = 11
+	thriftTypeStruct = 12
+)
+
+// thriftWriter writes a struct in the compact protocol. The fields of each
+// struct must be written in increasing order of their ids.
+type thriftWriter struct {
+	buf     []byte
+	lastIDs []int16 // the last field id written, for each struct being written
+}
+
+func (w *thriftWriter) fieldHeader(id int16, typ byte) {
+	last := &w.lastIDs[len(w.lastIDs)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.varint(int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) varint(v int64) {
+	w.uvarint(uint64(v<<1 ^ v>>63))
+}
+
+func (w *thriftWriter) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (w *thriftWriter) binary(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *thriftWriter) listHeader(typ byte, n int) {
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|typ)
+		return
+	}
+	w.buf = append(w.buf, 0xf0|typ)
+	w.uvarint(uint64(n))
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.fieldHeader(id, thriftTypeI32)
+	w.varint(int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.fieldHeader(id, thriftTypeI64)
+	w.varint(v)
+}
+
+func (w *thriftWriter) bool(id int16, v bool) {
+	if v {
+		w.fieldHeader(id, thriftTypeTrue)
+	} else {
+		w.fieldHeader(id, thriftTypeFalse)
+	}
+}
+
+func (w *thriftWriter) string(id int16, s string) {
+	w.fieldHeader(id, thriftTypeBinary)
+	w.binary([]byte(s))
+}
+
+func (w *thriftWriter) i32List(id int16, vs []int32) {
+	w.fieldHeader(id, thriftTypeList)
+	w.listHeader(thriftTypeI32, len(vs))
+	for _, v := range vs {
+		w.varint(int64(v))
+	}
+}
+
+func (w *thriftWriter) stringList(id int16, ss []string) {
+	w.fieldHeader(id, thriftTypeList)
+	w.listHeader(thriftTypeBinary, len(ss))
+	for _, s := range ss {
+		w.binary([]byte(s))
+	}
+}
+
+// structField writes a struct field, whose own fields are written by fields.
+func (w *thriftWriter) structField(id int16, fields func()) {
+	w.fieldHeader(id, thriftTypeStruct)
+	w.writeStruct(fields)
+}
+
+// structList writes a list of n structs, the fields of the i-th being
+// written by fields(i).
+func (w *thriftWriter) structList(id int16, n int, fields func(i int)) {
+	w.fieldHeader(id, thriftTypeList)
+	w.listHeader(thriftTypeStruct, n)
+	for i := 0; i < n; i++ {
+		w.writeStruct(func() { fields(i) })
+	}
+}
+
+// writeStruct writes a whole struct, whose fields are written by fields.
+func (w *thriftWriter) writeStruct(fields func()) {
+	w.lastIDs = append(w.lastIDs, 0)
+	fields()
+	w.buf = append(w.buf, thriftTypeStop)
+	w.lastIDs = w.lastIDs[:len(w.lastIDs)-1]
+}
+
+// thriftStruct holds the fields of a decoded struct by id. The values are
+// int64 for all integers, bool, float64, []byte, thriftStruct, or
+// []interface{} for lists and sets. Maps are skipped.
+type thriftStruct map[int16]interface{}
+
+func (s thriftStruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s thriftStruct) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s thriftStruct) bool(id int16) bool {
+	v, _ := s[id].(bool)
+	return v
+}
+
+func (s thriftStruct) string(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s thriftStruct) structField(id int16) thriftStruct {
+	v, _ := s[id].(thriftStruct)
+	return v
+}
+
+func (s thriftStruct) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
+
+func (s thriftStruct) structList(id int16) []thriftStruct {
+	var structs []thriftStruct
+	for _, v := range s.list(id) {
+		if st, ok := v.(thriftStruct); ok {
+			structs = append(structs, st)
+		}
+	}
+	return structs
+}
+
+var errThriftData = errors.New("thrift: invalid compact protocol data")
+
+// thriftReader decodes compact protocol structs.
+type thriftReader struct {
+	r     io.ByteReader
+	depth int
+}
+
+// readThriftStruct decodes the struct at the start of data, returning it
+// along with the number of bytes it takes up.
+func readThriftStruct(data []byte) (thriftStruct, int, error) {
+	r := &sliceByteReader{data: data}
+	s, err := (&thriftReader{r: r}).readStruct()
+	return s, r.pos, err
+}
+
+type sliceByteReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *sliceByteReader) ReadByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	r.pos++
+	return r.data[r.pos-1], nil
+}
+
+func (r *thriftReader) uvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(r.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
+}
+
+func (r *thriftReader) varint() (int64, error) {
+	u, err := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1), err
+}
+
+func (r *thriftReader) readStruct() (thriftStruct, error) {
+	if r.depth++; r.depth > 64 {
+		return nil, errThriftData
+	}
+	defer func() { r.depth-- }()
+
+	s := make(thriftStruct)
+	var id int16
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		typ := b & 0x0f
+		if typ == thriftTypeStop {
+			return s, nil
+		}
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		switch typ {
+		case thriftTypeTrue, thriftTypeFalse:
+			s[id] = typ == thriftTypeTrue
+		default:
+			v, err := r.readValue(typ)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				s[id] = v
+			}
+		}
+	}
+}
+
+func (r *thriftReader) readValue(typ byte) (interface{}, error) {
+	switch typ {
+	case thriftTypeTrue, thriftTypeFalse:
+		// Booleans in lists are a byte each.
+		b, err := r.r.ReadByte()
+		return b == thriftTypeTrue, err
+	case thriftTypeByte:
+		b, err := r.r.ReadByte()
+		return int64(int8(b)), err
+	case thriftTypeI16, thriftTypeI32, thriftTypeI64:
+		return r.varint()
+	case thriftTypeDouble:
+		var b [8]byte
+		for i := range b {
+			c, err := r.r.ReadByte()
+			if err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+			b[i] = c
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[:])), nil
+	case thriftTypeBinary:
+		n, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > 1<<30 {
+			return nil, errThriftData
+		}
+		b := make([]byte, n)
+		for i := range b {
+			if b[i], err = r.r.ReadByte(); err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+		}
+		return b, nil
+	case thriftTypeList, thriftTypeSet:
+		h, err := r.r.ReadByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		n := uint64(h >> 4)
+		if n == 15 {
+			if n, err = r.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		if n > 1<<24 {
+			return nil, errThriftData
+		}
+		list := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := r.readValue(h & 0x0f)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case thriftTypeMap:
+		n, err := r.uvarint()
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		kv, err := r.r.ReadByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		for i := uint64(0); i < n; i++ {
+			if _, err := r.readValue(kv >> 4); err != nil {
+				return nil, err
+			}
+			if _, err := r.readValue(kv & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case thriftTypeStruct:
+		return r.readStruct()
+	}
+	return nil, fmt.Errorf("thrift: unknown type %d", typ)
+}
@@ -37,6 +37,17 @@ func (t *Timer) Duration() time.Duration {
 	return time.Now().Sub(t.startTime)
 }
 
+// StartTime returns the time the Timer was started.
+func (t *Timer) StartTime() time.Time {
+	return t.startTime
+}
+
+// EndTime returns the time the Timer was stopped, or the zero Time if it
+// is still running.
+func (t *Timer) EndTime() time.Time {
+	return t.endTime
+}
+
 func (t *Timer) String() string {
 	if t.Stopped() {
 		return fmt.Sprintf("Ran in %v secs", t.Duration().Seconds())
@@ -0,0 +1,396 @@
+package etlutil
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrXLSXSheet is returned by XLSXReader.ReadRows for a sheet that is not in
+// the workbook.
+var ErrXLSXSheet = errors.New("xlsx: no such sheet")
+
+// XLSXReader reads the sheets of an Excel workbook (an .xlsx file). The
+// rows of a sheet are streamed with ReadRows, without holding the whole
+// sheet in memory.
+//
+// Cells are read as strings, booleans, json.Number for numbers, and
+// time.Time for numbers formatted as dates or times. Errors such as #N/A
+// are read as strings, and the cached values of formulas are used.
+type XLSXReader struct {
+	zip       *zip.Reader
+	sheets    []string
+	paths     map[string]string // sheet name -> path in the zip
+	strings   []string
+	dateStyle []bool // whether each cell style is a date format
+	date1904  bool
+}
+
+// NewXLSXReader opens the workbook held by r, of the given size.
+func NewXLSXReader(r io.ReaderAt, size int64) (*XLSXReader, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: %v", err)
+	}
+	x := &XLSXReader{zip: z, paths: make(map[string]string)}
+	if err := x.readWorkbook(); err != nil {
+		return nil, err
+	}
+	if err := x.readSharedStrings(); err != nil {
+		return nil, err
+	}
+	if err := x.readStyles(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Sheets returns the names of the sheets, in the order of the workbook.
+func (x *XLSXReader) Sheets() []string {
+	return x.sheets
+}
+
+// ReadRows calls fn with the values of each row of the sheet with the given
+// name (or the first sheet if name is ""), indexed by column. Missing and
+// empty cells are nil, and rows with no values at all are skipped. The values of the
+// row are only valid during the call.
+func (x *XLSXReader) ReadRows(name string, fn func(row []interface{}) error) error {
+	if name == "" && len(x.sheets) > 0 {
+		name = x.sheets[0]
+	}
+	p, ok := x.paths[name]
+	if !ok {
+		return ErrXLSXSheet
+	}
+	f, err := x.open(p)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return fmt.Errorf("xlsx: %v is missing", p)
+	}
+	defer f.Close()
+
+	dec := xml.NewDecoder(f)
+	var row []interface{}
+	for {
+		t, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("xlsx: %v: %v", name, err)
+		}
+		switch se := t.(type) {
+		case xml.StartElement:
+			switch se.Name.Local {
+			case "row":
+				row = row[:0]
+			case "c":
+				var c xlsxCell
+				if err := dec.DecodeElement(&c, &se); err != nil {
+					return fmt.Errorf("xlsx: %v: %v", name, err)
+				}
+				col := len(row)
+				if c.Ref != "" {
+					if col, err = xlsxColumnIndex(c.Ref); err != nil {
+						return fmt.Errorf("xlsx: %v: %v", name, err)
+					}
+				}
+				v, err := x.cellValue(c)
+				if err != nil {
+					return fmt.Errorf("xlsx: %v: cell %v: %v", name, c.Ref, err)
+				}
+				for len(row) <= col {
+					row = append(row, nil)
+				}
+				row[col] = v
+			}
+		case xml.EndElement:
+			if se.Name.Local == "row" && !xlsxEmpty(row) {
+				if err := fn(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func xlsxEmpty(row []interface{}) bool {
+	for _, v := range row {
+		if v != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// xlsxCell is a <c> element of a sheet.
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  int    `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text []string `xml:"t"`
+		Runs []string `xml:"r>t"`
+	} `xml:"is"`
+}
+
+func (x *XLSXReader) cellValue(c xlsxCell) (interface{}, error) {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(x.strings) {
+			return nil, fmt.Errorf("invalid shared string %q", c.Value)
+		}
+		return x.strings[i], nil
+	case "inlineStr":
+		return strings.Join(c.Inline.Text, "") + strings.Join(c.Inline.Runs, ""), nil
+	case "str", "e":
+		return c.Value, nil
+	case "b":
+		return c.Value == "1" || c.Value == "true", nil
+	case "d":
+		// ISO 8601, which Excel itself does not write.
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02", "15:04:05"} {
+			if t, err := time.Parse(layout, c.Value); err == nil {
+				return t, nil
+			}
+		}
+		return c.Value, nil
+	}
+	if c.Value == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(c.Value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", c.Value)
+	}
+	if c.Style >= 0 && c.Style < len(x.dateStyle) && x.dateStyle[c.Style] {
+		return xlsxTime(n, x.date1904), nil
+	}
+	return json.Number(c.Value), nil
+}
+
+// open opens a file of the zip, returning nil if there is no such file.
+func (x *XLSXReader) open(name string) (io.ReadCloser, error) {
+	for _, f := range x.zip.File {
+		if f.Name == name {
+			return f.Open()
+		}
+	}
+	return nil, nil
+}
+
+// decode decodes the XML file with the given name, returning false if
+// there is no such file.
+func (x *XLSXReader) decode(name string, v interface{}) (bool, error) {
+	f, err := x.open(name)
+	if err != nil || f == nil {
+		return false, err
+	}
+	defer f.Close()
+	if err := xml.NewDecoder(f).Decode(v); err != nil {
+		return false, fmt.Errorf("xlsx: %v: %v", name, err)
+	}
+	return true, nil
+}
+
+func (x *XLSXReader) readWorkbook() error {
+	var wb struct {
+		Properties struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if ok, err := x.decode("xl/workbook.xml", &wb); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("xlsx: not a workbook")
+	}
+	x.date1904 = wb.Properties.Date1904 == "1" || wb.Properties.Date1904 == "true"
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if _, err := x.decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join("xl", rel.Target)
+		}
+	}
+	for i, s := range wb.Sheets {
+		p, ok := targets[s.ID]
+		if !ok {
+			p = fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		}
+		x.sheets = append(x.sheets, s.Name)
+		x.paths[s.Name] = p
+	}
+	return nil
+}
+
+func (x *XLSXReader) readSharedStrings() error {
+	f, err := x.open("xl/sharedStrings.xml")
+	if err != nil || f == nil {
+		return err
+	}
+	defer f.Close()
+	// Each <si> is decoded on its own, to keep the text of its <t>
+	// elements (directly or in rich text runs) but not phonetic hints.
+	dec := xml.NewDecoder(f)
+	for {
+		t, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("xlsx: shared strings: %v", err)
+		}
+		if se, ok := t.(xml.StartElement); ok && se.Name.Local == "si" {
+			var si struct {
+				Text []string `xml:"t"`
+				Runs []string `xml:"r>t"`
+			}
+			if err := dec.DecodeElement(&si, &se); err != nil {
+				return fmt.Errorf("xlsx: shared strings: %v", err)
+			}
+			x.strings = append(x.strings, strings.Join(si.Text, "")+strings.Join(si.Runs, ""))
+		}
+	}
+}
+
+func (x *XLSXReader) readStyles() error {
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if _, err := x.decode("xl/styles.xml", &styles); err != nil {
+		return err
+	}
+	custom := make(map[int]string)
+	for _, f := range styles.NumFmts {
+		custom[f.ID] = f.Code
+	}
+	for _, xf := range styles.CellXfs {
+		code, ok := custom[xf.NumFmtID]
+		x.dateStyle = append(x.dateStyle, ok && isDateFormat(code) || !ok && isDateFormatID(xf.NumFmtID))
+	}
+	return nil
+}
+
+// isDateFormatID returns whether a built-in number format is a date or
+// time format.
+func isDateFormatID(id int) bool {
+	return id >= 14 && id <= 22 || id >= 27 && id <= 36 || id >= 45 && id <= 47 || id >= 50 && id <= 58
+}
+
+// isDateFormat returns whether a custom number format code formats dates
+// or times, ignoring literal text, colors and conditions.
+func isDateFormat(code string) bool {
+	inQuote, inBracket := false, false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case inQuote:
+			inQuote = c != '"'
+		case inBracket:
+			inBracket = c != ']'
+		case c == '"':
+			inQuote = true
+		case c == '[':
+			inBracket = true
+		case c == '\\' || c == '_' || c == '*':
+			i++ // the next character is literal, or padding
+		case strings.IndexByte("dmyhsDMYHS", c) >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	xlsxEpoch     = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	xlsxEpoch1904 = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// xlsxTime converts a date serial number to a time, rounded to the
+// millisecond. In the 1900 date system, serial number 60 is the 29th of
+// February 1900, which did not exist, so earlier dates are a day off.
+func xlsxTime(serial float64, date1904 bool) time.Time {
+	epoch := xlsxEpoch
+	if date1904 {
+		epoch = xlsxEpoch1904
+	} else if serial >= 1 && serial < 61 {
+		serial++
+	}
+	days := math.Floor(serial)
+	ms := math.Round((serial - days) * 86400e3)
+	return epoch.AddDate(0, 0, int(days)).Add(time.Duration(ms) * time.Millisecond)
+}
+
+// xlsxSerial converts a time to a date serial number in the 1900 date
+// system, using its wall clock.
+func xlsxSerial(t time.Time) float64 {
+	utc := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	serial := float64(utc.Sub(xlsxEpoch)) / float64(24*time.Hour)
+	if serial >= 2 && serial < 61 {
+		serial-- // see xlsxTime
+	}
+	return serial
+}
+
+// xlsxColumnIndex returns the zero-based column of a cell reference such as
+// "C5".
+func xlsxColumnIndex(ref string) (int, error) {
+	col := 0
+	for i := 0; i < len(ref); i++ {
+		c := ref[i]
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		if c < 'A' || c > 'Z' {
+			if i == 0 {
+				break
+			}
+			return col - 1, nil
+		}
+		col = col*26 + int(c-'A') + 1
+	}
+	return 0, fmt.Errorf("invalid cell reference %q", ref)
+}
+
+// xlsxColumnName returns the letters of a zero-based column, such as "AA"
+// for 26.
+func xlsxColumnName(col int) string {
+	var name []byte
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = append([]byte{byte('A' + (col-1)%26)}, name...)
+	}
+	return string(name)
+}
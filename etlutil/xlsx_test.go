@@ -0,0 +1,265 @@
+package etlutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+func TestXLSXRoundTrip(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("EST", -5*3600))
+	var buf bytes.Buffer
+	w := NewXLSXWriter(&buf)
+	rows := map[string][][]interface{}{
+		"Orders": {
+			{"id", "name", "paid", "day", "at", "total", "tags"},
+			{1, "a & <b>", true, day, etldata.SQLTime{Time: at}, json.Number("1.5"), []string{"x"}},
+			{int64(2), nil, false, nil, nil, 0.25, nil},
+			{},
+			{"NaN", json.Number("not a number")},
+		},
+		"Empty": {{nil, nil}},
+	}
+	for _, sheet := range []string{"Orders", "Empty"} {
+		for _, row := range rows[sheet] {
+			if err := w.WriteRow(sheet, row); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewXLSXReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Sheets(); !reflect.DeepEqual(got, []string{"Orders", "Empty"}) {
+		t.Errorf("Sheets = %v", got)
+	}
+	tests := []struct {
+		sheet string
+		want  [][]interface{}
+	}{
+		{
+			sheet: "", // the first sheet
+			want: [][]interface{}{
+				{"id", "name", "paid", "day", "at", "total", "tags"},
+				// Times are written with their wall clock.
+				{json.Number("1"), "a & <b>", true, day, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), json.Number("1.5"), `["x"]`},
+				{json.Number("2"), nil, false, nil, nil, json.Number("0.25")},
+				{"NaN", "not a number"},
+			},
+		},
+		{sheet: "Empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sheet, func(t *testing.T) {
+			var got [][]interface{}
+			err := r.ReadRows(tt.sheet, func(row []interface{}) error {
+				got = append(got, append([]interface{}(nil), row...))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if err := r.ReadRows("Missing", func([]interface{}) error { return nil }); err != ErrXLSXSheet {
+		t.Errorf("ReadRows of a missing sheet error = %v", err)
+	}
+}
+
+// TestXLSXReaderExcel reads a workbook laid out as Excel writes them, with
+// shared strings, custom date formats and the 1904 date system.
+func TestXLSXReaderExcel(t *testing.T) {
+	files := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<workbookPr date1904="1"/><sheets><sheet name="Data" sheetId="1" r:id="rId7"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId7" Target="/xl/worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>plain</t></si><si><r><t>rich </t></r><r><t>text</t></r><rPh><t>hint</t></rPh></si></sst>`,
+		"xl/styles.xml": `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<numFmts><numFmt numFmtId="164" formatCode="[Red]&quot;day&quot;\ d/m/yyyy"/><numFmt numFmtId="165" formatCode="0.00&quot;h&quot;"/></numFmts>` +
+			`<cellXfs><xf numFmtId="0"/><xf numFmtId="164"/><xf numFmtId="165"/><xf numFmtId="14"/></cellXfs></styleSheet>`,
+		"xl/worksheets/data.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>` +
+			`<row r="2"><c r="A2" s="1"><v>1.5</v></c><c r="B2" s="2"><v>1.5</v></c><c r="C2" s="3"><v>0</v></c></row>` +
+			`<row r="3"><c r="A3" t="str"><f>A1</f><v>plain</v></c><c r="B3" t="e"><v>#N/A</v></c><c r="C3" t="d"><v>2024-01-02</v></c></row>` +
+			`<row r="4"><c r="B4"/></row>` +
+			`</sheetData></worksheet>`,
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readXLSXRows(t, buf.Bytes(), "Data")
+	want := [][]interface{}{
+		{"plain", nil, "rich text"},
+		{time.Date(1904, 1, 2, 12, 0, 0, 0, time.UTC), json.Number("1.5"), time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"plain", "#N/A", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
+
+// readXLSXRows returns the rows of a sheet of the given workbook.
+func readXLSXRows(t *testing.T, data []byte, sheet string) [][]interface{} {
+	t.Helper()
+	r, err := NewXLSXReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]interface{}
+	err = r.ReadRows(sheet, func(row []interface{}) error {
+		rows = append(rows, append([]interface{}(nil), row...))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+// TestXLSXReaderFixtures reads workbooks written by other applications:
+// excel.xlsx was saved by Excel for Mac (it is Book1.xlsx from the tests of
+// github.com/xuri/excelize, whose second sheet has had an inline string
+// added), and dates.xlsx is written by testdata/xlsxgen.
+func TestXLSXReaderFixtures(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		file  string
+		sheet string
+		want  [][]interface{}
+	}{
+		{
+			file:  "excel.xlsx",
+			sheet: "Sheet1",
+			want: [][]interface{}{
+				{"Total:", json.Number("237")},
+				{nil, nil, "Column1", "Column2"},
+				{"GitHub"},
+			},
+		},
+		{
+			file:  "excel.xlsx",
+			sheet: "Sheet2",
+			want: [][]interface{}{
+				{"Monitor", nil, "Brand", nil, "inlineStr"},
+				{"> 23 Inch", json.Number("19"), "HP", json.Number("200")},
+				{"20-23 Inch", json.Number("24"), "DELL", json.Number("450")},
+				{"17-20 Inch", json.Number("56"), "Lenove", json.Number("200")},
+				{"< 17 Inch", json.Number("21"), "SONY", json.Number("510")},
+				{nil, nil, "Acer", json.Number("315")},
+				{nil, nil, "IBM", json.Number("127")}, // rich text
+				{nil, nil, "ASUS", json.Number("89")},
+				{nil, nil, "Apple", json.Number("348")},
+				{nil, nil, "SAMSUNG", json.Number("53")},
+				// Formulas without cached values are empty.
+				{nil, nil, "Other", json.Number("37"), nil, nil, nil, nil, nil},
+			},
+		},
+		{
+			file:  "dates.xlsx",
+			sheet: "Dates",
+			want: [][]interface{}{
+				{"name", "date", "date time", "time", "amount"},
+				{"first", at, at, at, json.Number("12.5")},
+				// excelize writes times before 1900 as inline strings.
+				{"leap", time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC), "1899-12-30T18:30:00Z", json.Number("-1")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.sheet, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readXLSXRows(t, data, tt.sheet); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXLSXDates(t *testing.T) {
+	tests := []struct {
+		serial float64
+		want   time.Time
+	}{
+		{serial: 1, want: time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{serial: 59, want: time.Date(1900, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{serial: 61, want: time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{serial: 45293.5, want: time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)},
+		{serial: 0.25, want: time.Date(1899, 12, 30, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := xlsxTime(tt.serial, false); !got.Equal(tt.want) {
+			t.Errorf("xlsxTime(%v) = %v, want %v", tt.serial, got, tt.want)
+		}
+		if got := xlsxSerial(tt.want); got != tt.serial {
+			t.Errorf("xlsxSerial(%v) = %v, want %v", tt.want, got, tt.serial)
+		}
+	}
+}
+
+func TestXLSXNames(t *testing.T) {
+	for col, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumnName(col); got != name {
+			t.Errorf("xlsxColumnName(%d) = %v, want %v", col, got, name)
+		}
+		if got, err := xlsxColumnIndex(name + "12"); err != nil || got != col {
+			t.Errorf("xlsxColumnIndex(%v12) = %v, %v, want %v", name, got, err, col)
+		}
+	}
+	if _, err := xlsxColumnIndex("12"); err == nil {
+		t.Error("no error for a reference without a column")
+	}
+
+	formats := map[string]bool{
+		"yyyy-mm-dd": true, "h:mm AM/PM": true, "[$-409]d-mmm": true,
+		"0.00": false, `0.00" days"`: false, "[Red]#,##0": false, `#\d`: false,
+	}
+	for code, want := range formats {
+		if got := isDateFormat(code); got != want {
+			t.Errorf("isDateFormat(%q) = %v", code, got)
+		}
+	}
+
+	w := NewXLSXWriter(&bytes.Buffer{})
+	for _, name := range []string{"", "a/b", "[x]", "a very long sheet name of 32 char"} {
+		if err := w.WriteRow(name, nil); err == nil {
+			t.Errorf("no error for the sheet name %q", name)
+		}
+	}
+	if err := w.WriteRow("Sheet", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow("SHEET", nil); err == nil {
+		t.Error("no error for a sheet name differing only in case")
+	}
+}
@@ -0,0 +1,242 @@
+package etlutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+// XLSXWriter writes an Excel workbook (an .xlsx file) with one or more
+// sheets. Rows are added to the sheets with WriteRow, in any order, and the
+// workbook is written to the underlying io.Writer by Close, so the sheets
+// are held in memory until then.
+//
+// Strings, booleans and numbers (of any Go type, or json.Number) are
+// written as such, and times (time.Time or etldata.SQLTime) as dates, with
+// the time of day unless it is midnight. Other values are written as JSON.
+type XLSXWriter struct {
+	w      io.Writer
+	sheets []*xlsxSheet
+	names  map[string]bool // lower case, as sheet names are case insensitive
+}
+
+type xlsxSheet struct {
+	name string
+	data bytes.Buffer // the <row> elements
+	rows int
+}
+
+// NewXLSXWriter returns a new XLSXWriter writing to w.
+func NewXLSXWriter(w io.Writer) *XLSXWriter {
+	return &XLSXWriter{w: w, names: make(map[string]bool)}
+}
+
+// The cell styles of the workbook, see xlsxStyles.
+const (
+	xlsxStyleDate     = 1
+	xlsxStyleDateTime = 2
+)
+
+// WriteRow adds a row to the sheet with the given name, adding the sheet
+// to the workbook if it is new. Nil values are left empty.
+func (w *XLSXWriter) WriteRow(sheet string, row []interface{}) error {
+	s, err := w.sheet(sheet)
+	if err != nil {
+		return err
+	}
+	s.rows++
+	fmt.Fprintf(&s.data, `<row r="%d">`, s.rows)
+	for i, v := range row {
+		if v == nil {
+			continue
+		}
+		ref := xlsxColumnName(i) + strconv.Itoa(s.rows)
+		if err := writeXLSXCell(&s.data, ref, v); err != nil {
+			return fmt.Errorf("xlsx: %v!%v: %v", sheet, ref, err)
+		}
+	}
+	s.data.WriteString(`</row>`)
+	return nil
+}
+
+func (w *XLSXWriter) sheet(name string) (*xlsxSheet, error) {
+	for _, s := range w.sheets {
+		if s.name == name {
+			return s, nil
+		}
+	}
+	if name == "" || len([]rune(name)) > 31 || strings.ContainsAny(name, `:\/?*[]`) {
+		return nil, fmt.Errorf("xlsx: invalid sheet name %q", name)
+	}
+	if w.names[strings.ToLower(name)] {
+		return nil, fmt.Errorf("xlsx: sheet name %q differs from another only in case", name)
+	}
+	w.names[strings.ToLower(name)] = true
+	s := &xlsxSheet{name: name}
+	w.sheets = append(w.sheets, s)
+	return s, nil
+}
+
+func writeXLSXCell(buf *bytes.Buffer, ref string, v interface{}) error {
+	switch vv := v.(type) {
+	case string:
+		writeXLSXString(buf, ref, vv)
+		return nil
+	case bool:
+		b := 0
+		if vv {
+			b = 1
+		}
+		fmt.Fprintf(buf, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		return nil
+	case json.Number:
+		if _, err := strconv.ParseFloat(string(vv), 64); err != nil {
+			writeXLSXString(buf, ref, string(vv))
+		} else {
+			fmt.Fprintf(buf, `<c r="%s"><v>%s</v></c>`, ref, vv)
+		}
+		return nil
+	case time.Time:
+		writeXLSXTime(buf, ref, vv)
+		return nil
+	case etldata.SQLTime:
+		writeXLSXTime(buf, ref, vv.Time)
+		return nil
+	case *etldata.SQLTime:
+		writeXLSXTime(buf, ref, vv.Time)
+		return nil
+	}
+	if n, ok := toInt64(v); ok {
+		fmt.Fprintf(buf, `<c r="%s"><v>%d</v></c>`, ref, n)
+		return nil
+	}
+	if x, ok := toFloat64(v); ok {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			writeXLSXString(buf, ref, fmt.Sprint(x))
+		} else {
+			fmt.Fprintf(buf, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(x, 'g', -1, 64))
+		}
+		return nil
+	}
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	writeXLSXString(buf, ref, string(js))
+	return nil
+}
+
+func writeXLSXString(buf *bytes.Buffer, ref, s string) {
+	fmt.Fprintf(buf, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+	xml.EscapeText(buf, []byte(s))
+	buf.WriteString(`</t></is></c>`)
+}
+
+func writeXLSXTime(buf *bytes.Buffer, ref string, t time.Time) {
+	style := xlsxStyleDateTime
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		style = xlsxStyleDate
+	}
+	fmt.Fprintf(buf, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(xlsxSerial(t), 'f', -1, 64))
+}
+
+const xlsxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// xlsxStyles has the default cell style, then xlsxStyleDate and
+// xlsxStyleDateTime.
+const xlsxStyles = xlsxHeader + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd"/><numFmt numFmtId="165" formatCode="yyyy\-mm\-dd\ hh:mm:ss"/></numFmts>` +
+	`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// Close writes the workbook. A workbook needs at least one sheet, so an
+// empty "Sheet1" is added if no row has been written. It does not close
+// the underlying io.Writer.
+func (w *XLSXWriter) Close() error {
+	if len(w.sheets) == 0 {
+		w.sheet("Sheet1")
+	}
+	z := zip.NewWriter(w.w)
+	add := func(name string, parts ...string) error {
+		f, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		for _, p := range parts {
+			if _, err := io.WriteString(f, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var types, sheets, rels strings.Builder
+	for i, s := range w.sheets {
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlAttr(s.name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(w.sheets)+1)
+
+	err := add("[Content_Types].xml", xlsxHeader,
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`,
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`,
+		`<Default Extension="xml" ContentType="application/xml"/>`,
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`,
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`,
+		types.String(), `</Types>`)
+	if err == nil {
+		err = add("_rels/.rels", xlsxHeader,
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`,
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>`,
+			`</Relationships>`)
+	}
+	if err == nil {
+		err = add("xl/workbook.xml", xlsxHeader,
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`,
+			`<sheets>`, sheets.String(), `</sheets></workbook>`)
+	}
+	if err == nil {
+		err = add("xl/_rels/workbook.xml.rels", xlsxHeader,
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`, rels.String(), `</Relationships>`)
+	}
+	if err == nil {
+		err = add("xl/styles.xml", xlsxStyles)
+	}
+	for i, s := range w.sheets {
+		if err != nil {
+			break
+		}
+		err = add(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxHeader,
+			`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`,
+			s.data.String(), `</sheetData></worksheet>`)
+		s.data.Reset()
+	}
+	if err != nil {
+		return fmt.Errorf("xlsx: %v", err)
+	}
+	return z.Close()
+}
+
+// xmlAttr escapes s for use in an attribute value.
+func xmlAttr(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -1,10 +1,21 @@
 package goetl
 
 import (
+	"math/rand"
+	"sort"
+	"sync"
 	"time"
 )
 
+// latencySamples is how many ProcessData durations are kept per Processor
+// to estimate the latency percentiles in a StatsSnapshot.
+const latencySamples = 1024
+
+// executionStat is embedded in each DataProcessor. It is updated from
+// several goroutines (the stage, branchOut and any concurrent workers),
+// so every field is guarded by statMutex.
 type executionStat struct {
+	statMutex           sync.Mutex
 	dataSentCounter     int
 	dataReceivedCounter int
 	executionsCounter   int
@@ -14,25 +25,165 @@ type executionStat struct {
 	avgBytesReceived    int
 	totalBytesSent      int
 	avgBytesSent        int
+	retriesCounter      int
+	skippedCounter      int
+	deadLetterCounter   int
+	running             int
+
+	// Kept for StatsSnapshot.
+	statName           string
+	startedAt          time.Time
+	finishedAt         time.Time
+	recordsSentCounter int
+	recordsRecvCounter int
+	minBytesReceived   int
+	maxBytesReceived   int
+	minBytesSent       int
+	maxBytesSent       int
+	minExecutionTime   float64
+	maxExecutionTime   float64
+	completedCounter   int
+	latencies          []float64 // a reservoir sample of execution times
+	blockedTime        float64
+
+	// Set by the Pipeline when it has a MetricsSink.
+	metrics      MetricsSink
+	metricLabels Labels
 }
 
 func (s *executionStat) recordExecution(foo func()) {
-	s.executionsCounter++
 	st := time.Now()
+	s.statMutex.Lock()
+	s.executionsCounter++
+	s.running++
+	if s.startedAt.IsZero() {
+		s.startedAt = st
+	}
+	s.statMutex.Unlock()
+
 	foo()
-	s.totalExecutionTime += time.Now().Sub(st).Seconds()
+	elapsed := time.Now().Sub(st).Seconds()
+
+	s.statMutex.Lock()
+	s.totalExecutionTime += elapsed
+	s.running--
+	s.recordLatency(elapsed)
+	s.statMutex.Unlock()
+	if s.metrics != nil {
+		s.metrics.Histogram(MetricProcessingSeconds, s.metricLabels, elapsed)
+	}
 }
 
-func (s *executionStat) recordDataSent(b []byte) {
+func (s *executionStat) recordDataSent(size int) {
+	s.statMutex.Lock()
+	if s.dataSentCounter == 0 || size < s.minBytesSent {
+		s.minBytesSent = size
+	}
+	if size > s.maxBytesSent {
+		s.maxBytesSent = size
+	}
 	s.dataSentCounter++
-	s.totalBytesSent += len(b)
+	s.totalBytesSent += size
+	s.statMutex.Unlock()
+	if s.metrics != nil {
+		s.metrics.Counter(MetricPayloadsSent, s.metricLabels, 1)
+		s.metrics.Counter(MetricBytesSent, s.metricLabels, float64(size))
+	}
 }
 
-func (s *executionStat) recordDataReceived(b []byte) {
+func (s *executionStat) recordDataReceived(size int) {
+	s.statMutex.Lock()
+	if s.dataReceivedCounter == 0 || size < s.minBytesReceived {
+		s.minBytesReceived = size
+	}
+	if size > s.maxBytesReceived {
+		s.maxBytesReceived = size
+	}
 	s.dataReceivedCounter++
-	s.totalBytesReceived += len(b)
+	s.totalBytesReceived += size
+	s.statMutex.Unlock()
+	if s.metrics != nil {
+		s.metrics.Counter(MetricPayloadsReceived, s.metricLabels, 1)
+		s.metrics.Counter(MetricBytesReceived, s.metricLabels, float64(size))
+	}
+}
+
+// recordLatency must be called with statMutex held.
+func (s *executionStat) recordLatency(elapsed float64) {
+	if s.completedCounter == 0 || elapsed < s.minExecutionTime {
+		s.minExecutionTime = elapsed
+	}
+	if elapsed > s.maxExecutionTime {
+		s.maxExecutionTime = elapsed
+	}
+	s.completedCounter++
+	if len(s.latencies) < latencySamples {
+		s.latencies = append(s.latencies, elapsed)
+	} else if i := rand.Intn(s.completedCounter); i < latencySamples {
+		s.latencies[i] = elapsed
+	}
+}
+
+func (s *executionStat) recordRecordsSent(n int) {
+	s.statMutex.Lock()
+	s.recordsSentCounter += n
+	s.statMutex.Unlock()
+}
+
+func (s *executionStat) recordRecordsReceived(n int) {
+	s.statMutex.Lock()
+	s.recordsRecvCounter += n
+	s.statMutex.Unlock()
+}
+
+// recordBlocked adds time spent waiting for the next stage to take a payload.
+func (s *executionStat) recordBlocked(d time.Duration) {
+	s.statMutex.Lock()
+	s.blockedTime += d.Seconds()
+	s.statMutex.Unlock()
 }
 
+func (s *executionStat) recordFinished() {
+	s.statMutex.Lock()
+	s.finishedAt = time.Now()
+	s.statMutex.Unlock()
+}
+
+func (s *executionStat) recordRetry() {
+	s.statMutex.Lock()
+	s.retriesCounter++
+	s.statMutex.Unlock()
+	if s.metrics != nil {
+		s.metrics.Counter(MetricRetries, s.metricLabels, 1)
+	}
+}
+
+func (s *executionStat) recordSkip() {
+	s.statMutex.Lock()
+	s.skippedCounter++
+	s.statMutex.Unlock()
+	if s.metrics != nil {
+		s.metrics.Counter(MetricSkipped, s.metricLabels, 1)
+	}
+}
+
+func (s *executionStat) recordDeadLetter() {
+	s.statMutex.Lock()
+	s.deadLetterCounter++
+	s.statMutex.Unlock()
+	if s.metrics != nil {
+		s.metrics.Counter(MetricDeadLettered, s.metricLabels, 1)
+	}
+}
+
+// runningExecutions returns the number of ProcessData calls in progress.
+func (s *executionStat) runningExecutions() int {
+	s.statMutex.Lock()
+	defer s.statMutex.Unlock()
+	return s.running
+}
+
+// calculate must be called with statMutex held.
 func (s *executionStat) calculate() {
 	if s.executionsCounter > 0 {
 		s.avgExecutionTime = (s.totalExecutionTime / float64(s.executionsCounter))
@@ -44,3 +195,82 @@ func (s *executionStat) calculate() {
 		s.avgBytesSent = (s.totalBytesSent / s.dataSentCounter)
 	}
 }
+
+func (s *executionStat) processorStats(stage int, processor string) ProcessorStats {
+	s.statMutex.Lock()
+	defer s.statMutex.Unlock()
+	s.calculate()
+	return ProcessorStats{
+		Stage:              stage,
+		Processor:          processor,
+		PayloadsSent:       s.dataSentCounter,
+		PayloadsReceived:   s.dataReceivedCounter,
+		Executions:         s.executionsCounter,
+		TotalExecutionTime: s.totalExecutionTime,
+		AvgExecutionTime:   s.avgExecutionTime,
+		TotalBytesSent:     s.totalBytesSent,
+		AvgBytesSent:       s.avgBytesSent,
+		TotalBytesReceived: s.totalBytesReceived,
+		AvgBytesReceived:   s.avgBytesReceived,
+		Retries:            s.retriesCounter,
+		Skipped:            s.skippedCounter,
+		DeadLettered:       s.deadLetterCounter,
+	}
+}
+
+func (s *executionStat) processorSnapshot() ProcessorSnapshot {
+	s.statMutex.Lock()
+	defer s.statMutex.Unlock()
+	ps := ProcessorSnapshot{
+		Processor:        s.statName,
+		Executions:       s.executionsCounter,
+		PayloadsReceived: s.dataReceivedCounter,
+		PayloadsSent:     s.dataSentCounter,
+		RecordsReceived:  s.recordsRecvCounter,
+		RecordsSent:      s.recordsSentCounter,
+		BytesReceived:    PayloadSizeStats{s.totalBytesReceived, s.minBytesReceived, s.maxBytesReceived},
+		BytesSent:        PayloadSizeStats{s.totalBytesSent, s.minBytesSent, s.maxBytesSent},
+		BlockedSeconds:   s.blockedTime,
+		Retries:          s.retriesCounter,
+		Skipped:          s.skippedCounter,
+		DeadLettered:     s.deadLetterCounter,
+	}
+	if s.blockedTime < s.totalExecutionTime {
+		ps.WorkingSeconds = s.totalExecutionTime - s.blockedTime
+	}
+	if len(s.latencies) > 0 {
+		sorted := append([]float64(nil), s.latencies...)
+		sort.Float64s(sorted)
+		ps.Latency = LatencyStats{
+			Min: s.minExecutionTime,
+			P50: percentile(sorted, 50),
+			P95: percentile(sorted, 95),
+			P99: percentile(sorted, 99),
+			Max: s.maxExecutionTime,
+		}
+	}
+	if !s.startedAt.IsZero() {
+		started := s.startedAt
+		ps.StartedAt = &started
+		end := time.Now()
+		if !s.finishedAt.IsZero() {
+			finished := s.finishedAt
+			ps.FinishedAt = &finished
+			end = finished
+		}
+		if secs := end.Sub(started).Seconds(); secs > 0 {
+			ps.RecordsReceivedPerSecond = float64(s.recordsRecvCounter) / secs
+			ps.RecordsSentPerSecond = float64(s.recordsSentCounter) / secs
+		}
+	}
+	return ps
+}
+
+// percentile returns the nearest-rank pth percentile of sorted.
+func percentile(sorted []float64, p int) float64 {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
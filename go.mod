@@ -3,13 +3,20 @@ module github.com/teambenny/goetl
 go 1.14
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/aws/aws-sdk-go v1.44.60
 	github.com/dailyburn/bigquery v0.0.0-20171116202005-b6f18972580e
+	github.com/go-sql-driver/mysql v1.6.0
+	github.com/golang/snappy v1.0.0
 	github.com/google/uuid v1.6.0
 	github.com/jlaffaye/ftp v0.0.0-20220630165035-11536801d1ff
 	github.com/kisielk/sqlstruct v0.0.0-20210630145711-dae28ed37023
+	github.com/klauspost/compress v1.13.1
+	github.com/lib/pq v1.10.9
 	github.com/pkg/sftp v1.13.5
+	github.com/ulikunitz/xz v0.5.15
 	golang.org/x/crypto v0.0.0-20220622213112-05595931fe9d
 	golang.org/x/oauth2 v0.0.0-20220718184931-c8730f7fcb92 // indirect
 	google.golang.org/api v0.88.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
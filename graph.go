@@ -0,0 +1,213 @@
+package goetl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Graph is an alternative to building a PipelineLayout stage by stage.
+// Processors are added to the Graph and connected to each other with
+// directed edges, and the Graph works out the PipelineStages by sorting
+// the Processors topologically. Unlike Outputs within a PipelineLayout,
+// an edge can skip over any number of stages, so there is no need to wire
+// data through Passthrough processors. For example:
+//
+//     graph := goetl.NewGraph().
+//             Add(read, transform, writeCSV, writeSQL).
+//             Connect(read, transform).
+//             Connect(transform, writeCSV).
+//             Connect(read, writeSQL) // skips a stage
+//     pipeline, err := graph.Pipeline()
+//
+// Each Processor is placed in the stage just after the latest stage of the
+// Processors sending data to it. Processors that nothing sends data to are
+// placed in the first stage and receive the StartSignal, and Processors that
+// send data nowhere (the writers) are placed in the final stage.
+type Graph struct {
+	nodes []*DataProcessor
+	err   error
+}
+
+// NewGraph returns a new, empty Graph.
+func NewGraph() *Graph {
+	return &Graph{}
+}
+
+// Add adds Processors to the Graph. A *DataProcessor (as returned by Do)
+// can also be added, for example to set an ErrorPolicy with OnError. Its
+// Outputs are kept as edges in the Graph.
+func (g *Graph) Add(processors ...Processor) *Graph {
+	for _, p := range processors {
+		if p == nil {
+			g.setErr(errors.New("Graph: cannot add a nil Processor"))
+			continue
+		}
+		dp, ok := p.(*DataProcessor)
+		if !ok {
+			dp = Do(p)
+		}
+		if g.node(dp.Processor) != nil {
+			g.setErr(fmt.Errorf("Graph: Processor (%v) was added more than once", dp))
+			continue
+		}
+		g.nodes = append(g.nodes, dp)
+	}
+	return g
+}
+
+// Connect adds an edge to the Graph, so that data sent by the "from"
+// Processor is received by the "to" Processor. Processors that have not
+// been added to the Graph yet are added automatically.
+func (g *Graph) Connect(from, to Processor) *Graph {
+	if from == nil || to == nil {
+		g.setErr(errors.New("Graph: cannot connect a nil Processor"))
+		return g
+	}
+	from, to = unwrapDataProcessor(from), unwrapDataProcessor(to)
+	if from == to {
+		g.setErr(fmt.Errorf("Graph: Processor (%v) cannot be connected to itself", from))
+		return g
+	}
+	if g.node(from) == nil {
+		g.Add(from)
+	}
+	if g.node(to) == nil {
+		g.Add(to)
+	}
+	dp := g.node(from)
+	for _, out := range dp.outputs {
+		if out == to {
+			g.setErr(fmt.Errorf("Graph: Processor (%v) is already connected to (%v)", from, to))
+			return g
+		}
+	}
+	dp.outputs = append(dp.outputs, to)
+	return g
+}
+
+// Layout sorts the Graph into a PipelineLayout. An error is returned if
+// the Graph is empty, contains a cycle, or if there was an error while
+// adding Processors or edges.
+func (g *Graph) Layout() (*PipelineLayout, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	if len(g.nodes) == 0 {
+		return nil, errors.New("Graph: must have at least one Processor")
+	}
+	for _, dp := range g.nodes {
+		for _, out := range dp.outputs {
+			if g.node(out) == nil {
+				return nil, fmt.Errorf("Graph: Processor (%v) Outputs point to Processor (%v) which is not in the Graph", dp, out)
+			}
+		}
+	}
+
+	levels, err := g.sort()
+	if err != nil {
+		return nil, err
+	}
+
+	final := 0
+	for _, level := range levels {
+		if level > final {
+			final = level
+		}
+	}
+	stages := make([]*PipelineStage, final+1)
+	for i := range stages {
+		stages[i] = NewPipelineStage()
+	}
+	for _, dp := range g.nodes {
+		level := levels[dp]
+		if len(dp.outputs) == 0 {
+			level = final
+		}
+		stages[level].processors = append(stages[level].processors, dp)
+	}
+	l := &PipelineLayout{stages}
+	if err := l.Validate(); err != nil {
+		return nil, fmt.Errorf("Graph: %v", err)
+	}
+	return l, nil
+}
+
+// Pipeline returns a new Pipeline ready to run the Graph. See Layout.
+func (g *Graph) Pipeline() (*Pipeline, error) {
+	layout, err := g.Layout()
+	if err != nil {
+		return nil, err
+	}
+	return NewBranchingPipeline(layout), nil
+}
+
+// sort assigns each DataProcessor a level (its stage index) using Kahn's
+// algorithm, where the level is the length of the longest path to it.
+func (g *Graph) sort() (map[*DataProcessor]int, error) {
+	inputs := make(map[*DataProcessor]int)
+	for _, dp := range g.nodes {
+		for _, out := range dp.outputs {
+			inputs[g.node(out)]++
+		}
+	}
+
+	queue := []*DataProcessor{}
+	for _, dp := range g.nodes {
+		if inputs[dp] == 0 {
+			queue = append(queue, dp)
+		}
+	}
+
+	levels := make(map[*DataProcessor]int)
+	sorted := 0
+	for len(queue) > 0 {
+		dp := queue[0]
+		queue = queue[1:]
+		sorted++
+		for _, out := range dp.outputs {
+			to := g.node(out)
+			if levels[dp]+1 > levels[to] {
+				levels[to] = levels[dp] + 1
+			}
+			inputs[to]--
+			if inputs[to] == 0 {
+				queue = append(queue, to)
+			}
+		}
+	}
+
+	if sorted < len(g.nodes) {
+		cycle := []string{}
+		for _, dp := range g.nodes {
+			if inputs[dp] > 0 {
+				cycle = append(cycle, fmt.Sprintf("(%v)", dp))
+			}
+		}
+		return nil, fmt.Errorf("Graph: contains a cycle, unable to sort Processors %s", strings.Join(cycle, ", "))
+	}
+	return levels, nil
+}
+
+// node returns the DataProcessor wrapping the given Processor, or nil.
+func (g *Graph) node(p Processor) *DataProcessor {
+	for _, dp := range g.nodes {
+		if dp.Processor == p {
+			return dp
+		}
+	}
+	return nil
+}
+
+func (g *Graph) setErr(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+func unwrapDataProcessor(p Processor) Processor {
+	if dp, ok := p.(*DataProcessor); ok {
+		return dp.Processor
+	}
+	return p
+}
@@ -0,0 +1,125 @@
+package goetl_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teambenny/goetl"
+)
+
+func TestGraphLayout(t *testing.T) {
+	a, b, c, d := &testSource{name: "a"}, &testSource{name: "b"}, &testSource{name: "c"}, &testSource{name: "d"}
+	tests := []struct {
+		name    string
+		graph   func() *goetl.Graph
+		want    string
+		wantErr string
+	}{
+		{
+			name: "skipped stage",
+			graph: func() *goetl.Graph {
+				return goetl.NewGraph().Add(a, b, c, d).Connect(a, b).Connect(b, c).Connect(a, d)
+			},
+			want: "stage 1: a -> b, d\nstage 2: b -> c\nstage 3: c, d",
+		},
+		{
+			name: "diamond",
+			graph: func() *goetl.Graph {
+				return goetl.NewGraph().Connect(a, b).Connect(a, c).Connect(b, d).Connect(c, d)
+			},
+			want: "stage 1: a -> b, c\nstage 2: b -> d; c -> d\nstage 3: d",
+		},
+		{
+			name: "longest path",
+			graph: func() *goetl.Graph {
+				return goetl.NewGraph().Connect(a, c).Connect(a, b).Connect(b, c).Connect(c, d)
+			},
+			want: "stage 1: a -> c, b\nstage 2: b -> c\nstage 3: c -> d\nstage 4: d",
+		},
+		{
+			name: "several sources",
+			graph: func() *goetl.Graph {
+				return goetl.NewGraph().Add(goetl.Do(a).Outputs(c)).Connect(b, c)
+			},
+			want: "stage 1: a -> c; b -> c\nstage 2: c",
+		},
+		{
+			name: "cycle",
+			graph: func() *goetl.Graph {
+				return goetl.NewGraph().Connect(a, b).Connect(b, c).Connect(c, b).Connect(c, d)
+			},
+			wantErr: "contains a cycle, unable to sort Processors (b), (c)",
+		},
+		{
+			name:    "connected to itself",
+			graph:   func() *goetl.Graph { return goetl.NewGraph().Connect(a, a) },
+			wantErr: "cannot be connected to itself",
+		},
+		{
+			name:    "connected twice",
+			graph:   func() *goetl.Graph { return goetl.NewGraph().Connect(a, b).Connect(a, b) },
+			wantErr: "is already connected to (b)",
+		},
+		{
+			name:    "added twice",
+			graph:   func() *goetl.Graph { return goetl.NewGraph().Add(a, b, a) },
+			wantErr: "was added more than once",
+		},
+		{
+			name:    "nil",
+			graph:   func() *goetl.Graph { return goetl.NewGraph().Add(nil) },
+			wantErr: "cannot add a nil Processor",
+		},
+		{
+			name:    "empty",
+			graph:   goetl.NewGraph,
+			wantErr: "must have at least one Processor",
+		},
+		{
+			name:    "output not in graph",
+			graph:   func() *goetl.Graph { return goetl.NewGraph().Add(goetl.Do(a).Outputs(b)) },
+			wantErr: "Outputs point to Processor (b) which is not in the Graph",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := tt.graph().Layout()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := layout.String(); got != tt.want {
+				t.Errorf("layout =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphPipeline(t *testing.T) {
+	read := &testSource{name: "read", data: []string{`{"a":1}`, `{"a":2}`}}
+	transform := &flakyProcessor{}
+	write, archive := &testSink{}, &testSink{}
+	p, err := goetl.NewGraph().
+		Add(read, transform, goetl.Do(write).Named("write"), goetl.Do(archive).Named("archive")).
+		Connect(read, transform).
+		Connect(transform, write).
+		Connect(read, archive).
+		Pipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := p.Execute(); r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	for _, s := range []*testSink{write, archive} {
+		if !reflect.DeepEqual(s.got, read.data) || s.finished != 1 {
+			t.Errorf("got %v and finished %d times, want %v", s.got, s.finished, read.data)
+		}
+	}
+}
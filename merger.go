@@ -0,0 +1,535 @@
+package goetl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+// Merger controls how a DataProcessor receiving data from several
+// Processors combines its inputs into the single stream of payloads
+// passed to ProcessData. See DataProcessor.Merge.
+//
+// By default (without a Merger) payloads are passed on in whatever order
+// they arrive. The built-in Mergers are RoundRobinMerger, OrderedMerger and
+// HashJoinMerger.
+//
+// Merge should send to output until all the inputs are closed, or until
+// ctx is done. Any input left open when Merge returns is drained by the
+// Pipeline. Returning an error halts the Pipeline.
+type Merger interface {
+	Merge(ctx context.Context, inputs []MergeInput, output chan etldata.Payload) error
+}
+
+// MergeInput is a single input to a Merger: the data sent by the
+// Processor From.
+type MergeInput struct {
+	From Processor
+	Data chan etldata.Payload
+}
+
+// Merge sets the Merger used to combine the data this Processor
+// receives from several Processors. See Merger.
+func (dp *DataProcessor) Merge(merger Merger) *DataProcessor {
+	dp.merger = merger
+	return dp
+}
+
+// mergeInWith runs the DataProcessor's Merger over its inputs.
+func (dp *DataProcessor) mergeInWith(ctx context.Context, wg *sync.WaitGroup) {
+	inputs := make([]MergeInput, len(dp.mergeInChans))
+	for i := range dp.mergeInChans {
+		inputs[i] = MergeInput{From: dp.mergeInFrom[i], Data: dp.mergeInChans[i]}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := dp.merger.Merge(ctx, inputs, dp.inputChan); err != nil && ctx.Err() == nil {
+			dp.killChan <- err
+		}
+		// Drain whatever the Merger left behind (all at once, since the
+		// inputs may share an upstream brancher), so nothing upstream blocks.
+		var drain sync.WaitGroup
+		drain.Add(len(inputs))
+		for _, in := range inputs {
+			go func(c chan etldata.Payload) {
+				for range c {
+				}
+				drain.Done()
+			}(in.Data)
+		}
+		drain.Wait()
+		close(dp.inputChan)
+	}()
+}
+
+// RoundRobinMerger interleaves its inputs, passing on one payload from
+// each open input in turn.
+type RoundRobinMerger struct{}
+
+// NewRoundRobinMerger returns a new RoundRobinMerger.
+func NewRoundRobinMerger() *RoundRobinMerger {
+	return &RoundRobinMerger{}
+}
+
+// Merge implements Merger.
+func (m *RoundRobinMerger) Merge(ctx context.Context, inputs []MergeInput, output chan etldata.Payload) error {
+	open := make([]chan etldata.Payload, len(inputs))
+	for i := range inputs {
+		open[i] = inputs[i].Data
+	}
+	for len(open) > 0 {
+		next := open[:0]
+		for _, c := range open {
+			d, ok := receiveData(ctx, c)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if !ok {
+				continue
+			}
+			if !sendData(ctx, output, d) {
+				return nil
+			}
+			next = append(next, c)
+		}
+		open = next
+	}
+	return nil
+}
+
+// OrderedMerger merges inputs that are each already sorted by Key (such as
+// the results of SQL queries with an ORDER BY), keeping the merged objects
+// sorted. Each object of the received payloads is compared by its Key value
+// (see compareKeys), and the merged objects are sent as etldata.JSON arrays
+// of up to BatchSize objects.
+type OrderedMerger struct {
+	Key       func(obj map[string]interface{}) interface{}
+	BatchSize int // defaults to 1000
+}
+
+// NewOrderedMerger returns a new OrderedMerger. See KeyPath for a
+// simple key extractor.
+func NewOrderedMerger(key func(obj map[string]interface{}) interface{}) *OrderedMerger {
+	return &OrderedMerger{Key: key, BatchSize: 1000}
+}
+
+// orderedInput holds the objects received but not yet merged from a single input.
+type orderedInput struct {
+	data    chan etldata.Payload
+	objects []map[string]interface{}
+}
+
+// fill makes sure there is an object to compare, returning false once
+// the input is closed and empty.
+func (in *orderedInput) fill(ctx context.Context) (bool, error) {
+	for len(in.objects) == 0 {
+		d, ok := receiveData(ctx, in.data)
+		if !ok {
+			return false, nil
+		}
+		objects, err := d.Objects()
+		if err != nil {
+			return false, err
+		}
+		in.objects = objects
+	}
+	return true, nil
+}
+
+// Merge implements Merger.
+func (m *OrderedMerger) Merge(ctx context.Context, inputs []MergeInput, output chan etldata.Payload) error {
+	open := []*orderedInput{}
+	for _, in := range inputs {
+		open = append(open, &orderedInput{data: in.Data})
+	}
+
+	batch := newObjectBatcher(ctx, output, m.BatchSize)
+	for {
+		// Find the input with the lowest key, dropping any inputs that are done.
+		var lowest *orderedInput
+		var lowestKey interface{}
+		next := open[:0]
+		for _, in := range open {
+			ok, err := in.fill(ctx)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			next = append(next, in)
+			key := m.Key(in.objects[0])
+			if lowest == nil || compareKeys(key, lowestKey) < 0 {
+				lowest, lowestKey = in, key
+			}
+		}
+		open = next
+		if ctx.Err() != nil {
+			return nil
+		}
+		if lowest == nil {
+			return batch.flush()
+		}
+
+		obj := lowest.objects[0]
+		lowest.objects = lowest.objects[1:]
+		if err := batch.add(obj); err != nil {
+			return err
+		}
+	}
+}
+
+// HashJoinMerger joins objects received from the Build Processor with the
+// objects received from every other input (the "probe" side), where the value
+// at BuildKeyPath equals the value at ProbeKeyPath (see KeyPath). All of the
+// build side is collected in memory first, then the probe side is streamed,
+// sending one merged etldata.JSON object per matching pair.
+//
+// The merged object has all the keys of both objects. When both objects
+// have the same key, the probe value is kept unless BuildPrefix is set, in
+// which case every key from the build object is prefixed with BuildPrefix.
+//
+// By default only matching pairs are sent (an inner join). Set KeepUnmatched
+// to also send the probe objects without a match, as they are (a left join).
+// Objects without a value at their key path never match, as with NULL in SQL:
+// they are left out of the build side, and are unmatched on the probe side.
+//
+// Payloads that arrive on the probe side before the build side is complete
+// are buffered, since both sides may be fed by the same upstream Processor.
+// MaxBuffered bounds that buffer (DefaultHashJoinMaxBuffered when zero, and
+// no bound when negative); Merge fails once more payloads than that arrive,
+// rather than running out of memory.
+type HashJoinMerger struct {
+	Build         Processor
+	BuildKeyPath  string
+	ProbeKeyPath  string
+	BuildPrefix   string
+	KeepUnmatched bool
+	MaxBuffered   int
+}
+
+// DefaultHashJoinMaxBuffered is the number of probe payloads a
+// HashJoinMerger buffers by default while collecting the build side.
+const DefaultHashJoinMaxBuffered = 10000
+
+// NewHashJoinMerger returns a new HashJoinMerger that collects the data sent
+// by build, and joins it with the other inputs using the given key paths.
+func NewHashJoinMerger(build Processor, buildKeyPath, probeKeyPath string) *HashJoinMerger {
+	return &HashJoinMerger{Build: build, BuildKeyPath: buildKeyPath, ProbeKeyPath: probeKeyPath}
+}
+
+// Merge implements Merger.
+func (m *HashJoinMerger) Merge(ctx context.Context, inputs []MergeInput, output chan etldata.Payload) error {
+	// Make sure the probe goroutine below stops if we return early.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var build chan etldata.Payload
+	probes := []chan etldata.Payload{}
+	for _, in := range inputs {
+		if in.From == m.Build {
+			build = in.Data
+		} else {
+			probes = append(probes, in.Data)
+		}
+	}
+	if build == nil {
+		return fmt.Errorf("HashJoinMerger: build Processor (%v) is not one of the inputs", m.Build)
+	}
+
+	// The probe side is buffered while the build side is collected, since
+	// both sides may be fed by the same upstream Processor.
+	maxBuffered := m.MaxBuffered
+	if maxBuffered == 0 {
+		maxBuffered = DefaultHashJoinMaxBuffered
+	}
+	probe := make(chan etldata.Payload)
+	go func() {
+		mergeFIFO(ctx, probes, probe)
+		close(probe)
+	}()
+	buffered := []etldata.Payload{}
+	table := make(map[string][]map[string]interface{})
+	buildKey := KeyPath(m.BuildKeyPath)
+	for build != nil {
+		select {
+		case d, ok := <-build:
+			if !ok {
+				build = nil
+				continue
+			}
+			objects, err := d.Objects()
+			if err != nil {
+				return err
+			}
+			for _, obj := range objects {
+				v := buildKey(obj)
+				if v == nil {
+					continue
+				}
+				key := hashKey(v)
+				table[key] = append(table[key], obj)
+			}
+		case d, ok := <-probe:
+			if !ok {
+				probe = nil
+				continue
+			}
+			if maxBuffered > 0 && len(buffered) == maxBuffered {
+				return fmt.Errorf("HashJoinMerger: more than %d probe payloads arrived before the build side was complete", maxBuffered)
+			}
+			buffered = append(buffered, d)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	probeKey := KeyPath(m.ProbeKeyPath)
+	send := func(obj map[string]interface{}) error {
+		d, err := etldata.NewJSON(obj)
+		if err != nil {
+			return err
+		}
+		sendData(ctx, output, d)
+		return nil
+	}
+	join := func(d etldata.Payload) error {
+		objects, err := d.Objects()
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			var matches []map[string]interface{}
+			if v := probeKey(obj); v != nil {
+				matches = table[hashKey(v)]
+			}
+			if len(matches) == 0 && m.KeepUnmatched {
+				if err := send(obj); err != nil {
+					return err
+				}
+			}
+			for _, match := range matches {
+				if err := send(m.merge(match, obj)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, d := range buffered {
+		if err := join(d); err != nil {
+			return err
+		}
+	}
+	for probe != nil {
+		d, ok := receiveData(ctx, probe)
+		if !ok {
+			break
+		}
+		if err := join(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *HashJoinMerger) merge(build, probe map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(build)+len(probe))
+	for k, v := range build {
+		merged[m.BuildPrefix+k] = v
+	}
+	for k, v := range probe {
+		if _, ok := merged[k]; ok && m.BuildPrefix != "" {
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// KeyPath returns a key extractor for the value at the given path within
+// an object, where nested objects are separated by dots (e.g. "customer.id").
+// The extractor returns nil if there is no value at the path.
+func KeyPath(path string) func(obj map[string]interface{}) interface{} {
+	keys := strings.Split(path, ".")
+	return func(obj map[string]interface{}) interface{} {
+		var v interface{} = obj
+		for _, k := range keys {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			v = m[k]
+		}
+		return v
+	}
+}
+
+// compareKeys compares two key values, returning -1, 0 or 1. Numbers of
+// any type (including the native ints of etldata.Records and json.Number)
+// are compared numerically; anything else is compared by its string form.
+// nil is lower than any other value.
+func compareKeys(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if ai, aok := intKey(a); aok {
+		if bi, bok := intKey(b); bok {
+			return compareOrdered(ai < bi, ai > bi)
+		}
+	}
+	if af, aok := floatKey(a); aok {
+		if bf, bok := floatKey(b); bok {
+			return compareOrdered(af < bf, af > bf)
+		}
+	}
+	return strings.Compare(hashKey(a), hashKey(b))
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// intKey returns a key value of an integer type as an int64, so that large
+// ids are compared exactly.
+func intKey(v interface{}) (int64, bool) {
+	if n, ok := v.(json.Number); ok {
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), rv.Uint() <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// floatKey returns a key value of any number type as a float64.
+func floatKey(v interface{}) (float64, bool) {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// hashKey returns the string form of a key value, so that the same id
+// matches whether it was sent as a string or a number of any type.
+func hashKey(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if i, ok := intKey(v); ok {
+		return strconv.FormatInt(i, 10)
+	}
+	if f, ok := floatKey(v); ok && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// objectBatcher collects objects and sends them on as etldata.JSON arrays.
+type objectBatcher struct {
+	ctx     context.Context
+	output  chan etldata.Payload
+	size    int
+	objects []map[string]interface{}
+}
+
+func newObjectBatcher(ctx context.Context, output chan etldata.Payload, size int) *objectBatcher {
+	if size <= 0 {
+		size = 1
+	}
+	return &objectBatcher{ctx: ctx, output: output, size: size}
+}
+
+func (b *objectBatcher) add(obj map[string]interface{}) error {
+	b.objects = append(b.objects, obj)
+	if len(b.objects) >= b.size {
+		return b.flush()
+	}
+	return nil
+}
+
+func (b *objectBatcher) flush() error {
+	if len(b.objects) == 0 {
+		return nil
+	}
+	d, err := etldata.NewJSON(b.objects)
+	if err != nil {
+		return err
+	}
+	b.objects = nil
+	sendData(b.ctx, b.output, d)
+	return nil
+}
+
+// mergeFIFO passes on the data from all the inputs in whatever order it arrives.
+func mergeFIFO(ctx context.Context, inputs []chan etldata.Payload, output chan etldata.Payload) {
+	var wg sync.WaitGroup
+	wg.Add(len(inputs))
+	for _, in := range inputs {
+		go func(c chan etldata.Payload) {
+			defer wg.Done()
+			for {
+				d, ok := receiveData(ctx, c)
+				if !ok || !sendData(ctx, output, d) {
+					return
+				}
+			}
+		}(in)
+	}
+	wg.Wait()
+}
+
+// receiveData receives from c, returning false if c is closed or ctx is done.
+func receiveData(ctx context.Context, c chan etldata.Payload) (etldata.Payload, bool) {
+	select {
+	case d, ok := <-c:
+		return d, ok
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// sendData sends d on c, returning false if ctx is done first.
+func sendData(ctx context.Context, c chan etldata.Payload, d etldata.Payload) bool {
+	select {
+	case c <- d:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
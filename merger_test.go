@@ -0,0 +1,200 @@
+package goetl_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+)
+
+// recordsSource sends each of its batches as etldata.Records.
+type recordsSource struct {
+	name    string
+	batches [][]map[string]interface{}
+}
+
+func (s *recordsSource) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	for _, rows := range s.batches {
+		outputChan <- etldata.NewRecords(rows)
+	}
+}
+
+func (s *recordsSource) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (s *recordsSource) String() string {
+	return s.name
+}
+
+// gatedSource sends its data once wait is closed, then closes done.
+type gatedSource struct {
+	name       string
+	data       []string
+	wait, done chan struct{}
+}
+
+func (s *gatedSource) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+}
+
+func (s *gatedSource) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	if s.wait != nil {
+		select {
+		case <-s.wait:
+		case <-ctx.Done():
+			return
+		}
+	}
+	for _, v := range s.data {
+		outputChan <- etldata.JSON(v)
+	}
+	if s.done != nil {
+		close(s.done)
+	}
+}
+
+func (s *gatedSource) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (s *gatedSource) String() string {
+	return s.name
+}
+
+func TestMerger(t *testing.T) {
+	probed, never := make(chan struct{}), make(chan struct{})
+	tests := []struct {
+		name    string
+		a, b    goetl.Processor
+		merger  func(a, b goetl.Processor) goetl.Merger
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "round robin",
+			a:      &testSource{name: "a", data: []string{`{"a":1}`, `{"a":2}`, `{"a":3}`}},
+			b:      &testSource{name: "b", data: []string{`{"b":1}`}},
+			merger: func(a, b goetl.Processor) goetl.Merger { return goetl.NewRoundRobinMerger() },
+			want:   []string{`{"a":1}`, `{"b":1}`, `{"a":2}`, `{"a":3}`},
+		},
+		{
+			name: "ordered",
+			a:    &testSource{name: "a", data: []string{`[{"k":1},{"k":4}]`, `{"k":7}`}},
+			b:    &testSource{name: "b", data: []string{`[{"k":2},{"k":3}]`, `{"k":9}`}},
+			merger: func(a, b goetl.Processor) goetl.Merger {
+				m := goetl.NewOrderedMerger(goetl.KeyPath("k"))
+				m.BatchSize = 2
+				return m
+			},
+			want: []string{`[{"k":1},{"k":2}]`, `[{"k":3},{"k":4}]`, `[{"k":7},{"k":9}]`},
+		},
+		{
+			name: "ordered by nested key with nulls",
+			a:    &testSource{name: "a", data: []string{`[{"o":{"k":"b"}},{"o":{"k":"d"}}]`}},
+			b:    &testSource{name: "b", data: []string{`[{"x":1},{"o":{"k":"c"}}]`}},
+			merger: func(a, b goetl.Processor) goetl.Merger {
+				return goetl.NewOrderedMerger(goetl.KeyPath("o.k"))
+			},
+			want: []string{`[{"x":1},{"o":{"k":"b"}},{"o":{"k":"c"}},{"o":{"k":"d"}}]`},
+		},
+		{
+			name: "ordered by large integer ids",
+			a:    &recordsSource{name: "a", batches: [][]map[string]interface{}{{{"id": int64(9007199254740993)}}}},
+			b:    &recordsSource{name: "b", batches: [][]map[string]interface{}{{{"id": uint32(10)}, {"id": int64(9007199254740992)}}}},
+			merger: func(a, b goetl.Processor) goetl.Merger {
+				return goetl.NewOrderedMerger(goetl.KeyPath("id"))
+			},
+			want: []string{`[{"id":10},{"id":9007199254740992},{"id":9007199254740993}]`},
+		},
+		{
+			name: "hash join",
+			a:    &testSource{name: "customers", data: []string{`[{"id":1,"name":"a"},{"id":2,"name":"b"}]`, `{"id":3,"name":"c"}`}},
+			b:    &testSource{name: "orders", data: []string{`{"oid":10,"cid":"1"}`, `[{"oid":11,"cid":3},{"oid":12,"cid":9}]`}},
+			merger: func(a, b goetl.Processor) goetl.Merger {
+				return goetl.NewHashJoinMerger(a, "id", "cid")
+			},
+			want: []string{`{"cid":"1","id":1,"name":"a","oid":10}`, `{"cid":3,"id":3,"name":"c","oid":11}`},
+		},
+		{
+			name: "hash join keeping unmatched with prefix",
+			a:    &recordsSource{name: "customers", batches: [][]map[string]interface{}{{{"id": 1, "name": "a"}, {"id": 1, "name": "b"}}}},
+			b:    &testSource{name: "orders", data: []string{`[{"id":1.0,"name":"x"},{"id":2,"name":"y"}]`}},
+			merger: func(a, b goetl.Processor) goetl.Merger {
+				m := goetl.NewHashJoinMerger(a, "id", "id")
+				m.BuildPrefix = "customer_"
+				m.KeepUnmatched = true
+				return m
+			},
+			want: []string{
+				`{"customer_id":1,"customer_name":"a","id":1,"name":"x"}`,
+				`{"customer_id":1,"customer_name":"b","id":1,"name":"x"}`,
+				`{"id":2,"name":"y"}`,
+			},
+		},
+		{
+			name: "hash join never matching missing keys",
+			a:    &testSource{name: "customers", data: []string{`[{"id":null,"name":"a"},{"name":"b"},{"id":1,"name":"c"}]`}},
+			b:    &testSource{name: "orders", data: []string{`[{"cid":null,"oid":10},{"oid":11},{"cid":1,"oid":12}]`}},
+			merger: func(a, b goetl.Processor) goetl.Merger {
+				m := goetl.NewHashJoinMerger(a, "id", "cid")
+				m.KeepUnmatched = true
+				return m
+			},
+			want: []string{`{"cid":null,"oid":10}`, `{"oid":11}`, `{"cid":1,"id":1,"name":"c","oid":12}`},
+		},
+		{
+			name: "hash join with the probe side first",
+			a:    &gatedSource{name: "customers", data: []string{`{"id":1,"name":"a"}`, `{"id":2,"name":"b"}`}, wait: probed},
+			b:    &gatedSource{name: "orders", data: []string{`{"oid":10,"cid":2}`, `{"oid":11,"cid":1}`, `{"oid":12,"cid":3}`}, done: probed},
+			merger: func(a, b goetl.Processor) goetl.Merger {
+				return goetl.NewHashJoinMerger(a, "id", "cid")
+			},
+			want: []string{`{"cid":2,"id":2,"name":"b","oid":10}`, `{"cid":1,"id":1,"name":"a","oid":11}`},
+		},
+		{
+			name: "hash join buffering too much of the probe side",
+			a:    &gatedSource{name: "customers", data: []string{`{"id":1}`}, wait: never},
+			b:    &testSource{name: "orders", data: []string{`{"cid":1}`, `{"cid":2}`, `{"cid":3}`}},
+			merger: func(a, b goetl.Processor) goetl.Merger {
+				m := goetl.NewHashJoinMerger(a, "id", "cid")
+				m.MaxBuffered = 2
+				return m
+			},
+			wantErr: "HashJoinMerger: more than 2 probe payloads arrived before the build side was complete",
+		},
+		{
+			name: "hash join without build input",
+			a:    &testSource{name: "a", data: []string{`{"id":1}`}},
+			b:    &testSource{name: "b", data: []string{`{"id":1}`}},
+			merger: func(a, b goetl.Processor) goetl.Merger {
+				return goetl.NewHashJoinMerger(&testSource{name: "other"}, "id", "id")
+			},
+			wantErr: "build Processor (other) is not one of the inputs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &testSink{}
+			p, err := goetl.NewGraph().
+				Add(goetl.Do(sink).Merge(tt.merger(tt.a, tt.b))).
+				Connect(tt.a, sink).
+				Connect(tt.b, sink).
+				Pipeline()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := p.Execute()
+			if tt.wantErr != "" {
+				if r.Err == nil || !strings.Contains(r.Err.Error(), tt.wantErr) {
+					t.Fatalf("Err = %v, want %q", r.Err, tt.wantErr)
+				}
+				return
+			}
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			if !reflect.DeepEqual(sink.got, tt.want) {
+				t.Errorf("got %v, want %v", sink.got, tt.want)
+			}
+		})
+	}
+}
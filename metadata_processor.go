@@ -0,0 +1,78 @@
+package goetl
+
+import (
+	"github.com/teambenny/goetl/etldata"
+)
+
+// MetadataProcessor is a Processor that reads the etldata.Metadata of the
+// payloads it receives, with etldata.MetadataOf.
+//
+// The Pipeline carries the Metadata of each payload beside it, in the same
+// way as its trace, so that a payload sent as an etldata.JSON reaches the
+// next Processor as an etldata.JSON, and type assertions such as
+// d.(etldata.JSON) keep working. Only a MetadataProcessor whose
+// ReadsMetadata returns true receives payloads with their Metadata
+// attached. Either way, the payloads sent while processing a payload
+// inherit its Metadata, unless they are sent with their own (see
+// etldata.WithMetadata).
+type MetadataProcessor interface {
+	Processor
+	ReadsMetadata() bool
+}
+
+// readsMetadata returns true if the given Processor, or the one it wraps,
+// is a MetadataProcessor that reads Metadata.
+func readsMetadata(p Processor) bool {
+	for _, p := range unwrapProcessor(p) {
+		if mp, ok := p.(MetadataProcessor); ok {
+			return mp.ReadsMetadata()
+		}
+	}
+	return false
+}
+
+// setupMetadata works out which Processors are given the Metadata of the
+// payloads they receive.
+func (p *Pipeline) setupMetadata() {
+	for _, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			dp.readsMetadata = readsMetadata(dp.Processor)
+		}
+	}
+}
+
+// metadataOf returns the Metadata carried beside d, or by d itself.
+func metadataOf(d etldata.Payload) etldata.Metadata {
+	if e := envelopeOf(d); e != nil && e.metadata != nil {
+		return e.metadata
+	}
+	return etldata.MetadataOf(unwrapped(d))
+}
+
+// carryMetadata moves the Metadata attached to a payload sent by a
+// Processor into its envelope, so that the payload is passed on as it was
+// before etldata.WithMetadata. An etldata.Records keeps its own.
+func carryMetadata(d etldata.Payload) etldata.Payload {
+	p := unwrapped(d)
+	if _, ok := p.(*etldata.Records); ok {
+		return d
+	}
+	md := etldata.MetadataOf(p)
+	if md == nil {
+		return d
+	}
+	e := rewrap(d)
+	e.Payload = etldata.Unwrap(p)
+	e.metadata = md
+	return e
+}
+
+// payloadFor returns a payload as the DataProcessor's Processor is given
+// it: as it was sent, with its Metadata attached for a MetadataProcessor.
+func (dp *DataProcessor) payloadFor(d etldata.Payload) etldata.Payload {
+	p := unwrapped(d)
+	if e := envelopeOf(d); e != nil && e.metadata != nil && dp.readsMetadata {
+		return etldata.WithMetadata(p, e.metadata)
+	}
+	return p
+}
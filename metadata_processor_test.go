@@ -0,0 +1,109 @@
+package goetl_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+)
+
+// fileSource sends each of its files' data with the file's name.
+type fileSource struct {
+	files []string
+}
+
+func (s *fileSource) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	for _, f := range s.files {
+		outputChan <- etldata.WithMetadata(etldata.JSON(`"`+f+`"`), etldata.Metadata{etldata.MetadataFileName: f})
+	}
+}
+
+func (s *fileSource) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+// upper sends each string it receives in upper case, and the payloads
+// received on their own with the "archive" table.
+type upper struct {
+	concurrency int
+}
+
+func (u *upper) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	js, ok := d.(etldata.JSON)
+	if !ok {
+		killChan <- fmt.Errorf("received a %T", d)
+		return
+	}
+	outputChan <- etldata.JSON(strings.ToUpper(string(js)))
+	outputChan <- etldata.WithMetadata(js, etldata.Metadata{etldata.MetadataTable: "archive"})
+}
+
+func (u *upper) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (u *upper) Concurrency() int { return u.concurrency }
+
+// metadataSink keeps the data it receives, along with its Metadata if
+// reads is set.
+type metadataSink struct {
+	mutex sync.Mutex
+	reads bool
+	got   []string
+}
+
+func (s *metadataSink) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.got = append(s.got, fmt.Sprintf("%T %s %v", d, d.Bytes(), etldata.MetadataOf(d)))
+}
+
+func (s *metadataSink) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (s *metadataSink) ReadsMetadata() bool { return s.reads }
+
+func TestMetadataProcessor(t *testing.T) {
+	tests := []struct {
+		name        string
+		traced      bool
+		concurrency int
+	}{
+		{name: "plain"},
+		{name: "traced", traced: true},
+		{name: "concurrent", concurrency: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, plain := &metadataSink{reads: true}, &metadataSink{}
+			source := &fileSource{files: []string{"a", "b"}}
+			transform := &upper{concurrency: tt.concurrency}
+			p, err := goetl.NewGraph().Connect(source, transform).Connect(transform, reader).Connect(transform, plain).Pipeline()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.traced {
+				p.Tracing = goetl.NewInMemorySpanExporter()
+			}
+			if r := p.Execute(); r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			// The order of the files is only kept without concurrency.
+			sort.Strings(reader.got)
+			sort.Strings(plain.got)
+			wantReader := []string{
+				`*etldata.metadataPayload "A" map[file_name:a]`,
+				`*etldata.metadataPayload "B" map[file_name:b]`,
+				`*etldata.metadataPayload "a" map[table:archive]`,
+				`*etldata.metadataPayload "b" map[table:archive]`,
+			}
+			if !reflect.DeepEqual(reader.got, wantReader) {
+				t.Errorf("MetadataProcessor received %q, want %q", reader.got, wantReader)
+			}
+			wantPlain := []string{`etldata.JSON "A" map[]`, `etldata.JSON "B" map[]`, `etldata.JSON "a" map[]`, `etldata.JSON "b" map[]`}
+			if !reflect.DeepEqual(plain.got, wantPlain) {
+				t.Errorf("Processor received %q, want %q", plain.got, wantPlain)
+			}
+		})
+	}
+}
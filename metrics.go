@@ -0,0 +1,152 @@
+package goetl
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+// MetricsSink receives live metrics from a running Pipeline (see
+// Pipeline.Metrics), so that long-running pipelines can be monitored while
+// they run rather than only through Stats once they are done. The metric
+// names are the Metric* constants, and every method must be safe for
+// concurrent use. See PrometheusSink for an implementation.
+type MetricsSink interface {
+	// Counter adds delta to a counter.
+	Counter(name string, labels Labels, delta float64)
+	// Gauge sets a gauge to value.
+	Gauge(name string, labels Labels, value float64)
+	// Histogram records an observation of value.
+	Histogram(name string, labels Labels, value float64)
+}
+
+// Labels identify a series within a metric. Processor metrics are labelled
+// with "pipeline", "stage" and "processor", and queue metrics with
+// "pipeline", "from" and "to".
+type Labels map[string]string
+
+// The metrics sent to a MetricsSink.
+const (
+	// Counters, labelled by processor.
+	MetricPayloadsReceived = "goetl_payloads_received_total"
+	MetricPayloadsSent     = "goetl_payloads_sent_total"
+	MetricBytesReceived    = "goetl_bytes_received_total"
+	MetricBytesSent        = "goetl_bytes_sent_total"
+	MetricRetries          = "goetl_retries_total"
+	MetricSkipped          = "goetl_skipped_total"
+	MetricDeadLettered     = "goetl_dead_lettered_total"
+	// Histogram of ProcessData call durations in seconds, labelled by processor.
+	MetricProcessingSeconds = "goetl_processing_seconds"
+	// Gauges of the number of ProcessData calls in progress, and of the
+	// number that can run at once (see ConcurrentProcessor), labelled by
+	// processor.
+	MetricWorkersBusy = "goetl_workers_busy"
+	MetricWorkers     = "goetl_workers"
+	// Gauges of the number of payloads waiting in the channel between two
+	// Processors, and of its buffer size (see Pipeline.BufferLength).
+	MetricQueueDepth    = "goetl_queue_depth"
+	MetricQueueCapacity = "goetl_queue_capacity"
+	// Counter of errors received, labelled by pipeline.
+	MetricErrors = "goetl_errors_total"
+)
+
+// metricHelp describes each metric, for sinks that need a description.
+var metricHelp = map[string]string{
+	MetricPayloadsReceived:  "Payloads received by a processor.",
+	MetricPayloadsSent:      "Payloads sent by a processor.",
+	MetricBytesReceived:     "Bytes received by a processor.",
+	MetricBytesSent:         "Bytes sent by a processor.",
+	MetricRetries:           "Payloads retried by a processor's ErrorPolicy.",
+	MetricSkipped:           "Payloads skipped by a processor's ErrorPolicy.",
+	MetricDeadLettered:      "Payloads dead-lettered by a processor's ErrorPolicy.",
+	MetricProcessingSeconds: "Time spent processing a payload.",
+	MetricWorkersBusy:       "ProcessData calls in progress.",
+	MetricWorkers:           "ProcessData calls that can run at once.",
+	MetricQueueDepth:        "Payloads waiting in the channel between two processors.",
+	MetricQueueCapacity:     "Buffer size of the channel between two processors.",
+	MetricErrors:            "Errors received by a pipeline.",
+}
+
+// defaultMetricsInterval is used when Pipeline.MetricsInterval is not set.
+const defaultMetricsInterval = time.Second
+
+// setupStats names every DataProcessor's stats and points them at the
+// Pipeline's MetricsSink. The Processor names are worked out here, before
+// any Processor is running, since formatting a name may read its state.
+func (p *Pipeline) setupStats() {
+	for n, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			dp.statName = dp.String()
+			dp.metrics = p.Metrics
+			dp.metricLabels = Labels{"pipeline": p.Name, "stage": strconv.Itoa(n + 1), "processor": dp.statName}
+		}
+	}
+}
+
+// startMetrics samples the gauges every MetricsInterval until the returned
+// stop func is called, which samples them one last time.
+func (p *Pipeline) startMetrics() (stop func()) {
+	if p.Metrics == nil {
+		return func() {}
+	}
+	interval := p.MetricsInterval
+	if interval <= 0 {
+		interval = defaultMetricsInterval
+	}
+	queues := []metricsQueue{}
+	for _, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			outputs := p.dataProcessorOutputs(dp)
+			for i, c := range dp.branchOutChans {
+				labels := Labels{"pipeline": p.Name, "from": dp.statName, "to": outputs[i].statName}
+				queues = append(queues, metricsQueue{c, labels})
+			}
+		}
+	}
+	quit := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		defer close(stopped)
+		p.sampleMetrics(queues)
+		for {
+			select {
+			case <-ticker.C:
+				p.sampleMetrics(queues)
+			case <-quit:
+				p.sampleMetrics(queues)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-stopped
+	}
+}
+
+// metricsQueue is a channel between two Processors.
+type metricsQueue struct {
+	c      chan etldata.Payload
+	labels Labels
+}
+
+// sampleMetrics sets the worker and queue gauges.
+func (p *Pipeline) sampleMetrics(queues []metricsQueue) {
+	for _, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			workers := dp.concurrency
+			if workers < 1 {
+				workers = 1
+			}
+			p.Metrics.Gauge(MetricWorkers, dp.metricLabels, float64(workers))
+			p.Metrics.Gauge(MetricWorkersBusy, dp.metricLabels, float64(dp.runningExecutions()))
+		}
+	}
+	for _, q := range queues {
+		p.Metrics.Gauge(MetricQueueDepth, q.labels, float64(len(q.c)))
+		p.Metrics.Gauge(MetricQueueCapacity, q.labels, float64(cap(q.c)))
+	}
+}
@@ -1,17 +1,22 @@
 package goetl
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"sync"
+	"time"
 
 	"github.com/teambenny/goetl/etldata"
 	"github.com/teambenny/goetl/etlutil"
 	"github.com/teambenny/goetl/logger"
 )
 
+// defaultPipelineName is the Name of a new Pipeline.
+const defaultPipelineName = "Pipeline"
+
 // StartSignal is what's sent to a starting Processor
 // to kick off execution. Typically this value will be ignored.
 var StartSignal = "GO"
@@ -24,6 +29,36 @@ type Pipeline struct {
 	PrintData    bool   // Set to true to log full data payloads (only in Debug logging mode).
 	timer        *etlutil.Timer
 	wg           sync.WaitGroup
+	cancel       context.CancelFunc
+	killChan     chan error
+	done         chan struct{}
+	watchers     sync.WaitGroup
+	stagesDone   chan struct{}
+	result       *PipelineResult
+	resultMutex  sync.Mutex
+	finished     bool
+	interrupt    chan os.Signal
+
+	// CheckpointStore, if set, is used to save the state of any Processors
+	// implementing Checkpointer when a run fails, and to restore it at the
+	// start of the next run. See Checkpointer. Checkpoints are saved under
+	// the Pipeline's Name, which must then be set to one of its own.
+	CheckpointStore CheckpointStore
+	// CheckpointInterval, if set, also saves a checkpoint periodically
+	// while the Pipeline is running.
+	CheckpointInterval time.Duration
+
+	// Metrics, if set, receives live metrics while the Pipeline is
+	// running. See MetricsSink.
+	Metrics MetricsSink
+	// MetricsInterval is how often the queue depth and worker gauges
+	// are sampled. Defaults to 1 second.
+	MetricsInterval time.Duration
+
+	// Tracing, if set, receives a Span for every ProcessData call, so that
+	// each payload can be followed through the stages. See Span.
+	Tracing SpanExporter
+	tracer  *tracer
 }
 
 // PipelineIface provides an interface to enable mocking the Pipeline.
@@ -35,7 +70,7 @@ type PipelineIface interface {
 // NewPipeline creates a new pipeline ready to run the given Processors.
 // For more complex use-cases, see NewBranchingPipeline.
 func NewPipeline(processors ...Processor) *Pipeline {
-	p := &Pipeline{Name: "Pipeline"}
+	p := &Pipeline{Name: defaultPipelineName}
 	stages := make([]*PipelineStage, len(processors))
 	for i, p := range processors {
 		dp := Do(p)
@@ -53,7 +88,7 @@ func NewPipeline(processors ...Processor) *Pipeline {
 // between stages each containing variable number of Processors.
 // See the goetl package documentation for code examples and diagrams.
 func NewBranchingPipeline(layout *PipelineLayout) *Pipeline {
-	p := &Pipeline{layout: layout, Name: "Pipeline"}
+	p := &Pipeline{layout: layout, Name: defaultPipelineName}
 	return p
 }
 
@@ -83,7 +118,7 @@ func (p *Pipeline) dataProcessorOutputs(dp *DataProcessor) []*DataProcessor {
 // DataProcessor's outputs), we set up some intermediary channels that will
 // manage copying and passing data between stages, as well as properly closing
 // channels when all data is received.
-func (p *Pipeline) connectStages() {
+func (p *Pipeline) connectStages(ctx context.Context) {
 	logger.Debug(p.Name, ": connecting stages")
 	// First, setup the bridgeing channels & brancher/merger's to aid in
 	// managing channel communication between processors.
@@ -91,13 +126,16 @@ func (p *Pipeline) connectStages() {
 		for _, from := range stage.processors {
 			if from.outputs != nil {
 				from.branchOutChans = []chan etldata.Payload{}
+				from.branchOutDest = []*DataProcessor{}
 				for _, to := range p.dataProcessorOutputs(from) {
 					if to.mergeInChans == nil {
 						to.mergeInChans = []chan etldata.Payload{}
 					}
 					c := p.initDataChan()
 					from.branchOutChans = append(from.branchOutChans, c)
+					from.branchOutDest = append(from.branchOutDest, to)
 					to.mergeInChans = append(to.mergeInChans, c)
+					to.mergeInFrom = append(to.mergeInFrom, from.Processor)
 				}
 			}
 		}
@@ -107,16 +145,44 @@ func (p *Pipeline) connectStages() {
 	for _, stage := range p.layout.stages {
 		for _, dp := range stage.processors {
 			if dp.branchOutChans != nil {
-				dp.branchOut()
+				dp.branchOut(ctx, &p.wg)
 			}
 			if dp.mergeInChans != nil {
-				dp.mergeIn()
+				dp.mergeIn(ctx, &p.wg)
 			}
 		}
 	}
 }
 
-func (p *Pipeline) runStages(killChan chan error) {
+// watchKillChans gives every DataProcessor its own killChan, so that errors
+// sent by a Processor can be attributed to it in the PipelineResult.
+// The watchers stop once stagesDone is closed, after every stage has
+// returned, so waiting on p.watchers makes sure every error sent has
+// been recorded.
+func (p *Pipeline) watchKillChans() {
+	p.stagesDone = make(chan struct{})
+	for n, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			dp.killChan = make(chan error)
+			dp.resetFinished()
+			p.watchers.Add(1)
+			go func(n int, dp *DataProcessor) {
+				defer p.watchers.Done()
+				for {
+					select {
+					case err := <-dp.killChan:
+						dp.markFailed()
+						p.recordError(&StageError{Stage: n + 1, Processor: dp.String(), Err: err})
+					case <-p.stagesDone:
+						return
+					}
+				}
+			}(n, dp)
+		}
+	}
+}
+
+func (p *Pipeline) runStages(ctx context.Context) {
 	for n, stage := range p.layout.stages {
 		for _, dp := range stage.processors {
 			p.wg.Add(1)
@@ -131,12 +197,18 @@ func (p *Pipeline) runStages(killChan chan error) {
 				exitChans := []chan bool{}
 
 				for d := range dp.inputChan {
+					// Once cancelled, drain the input without processing it
+					// so the previous stages can finish and close up.
+					if ctx.Err() != nil {
+						continue
+					}
 					logger.Info(p.Name, "- stage", n+1, dp, "received data")
 					if p.PrintData {
 						logger.Debug(p.Name, "- stage", n+1, dp, "data =", string(d.Bytes()))
 					}
-					dp.recordDataReceived(d.Bytes())
-					exitChans = append(exitChans, dp.processData(d, killChan))
+					dp.recordDataReceived(payloadSize(d))
+					dp.checkpoint.receive(markOf(d))
+					exitChans = append(exitChans, dp.processData(ctx, d, dp.killChan))
 				}
 
 				// Wait until everything is finished before calling dp.Finish.
@@ -145,9 +217,21 @@ func (p *Pipeline) runStages(killChan chan error) {
 				for i := range exitChans {
 					<-exitChans[i]
 				}
+				dp.sendRestingCheckpoint()
 
-				logger.Info(p.Name, "- stage", n+1, dp, "input closed, calling Finish")
-				dp.Finish(dp.outputChan, killChan)
+				if ctx.Err() != nil {
+					logger.Info(p.Name, "- stage", n+1, dp, "input closed, skipping Finish:", ctx.Err())
+				} else {
+					logger.Info(p.Name, "- stage", n+1, dp, "input closed, calling Finish")
+					dp.callFinish()
+					if dp.errorPolicy != nil {
+						dp.errorPolicy.finish(dp.killChan)
+					}
+					dp.markFinished()
+					dp.sendRestingCheckpoint()
+				}
+				dp.stopForwarding()
+				dp.recordFinished()
 				if dp.outputChan != nil {
 					logger.Info(p.Name, "- stage", n+1, dp, "closing output")
 					close(dp.outputChan)
@@ -164,33 +248,110 @@ func (p *Pipeline) runStages(killChan chan error) {
 // return prematurely. Any stage of the pipeline can send to the killChan to halt
 // execution. Your calling function should check if the sent value is an error or nil to know if
 // execution was a failure or a success (nil being the success value).
+//
+// Only the first error is sent on the returned killChan. Use Wait (or Execute)
+// to get a PipelineResult describing every error and the final stats.
+//
+// Run also halts execution when the process receives an interrupt signal.
+// See RunContext for running a Pipeline that can be cancelled by its caller.
 func (p *Pipeline) Run() (killChan chan error) {
+	return p.run(context.Background(), true)
+}
+
+// RunContext behaves like Run, but execution is bound to the given context.
+// Once ctx is cancelled or its deadline passes, every stage stops processing
+// new data (Finish is not called), any ContextProcessor is able to abort the
+// work in progress, and ctx.Err() is sent on the returned killChan after the
+// stage goroutines have returned.
+//
+// Unlike Run, RunContext does not register an os.Interrupt handler. Use
+// signal.NotifyContext (or similar) if that behavior is wanted.
+func (p *Pipeline) RunContext(ctx context.Context) (killChan chan error) {
+	return p.run(ctx, false)
+}
+
+// run kicks off execution for Run and RunContext.
+//
+// When the run fails, every goroutine started for it is torn down before the
+// PipelineResult is made available: stages stop processing and drain their
+// inputs, the brancher/merger goroutines close their channels, every
+// AbortableProcessor is told to clean up, and the interrupt handler (if any)
+// is stopped.
+func (p *Pipeline) run(ctx context.Context, handleInterrupt bool) (killChan chan error) {
 	p.timer = etlutil.StartTimer()
-	killChan = make(chan error)
+	p.result = &PipelineResult{Name: p.Name, Timer: p.timer}
+	p.done = make(chan struct{})
+	// Exactly one value is sent on killChan, and it is buffered so that
+	// sending never blocks if the caller has stopped listening.
+	p.killChan = make(chan error, 1)
+
+	// The first error sent by any Processor halts the remaining stages.
+	runCtx, cancel := context.WithCancel(ctx)
+	p.cancel = cancel
 
-	p.connectStages()
-	p.runStages(killChan)
+	if handleInterrupt {
+		p.handleInterrupt()
+	}
+	p.setupStats()
+	p.setupTracing()
+	p.setupMetadata()
+	p.setupCheckpoints()
+	p.watchKillChans()
+
+	// Checkpoints are only saved for this run if the last one was restored,
+	// otherwise the last good checkpoint would be overwritten.
+	checkpointing := false
+	stopCheckpoints := func() {}
+	if p.CheckpointStore != nil {
+		if err := p.restoreCheckpoint(); err != nil {
+			p.recordError(err)
+		} else {
+			checkpointing = true
+			stopCheckpoints = p.startCheckpoints()
+		}
+	}
+
+	p.connectStages(runCtx)
+	stopMetrics := p.startMetrics()
+	p.runStages(runCtx)
 
 	for _, dp := range p.layout.stages[0].processors {
 		logger.Debug(p.Name, ": sending", StartSignal, "to", dp)
 		dp.inputChan <- etldata.JSON(StartSignal)
-		dp.Finish(dp.outputChan, killChan)
 		close(dp.inputChan)
 	}
 
 	// After all the stages are running, send the StartSignal
 	// to the initial stage processors to kick off execution, and
 	// then wait until all the processing goroutines are done to
-	// signal successful pipeline completion.
+	// signal pipeline completion (nil on success, or the context
+	// error if the run was cancelled).
 	go func() {
 		p.wg.Wait()
+		close(p.stagesDone)
+		p.watchers.Wait()
 		p.timer.Stop()
-		killChan <- nil
+		stopCheckpoints()
+		stopMetrics()
+		if p.tracer != nil {
+			p.tracer.flush()
+		}
+		if err := ctx.Err(); err != nil {
+			p.recordError(err)
+		}
+		if err := p.firstError(); err != nil {
+			p.abortProcessors(err)
+		}
+		if checkpointing {
+			p.finishCheckpoints(p.firstError())
+		}
+		p.finishResult()
+		p.stopInterrupt()
+		cancel()
+		close(p.done)
 	}()
 
-	handleInterrupt(killChan)
-
-	return killChan
+	return p.killChan
 }
 
 func (p *Pipeline) initDataChans(length int) []chan etldata.Payload {
@@ -204,14 +365,25 @@ func (p *Pipeline) initDataChan() chan etldata.Payload {
 	return make(chan etldata.Payload, p.BufferLength)
 }
 
-func handleInterrupt(killChan chan error) {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
+func (p *Pipeline) handleInterrupt() {
+	p.interrupt = make(chan os.Signal, 1)
+	signal.Notify(p.interrupt, os.Interrupt)
+	go func(c chan os.Signal) {
 		for range c {
-			killChan <- errors.New("exiting due to interrupt signal")
+			p.recordError(errors.New("exiting due to interrupt signal"))
 		}
-	}()
+	}(p.interrupt)
+}
+
+// stopInterrupt undoes handleInterrupt, so that a finished Pipeline
+// no longer holds on to the interrupt signal or its goroutine.
+func (p *Pipeline) stopInterrupt() {
+	if p.interrupt == nil {
+		return
+	}
+	signal.Stop(p.interrupt)
+	close(p.interrupt)
+	p.interrupt = nil
 }
 
 // Stats returns a string (formatted for output display) listing the stats
@@ -222,11 +394,14 @@ func (p *Pipeline) Stats() string {
 		o += fmt.Sprintf("Stage %d)\r\n", n+1)
 		for _, dp := range stage.processors {
 			o += fmt.Sprintf("  * %v\r\n", dp)
-			dp.executionStat.calculate()
-			o += fmt.Sprintf("     - Total/Avg Execution Time = %f/%fs\r\n", dp.totalExecutionTime, dp.avgExecutionTime)
-			o += fmt.Sprintf("     - Payloads Sent/Received = %d/%d\r\n", dp.dataSentCounter, dp.dataReceivedCounter)
-			o += fmt.Sprintf("     - Total/Avg Bytes Sent = %d/%d\r\n", dp.totalBytesSent, dp.avgBytesSent)
-			o += fmt.Sprintf("     - Total/Avg Bytes Received = %d/%d\r\n", dp.totalBytesReceived, dp.avgBytesReceived)
+			s := dp.executionStat.processorStats(n+1, dp.String())
+			o += fmt.Sprintf("     - Total/Avg Execution Time = %f/%fs\r\n", s.TotalExecutionTime, s.AvgExecutionTime)
+			o += fmt.Sprintf("     - Payloads Sent/Received = %d/%d\r\n", s.PayloadsSent, s.PayloadsReceived)
+			o += fmt.Sprintf("     - Total/Avg Bytes Sent = %d/%d\r\n", s.TotalBytesSent, s.AvgBytesSent)
+			o += fmt.Sprintf("     - Total/Avg Bytes Received = %d/%d\r\n", s.TotalBytesReceived, s.AvgBytesReceived)
+			if dp.errorPolicy != nil {
+				o += fmt.Sprintf("     - Retries/Skipped/Dead Lettered = %d/%d/%d\r\n", s.Retries, s.Skipped, s.DeadLettered)
+			}
 		}
 	}
 	return o
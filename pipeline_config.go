@@ -0,0 +1,198 @@
+package goetl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PipelineConfig is a declarative definition of a Pipeline, which can be
+// parsed from a YAML or JSON document with ParsePipelineConfig. Each
+// Processor is built by the factory registered for its type (see
+// RegisterProcessor), and connected to its outputs by name. The stages
+// are then worked out as for a Graph. For example:
+//
+//     name: orders
+//     processors:
+//       - name: read
+//         type: SftpReader
+//         config: {server: "sftp.example.com:22", username: etl, key_file: /etc/etl/id_rsa, path: /out/orders.json}
+//         outputs: [filter]
+//       - name: filter
+//         type: RegexpMatcher
+//         config: {pattern: '"status":"shipped"'}
+//         outputs: [write]
+//       - name: write
+//         type: PostgreSQLWriter
+//         config: {driver: postgres, dsn: "postgres://etl@db/warehouse", table: orders}
+type PipelineConfig struct {
+	Name         string             `json:"name"`
+	BufferLength int                `json:"buffer_length,omitempty"`
+	Processors   []*ProcessorConfig `json:"processors"`
+}
+
+// ParsePipelineConfig parses a PipelineConfig from a YAML or JSON document,
+// and validates it. Errors name the offending Processor.
+func ParsePipelineConfig(data []byte) (*PipelineConfig, error) {
+	// JSON is valid YAML, so both are parsed as YAML and then converted
+	// to JSON, which lets Processor factories decode their parameters
+	// with the standard json tags.
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("pipeline config: %v", err)
+	}
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline config: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	var c PipelineConfig
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("pipeline config: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate checks that every Processor has a unique name and a registered
+// type, and that the outputs refer to Processors in the config without
+// forming a cycle. It does not build the Processors.
+func (c *PipelineConfig) Validate() error {
+	if len(c.Processors) == 0 {
+		return errors.New("pipeline config: must have at least one processor")
+	}
+	nodes := make(map[string]*ProcessorConfig)
+	for i, pc := range c.Processors {
+		if pc == nil || pc.Name == "" {
+			return fmt.Errorf("pipeline config: processor #%d must have a name", i+1)
+		}
+		if _, dup := nodes[pc.Name]; dup {
+			return fmt.Errorf("pipeline config: processor %q: name is used more than once", pc.Name)
+		}
+		nodes[pc.Name] = pc
+	}
+	registered := make(map[string]bool)
+	for _, name := range RegisteredProcessors() {
+		registered[name] = true
+	}
+	for _, pc := range c.Processors {
+		if pc.Type == "" {
+			return fmt.Errorf("pipeline config: processor %q: must have a type", pc.Name)
+		}
+		if !registered[pc.Type] {
+			return fmt.Errorf("pipeline config: processor %q: unknown processor type %q", pc.Name, pc.Type)
+		}
+		for _, out := range pc.Outputs {
+			if _, ok := nodes[out]; !ok {
+				return fmt.Errorf("pipeline config: processor %q: output %q is not defined", pc.Name, out)
+			}
+			if out == pc.Name {
+				return fmt.Errorf("pipeline config: processor %q: cannot output to itself", pc.Name)
+			}
+		}
+	}
+	return c.checkCycles(nodes)
+}
+
+// checkCycles returns an error naming a Processor that is part of a cycle.
+func (c *PipelineConfig) checkCycles(nodes map[string]*ProcessorConfig) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("pipeline config: processor %q: outputs form a cycle", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, out := range nodes[name].Outputs {
+			if err := visit(out); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, pc := range c.Processors {
+		if err := visit(pc.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Graph builds every Processor and connects them in a Graph.
+func (c *PipelineConfig) Graph() (*Graph, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	built := make(map[string]Processor)
+	g := NewGraph()
+	for _, pc := range c.Processors {
+		p, err := NewProcessorFromConfig(pc)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline config: processor %q (%v): %v", pc.Name, pc.Type, err)
+		}
+		built[pc.Name] = p
+		g.Add(Do(p).Named(pc.Name))
+	}
+	for _, pc := range c.Processors {
+		for _, out := range pc.Outputs {
+			g.Connect(built[pc.Name], built[out])
+		}
+	}
+	return g, nil
+}
+
+// Layout builds every Processor and returns the resulting PipelineLayout.
+func (c *PipelineConfig) Layout() (*PipelineLayout, error) {
+	g, err := c.Graph()
+	if err != nil {
+		return nil, err
+	}
+	return g.Layout()
+}
+
+// Pipeline builds every Processor and returns a new Pipeline ready to run,
+// with its Name and BufferLength taken from the config.
+func (c *PipelineConfig) Pipeline() (*Pipeline, error) {
+	layout, err := c.Layout()
+	if err != nil {
+		return nil, err
+	}
+	return c.NewPipeline(layout), nil
+}
+
+// NewPipeline returns a new Pipeline running a layout already built by
+// Layout, with its Name and BufferLength taken from the config.
+func (c *PipelineConfig) NewPipeline(layout *PipelineLayout) *Pipeline {
+	p := NewBranchingPipeline(layout)
+	if c.Name != "" {
+		p.Name = c.Name
+	}
+	if c.BufferLength > 0 {
+		p.BufferLength = c.BufferLength
+	}
+	return p
+}
+
+// NewPipelineLayoutFromConfig parses a YAML or JSON pipeline config (see
+// PipelineConfig) and builds its PipelineLayout.
+func NewPipelineLayoutFromConfig(data []byte) (*PipelineLayout, error) {
+	c, err := ParsePipelineConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.Layout()
+}
@@ -1,6 +1,9 @@
 package goetl
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // PipelineLayout holds a series of PipelineStage instances.
 type PipelineLayout struct {
@@ -16,19 +19,22 @@ type PipelineLayout struct {
 // A valid layout meets these conditions:
 // 	1) Processors in the final PipelineStage must NOT have outputs set.
 // 	2) Processors in a non-final stage MUST have outputs set.
-// 	3) Outputs must point to a Processor in the next immediate stage.
-// 	4) A Processor must be pointed to by one of the previous Outputs (unless it is in the first PipelineStage).
+// 	3) Outputs must point to a Processor in a later stage (usually the next immediate stage).
+// 	4) A Processor must be pointed to by one of the Outputs in an earlier stage (unless it is in the first PipelineStage).
+//
+// To connect Processors across any number of stages without working out
+// the stages by hand, see Graph.
 func NewPipelineLayout(stages ...*PipelineStage) (*PipelineLayout, error) {
 	l := &PipelineLayout{stages}
-	if err := l.validate(); err != nil {
+	if err := l.Validate(); err != nil {
 		return nil, err
 	}
 	return l, nil
 }
 
-// validate returns an error or nil
-// See the validation rules defined in NewPipelineLayout.
-func (l *PipelineLayout) validate() error {
+// Validate returns an error if the layout breaks any of the rules
+// defined in NewPipelineLayout, or nil.
+func (l *PipelineLayout) Validate() error {
 	var stage *PipelineStage
 	for stageNum := range l.stages {
 		stage = l.stages[stageNum]
@@ -42,23 +48,75 @@ func (l *PipelineLayout) validate() error {
 			} else if stageNum != len(l.stages)-1 && dp.outputs == nil {
 				return fmt.Errorf("Processor (%v) must have Outputs set in non-final PipelineStage #%d", dp, stageNum+1)
 			}
-			// 3) outputs must point to a Processor in the next immediate stage
-			if stageNum < len(l.stages)-1 {
-				nextStage := l.stages[stageNum+1]
-				for k := range dp.outputs {
-					if !nextStage.hasProcessor(dp.outputs[k]) {
-						return fmt.Errorf("Processor (%v) Outputs must point to Processor in the next PipelineStage #%d", dp, stageNum+2)
-					}
+			// 3) outputs must point to a Processor in a later stage
+			for k := range dp.outputs {
+				if !l.laterStageHasProcessor(stageNum, dp.outputs[k]) {
+					return fmt.Errorf("Processor (%v) Outputs must point to Processor in a later PipelineStage than #%d", dp, stageNum+1)
 				}
 			}
-			// 4) a non-starting Processor must be pointed to by one of the previous outputs
-			if stageNum > 0 {
-				prevStage := l.stages[stageNum-1]
-				if !prevStage.hasOutput(dp.Processor) {
-					return fmt.Errorf("Processor (%v) is not pointed to by any output in the previous PipelineStage #%d", dp, stageNum)
-				}
+			// 4) a non-starting Processor must be pointed to by one of the earlier outputs
+			if stageNum > 0 && !l.earlierStageHasOutput(stageNum, dp.Processor) {
+				return fmt.Errorf("Processor (%v) is not pointed to by any output in a PipelineStage before #%d", dp, stageNum+1)
 			}
 		}
 	}
 	return nil
 }
+
+// String describes each stage of the layout, along with the Outputs of
+// every Processor, for example:
+//
+//     stage 1: read -> filter, archive
+//     stage 2: filter -> write
+//     stage 3: write, archive
+func (l *PipelineLayout) String() string {
+	lines := make([]string, len(l.stages))
+	for n, stage := range l.stages {
+		procs := make([]string, len(stage.processors))
+		sep := ", "
+		for i, dp := range stage.processors {
+			procs[i] = dp.String()
+			if len(dp.outputs) == 0 {
+				continue
+			}
+			outs := make([]string, len(dp.outputs))
+			for j, out := range dp.outputs {
+				outs[j] = l.processorName(out)
+			}
+			procs[i] += " -> " + strings.Join(outs, ", ")
+			sep = "; "
+		}
+		lines[n] = fmt.Sprintf("stage %d: %s", n+1, strings.Join(procs, sep))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// processorName returns the String of the DataProcessor wrapping p.
+func (l *PipelineLayout) processorName(p Processor) string {
+	for _, stage := range l.stages {
+		for _, dp := range stage.processors {
+			if dp.Processor == p {
+				return dp.String()
+			}
+		}
+	}
+	return fmt.Sprintf("%v", p)
+}
+
+func (l *PipelineLayout) laterStageHasProcessor(stageNum int, p Processor) bool {
+	for _, stage := range l.stages[stageNum+1:] {
+		if stage.hasProcessor(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *PipelineLayout) earlierStageHasOutput(stageNum int, p Processor) bool {
+	for _, stage := range l.stages[:stageNum] {
+		if stage.hasOutput(p) {
+			return true
+		}
+	}
+	return false
+}
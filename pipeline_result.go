@@ -0,0 +1,132 @@
+package goetl
+
+import (
+	"fmt"
+
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// PipelineResult describes the outcome of a Pipeline run. It is returned
+// by Wait and Execute once every stage has finished.
+type PipelineResult struct {
+	Name string
+	// Err is the first error received, or nil if the Pipeline succeeded.
+	// This is the same value that is sent on the killChan returned by Run.
+	Err error
+	// Errors holds every error received, in order. Errors sent by a
+	// Processor are wrapped in a *StageError.
+	Errors []error
+	// Stage and Processor identify where Err came from. Stage is the
+	// 1-based stage number (as shown in log output and Stats), and is 0
+	// when Err did not come from a Processor (e.g. an interrupt signal
+	// or a cancelled context).
+	Stage     int
+	Processor string
+	// Stats holds the final execution stats of every DataProcessor,
+	// ordered by stage.
+	Stats []ProcessorStats
+	Timer *etlutil.Timer
+}
+
+// Success returns true if the Pipeline ran without any errors.
+func (r *PipelineResult) Success() bool {
+	return r.Err == nil
+}
+
+// StageError wraps an error sent to the killChan by a Processor.
+type StageError struct {
+	Stage     int // 1-based stage number
+	Processor string
+	Err       error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %d (%s): %v", e.Stage, e.Processor, e.Err)
+}
+
+// Unwrap returns the error sent by the Processor.
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// ProcessorStats holds the execution stats gathered for a single
+// DataProcessor. Execution times are in seconds.
+type ProcessorStats struct {
+	Stage              int     `json:"stage"` // 1-based stage number
+	Processor          string  `json:"processor"`
+	PayloadsSent       int     `json:"payloads_sent"`
+	PayloadsReceived   int     `json:"payloads_received"`
+	Executions         int     `json:"executions"`
+	TotalExecutionTime float64 `json:"total_execution_time"`
+	AvgExecutionTime   float64 `json:"avg_execution_time"`
+	TotalBytesSent     int     `json:"total_bytes_sent"`
+	AvgBytesSent       int     `json:"avg_bytes_sent"`
+	TotalBytesReceived int     `json:"total_bytes_received"`
+	AvgBytesReceived   int     `json:"avg_bytes_received"`
+	// See ErrorPolicy
+	Retries      int `json:"retries"`
+	Skipped      int `json:"skipped"`
+	DeadLettered int `json:"dead_lettered"`
+}
+
+// Wait blocks until the Pipeline started by Run or RunContext has finished,
+// and returns the result of the run.
+func (p *Pipeline) Wait() *PipelineResult {
+	<-p.done
+	return p.result
+}
+
+// Execute runs the Pipeline (see Run) and blocks until it has finished.
+func (p *Pipeline) Execute() *PipelineResult {
+	p.Run()
+	return p.Wait()
+}
+
+// recordError adds err to the result. The first error recorded is sent
+// on the killChan and halts execution of the remaining stages.
+func (p *Pipeline) recordError(err error) {
+	p.resultMutex.Lock()
+	defer p.resultMutex.Unlock()
+
+	if p.finished {
+		return
+	}
+	p.result.Errors = append(p.result.Errors, err)
+	if p.Metrics != nil {
+		p.Metrics.Counter(MetricErrors, Labels{"pipeline": p.Name}, 1)
+	}
+	if p.result.Err != nil {
+		return
+	}
+	p.result.Err = err
+	if serr, ok := err.(*StageError); ok {
+		p.result.Stage = serr.Stage
+		p.result.Processor = serr.Processor
+	}
+	p.killChan <- err
+	p.cancel()
+}
+
+// firstError returns the first error recorded, if any.
+func (p *Pipeline) firstError() error {
+	p.resultMutex.Lock()
+	defer p.resultMutex.Unlock()
+	return p.result.Err
+}
+
+// finishResult gathers the final stats and signals success on the
+// killChan if no error was recorded.
+func (p *Pipeline) finishResult() {
+	p.resultMutex.Lock()
+	defer p.resultMutex.Unlock()
+
+	for n, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			p.result.Stats = append(p.result.Stats, dp.executionStat.processorStats(n+1, dp.String()))
+		}
+	}
+	if p.result.Err == nil {
+		p.killChan <- nil
+	}
+	p.finished = true
+}
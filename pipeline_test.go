@@ -0,0 +1,184 @@
+package goetl_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.LogLevel = logger.LevelSilent
+	os.Exit(m.Run())
+}
+
+// testSource sends each of data as a JSON payload.
+type testSource struct {
+	name string
+	data []string
+}
+
+func (s *testSource) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	for _, v := range s.data {
+		outputChan <- etldata.JSON(v)
+	}
+}
+
+func (s *testSource) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (s *testSource) String() string {
+	return s.name
+}
+
+// endlessSource sends payloads until the pipeline's context is done.
+type endlessSource struct{}
+
+func (s *endlessSource) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+}
+
+func (s *endlessSource) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	for ctx.Err() == nil {
+		select {
+		case outputChan <- etldata.JSON(`{"a":1}`):
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (s *endlessSource) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (s *endlessSource) String() string {
+	return "endlessSource"
+}
+
+// testSink records the payloads it receives, and the calls to Finish and
+// Abort.
+type testSink struct {
+	got      []string
+	finished int
+	aborted  error
+}
+
+func (s *testSink) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	s.got = append(s.got, string(d.Bytes()))
+}
+
+func (s *testSink) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	s.finished++
+}
+
+func (s *testSink) Abort(err error) {
+	s.aborted = err
+}
+
+func (s *testSink) String() string {
+	return "testSink"
+}
+
+// testFailer passes its data on, and fails on the failAt'th call.
+type testFailer struct {
+	failAt int
+	calls  int
+}
+
+func (f *testFailer) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	f.calls++
+	if f.calls == f.failAt {
+		killChan <- errors.New("failed")
+		return
+	}
+	outputChan <- d
+}
+
+func (f *testFailer) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (f *testFailer) String() string {
+	return "testFailer"
+}
+
+func TestPipelineTeardown(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    goetl.Processor
+		failer    *testFailer
+		timeout   time.Duration
+		wantErr   error
+		wantStage int
+		wantGot   int
+	}{
+		{
+			name:    "success",
+			source:  &testSource{name: "source", data: []string{`{"a":1}`, `{"a":2}`}},
+			failer:  &testFailer{},
+			wantGot: 2,
+		},
+		{
+			name:      "processor error",
+			source:    &testSource{name: "source", data: []string{`{"a":1}`, `{"a":2}`, `{"a":3}`}},
+			failer:    &testFailer{failAt: 2},
+			wantStage: 2,
+		},
+		{
+			name:    "cancelled",
+			source:  &endlessSource{},
+			failer:  &testFailer{},
+			timeout: 20 * time.Millisecond,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			sink := &testSink{}
+			p := goetl.NewPipeline(tt.source, tt.failer, sink)
+			p.RunContext(ctx)
+			r := p.Wait()
+
+			switch {
+			case tt.wantStage > 0:
+				serr, ok := r.Err.(*goetl.StageError)
+				if !ok || serr.Stage != tt.wantStage || serr.Processor != "testFailer" {
+					t.Fatalf("Err = %v, want an error from stage %d", r.Err, tt.wantStage)
+				}
+			case r.Err != tt.wantErr:
+				t.Fatalf("Err = %v, want %v", r.Err, tt.wantErr)
+			}
+			if r.Err == nil {
+				if sink.finished != 1 || sink.aborted != nil {
+					t.Errorf("Finish called %d times, Abort called with %v", sink.finished, sink.aborted)
+				}
+				if len(sink.got) != tt.wantGot {
+					t.Errorf("got %d payloads, want %d", len(sink.got), tt.wantGot)
+				}
+			} else if sink.aborted != r.Err {
+				t.Errorf("Abort called with %v, want %v", sink.aborted, r.Err)
+			}
+		})
+	}
+}
+
+func TestPipelineNoGoroutineLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		goetl.NewPipeline(&endlessSource{}, &testFailer{failAt: 5}, &testSink{}).Execute()
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before+2 {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left running, was %d:\n%s", runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,158 @@
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// AvroReader decodes the Avro object container files it receives, and
+// sends their records on as JSON arrays, in batches of up to BatchSize
+// records. It is meant to follow a reader sending the raw contents of
+// files, such as FileReader, or an IoReader, SftpReader or S3Reader with
+// LineByLine set to false. The payloads from each source (told apart by
+// their etldata.Metadata) are joined back together, and each block of the
+// file is decoded as soon as it has been received.
+//
+// Dates and timestamps are sent as etldata.SQLTime, or as time.Time if
+// TypedRecords is set, and decimals as numbers (see etlutil.AvroOCFReader
+// for the other types). Fields written by AvroWriter as strings holding
+// JSON (see etldata.Schema.AvroSchema) are decoded back.
+type AvroReader struct {
+	BatchSize    int  // defaults to 1000, and if 0 each object is sent on its own (as Records of one row with TypedRecords)
+	TypedRecords bool // send etldata.Records instead of etldata.JSON, see SQLReader.TypedRecords
+
+	sources map[string]*avroSource
+	order   []string // sources in the order they were first seen
+}
+
+// avroSource holds what has been read from a single source so far.
+type avroSource struct {
+	buf        []byte // data that has not been decoded yet
+	reader     *etlutil.AvroOCFReader
+	jsonFields []string
+	md         etldata.Metadata
+	batch      []map[string]interface{}
+}
+
+// NewAvroReader returns a new AvroReader.
+func NewAvroReader() *AvroReader {
+	return &AvroReader{BatchSize: 1000}
+}
+
+// ProcessData decodes the complete blocks received so far, and sends the
+// full batches.
+func (r *AvroReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	src := r.source(etldata.MetadataOf(d))
+	src.buf = append(src.buf, d.Bytes()...)
+	etlutil.KillPipelineIfErr(r.parse(src, false, outputChan), killChan)
+}
+
+// Finish decodes whatever is left of each source, and sends the last
+// batches.
+func (r *AvroReader) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	for _, key := range r.order {
+		if err := r.parse(r.sources[key], true, outputChan); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		if err := r.send(r.sources[key], outputChan); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	r.sources, r.order = nil, nil
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that the data of
+// each file is decoded on its own.
+func (r *AvroReader) ReadsMetadata() bool {
+	return true
+}
+
+func (r *AvroReader) String() string {
+	return "AvroReader"
+}
+
+// source returns the state of the source the Metadata describes.
+func (r *AvroReader) source(md etldata.Metadata) *avroSource {
+	key := sourceKey(md)
+	if r.sources == nil {
+		r.sources = make(map[string]*avroSource)
+	}
+	src, ok := r.sources[key]
+	if !ok {
+		src = &avroSource{reader: etlutil.NewAvroOCFReader()}
+		r.sources[key] = src
+		r.order = append(r.order, key)
+	}
+	if md != nil {
+		src.md = md.Clone()
+		delete(src.md, etldata.MetadataLine)
+		delete(src.md, etldata.MetadataLineByLine)
+	}
+	return src
+}
+
+func (r *AvroReader) parse(src *avroSource, atEOF bool, outputChan chan etldata.Payload) error {
+	started := src.reader.Schema() != nil
+	records, n, err := src.reader.ReadRecords(src.buf, atEOF)
+	src.buf = src.buf[n:]
+	if !started && src.reader.Schema() != nil {
+		src.jsonFields = avroJSONFields(src.reader.Schema())
+	}
+	for _, o := range records {
+		for k, v := range o {
+			if t, ok := v.(time.Time); ok && !r.TypedRecords {
+				o[k] = etldata.SQLTime{Time: t}
+			}
+		}
+		for _, k := range src.jsonFields {
+			if s, ok := o[k].(string); ok {
+				var v interface{}
+				if json.Unmarshal([]byte(s), &v) == nil {
+					o[k] = v
+				}
+			}
+		}
+		src.batch = append(src.batch, o)
+		if len(src.batch) >= r.BatchSize {
+			if err := r.send(src, outputChan); err != nil {
+				return err
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("AvroReader: %v", err)
+	}
+	return nil
+}
+
+// send sends the batch of objects read so far.
+func (r *AvroReader) send(src *avroSource, outputChan chan etldata.Payload) error {
+	err := sendObjects(src.batch, src.md, r.BatchSize, r.TypedRecords, outputChan)
+	src.batch = nil
+	return err
+}
+
+// avroJSONFields returns the fields of an Avro schema that hold JSON,
+// marked by the x-goetl-type attribute.
+func avroJSONFields(schema []byte) []string {
+	var record struct {
+		Fields []struct {
+			Name      string `json:"name"`
+			GoetlType string `json:"x-goetl-type"`
+		} `json:"fields"`
+	}
+	json.Unmarshal(schema, &record)
+	var names []string
+	for _, f := range record.Fields {
+		if f.GoetlType != "" {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,182 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// AvroWriter writes the objects it receives (see Payload.Objects) as an
+// Avro object container file, in blocks of BlockSize records. The file is
+// written to Writer, such as a local file or an etlutil.S3ObjectWriter, or
+// if Writer is nil it is sent on as it is written, so that it can be
+// written by an IoWriter, SftpWriter or S3Writer (with its LineSeparator
+// set to "").
+//
+// The records are written with AvroSchema, an Avro record schema in its
+// JSON form. If it is empty, the schema is converted from Schema (see
+// etldata.Schema.AvroSchema), in which case objects, arrays and fields of
+// any type are written as JSON, and timestamps and dates in the Field's
+// format are understood. If Schema is nil too, it is inferred from the
+// records of the first block with etldata.InferSchema, with every field
+// made nullable.
+type AvroWriter struct {
+	Writer     io.Writer
+	AvroSchema string
+	Schema     *etldata.Schema
+	Name       string            // the name of the record when converting Schema, defaults to "Record"
+	Codec      etlutil.AvroCodec // defaults to etlutil.AvroDeflate
+	BlockSize  int               // defaults to 1000
+
+	writer *etlutil.AvroOCFWriter
+	schema *etldata.Schema // the Schema AvroSchema was converted from
+	buf    bytes.Buffer    // what is sent on if Writer is nil
+	rows   []map[string]interface{}
+}
+
+// NewAvroWriter returns a new AvroWriter wrapping the given io.Writer
+// object, which can be nil.
+func NewAvroWriter(w io.Writer) *AvroWriter {
+	return &AvroWriter{Writer: w, Name: "Record", Codec: etlutil.AvroDeflate, BlockSize: 1000}
+}
+
+// ProcessData adds the objects to the current block, writing it once it
+// is full.
+func (w *AvroWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	objects, err := d.Objects()
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	w.rows = append(w.rows, objects...)
+	if len(w.rows) >= w.BlockSize {
+		etlutil.KillPipelineIfErr(w.flush(outputChan), killChan)
+	}
+}
+
+// Finish writes the last block.
+func (w *AvroWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	if err := w.flush(outputChan); err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if w.writer == nil {
+		if err := w.open(nil); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	etlutil.KillPipelineIfErr(w.writer.Close(), killChan)
+	w.send(outputChan)
+}
+
+func (w *AvroWriter) String() string {
+	return "AvroWriter"
+}
+
+func (w *AvroWriter) flush(outputChan chan etldata.Payload) error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	if w.writer == nil {
+		if err := w.open(w.rows); err != nil {
+			return err
+		}
+	}
+	if w.schema != nil {
+		for i, o := range w.rows {
+			converted, err := avroValues(w.schema, o)
+			if err != nil {
+				return err
+			}
+			w.rows[i] = converted
+		}
+	}
+	err := w.writer.WriteBlock(w.rows)
+	w.rows = nil
+	w.send(outputChan)
+	return err
+}
+
+// open creates the etlutil.AvroOCFWriter, inferring the schema from the
+// sample records if need be.
+func (w *AvroWriter) open(sample []map[string]interface{}) error {
+	schema := []byte(w.AvroSchema)
+	if len(schema) == 0 {
+		w.schema = w.Schema
+		if w.schema == nil {
+			inferred, err := etldata.InferSchema(etldata.NewRecords(sample))
+			if err != nil {
+				return err
+			}
+			for i := range inferred.Fields {
+				inferred.Fields[i].Nullable = true
+			}
+			w.schema = inferred
+		}
+		name := w.Name
+		if name == "" {
+			name = "Record"
+		}
+		var err error
+		if schema, err = w.schema.AvroSchema(name); err != nil {
+			return err
+		}
+	}
+	out := w.Writer
+	if out == nil {
+		out = &w.buf
+	}
+	writer, err := etlutil.NewAvroOCFWriter(out, schema)
+	if err != nil {
+		return err
+	}
+	writer.Codec = w.Codec
+	w.writer = writer
+	return nil
+}
+
+// send sends on what has been written, if Writer is nil.
+func (w *AvroWriter) send(outputChan chan etldata.Payload) {
+	if w.buf.Len() == 0 {
+		return
+	}
+	outputChan <- etldata.JSON(append([]byte(nil), w.buf.Bytes()...))
+	w.buf.Reset()
+}
+
+// avroValues returns a copy of an object with its values converted to what
+// the Avro schema converted from the Schema expects: JSON for objects,
+// arrays and fields of any type, and time.Time for timestamps and dates in
+// the Field's format.
+func avroValues(schema *etldata.Schema, object map[string]interface{}) (map[string]interface{}, error) {
+	o := make(map[string]interface{}, len(object))
+	for k, v := range object {
+		o[k] = v
+	}
+	for _, f := range schema.Fields {
+		v, ok := o[f.Name]
+		if !ok || v == nil {
+			continue
+		}
+		switch f.Type {
+		case etldata.FieldObject, etldata.FieldArray, etldata.FieldAny:
+			js, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			o[f.Name] = string(js)
+		case etldata.FieldTimestamp, etldata.FieldDate:
+			if s, ok := v.(string); ok {
+				if t, err := time.Parse(f.TimeFormat(), s); err == nil {
+					o[f.Name] = t
+				}
+			}
+		}
+	}
+	return o, nil
+}
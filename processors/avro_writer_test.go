@@ -0,0 +1,132 @@
+package processors
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+func TestAvroWriterAndReader(t *testing.T) {
+	input := []etldata.Payload{
+		etldata.JSON(`[{"id":1,"tags":["a"],"attrs":{"k":1},"day":"02/01/2024"},{"id":2,"tags":null,"attrs":{},"day":null}]`),
+		etldata.JSON(`{"id":3,"tags":[],"attrs":{"k":[1,2]},"day":"03/01/2024"}`),
+	}
+	schema := etldata.NewSchema(
+		etldata.Field{Name: "id", Type: etldata.FieldInteger},
+		etldata.Field{Name: "tags", Type: etldata.FieldArray, Nullable: true},
+		etldata.Field{Name: "attrs", Type: etldata.FieldObject},
+		etldata.Field{Name: "day", Type: etldata.FieldDate, Format: "02/01/2006", Nullable: true},
+	)
+	tests := []struct {
+		name         string
+		setup        func(w *AvroWriter, r *AvroReader)
+		want         []string
+		wantPayloads int // sent by the AvroWriter
+	}{
+		{
+			name:         "schema",
+			setup:        func(w *AvroWriter, r *AvroReader) { w.Schema = schema },
+			want:         []string{`[{"attrs":{"k":1},"day":"2024-01-02 00:00:00","id":1,"tags":["a"]},{"attrs":{},"day":null,"id":2,"tags":null},{"attrs":{"k":[1,2]},"day":"2024-01-03 00:00:00","id":3,"tags":[]}]`},
+			wantPayloads: 1,
+		},
+		{
+			name: "blocks and batches",
+			setup: func(w *AvroWriter, r *AvroReader) {
+				w.Schema = schema
+				w.BlockSize = 2
+				w.Codec = etlutil.AvroSnappy
+				r.BatchSize = 2
+			},
+			want:         []string{`[{"attrs":{"k":1},"day":"2024-01-02 00:00:00","id":1,"tags":["a"]},{"attrs":{},"day":null,"id":2,"tags":null}]`, `[{"attrs":{"k":[1,2]},"day":"2024-01-03 00:00:00","id":3,"tags":[]}]`},
+			wantPayloads: 2,
+		},
+		{
+			name:         "inferred schema",
+			want:         []string{`[{"attrs":{"k":1},"day":"02/01/2024","id":1,"tags":["a"]},{"attrs":{},"day":null,"id":2,"tags":null},{"attrs":{"k":[1,2]},"day":"03/01/2024","id":3,"tags":[]}]`},
+			wantPayloads: 1,
+		},
+		{
+			name: "Avro schema, each object on its own",
+			setup: func(w *AvroWriter, r *AvroReader) {
+				w.AvroSchema = `{"type": "record", "name": "R", "fields": [{"name": "id", "type": "int"}, {"name": "extra", "type": "string", "default": "x"}]}`
+				r.BatchSize = 0
+			},
+			want:         []string{`{"extra":"x","id":1}`, `{"extra":"x","id":2}`, `{"extra":"x","id":3}`},
+			wantPayloads: 1,
+		},
+		{
+			name: "typed records",
+			setup: func(w *AvroWriter, r *AvroReader) {
+				w.Schema = etldata.NewSchema(etldata.Field{Name: "day", Type: etldata.FieldDate, Format: "02/01/2006", Nullable: true})
+				r.TypedRecords = true
+			},
+			want:         []string{`[{"day":"2024-01-02T00:00:00Z"},{"day":null},{"day":"2024-01-03T00:00:00Z"}]`},
+			wantPayloads: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, r := NewAvroWriter(nil), NewAvroReader()
+			if tt.setup != nil {
+				tt.setup(w, r)
+			}
+			file, err := processAll(w, input...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(file) != tt.wantPayloads {
+				t.Errorf("AvroWriter sent %d payloads, want %d", len(file), tt.wantPayloads)
+			}
+			sent, err := processAll(r, file...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range sent {
+				got = append(got, string(d.Bytes()))
+				if _, ok := d.(*etldata.Records); ok != r.TypedRecords {
+					t.Errorf("sent a %T", d)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAvroWriterEmpty(t *testing.T) {
+	// A file with no records is still a valid file.
+	var buf bytes.Buffer
+	w := NewAvroWriter(&buf)
+	w.Schema = etldata.NewSchema(etldata.Field{Name: "id", Type: etldata.FieldInteger})
+	if sent, err := processAll(w); err != nil || len(sent) != 0 {
+		t.Fatalf("AvroWriter sent %v, %v", sent, err)
+	}
+	sent, err := processAll(NewAvroReader(), etldata.JSON(buf.Bytes()))
+	if err != nil || len(sent) != 0 {
+		t.Errorf("AvroReader sent %v, %v", sent, err)
+	}
+}
+
+func TestAvroReaderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "not Avro", data: "id,name\n", wantErr: "AvroReader: " + etlutil.ErrAvroFile.Error()},
+		{name: "truncated", data: "Obj\x01\x02", wantErr: "AvroReader: avro: invalid or truncated data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := processAll(NewAvroReader(), etldata.JSON(tt.data))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package processors
+
+import (
+	"github.com/teambenny/goetl/etldata"
+)
+
+// objectsPayload returns the objects as etldata.Records if typedRecords is
+// set, or as a JSON array otherwise.
+func objectsPayload(objects []map[string]interface{}, typedRecords bool) (etldata.Payload, error) {
+	if typedRecords {
+		return etldata.NewRecords(objects), nil
+	}
+	return etldata.NewJSON(objects)
+}
+
+// sendObjects sends a batch of objects read by a reader as one payload, or,
+// if batchSize is 0, each object on its own: as a JSON object, or as
+// etldata.Records of one row if typedRecords is set. Nothing is sent for an
+// empty batch.
+func sendObjects(objects []map[string]interface{}, md etldata.Metadata, batchSize int, typedRecords bool, outputChan chan etldata.Payload) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	send := func(d etldata.Payload) {
+		if md != nil {
+			d = etldata.WithMetadata(d, md)
+		}
+		outputChan <- d
+	}
+	if batchSize > 0 {
+		d, err := objectsPayload(objects, typedRecords)
+		if err != nil {
+			return err
+		}
+		send(d)
+		return nil
+	}
+	for _, o := range objects {
+		if typedRecords {
+			send(etldata.NewRecords([]map[string]interface{}{o}))
+			continue
+		}
+		d, err := etldata.NewJSON(o)
+		if err != nil {
+			return err
+		}
+		send(d)
+	}
+	return nil
+}
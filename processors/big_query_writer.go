@@ -10,6 +10,10 @@ import (
 // BigQueryWriter is used to write data to Google's BigQuery. If the table you want to
 // write to already exists, use NewBigQueryWriter, otherwise use NewBigQueryWriterForNewTable
 // and the desired table structure will be created when the client is initiated.
+//
+// Unlike MySQLWriter and PostgreSQLWriter, BigQueryWriter does not take an
+// etldata.Schema to check the table against, as the BigQuery client cannot
+// read a table's schema. Put a SchemaValidator in front of it instead.
 type BigQueryWriter struct {
 	client            *bigquery.Client
 	config            *BigQueryConfig
@@ -0,0 +1,180 @@
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// CSVReader parses the CSV data it receives into JSON objects, and sends
+// them on in batches of up to BatchSize objects (as JSON arrays). It is
+// meant to follow a reader such as IoReader, SftpReader or S3Reader: the
+// payloads from each source (told apart by their etldata.Metadata) are
+// joined back together, so quoted fields can span several lines. Payloads
+// read line by line have their newline added back.
+//
+// The keys of the objects are the fields of the first row of each source,
+// unless Header is set, in which case every row is data. Rename can be used
+// to change the keys taken from the first row.
+//
+// With InferTypes set, empty fields are null, and fields that look like
+// numbers, booleans (true or false) or SQL times (see etldata.SQLTime) are
+// converted. Numbers with leading zeros, such as zip codes, are kept as
+// strings. With TypedRecords also set, SQL times are sent as time.Time.
+type CSVReader struct {
+	Parser       *etlutil.CSVReader // sets the Comma, Quote and QuoteEscape
+	Header       []string
+	Rename       map[string]string
+	InferTypes   bool
+	BatchSize    int  // defaults to 1000, and if 0 each object is sent on its own (as Records of one row with TypedRecords)
+	TypedRecords bool // send etldata.Records instead of etldata.JSON, see SQLReader.TypedRecords
+
+	sources map[string]*csvSource
+	order   []string // sources in the order they were first seen
+}
+
+// csvSource holds what has been read from a single source so far.
+type csvSource struct {
+	buf    []byte // data that has not been parsed yet
+	header []string
+	row    int // rows read, including the header row
+	md     etldata.Metadata
+	batch  []map[string]interface{}
+}
+
+// NewCSVReader returns a new CSVReader reading comma-separated data with
+// a header row.
+func NewCSVReader() *CSVReader {
+	return &CSVReader{Parser: etlutil.NewCSVReader(), BatchSize: 1000}
+}
+
+// ProcessData parses the complete rows received so far, and sends the full
+// batches.
+func (r *CSVReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	md := etldata.MetadataOf(d)
+	src := r.source(md)
+	src.buf = append(src.buf, d.Bytes()...)
+	if md[etldata.MetadataLineByLine] != "" {
+		src.buf = append(src.buf, '\n')
+	}
+	etlutil.KillPipelineIfErr(r.parse(src, false, outputChan), killChan)
+}
+
+// Finish parses whatever is left of each source, and sends the last batches.
+func (r *CSVReader) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	for _, key := range r.order {
+		if err := r.parse(r.sources[key], true, outputChan); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		if err := r.send(r.sources[key], outputChan); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	r.sources, r.order = nil, nil
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that the data of
+// each file is parsed on its own.
+func (r *CSVReader) ReadsMetadata() bool {
+	return true
+}
+
+func (r *CSVReader) String() string {
+	return "CSVReader"
+}
+
+// source returns the state of the source the Metadata describes.
+func (r *CSVReader) source(md etldata.Metadata) *csvSource {
+	key := sourceKey(md)
+	if r.sources == nil {
+		r.sources = make(map[string]*csvSource)
+	}
+	src, ok := r.sources[key]
+	if !ok {
+		src = &csvSource{header: r.Header}
+		r.sources[key] = src
+		r.order = append(r.order, key)
+	}
+	if md != nil {
+		src.md = md.Clone()
+		delete(src.md, etldata.MetadataLine)
+		delete(src.md, etldata.MetadataLineByLine)
+	}
+	return src
+}
+
+func (r *CSVReader) parse(src *csvSource, atEOF bool, outputChan chan etldata.Payload) error {
+	records, n, err := r.Parser.ReadRecords(src.buf, atEOF)
+	src.buf = src.buf[n:]
+	for _, record := range records {
+		src.row++
+		if src.header == nil {
+			src.header = make([]string, len(record))
+			for i, k := range record {
+				if renamed, ok := r.Rename[k]; ok {
+					k = renamed
+				}
+				src.header[i] = k
+			}
+			continue
+		}
+		if len(record) != len(src.header) {
+			return fmt.Errorf("CSVReader: row %d has %d fields, expected %d", src.row, len(record), len(src.header))
+		}
+		o := make(map[string]interface{}, len(record))
+		for i, v := range record {
+			o[src.header[i]] = r.value(v)
+		}
+		src.batch = append(src.batch, o)
+		if len(src.batch) >= r.BatchSize {
+			if err := r.send(src, outputChan); err != nil {
+				return err
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("CSVReader: row %d: %v", src.row+1, err)
+	}
+	return nil
+}
+
+// send sends the batch of objects read so far.
+func (r *CSVReader) send(src *csvSource, outputChan chan etldata.Payload) error {
+	err := sendObjects(src.batch, src.md, r.BatchSize, r.TypedRecords, outputChan)
+	src.batch = nil
+	return err
+}
+
+var csvNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// value returns the value of a field, inferring its type if InferTypes is
+// set.
+func (r *CSVReader) value(v string) interface{} {
+	if !r.InferTypes {
+		return v
+	}
+	switch {
+	case v == "":
+		return nil
+	case strings.EqualFold(v, "true"):
+		return true
+	case strings.EqualFold(v, "false"):
+		return false
+	case csvNumber.MatchString(v):
+		return json.Number(v)
+	}
+	var t etldata.SQLTime
+	if err := t.UnmarshalJSON([]byte(`"` + v + `"`)); err == nil {
+		if r.TypedRecords {
+			return t.Time // which SQL drivers can use
+		}
+		return t
+	}
+	return v
+}
@@ -0,0 +1,160 @@
+package processors
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+)
+
+// processAll sends each of inputs to a processor and then finishes it,
+// returning what it sent and the error it killed the pipeline with, if any.
+func processAll(p goetl.Processor, inputs ...etldata.Payload) ([]etldata.Payload, error) {
+	outputChan := make(chan etldata.Payload, 1000)
+	killChan := make(chan error, 1)
+	for _, d := range inputs {
+		p.ProcessData(d, outputChan, killChan)
+		if len(killChan) > 0 {
+			break
+		}
+	}
+	if len(killChan) == 0 {
+		p.Finish(outputChan, killChan)
+	}
+	close(outputChan)
+	var sent []etldata.Payload
+	for d := range outputChan {
+		sent = append(sent, d)
+	}
+	if len(killChan) > 0 {
+		return sent, <-killChan
+	}
+	return sent, nil
+}
+
+func TestCSVReader(t *testing.T) {
+	a := etldata.Metadata{etldata.MetadataFileName: "a.csv"}
+	b := etldata.Metadata{etldata.MetadataFileName: "b.csv"}
+	lines := etldata.Metadata{etldata.MetadataFileName: "a.csv", etldata.MetadataLineByLine: "true", etldata.MetadataLine: "1"}
+	tests := []struct {
+		name    string
+		setup   func(r *CSVReader)
+		inputs  []etldata.Payload
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "quoted field split across payloads",
+			inputs: []etldata.Payload{etldata.JSON("id,note\n1,\"multi\nli"), etldata.JSON("ne, \"\"x\"\"\"\n2,b")},
+			want:   []string{`[{"id":"1","note":"multi\nline, \"x\""},{"id":"2","note":"b"}]`},
+		},
+		{
+			name:   "inferred types",
+			setup:  func(r *CSVReader) { r.InferTypes = true },
+			inputs: []etldata.Payload{etldata.JSON("zip,n,f,ok,at,empty,s\n02134,-12,1.5e3,TRUE,2024-01-02 03:04:05,,x\n")},
+			want:   []string{`[{"at":"2024-01-02 03:04:05","empty":null,"f":1.5e3,"n":-12,"ok":true,"s":"x","zip":"02134"}]`},
+		},
+		{
+			name:   "header and rename",
+			setup:  func(r *CSVReader) { r.Header = []string{"x", "y"}; r.Rename = map[string]string{"x": "unused"} },
+			inputs: []etldata.Payload{etldata.JSON("1,2\n3,4")},
+			want:   []string{`[{"x":"1","y":"2"},{"x":"3","y":"4"}]`},
+		},
+		{
+			name:   "rename",
+			setup:  func(r *CSVReader) { r.Rename = map[string]string{"Customer ID": "customer_id"} },
+			inputs: []etldata.Payload{etldata.JSON("Customer ID,name\r\n7,a\r\n")},
+			want:   []string{`[{"customer_id":"7","name":"a"}]`},
+		},
+		{
+			name:   "line by line with escaped quotes",
+			setup:  func(r *CSVReader) { r.Parser.QuoteEscape = `\` },
+			inputs: []etldata.Payload{etldata.WithMetadata(etldata.JSON(`"id","note"`), lines), etldata.WithMetadata(etldata.JSON(`"1","a \"b\""`), lines)},
+			want:   []string{`[{"id":"1","note":"a \"b\""}]`},
+		},
+		{
+			name:   "sources are read separately",
+			setup:  func(r *CSVReader) { r.BatchSize = 2 },
+			inputs: []etldata.Payload{etldata.WithMetadata(etldata.JSON("id\n1\n2\n3"), a), etldata.WithMetadata(etldata.JSON("key\nb"), b)},
+			want:   []string{`[{"id":"1"},{"id":"2"}]`, `[{"id":"3"}]`, `[{"key":"b"}]`},
+		},
+		{
+			name:   "each object on its own",
+			setup:  func(r *CSVReader) { r.BatchSize = 0 },
+			inputs: []etldata.Payload{etldata.JSON("id\n1\n2\n")},
+			want:   []string{`{"id":"1"}`, `{"id":"2"}`},
+		},
+		{
+			name:   "header only",
+			inputs: []etldata.Payload{etldata.JSON("id,name\n")},
+		},
+		{
+			name:    "wrong number of fields",
+			inputs:  []etldata.Payload{etldata.JSON("a,b\n1,2\n3\n")},
+			wantErr: "CSVReader: row 3 has 1 fields, expected 2",
+		},
+		{
+			name:    "unterminated quote",
+			inputs:  []etldata.Payload{etldata.JSON("a\n\"1\n")},
+			wantErr: "CSVReader: row 2: csv: badly quoted field",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewCSVReader()
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			sent, err := processAll(r, tt.inputs...)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range sent {
+				got = append(got, string(d.Bytes()))
+				if md := etldata.MetadataOf(d); md[etldata.MetadataLine] != "" || md[etldata.MetadataLineByLine] != "" {
+					t.Errorf("line metadata was passed on: %v", md)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVReaderTypedRecords(t *testing.T) {
+	r := NewCSVReader()
+	r.InferTypes = true
+	r.TypedRecords = true
+	r.BatchSize = 0
+	sent, err := processAll(r, etldata.JSON("id,at\n1,2024-01-02T03:04:05Z\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("sent %d payloads", len(sent))
+	}
+	if _, ok := sent[0].(*etldata.Records); !ok {
+		t.Fatalf("sent a %T, want *etldata.Records", sent[0])
+	}
+	objects, err := sent[0].Objects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SQL times are sent as time.Time, which SQL drivers can use.
+	if at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); objects[0]["at"] != at {
+		t.Errorf("at = %#v, want %v", objects[0]["at"], at)
+	}
+	if got, want := string(sent[0].Bytes()), `[{"at":"2024-01-02T03:04:05Z","id":1}]`; got != want {
+		t.Errorf("Bytes = %s, want %s", got, want)
+	}
+}
@@ -11,6 +11,9 @@ import (
 //
 // CSVTransformer is for more complex use-cases where you need to
 // generate CSV data and perhaps send it to multiple output stages.
+//
+// etldata.Records payloads (see SQLReader.TypedRecords) are written from the
+// rows they hold, without parsing any JSON.
 type CSVTransformer struct {
 	Parameters etlutil.CSVParameters
 }
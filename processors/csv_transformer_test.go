@@ -0,0 +1,33 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+func TestCSVTransformerRecords(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := `"at","id","name"` + "\n" + `"2024-01-02T03:04:05Z","1","a"` + "\n" + `"","2",""` + "\n"
+	tests := []struct {
+		name string
+		d    etldata.Payload
+	}{
+		{name: "JSON", d: etldata.JSON(`[{"id":1,"name":"a","at":"2024-01-02T03:04:05Z"},{"id":2,"name":null,"at":null}]`)},
+		{name: "Records", d: etldata.NewRecords([]map[string]interface{}{{"id": 1, "name": "a", "at": at}, {"id": int64(2), "name": nil, "at": nil}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputChan := make(chan etldata.Payload, 1)
+			killChan := make(chan error, 1)
+			NewCSVTransformer().ProcessData(tt.d, outputChan, killChan)
+			if len(killChan) > 0 {
+				t.Fatal(<-killChan)
+			}
+			if got := string((<-outputChan).Bytes()); got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package processors
 
 import (
+	"io"
 	"io/ioutil"
+	"os"
 
 	"github.com/teambenny/goetl/etldata"
 	"github.com/teambenny/goetl/etlutil"
@@ -9,21 +11,43 @@ import (
 
 // FileReader opens and reads the contents of the given filename.
 type FileReader struct {
-	filename string
+	filename    string
+	Compression string // a codec name, or "auto", see IoReader
 }
 
 // NewFileReader returns a new FileReader that will read the entire contents
 // of the given file path and send it at once. For buffered or line-by-line
-// reading try using IoReader.
+// reading try using IoReader. If Compression is set, the file is
+// decompressed first, and each file of a zip archive is sent on its own.
+//
+// The payload carries etldata.Metadata with the file name, the time it was
+// read and its content type (guessed from the file extension).
 func NewFileReader(filename string) *FileReader {
 	return &FileReader{filename: filename}
 }
 
 // ProcessData reads a file and sends its contents to outputChan
 func (r *FileReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
-	dd, err := ioutil.ReadFile(r.filename)
+	f, err := os.Open(r.filename)
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	defer f.Close()
+	md := etldata.Metadata{
+		etldata.MetadataFileName:    r.filename,
+		etldata.MetadataIngestedAt:  ingestedAt(),
+		etldata.MetadataContentType: contentTypeOf(r.filename),
+	}
+	err = forEachStream(f, r.Compression, false, md, func(reader io.Reader, md etldata.Metadata) error {
+		dd, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		outputChan <- etldata.WithMetadata(etldata.JSON(dd), md)
+		return nil
+	})
 	etlutil.KillPipelineIfErr(err, killChan)
-	outputChan <- etldata.JSON(dd)
 }
 
 // Finish - see interface for documentation.
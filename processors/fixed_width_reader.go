@@ -0,0 +1,200 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// FixedWidthReader parses the fixed-width text it receives into JSON
+// objects, one per line, and sends them on in batches of up to BatchSize
+// objects (as JSON arrays). Like CSVReader, it is meant to follow a reader
+// such as IoReader, SftpReader or S3Reader: the payloads from each source
+// (told apart by their etldata.Metadata) are joined back together, and
+// payloads read line by line have their newline added back.
+//
+// The fields of the lines are given by Layout (see
+// etlutil.FixedWidthLayout). Blank numbers and dates are null, numbers are
+// sent as they are written, with their implied decimal point, and dates as
+// etldata.SQLTime, or as time.Time if TypedRecords is set. Blank lines are
+// skipped.
+//
+// If Layout mixes several kinds of records, the type of each record is
+// added to its object under RecordTypeKey, and only the types in Types are
+// sent, or all of them if Types is empty. The counts of trailer records are
+// checked against the detail records of the source, and the pipeline is
+// killed if they do not match.
+type FixedWidthReader struct {
+	Layout        *etlutil.FixedWidthLayout
+	Types         []string
+	RecordTypeKey string // defaults to "record_type"
+	BatchSize     int    // defaults to 1000, and if 0 each object is sent on its own (as Records of one row with TypedRecords)
+	TypedRecords  bool   // send etldata.Records instead of etldata.JSON, see SQLReader.TypedRecords
+
+	sources map[string]*fixedWidthSource
+	order   []string // sources in the order they were first seen
+}
+
+// fixedWidthSource holds what has been read from a single source so far.
+type fixedWidthSource struct {
+	buf     []byte // data that has not been parsed yet
+	line    int    // lines read
+	counter etlutil.FixedWidthCounter
+	md      etldata.Metadata
+	batch   []map[string]interface{}
+}
+
+// NewFixedWidthReader returns a new FixedWidthReader reading lines with
+// the given layout.
+func NewFixedWidthReader(layout *etlutil.FixedWidthLayout) *FixedWidthReader {
+	return &FixedWidthReader{Layout: layout, RecordTypeKey: "record_type", BatchSize: 1000}
+}
+
+// ProcessData parses the complete lines received so far, and sends the full
+// batches.
+func (r *FixedWidthReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	md := etldata.MetadataOf(d)
+	src := r.source(md)
+	src.buf = append(src.buf, d.Bytes()...)
+	if md[etldata.MetadataLineByLine] != "" {
+		src.buf = append(src.buf, '\n')
+	}
+	etlutil.KillPipelineIfErr(r.parse(src, false, outputChan), killChan)
+}
+
+// Finish parses whatever is left of each source, and sends the last batches.
+func (r *FixedWidthReader) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	for _, key := range r.order {
+		if err := r.parse(r.sources[key], true, outputChan); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		if err := r.send(r.sources[key], outputChan); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	r.sources, r.order = nil, nil
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that the data of
+// each file is parsed on its own.
+func (r *FixedWidthReader) ReadsMetadata() bool {
+	return true
+}
+
+func (r *FixedWidthReader) String() string {
+	return "FixedWidthReader"
+}
+
+// source returns the state of the source the Metadata describes.
+func (r *FixedWidthReader) source(md etldata.Metadata) *fixedWidthSource {
+	key := sourceKey(md)
+	if r.sources == nil {
+		r.sources = make(map[string]*fixedWidthSource)
+	}
+	src, ok := r.sources[key]
+	if !ok {
+		src = &fixedWidthSource{}
+		r.sources[key] = src
+		r.order = append(r.order, key)
+	}
+	if md != nil {
+		src.md = md.Clone()
+		delete(src.md, etldata.MetadataLine)
+		delete(src.md, etldata.MetadataLineByLine)
+	}
+	return src
+}
+
+func (r *FixedWidthReader) parse(src *fixedWidthSource, atEOF bool, outputChan chan etldata.Payload) error {
+	for len(src.buf) > 0 {
+		i := bytes.IndexByte(src.buf, '\n')
+		if i < 0 && !atEOF {
+			break
+		}
+		line := src.buf
+		if i >= 0 {
+			line, src.buf = src.buf[:i], src.buf[i+1:]
+		} else {
+			src.buf = nil
+		}
+		src.line++
+		o, err := parseFixedWidthLine(r.Layout, string(line), &src.counter, r.options())
+		if err != nil {
+			return fmt.Errorf("FixedWidthReader: line %d: %v", src.line, err)
+		}
+		if o == nil {
+			continue
+		}
+		src.batch = append(src.batch, o)
+		if len(src.batch) >= r.BatchSize {
+			if err := r.send(src, outputChan); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *FixedWidthReader) options() fixedWidthOptions {
+	return fixedWidthOptions{types: r.Types, recordTypeKey: r.RecordTypeKey, typedRecords: r.TypedRecords}
+}
+
+// send sends the batch of objects read so far.
+func (r *FixedWidthReader) send(src *fixedWidthSource, outputChan chan etldata.Payload) error {
+	err := sendObjects(src.batch, src.md, r.BatchSize, r.TypedRecords, outputChan)
+	src.batch = nil
+	return err
+}
+
+// fixedWidthOptions are the settings shared by FixedWidthReader and
+// FixedWidthTransformer.
+type fixedWidthOptions struct {
+	types         []string
+	recordTypeKey string
+	typedRecords  bool
+}
+
+// parseFixedWidthLine parses a line, checking trailer counts with counter.
+// It returns nil for blank lines and records of types that are not wanted.
+func parseFixedWidthLine(layout *etlutil.FixedWidthLayout, line string, counter *etlutil.FixedWidthCounter, opts fixedWidthOptions) (map[string]interface{}, error) {
+	line = strings.TrimSuffix(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return nil, nil
+	}
+	record, o, err := layout.Parse(line)
+	if err != nil {
+		return nil, err
+	}
+	if err := counter.Add(record, o); err != nil {
+		return nil, err
+	}
+	if record != nil {
+		if len(opts.types) > 0 && !containsString(opts.types, record.Type) {
+			return nil, nil
+		}
+		o[opts.recordTypeKey] = record.Type
+	}
+	if !opts.typedRecords {
+		for k, v := range o {
+			if t, ok := v.(time.Time); ok {
+				o[k] = etldata.SQLTime{Time: t}
+			}
+		}
+	}
+	return o, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
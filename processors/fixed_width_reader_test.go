@@ -0,0 +1,137 @@
+package processors
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil/etlutiltest"
+)
+
+func TestFixedWidthReader(t *testing.T) {
+	lines := etldata.Metadata{etldata.MetadataLineByLine: "true"}
+	tests := []struct {
+		name    string
+		setup   func(r *FixedWidthReader)
+		inputs  []etldata.Payload
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "lines split across payloads",
+			inputs: []etldata.Payload{etldata.JSON("H20240102\r\nD0001a\n\nD00"), etldata.JSON("02b   \nT002")},
+			want:   []string{`[{"date":"2024-01-02 00:00:00","record_type":"header"},{"amount":null,"id":1,"name":"a","record_type":"order"},{"amount":null,"id":2,"name":"b","record_type":"order"},{"count":2,"record_type":"trailer"}]`},
+		},
+		{
+			name: "types, each object on its own",
+			setup: func(r *FixedWidthReader) {
+				r.Types = []string{"order"}
+				r.RecordTypeKey = "kind"
+				r.BatchSize = 0
+			},
+			inputs: []etldata.Payload{etldata.WithMetadata(etldata.JSON("D0001a     0012C"), lines), etldata.WithMetadata(etldata.JSON("D0002b     0123}"), lines), etldata.WithMetadata(etldata.JSON("T002"), lines)},
+			want:   []string{`{"amount":1.23,"id":1,"kind":"order","name":"a"}`, `{"amount":-12.30,"id":2,"kind":"order","name":"b"}`},
+		},
+		{
+			name:   "typed records",
+			setup:  func(r *FixedWidthReader) { r.Types = []string{"header"}; r.TypedRecords = true },
+			inputs: []etldata.Payload{etldata.JSON("H20240102\n")},
+			want:   []string{`[{"date":"2024-01-02T00:00:00Z","record_type":"header"}]`},
+		},
+		{
+			name:    "line of an error, counted across payloads",
+			inputs:  []etldata.Payload{etldata.JSON("D0001a\n\nD0"), etldata.JSON("002b\nX\n")},
+			wantErr: `FixedWidthReader: line 4: unknown record code "X"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewFixedWidthReader(etlutiltest.FixedWidthLayout())
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			sent, err := processAll(r, tt.inputs...)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range sent {
+				got = append(got, string(d.Bytes()))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixedWidthTransformer(t *testing.T) {
+	a := etldata.Metadata{etldata.MetadataFileName: "a.txt", etldata.MetadataLine: "3"}
+	b := etldata.Metadata{etldata.MetadataFileName: "b.txt"}
+	tr := NewFixedWidthTransformer(etlutiltest.FixedWidthLayout())
+	tr.Types = []string{"order"}
+	// Each source is counted on its own.
+	sent, err := processAll(tr,
+		etldata.WithMetadata(etldata.JSON("D0001a\nD0002b"), a),
+		etldata.WithMetadata(etldata.JSON("D0003c"), b),
+		etldata.WithMetadata(etldata.JSON("T002"), a),
+		etldata.WithMetadata(etldata.JSON("T001\n"), b),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range sent {
+		got = append(got, etldata.MetadataOf(d)[etldata.MetadataFileName]+" "+string(d.Bytes()))
+	}
+	want := []string{`a.txt [{"amount":null,"id":1,"name":"a","record_type":"order"},{"amount":null,"id":2,"name":"b","record_type":"order"}]`, `b.txt [{"amount":null,"id":3,"name":"c","record_type":"order"}]`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+
+	_, err = processAll(NewFixedWidthTransformer(etlutiltest.FixedWidthLayout()), etldata.WithMetadata(etldata.JSON("T001"), a))
+	if want := "FixedWidthTransformer: line 3: trailer counts 1 detail records, found 0"; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+}
+
+func TestFixedWidthWriter(t *testing.T) {
+	input := []etldata.Payload{
+		etldata.JSON(`[{"record_type":"header","date":"2024-01-02 00:00:00"},{"record_type":"order","id":1,"name":"a"}]`),
+		etldata.JSON(`[{"record_type":"order","id":2},{"record_type":"trailer"},{"record_type":"order","id":3},{"record_type":"trailer","count":5}]`),
+	}
+	// The count of a trailer is filled in unless it is given.
+	want := "H20240102\nD0001a          \nD0002           \nT002\nD0003           \nT005\n"
+
+	// Sent on, payload by payload.
+	sent, err := processAll(NewFixedWidthWriter(nil, etlutiltest.FixedWidthLayout()), input...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 || string(sent[0].Bytes())+string(sent[1].Bytes()) != want {
+		t.Errorf("sent %q", sent)
+	}
+
+	// Written, with another line separator.
+	var buf bytes.Buffer
+	w := NewFixedWidthWriter(&buf, etlutiltest.FixedWidthLayout())
+	w.LineSeparator = "\r\n"
+	if _, err := processAll(w, input...); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(bytes.Replace([]byte(want), []byte("\n"), []byte("\r\n"), -1)) {
+		t.Errorf("wrote %q", got)
+	}
+
+	_, err = processAll(NewFixedWidthWriter(nil, etlutiltest.FixedWidthLayout()), etldata.JSON(`{"record_type":"refund"}`))
+	if want := `FixedWidthWriter: unknown record type "refund"`; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,93 @@
+package processors
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// FixedWidthTransformer parses each payload it receives, which holds one or
+// more whole lines of fixed-width text, such as those sent by an IoReader
+// reading line by line, into JSON objects. The objects of each payload are
+// sent on together (as a JSON array), with its etldata.Metadata, and
+// payloads with no objects left are dropped.
+//
+// Lines are parsed as by FixedWidthReader, which should be used instead
+// when payloads can end in the middle of a line. Trailer counts are checked
+// against the detail records of the same source (told apart by their
+// Metadata), so payloads must arrive in order.
+type FixedWidthTransformer struct {
+	Layout        *etlutil.FixedWidthLayout
+	Types         []string
+	RecordTypeKey string // defaults to "record_type"
+	TypedRecords  bool   // send etldata.Records instead of etldata.JSON, see SQLReader.TypedRecords
+
+	counters map[string]*etlutil.FixedWidthCounter
+}
+
+// NewFixedWidthTransformer returns a new FixedWidthTransformer parsing
+// lines with the given layout.
+func NewFixedWidthTransformer(layout *etlutil.FixedWidthLayout) *FixedWidthTransformer {
+	return &FixedWidthTransformer{Layout: layout, RecordTypeKey: "record_type"}
+}
+
+// ProcessData parses the lines of the payload, and sends their objects.
+func (t *FixedWidthTransformer) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	md := etldata.MetadataOf(d)
+	key := sourceKey(md)
+	if t.counters == nil {
+		t.counters = make(map[string]*etlutil.FixedWidthCounter)
+	}
+	counter, ok := t.counters[key]
+	if !ok {
+		counter = &etlutil.FixedWidthCounter{}
+		t.counters[key] = counter
+	}
+
+	opts := fixedWidthOptions{types: t.Types, recordTypeKey: t.RecordTypeKey, typedRecords: t.TypedRecords}
+	var objects []map[string]interface{}
+	for i, line := range strings.Split(string(d.Bytes()), "\n") {
+		o, err := parseFixedWidthLine(t.Layout, line, counter, opts)
+		if err != nil {
+			if n := md[etldata.MetadataLine]; n != "" {
+				err = fmt.Errorf("FixedWidthTransformer: line %v: %v", n, err)
+			} else {
+				err = fmt.Errorf("FixedWidthTransformer: line %d of payload: %v", i+1, err)
+			}
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		if o != nil {
+			objects = append(objects, o)
+		}
+	}
+	if len(objects) == 0 {
+		return
+	}
+	out, err := objectsPayload(objects, t.TypedRecords)
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if md != nil {
+		out = etldata.WithMetadata(out, md)
+	}
+	outputChan <- out
+}
+
+// Finish - see interface for documentation.
+func (t *FixedWidthTransformer) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	t.counters = nil
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that the records of
+// each file are counted on their own.
+func (t *FixedWidthTransformer) ReadsMetadata() bool {
+	return true
+}
+
+func (t *FixedWidthTransformer) String() string {
+	return "FixedWidthTransformer"
+}
@@ -0,0 +1,99 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// FixedWidthWriter writes the objects it receives (see Payload.Objects) as
+// fixed-width lines, the reverse of FixedWidthReader. The lines are written
+// to Writer, or if Writer is nil the lines of each payload are sent on
+// together, so that they can be written by an IoWriter, SftpWriter or
+// S3Writer (with its LineSeparator set to "").
+//
+// If Layout mixes several kinds of records, the type of each object is
+// taken from its RecordTypeKey. Trailer records whose count field is
+// missing or null are given the number of detail records written since
+// the previous trailer.
+type FixedWidthWriter struct {
+	Writer        io.Writer
+	Layout        *etlutil.FixedWidthLayout
+	RecordTypeKey string // defaults to "record_type"
+	LineSeparator string // defaults to "\n"
+
+	details int64 // detail records written since the last trailer
+}
+
+// NewFixedWidthWriter returns a new FixedWidthWriter writing lines with the
+// given layout to w, which can be nil.
+func NewFixedWidthWriter(w io.Writer, layout *etlutil.FixedWidthLayout) *FixedWidthWriter {
+	return &FixedWidthWriter{Writer: w, Layout: layout, RecordTypeKey: "record_type", LineSeparator: "\n"}
+}
+
+// ProcessData writes the objects of the payload.
+func (w *FixedWidthWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	objects, err := d.Objects()
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	var buf bytes.Buffer
+	for _, o := range objects {
+		line, err := w.format(o)
+		if err != nil {
+			etlutil.KillPipelineIfErr(fmt.Errorf("FixedWidthWriter: %v", err), killChan)
+			return
+		}
+		buf.WriteString(line)
+		buf.WriteString(w.LineSeparator)
+	}
+	if buf.Len() == 0 {
+		return
+	}
+	if w.Writer == nil {
+		outputChan <- etldata.JSON(buf.Bytes())
+		return
+	}
+	_, err = w.Writer.Write(buf.Bytes())
+	etlutil.KillPipelineIfErr(err, killChan)
+}
+
+// format formats an object, filling in the count of a trailer record.
+func (w *FixedWidthWriter) format(o map[string]interface{}) (string, error) {
+	if len(w.Layout.Records) == 0 {
+		return w.Layout.Format("", o)
+	}
+	recordType, _ := o[w.RecordTypeKey].(string)
+	record := w.Layout.Record(recordType)
+	if record == nil {
+		return "", fmt.Errorf("unknown record type %q", o[w.RecordTypeKey])
+	}
+	switch record.Role {
+	case "", etlutil.FixedWidthDetail:
+		w.details++
+	case etlutil.FixedWidthTrailer:
+		if record.CountField != "" && o[record.CountField] == nil {
+			filled := make(map[string]interface{}, len(o)+1)
+			for k, v := range o {
+				filled[k] = v
+			}
+			filled[record.CountField] = w.details
+			o = filled
+		}
+		w.details = 0
+	}
+	return w.Layout.Format(recordType, o)
+}
+
+// Finish - see interface for documentation.
+func (w *FixedWidthWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	w.details = 0
+}
+
+func (w *FixedWidthWriter) String() string {
+	return "FixedWidthWriter"
+}
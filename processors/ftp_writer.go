@@ -9,16 +9,20 @@ import (
 	"github.com/teambenny/goetl/logger"
 )
 
-// FtpWriter type represents an ftp writter processor
+// FtpWriter type represents an ftp writter processor.
+// Set Compression (and CompressionLevel) to compress the file, as with IoWriter.
 type FtpWriter struct {
-	ftpFilepath   string
-	conn          *ftp.ServerConn
-	fileWriter    *io.PipeWriter
-	authenticated bool
-	host          string
-	username      string
-	password      string
-	path          string
+	ftpFilepath      string
+	conn             *ftp.ServerConn
+	fileWriter       *io.PipeWriter
+	compressor       io.WriteCloser
+	authenticated    bool
+	host             string
+	username         string
+	password         string
+	path             string
+	Compression      string
+	CompressionLevel int
 }
 
 // NewFtpWriter instantiates new instance of an ftp writer
@@ -53,7 +57,12 @@ func (f *FtpWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Paylo
 		f.connect(killChan)
 	}
 
-	_, e := f.fileWriter.Write(d.Bytes())
+	writer, e := compressedWriter(&f.compressor, f.fileWriter, f.Compression, f.CompressionLevel)
+	if e != nil {
+		etlutil.KillPipelineIfErr(e, killChan)
+		return
+	}
+	_, e = writer.Write(d.Bytes())
 	if e != nil {
 		etlutil.KillPipelineIfErr(e, killChan)
 	}
@@ -61,6 +70,7 @@ func (f *FtpWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Paylo
 
 // Finish closes open references to the remote file and server
 func (f *FtpWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	etlutil.KillPipelineIfErr(closeCompressor(&f.compressor), killChan)
 	if f.fileWriter != nil {
 		f.fileWriter.Close()
 	}
@@ -70,6 +80,17 @@ func (f *FtpWriter) Finish(outputChan chan etldata.Payload, killChan chan error)
 	}
 }
 
+// Abort stops the upload in progress and closes the connection to the server
+// when the pipeline fails. See AbortableProcessor.
+func (f *FtpWriter) Abort(err error) {
+	if f.fileWriter != nil {
+		f.fileWriter.CloseWithError(err)
+	}
+	if f.conn != nil {
+		f.conn.Quit()
+	}
+}
+
 func (f *FtpWriter) String() string {
 	return "FtpWriter"
 }
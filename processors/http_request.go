@@ -1,6 +1,7 @@
 package processors
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -26,11 +27,23 @@ func NewHTTPRequest(method, url string, body io.Reader) (*HTTPRequest, error) {
 
 // ProcessData sends data to outputChan if the response body is not null
 func (r *HTTPRequest) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
-	resp, err := r.Client.Do(r.Request)
+	r.ProcessDataContext(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataContext sends the request bound to the pipeline's context,
+// so a cancelled pipeline also aborts the request. See ContextProcessor.
+func (r *HTTPRequest) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	resp, err := r.Client.Do(r.Request.WithContext(ctx))
+	if ctx.Err() != nil {
+		return
+	}
 	etlutil.KillPipelineIfErr(err, killChan)
 	if resp != nil && resp.Body != nil {
 		dd, err := ioutil.ReadAll(resp.Body)
 		resp.Body.Close()
+		if ctx.Err() != nil {
+			return
+		}
 		etlutil.KillPipelineIfErr(err, killChan)
 		outputChan <- etldata.JSON(dd)
 	}
@@ -2,19 +2,33 @@ package processors
 
 import (
 	"bufio"
-	"compress/gzip"
 	"io"
+	"strconv"
 
 	"github.com/teambenny/goetl/etldata"
 	"github.com/teambenny/goetl/etlutil"
 )
 
 // IoReader wraps an io.Reader and reads it.
+//
+// Compressed data is decompressed with the codec named by Compression (see
+// etlutil.Codec), or with the codec detected from the file name or the
+// first bytes of the data if it is etlutil.CompressionAuto. Each file of a
+// zip archive is read in turn, with its name in the etldata.Metadata.
+//
+// Every payload sent carries etldata.Metadata with the time it was read,
+// whether it was read line by line, and anything set in Metadata. The same
+// Metadata is shared by all the payloads read from a stream, unless
+// LineNumbers is set, in which case each line gets its own, with its line
+// number.
 type IoReader struct {
-	Reader     io.Reader
-	LineByLine bool // defaults to true
-	BufferSize int
-	Gzipped    bool
+	Reader      io.Reader
+	LineByLine  bool // defaults to true
+	LineNumbers bool // adds etldata.MetadataLine when reading line by line
+	BufferSize  int
+	Gzipped     bool             // the same as setting Compression to "gzip"
+	Compression string           // a codec name, or "auto"
+	Metadata    etldata.Metadata // added to the Metadata of every payload
 }
 
 // NewIoReader returns a new IoReader wrapping the given io.Reader object.
@@ -22,14 +36,14 @@ func NewIoReader(reader io.Reader) *IoReader {
 	return &IoReader{Reader: reader, LineByLine: true, BufferSize: 1024}
 }
 
-// ProcessData overwrites the reader if the content is Gzipped, then defers to ForEachData
+// ProcessData decompresses the content if need be, then defers to ForEachData
 func (r *IoReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
-	if r.Gzipped {
-		gzReader, err := gzip.NewReader(r.Reader)
-		etlutil.KillPipelineIfErr(err, killChan)
-		r.Reader = gzReader
-	}
-	r.ForEachData(killChan, func(d etldata.Payload) {
+	r.read(nil, outputChan, killChan)
+}
+
+// read is ProcessData, also adding md to the Metadata of every payload.
+func (r *IoReader) read(md etldata.Metadata, outputChan chan etldata.Payload, killChan chan error) {
+	r.forEachData(md, killChan, func(d etldata.Payload) {
 		outputChan <- d
 	})
 }
@@ -41,35 +55,79 @@ func (r *IoReader) Finish(outputChan chan etldata.Payload, killChan chan error)
 // ForEachData either reads by line or by buffered stream, sending the data
 // back to the anonymous func that ultimately shoves it onto the outputChan
 func (r *IoReader) ForEachData(killChan chan error, foo func(d etldata.Payload)) {
-	if r.LineByLine {
-		r.scanLines(killChan, foo)
-	} else {
-		r.bufferedRead(killChan, foo)
+	r.forEachData(nil, killChan, foo)
+}
+
+func (r *IoReader) forEachData(md etldata.Metadata, killChan chan error, foo func(d etldata.Payload)) {
+	base := r.Metadata.Clone()
+	if base == nil {
+		base = etldata.Metadata{}
 	}
+	for k, v := range md {
+		base[k] = v
+	}
+	base[etldata.MetadataIngestedAt] = ingestedAt()
+	err := forEachStream(r.Reader, r.Compression, r.Gzipped, base, func(reader io.Reader, md etldata.Metadata) error {
+		if r.LineByLine {
+			return r.scanLines(reader, md, foo)
+		}
+		return r.bufferedRead(reader, md, foo)
+	})
+	etlutil.KillPipelineIfErr(err, killChan)
 }
 
-func (r *IoReader) scanLines(killChan chan error, forEach func(d etldata.Payload)) {
-	scanner := bufio.NewScanner(r.Reader)
+// forEachStream decompresses what is read from reader as the readers do (see
+// IoReader), calling fn with each stream and its Metadata, which is md with
+// the name (and content type) of the archive entry the stream was read from,
+// if any.
+func forEachStream(reader io.Reader, codec string, gzipped bool, md etldata.Metadata, fn func(reader io.Reader, md etldata.Metadata) error) error {
+	if codec == "" && gzipped {
+		codec = etlutil.CodecGzip
+	}
+	return etlutil.ForEachStream(reader, codec, fileNameOf(md), func(entry string, reader io.Reader) error {
+		if entry == "" {
+			return fn(reader, md)
+		}
+		entryMd := md.Clone()
+		entryMd[etldata.MetadataArchiveEntry] = entry
+		if contentType := contentTypeOf(entry); contentType != "" {
+			entryMd[etldata.MetadataContentType] = contentType
+		}
+		return fn(reader, entryMd)
+	})
+}
+
+func (r *IoReader) scanLines(reader io.Reader, md etldata.Metadata, forEach func(d etldata.Payload)) error {
+	md = md.Clone()
+	md[etldata.MetadataLineByLine] = "true"
+	scanner := bufio.NewScanner(reader)
+	line := 0
 	for scanner.Scan() {
-		forEach(etldata.JSON(scanner.Text()))
+		line++
+		lineMd := md
+		if r.LineNumbers {
+			lineMd = md.Clone()
+			lineMd[etldata.MetadataLine] = strconv.Itoa(line)
+		}
+		forEach(etldata.WithMetadata(etldata.JSON(scanner.Text()), lineMd))
 	}
-	err := scanner.Err()
-	etlutil.KillPipelineIfErr(err, killChan)
+	return scanner.Err()
 }
 
-func (r *IoReader) bufferedRead(killChan chan error, forEach func(d etldata.Payload)) {
-	reader := bufio.NewReader(r.Reader)
+func (r *IoReader) bufferedRead(reader io.Reader, md etldata.Metadata, forEach func(d etldata.Payload)) error {
+	br := bufio.NewReader(reader)
 	d := make([]byte, r.BufferSize)
 	for {
-		n, err := reader.Read(d)
-		if err != nil && err != io.EOF {
-			killChan <- err
+		n, err := br.Read(d)
+		if n > 0 {
+			forEach(etldata.WithMetadata(etldata.JSON(d[:n]), md))
+			d = make([]byte, r.BufferSize)
 		}
-		if n == 0 {
-			break
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
 		}
-		forEach(etldata.JSON(d))
-		d = make([]byte, r.BufferSize)
 	}
 }
 
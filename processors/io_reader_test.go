@@ -0,0 +1,134 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+	"github.com/teambenny/goetl/etlutil/etlutiltest"
+)
+
+func TestIoReaderCompression(t *testing.T) {
+	gzipped := etlutiltest.Compress(t, etlutil.CodecGzip, 0, "a\nb\n")
+	archive := etlutiltest.ZipArchive(t, "one.xml", "one.xml\n", "two.json", "two.json\n")
+
+	tests := []struct {
+		name  string
+		data  []byte
+		setup func(r *IoReader)
+		want  []string
+	}{
+		{
+			name:  "gzipped",
+			data:  gzipped,
+			setup: func(r *IoReader) { r.Gzipped = true },
+			want:  []string{"a map[line_by_line:true]", "b map[line_by_line:true]"},
+		},
+		{
+			name: "detected, with line numbers",
+			data: gzipped,
+			setup: func(r *IoReader) {
+				r.Compression = etlutil.CompressionAuto
+				r.LineNumbers = true
+			},
+			want: []string{"a map[line:1 line_by_line:true]", "b map[line:2 line_by_line:true]"},
+		},
+		{
+			name:  "not compressed",
+			data:  []byte("a\n"),
+			setup: func(r *IoReader) { r.Compression = etlutil.CompressionAuto },
+			want:  []string{"a map[line_by_line:true]"},
+		},
+		{
+			name: "zip entries",
+			data: archive,
+			setup: func(r *IoReader) {
+				r.Compression = etlutil.CompressionAuto
+				r.LineByLine = false
+				r.Metadata = etldata.Metadata{etldata.MetadataFileName: "in.zip"}
+			},
+			want: []string{
+				"one.xml\n map[archive_entry:one.xml content_type:text/xml; charset=utf-8 file_name:in.zip]",
+				"two.json\n map[archive_entry:two.json content_type:application/json file_name:in.zip]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewIoReader(bytes.NewReader(tt.data))
+			tt.setup(r)
+			sent, err := readAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range sent {
+				md := etldata.MetadataOf(d).Clone()
+				if md[etldata.MetadataIngestedAt] == "" {
+					t.Errorf("no %v in %v", etldata.MetadataIngestedAt, md)
+				}
+				delete(md, etldata.MetadataIngestedAt)
+				got = append(got, string(d.Bytes())+" "+fmt.Sprint(map[string]string(md)))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	_, err := readAll(&IoReader{Reader: bytes.NewReader(gzipped), Compression: "lz4"})
+	if want := `unknown compression codec "lz4"`; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+}
+
+func TestIoWriterCompression(t *testing.T) {
+	tests := []struct {
+		codec   string
+		level   int
+		wantErr string
+	}{
+		{codec: ""},
+		{codec: etlutil.CodecGzip, level: 1},
+		{codec: etlutil.CodecZstd},
+		{codec: etlutil.CodecXz},
+		{codec: etlutil.CodecSnappy},
+		{codec: etlutil.CodecBzip2, wantErr: "bzip2 cannot be written"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.codec, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewIoWriter(&buf)
+			w.AddNewline = true
+			w.Compression = tt.codec
+			w.CompressionLevel = tt.level
+			_, err := processAll(w, etldata.JSON(`{"id":1}`), etldata.JSON(`{"id":2}`))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The stream has ended, and reads back whole.
+			var got []byte
+			err = etlutil.ForEachStream(&buf, etlutil.CompressionAuto, "", func(_ string, r io.Reader) error {
+				got, err = ioutil.ReadAll(r)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "{\"id\":1}\n{\"id\":2}\n"; string(got) != want {
+				t.Errorf("wrote %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -12,9 +12,17 @@ import (
 // IoWriter wraps any io.Writer object.
 // It can be used to write data out to a File, os.Stdout, or
 // any other task that can be supported via io.Writer.
+//
+// Set Compression to a codec name, such as "gzip" (see etlutil.Codec), to
+// compress the data at CompressionLevel (0 being the codec's default). The
+// compressed stream is ended in Finish, but Writer is not closed.
 type IoWriter struct {
-	Writer     io.Writer
-	AddNewline bool
+	Writer           io.Writer
+	AddNewline       bool
+	Compression      string
+	CompressionLevel int
+
+	compressor io.WriteCloser
 }
 
 // NewIoWriter returns a new IoWriter wrapping the given io.Writer object
@@ -24,21 +32,53 @@ func NewIoWriter(writer io.Writer) *IoWriter {
 
 // ProcessData writes the data
 func (w *IoWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	writer, err := compressedWriter(&w.compressor, w.Writer, w.Compression, w.CompressionLevel)
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
 	var bytesWritten int
-	var err error
 	if w.AddNewline {
-		bytesWritten, err = fmt.Fprintln(w.Writer, string(d.Bytes()))
+		bytesWritten, err = fmt.Fprintln(writer, string(d.Bytes()))
 	} else {
-		bytesWritten, err = w.Writer.Write(d.Bytes())
+		bytesWritten, err = writer.Write(d.Bytes())
 	}
 	etlutil.KillPipelineIfErr(err, killChan)
 	logger.Debug("IoWriter:", bytesWritten, "bytes written")
 }
 
-// Finish - see interface for documentation.
+// Finish ends the compressed stream, if any.
 func (w *IoWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	etlutil.KillPipelineIfErr(closeCompressor(&w.compressor), killChan)
 }
 
 func (w *IoWriter) String() string {
 	return "IoWriter"
 }
+
+// compressedWriter returns the writer to write to so that what is written
+// reaches w compressed with the named codec, or w itself if there is no
+// codec. The compressor is created in *cw the first time.
+func compressedWriter(cw *io.WriteCloser, w io.Writer, codec string, level int) (io.Writer, error) {
+	if codec == "" {
+		return w, nil
+	}
+	if *cw == nil {
+		c, err := etlutil.NewCompressWriter(w, codec, level)
+		if err != nil {
+			return nil, err
+		}
+		*cw = c
+	}
+	return *cw, nil
+}
+
+// closeCompressor ends the compressed stream in *cw, if any was started.
+func closeCompressor(cw *io.WriteCloser) error {
+	if *cw == nil {
+		return nil
+	}
+	err := (*cw).Close()
+	*cw = nil
+	return err
+}
@@ -0,0 +1,187 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// JSONStreamReader reads JSON objects from an io.Reader one at a time, and
+// sends them on in batches, each payload being a JSON array of up to
+// BatchSize objects. Only one batch is held in memory at a time, so large
+// exports can be read without loading them whole.
+//
+// The input can either be a single JSON array of objects, which is decoded
+// element by element, or a stream of objects such as NDJSON (one object per
+// line). Unlike an IoReader reading line by line, there is no limit on the
+// size of a line. Compressed input is read as by IoReader, and each file of
+// a zip archive is read as a separate input.
+//
+// Every payload sent carries etldata.Metadata with the time it was read,
+// and anything set in Metadata.
+type JSONStreamReader struct {
+	Reader      io.Reader
+	BatchSize   int              // defaults to 1000, and if 0 each object is sent on its own, not in an array
+	Gzipped     bool             // the same as setting Compression to "gzip"
+	Compression string           // a codec name, or "auto", see IoReader
+	Metadata    etldata.Metadata // added to the Metadata of every payload
+}
+
+// NewJSONStreamReader returns a new JSONStreamReader wrapping the given
+// io.Reader object.
+func NewJSONStreamReader(reader io.Reader) *JSONStreamReader {
+	return &JSONStreamReader{Reader: reader, BatchSize: 1000}
+}
+
+// ProcessData reads all of the objects, sending them in batches.
+func (r *JSONStreamReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	r.ProcessDataContext(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataContext is the same as ProcessData, but stops reading once the
+// pipeline's context is done. See ContextProcessor.
+func (r *JSONStreamReader) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	err := r.read(etlutil.NewContextReader(ctx, r.Reader), outputChan)
+	if err != nil && ctx.Err() == nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+	}
+}
+
+func (r *JSONStreamReader) read(reader io.Reader, outputChan chan etldata.Payload) error {
+	md := r.Metadata.Clone()
+	if md == nil {
+		md = etldata.Metadata{}
+	}
+	md[etldata.MetadataIngestedAt] = ingestedAt()
+	return forEachStream(reader, r.Compression, r.Gzipped, md, func(reader io.Reader, md etldata.Metadata) error {
+		return r.readStream(reader, md, outputChan)
+	})
+}
+
+// readStream reads the objects of a single stream.
+func (r *JSONStreamReader) readStream(reader io.Reader, md etldata.Metadata, outputChan chan etldata.Payload) error {
+	batch := &jsonBatch{name: r.String(), size: r.BatchSize, md: md, outputChan: outputChan}
+
+	// Peek at the first byte to tell an array from a stream of objects.
+	br := bufio.NewReader(reader)
+	isArray := false
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !unicode.IsSpace(rune(c)) {
+			isArray = c == '['
+			br.UnreadByte()
+			break
+		}
+	}
+
+	dec := json.NewDecoder(br)
+	if isArray {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		for dec.More() {
+			if err := batch.decode(dec); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("JSONStreamReader: after object %d: %v", batch.count, err)
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return errors.New("JSONStreamReader: unexpected data after array")
+		}
+	} else {
+		for dec.More() {
+			if err := batch.decode(dec); err != nil {
+				return err
+			}
+		}
+		// More returns false on invalid data as well as at the end.
+		if _, err := dec.Token(); err != io.EOF {
+			return fmt.Errorf("JSONStreamReader: after object %d: %v", batch.count, err)
+		}
+	}
+	batch.flush()
+	return nil
+}
+
+// Finish - see interface for documentation.
+func (r *JSONStreamReader) Finish(outputChan chan etldata.Payload, killChan chan error) {
+}
+
+func (r *JSONStreamReader) String() string {
+	return "JSONStreamReader"
+}
+
+// jsonBatch builds the JSON array payloads sent by a JSONStreamReader or an
+// XMLReader, whose name is used in errors. If size is 0, each object is sent
+// on its own instead.
+type jsonBatch struct {
+	name       string
+	size       int
+	md         etldata.Metadata
+	outputChan chan etldata.Payload
+
+	buf   bytes.Buffer
+	n     int // objects in buf
+	count int // objects read so far
+}
+
+// decode reads the next object, sending the batch once it is full.
+func (b *jsonBatch) decode(dec *json.Decoder) error {
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("%v: object %d: %v", b.name, b.count+1, err)
+	}
+	b.count++
+	if len(raw) == 0 || raw[0] != '{' {
+		return fmt.Errorf("%v: object %d: not a JSON object", b.name, b.count)
+	}
+	b.add(raw)
+	return nil
+}
+
+// add adds an encoded object to the batch, sending the batch once it is
+// full. raw is not used again by the caller, so it can be sent as it is.
+func (b *jsonBatch) add(raw []byte) {
+	if b.size <= 0 {
+		b.outputChan <- etldata.WithMetadata(etldata.JSON(raw), b.md)
+		return
+	}
+	if b.n == 0 {
+		b.buf.WriteByte('[')
+	} else {
+		b.buf.WriteByte(',')
+	}
+	b.buf.Write(raw)
+	b.n++
+	if b.n >= b.size {
+		b.flush()
+	}
+}
+
+// flush sends the objects read since the last batch, if any.
+func (b *jsonBatch) flush() {
+	if b.n == 0 {
+		return
+	}
+	b.buf.WriteByte(']')
+	d := make([]byte, b.buf.Len())
+	copy(d, b.buf.Bytes())
+	b.outputChan <- etldata.WithMetadata(etldata.JSON(d), b.md)
+	b.buf.Reset()
+	b.n = 0
+}
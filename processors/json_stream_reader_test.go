@@ -0,0 +1,79 @@
+package processors
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+// readAll runs a reader's ProcessData, returning what it sent and the error
+// it killed the pipeline with, if any. outputChan is large enough that the
+// reader never blocks.
+func readAll(p interface {
+	ProcessData(etldata.Payload, chan etldata.Payload, chan error)
+}) ([]etldata.Payload, error) {
+	outputChan := make(chan etldata.Payload, 1000)
+	killChan := make(chan error, 1)
+	p.ProcessData(nil, outputChan, killChan)
+	close(outputChan)
+	var sent []etldata.Payload
+	for d := range outputChan {
+		sent = append(sent, d)
+	}
+	if len(killChan) > 0 {
+		return sent, <-killChan
+	}
+	return sent, nil
+}
+
+func TestJSONStreamReader(t *testing.T) {
+	long := strings.Repeat("x", 100000)
+	tests := []struct {
+		name      string
+		input     string
+		batchSize int
+		want      []string
+		wantErr   string
+	}{
+		{name: "array", input: "[ {\"a\":1}, {\"a\":2},\n{\"a\":3} ]\n", batchSize: 2, want: []string{`[{"a":1},{"a":2}]`, `[{"a":3}]`}},
+		{name: "NDJSON", input: "{\"a\":1}\n\n{\"s\":\"" + long + "\"}\n", batchSize: 1000, want: []string{`[{"a":1},{"s":"` + long + `"}]`}},
+		{name: "each object on its own", input: `[{"a":1},{"a":2}]`, want: []string{`{"a":1}`, `{"a":2}`}},
+		{name: "NDJSON objects on their own", input: "{\"a\":1}\n{\"a\":2}", want: []string{`{"a":1}`, `{"a":2}`}},
+		{name: "empty", input: " \n", batchSize: 1000},
+		{name: "empty array", input: "[]", batchSize: 1000},
+		{name: "not an object", input: `[{"a":1}, 2]`, batchSize: 1000, wantErr: "JSONStreamReader: object 2: not a JSON object"},
+		{name: "invalid", input: "{\"a\":1}\n{bad", batchSize: 1000, wantErr: "JSONStreamReader: object 2: invalid character"},
+		{name: "data after array", input: `[{"a":1}] x`, batchSize: 1000, wantErr: "JSONStreamReader: unexpected data after array"},
+		{name: "unterminated array", input: `[{"a":1}`, batchSize: 1000, wantErr: "JSONStreamReader: object 2: unexpected end"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewJSONStreamReader(strings.NewReader(tt.input))
+			r.BatchSize = tt.batchSize
+			r.Metadata = etldata.Metadata{etldata.MetadataTable: "events"}
+			sent, err := readAll(r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sent) != len(tt.want) {
+				t.Fatalf("sent %d payloads, want %d", len(sent), len(tt.want))
+			}
+			for i, d := range sent {
+				if got := string(d.Bytes()); got != tt.want[i] {
+					t.Errorf("payload %d = %.100s, want %.100s", i, got, tt.want[i])
+				}
+				md := etldata.MetadataOf(d)
+				if md[etldata.MetadataTable] != "events" || md[etldata.MetadataIngestedAt] == "" {
+					t.Errorf("payload %d metadata = %v", i, md)
+				}
+			}
+		})
+	}
+}
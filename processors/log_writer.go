@@ -0,0 +1,35 @@
+package processors
+
+import (
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/logger"
+)
+
+// LogWriter logs every payload it receives instead of writing it anywhere,
+// which is handy while building a pipeline. The goetl command uses it in
+// place of the writers in a dry run.
+type LogWriter struct {
+	Prefix   string
+	payloads int
+}
+
+// NewLogWriter returns a new LogWriter logging each payload after the
+// given prefix.
+func NewLogWriter(prefix string) *LogWriter {
+	return &LogWriter{Prefix: prefix}
+}
+
+// ProcessData logs the payload at Info level
+func (w *LogWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	w.payloads++
+	logger.Info(w.Prefix, string(d.Bytes()))
+}
+
+// Finish logs the number of payloads received.
+func (w *LogWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	logger.Info(w.Prefix, "received", w.payloads, "payloads")
+}
+
+func (w *LogWriter) String() string {
+	return "LogWriter"
+}
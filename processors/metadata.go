@@ -0,0 +1,39 @@
+package processors
+
+import (
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+// ingestedAt returns the current time formatted for etldata.MetadataIngestedAt.
+func ingestedAt() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// contentTypeOf guesses the etldata.MetadataContentType of a file from its
+// extension, returning "" if it is not known.
+func contentTypeOf(filename string) string {
+	return mime.TypeByExtension(path.Ext(filename))
+}
+
+// sourceKey identifies the file or object a payload was read from, for
+// processors that join the payloads of each source back together.
+func sourceKey(md etldata.Metadata) string {
+	return strings.Join([]string{md[etldata.MetadataFileName], md[etldata.MetadataS3Bucket],
+		md[etldata.MetadataS3Key], md[etldata.MetadataSftpPath], md[etldata.MetadataArchiveEntry]}, "\x00")
+}
+
+// fileNameOf returns the name of the file or object the Metadata describes,
+// or "" if there is none.
+func fileNameOf(md etldata.Metadata) string {
+	for _, k := range []string{etldata.MetadataFileName, etldata.MetadataS3Key, etldata.MetadataSftpPath} {
+		if md[k] != "" {
+			return md[k]
+		}
+	}
+	return ""
+}
@@ -17,7 +17,8 @@ import (
 // the values are the SQL values to be inserted into those columns.
 //
 // For use-cases where a MySQLWriter instance needs to write to
-// multiple tables you can pass in SQLWriterData.
+// multiple tables you can pass in SQLWriterData, or set the etldata.MetadataTable
+// key in the payload's etldata.Metadata.
 type MySQLWriter struct {
 	writeDB          *sql.DB
 	TableName        string
@@ -25,6 +26,17 @@ type MySQLWriter struct {
 	OnDupKeyFields   []string
 	ConcurrencyLevel int // See ConcurrentProcessor
 	BatchSize        int
+	// Schema, if set, is checked against each table before it is first
+	// written to (see etlutil.CheckTableSchema), halting the pipeline if
+	// the records it describes would not fit.
+	Schema *etldata.Schema
+	// Transaction, if set, makes the writer write everything within a
+	// single transaction, which is committed by Finish, or rolled back by
+	// Abort if the pipeline fails, so that a failed run writes nothing.
+	Transaction bool
+
+	schemaCheck tableSchemaCheck
+	tx          sqlWriterTx
 }
 
 // NewMySQLWriter returns a new MySQLWriter
@@ -41,26 +53,91 @@ func (s *MySQLWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Pay
 		}
 	}()
 
-	// First check for SQLWriterData
+	// First check for SQLWriterData, unless the rows are already at hand.
 	var wd SQLWriterData
-	err := d.ParseSilent(&wd)
+	isWriterData := false
+	if _, ok := d.(*etldata.Records); !ok {
+		isWriterData = d.ParseSilent(&wd) == nil && wd.TableName != "" && wd.InsertData != nil
+	}
 	logger.Info("MySQLWriter: Writing data...")
-	if err == nil && wd.TableName != "" && wd.InsertData != nil {
+	if isWriterData {
 		logger.Debug("MySQLWriter: SQLWriterData scenario")
 		dd, err := etldata.NewJSON(wd.InsertData)
 		etlutil.KillPipelineIfErr(err, killChan)
-		err = etlutil.MySQLInsertData(s.writeDB, dd, wd.TableName, s.OnDupKeyUpdate, s.OnDupKeyFields, s.BatchSize)
+		if err := s.schemaCheck.check(s.writeDB, s.Schema, wd.TableName, etlutil.MySQLTableColumns); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		err = s.insert(dd, wd.TableName)
 		etlutil.KillPipelineIfErr(err, killChan)
 	} else {
 		logger.Debug("MySQLWriter: normal data scenario")
-		err = etlutil.MySQLInsertData(s.writeDB, d, s.TableName, s.OnDupKeyUpdate, s.OnDupKeyFields, s.BatchSize)
+		if err := s.schemaCheck.check(s.writeDB, s.Schema, s.tableFor(d), etlutil.MySQLTableColumns); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		err := s.insert(d, s.tableFor(d))
 		etlutil.KillPipelineIfErr(err, killChan)
 	}
 	logger.Info("MySQLWriter: Write complete")
 }
 
-// Finish - see interface for documentation.
+// insert writes a payload, and counts it for Acknowledged.
+func (s *MySQLWriter) insert(d etldata.Payload, tableName string) error {
+	err := s.write(d, tableName)
+	s.tx.wrote(s.Transaction, err)
+	return err
+}
+
+// write defers to etlutil.MySQLInsertData, or etlutil.MySQLInsertDataTx if
+// Transaction is set.
+func (s *MySQLWriter) write(d etldata.Payload, tableName string) error {
+	if !s.Transaction {
+		return etlutil.MySQLInsertData(s.writeDB, d, tableName, s.OnDupKeyUpdate, s.OnDupKeyFields, s.BatchSize)
+	}
+	tx, err := s.tx.begin(s.writeDB)
+	if err != nil {
+		return err
+	}
+	return etlutil.MySQLInsertDataTx(tx, d, tableName, s.OnDupKeyUpdate, s.OnDupKeyFields, s.BatchSize)
+}
+
+// Finish commits the transaction, if Transaction is set.
 func (s *MySQLWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	etlutil.KillPipelineIfErr(s.tx.commit(), killChan)
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that a payload can
+// name its table with etldata.MetadataTable.
+func (s *MySQLWriter) ReadsMetadata() bool {
+	return true
+}
+
+// Abort rolls back the transaction, if Transaction is set. It implements
+// goetl.AbortableProcessor.
+func (s *MySQLWriter) Abort(err error) {
+	if rerr := s.tx.rollback(); rerr != nil {
+		logger.Error("MySQLWriter: rolling back:", rerr)
+	}
+}
+
+// Acknowledged returns the number of payloads written, or committed if
+// Transaction is set. It implements goetl.Acknowledger. It is always 0 when
+// ConcurrencyLevel is above 1, since the payloads may then be written out of
+// order.
+func (s *MySQLWriter) Acknowledged() int {
+	if s.ConcurrencyLevel > 1 {
+		return 0
+	}
+	return s.tx.acknowledged()
+}
+
+// tableFor returns the table to write d to, unless it is SQLWriterData.
+func (s *MySQLWriter) tableFor(d etldata.Payload) string {
+	if table := etldata.MetadataOf(d)[etldata.MetadataTable]; table != "" {
+		return table
+	}
+	return s.TableName
 }
 
 func (s *MySQLWriter) String() string {
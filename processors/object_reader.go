@@ -0,0 +1,172 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+	"github.com/teambenny/goetl/logger"
+)
+
+// ObjectReader reads the objects of an etlutil.ObjectStore whose keys match
+// Pattern, such as "exports/" or "exports/*.csv" (see ObjectStore.List), one
+// after the other. It reads from a directory, S3 or SFTP alike, depending on
+// the store it is given.
+//
+// ObjectReader embeds an IoReader, so it supports the same options. The key
+// of each object (as etldata.MetadataFileName) and its content type are added
+// to the etldata.Metadata of the payloads read from it.
+//
+// It optionally deletes all of the objects it has read once they have all
+// been sent. Set CloseOnFinish to close the store, if it is an io.Closer
+// (such as etlutil.SftpObjectStore), in Finish.
+type ObjectReader struct {
+	IoReader      // embeds IoReader
+	Store         etlutil.ObjectStore
+	Pattern       string
+	DeleteObjects bool
+	CloseOnFinish bool
+
+	processedObjectKeys []string
+	keysMutex           sync.Mutex
+}
+
+// NewObjectReader returns a new ObjectReader reading the objects of store
+// that match pattern, line by line.
+func NewObjectReader(store etlutil.ObjectStore, pattern string) *ObjectReader {
+	r := ObjectReader{Store: store, Pattern: pattern}
+	r.IoReader.LineByLine = true
+	return &r
+}
+
+// ProcessData reads each of the objects matching Pattern, sending their
+// data to outputChan, and then optionally deletes them.
+func (r *ObjectReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	r.ProcessDataContext(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataContext is the same as ProcessData, but stops reading once the
+// pipeline's context is done, and then deletes nothing. See
+// ContextProcessor.
+func (r *ObjectReader) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	objects, err := r.Store.List(r.Pattern)
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	logger.Debug("ObjectReader: list =", objects)
+	for _, o := range objects {
+		if ctx.Err() != nil {
+			return
+		}
+		if r.isProcessed(o.Key) {
+			logger.Debug("ObjectReader: skipping object processed before checkpoint", o.Key)
+			continue
+		}
+		if err := r.readObject(ctx, o.Key, outputChan, killChan); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		// Never delete an object that may have only been partially read.
+		if ctx.Err() != nil {
+			return
+		}
+		r.addProcessed(o.Key)
+	}
+	if r.DeleteObjects {
+		for _, key := range r.processedKeys() {
+			if err := r.Store.Delete(key); err != nil {
+				etlutil.KillPipelineIfErr(err, killChan)
+				return
+			}
+		}
+	}
+}
+
+// Finish optionally closes the store.
+func (r *ObjectReader) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	if r.CloseOnFinish {
+		etlutil.KillPipelineIfErr(closeStore(r.Store), killChan)
+	}
+}
+
+// Abort closes the store (if CloseOnFinish is set) when the pipeline fails
+// before Finish is called. See AbortableProcessor.
+func (r *ObjectReader) Abort(err error) {
+	if r.CloseOnFinish {
+		closeStore(r.Store)
+	}
+}
+
+// Checkpoint saves the keys of the objects that have been read so far.
+// It implements goetl.Checkpointer.
+func (r *ObjectReader) Checkpoint() ([]byte, error) {
+	return json.Marshal(r.processedKeys())
+}
+
+// Restore skips reading the objects saved by Checkpoint. They are
+// still deleted along with the other objects if DeleteObjects is set.
+// It implements goetl.Checkpointer.
+func (r *ObjectReader) Restore(state []byte) error {
+	var keys []string
+	if err := json.Unmarshal(state, &keys); err != nil {
+		return err
+	}
+	r.keysMutex.Lock()
+	defer r.keysMutex.Unlock()
+	r.processedObjectKeys = keys
+	return nil
+}
+
+func (r *ObjectReader) String() string {
+	return "ObjectReader"
+}
+
+func (r *ObjectReader) readObject(ctx context.Context, key string, outputChan chan etldata.Payload, killChan chan error) error {
+	obj, err := r.Store.Open(key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	// Use IoReader for actual data handling
+	r.IoReader.Reader = etlutil.NewContextReader(ctx, obj)
+	r.IoReader.read(etldata.Metadata{
+		etldata.MetadataFileName:    key,
+		etldata.MetadataContentType: contentTypeOf(key),
+	}, outputChan, killChan)
+	return nil
+}
+
+func (r *ObjectReader) isProcessed(key string) bool {
+	r.keysMutex.Lock()
+	defer r.keysMutex.Unlock()
+	for _, k := range r.processedObjectKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ObjectReader) addProcessed(key string) {
+	r.keysMutex.Lock()
+	defer r.keysMutex.Unlock()
+	r.processedObjectKeys = append(r.processedObjectKeys, key)
+}
+
+func (r *ObjectReader) processedKeys() []string {
+	r.keysMutex.Lock()
+	defer r.keysMutex.Unlock()
+	return append([]string(nil), r.processedObjectKeys...)
+}
+
+// closeStore closes an etlutil.ObjectStore that holds a connection.
+func closeStore(store etlutil.ObjectStore) error {
+	if c, ok := store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+	"github.com/teambenny/goetl/etlutil/etlutiltest"
+)
+
+// closingStore is a MemoryObjectStore that counts how often it is closed.
+type closingStore struct {
+	*etlutil.MemoryObjectStore
+	closed int
+}
+
+func (s *closingStore) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestObjectReader(t *testing.T) {
+	gzipped := etlutiltest.Compress(t, etlutil.CodecGzip, 0, "c1\nc2\n")
+	newStore := func() *etlutil.MemoryObjectStore {
+		s := etlutil.NewMemoryObjectStore()
+		s.Put("in/b.json", []byte("b1\nb2\n"))
+		s.Put("in/a.json", []byte("a1\n"))
+		s.Put("in/c.json.gz", gzipped)
+		s.Put("out/a.json", []byte("x\n"))
+		return s
+	}
+	tests := []struct {
+		name        string
+		pattern     string
+		setup       func(r *ObjectReader)
+		want        []string
+		wantObjects []string // the objects left in the store
+	}{
+		{
+			name:        "prefix",
+			pattern:     "in/",
+			setup:       func(r *ObjectReader) { r.Compression = etlutil.CompressionAuto },
+			want:        []string{"in/a.json a1", "in/b.json b1", "in/b.json b2", "in/c.json.gz c1", "in/c.json.gz c2"},
+			wantObjects: []string{"in/a.json", "in/b.json", "in/c.json.gz", "out/a.json"},
+		},
+		{
+			name:        "glob, deleting what is read",
+			pattern:     "*/a.json",
+			setup:       func(r *ObjectReader) { r.DeleteObjects = true },
+			want:        []string{"in/a.json a1", "out/a.json x"},
+			wantObjects: []string{"in/b.json", "in/c.json.gz"},
+		},
+		{
+			name:    "restored checkpoint",
+			pattern: "in/*.json",
+			setup: func(r *ObjectReader) {
+				r.DeleteObjects = true
+				r.Restore([]byte(`["in/a.json"]`))
+			},
+			want:        []string{"in/b.json b1", "in/b.json b2"},
+			wantObjects: []string{"in/c.json.gz", "out/a.json"},
+		},
+		{
+			name:        "no match",
+			pattern:     "missing/",
+			wantObjects: []string{"in/a.json", "in/b.json", "in/c.json.gz", "out/a.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore()
+			r := NewObjectReader(store, tt.pattern)
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			sent, err := readAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range sent {
+				md := etldata.MetadataOf(d)
+				if md[etldata.MetadataContentType] == "" && md[etldata.MetadataFileName] != "in/c.json.gz" {
+					t.Errorf("no content type in %v", md)
+				}
+				got = append(got, md[etldata.MetadataFileName]+" "+string(d.Bytes()))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+			objects, _ := store.List("")
+			var keys []string
+			for _, o := range objects {
+				keys = append(keys, o.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.wantObjects) {
+				t.Errorf("objects = %v, want %v", keys, tt.wantObjects)
+			}
+		})
+	}
+}
+
+func TestObjectReaderCheckpoint(t *testing.T) {
+	store := &closingStore{MemoryObjectStore: etlutil.NewMemoryObjectStore()}
+	store.Put("a", []byte("a"))
+	store.Put("b", []byte("b"))
+	r := NewObjectReader(store, "")
+	r.CloseOnFinish = true
+	if _, err := processAll(r, nil); err != nil {
+		t.Fatal(err)
+	}
+	state, err := r.Checkpoint()
+	if err != nil || string(state) != `["a","b"]` {
+		t.Errorf("Checkpoint = %s, %v", state, err)
+	}
+	if store.closed != 1 {
+		t.Errorf("store closed %d times", store.closed)
+	}
+
+	// Nothing is read or deleted once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = NewObjectReader(store, "")
+	r.DeleteObjects = true
+	outputChan, killChan := make(chan etldata.Payload, 10), make(chan error, 1)
+	r.ProcessDataContext(ctx, nil, outputChan, killChan)
+	if len(outputChan) != 0 || len(killChan) != 0 {
+		t.Errorf("sent %d payloads and %d errors", len(outputChan), len(killChan))
+	}
+	if objects, _ := store.List(""); len(objects) != 2 {
+		t.Errorf("%d objects left", len(objects))
+	}
+	if err := r.Restore([]byte("a")); err == nil {
+		t.Error("no error restoring an invalid checkpoint")
+	}
+}
+
+func TestObjectWriter(t *testing.T) {
+	orders := etldata.Metadata{"table": "orders.json"}
+	input := []etldata.Payload{
+		etldata.JSON(`{"id":1}`),
+		etldata.WithMetadata(etldata.JSON(`{"order":1}`), orders),
+		etldata.JSON(`{"id":2}`),
+		etldata.WithMetadata(etldata.JSON(`{"order":2}`), orders),
+	}
+	tests := []struct {
+		name    string
+		setup   func(w *ObjectWriter)
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "one object",
+			want: map[string]string{"out/all.json": "{\"id\":1}\n{\"order\":1}\n{\"id\":2}\n{\"order\":2}"},
+		},
+		{
+			name: "objects per key",
+			setup: func(w *ObjectWriter) {
+				w.KeyMetadata = "table"
+				w.LineSeparator = ","
+			},
+			want: map[string]string{"out/all.json": `{"id":1},{"id":2}`, "orders.json": `{"order":1},{"order":2}`},
+		},
+		{
+			name: "compressed",
+			setup: func(w *ObjectWriter) {
+				w.Key = "out/all.json.GZ"
+				w.KeyMetadata = "table"
+				w.Compression = etlutil.CodecGzip
+				w.CompressionLevel = 9
+			},
+			want: map[string]string{"out/all.json.GZ": "{\"id\":1}\n{\"id\":2}", "orders.json.gz": "{\"order\":1}\n{\"order\":2}"},
+		},
+		{
+			name:    "codec that cannot be written",
+			setup:   func(w *ObjectWriter) { w.Compression = etlutil.CodecBzip2 },
+			wantErr: "ObjectWriter: bzip2 cannot be written",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &closingStore{MemoryObjectStore: etlutil.NewMemoryObjectStore()}
+			w := NewObjectWriter(store, "out/all.json")
+			w.CloseOnFinish = true
+			if tt.setup != nil {
+				tt.setup(w)
+			}
+			_, err := processAll(w, input...)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if store.closed != 1 {
+				t.Errorf("store closed %d times", store.closed)
+			}
+			got := make(map[string]string)
+			objects, _ := store.List("")
+			for _, o := range objects {
+				data, _ := store.Get(o.Key)
+				err := etlutil.ForEachStream(bytes.NewReader(data), w.Compression, "", func(_ string, r io.Reader) error {
+					data, err = ioutil.ReadAll(r)
+					return err
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[o.Key] = string(data)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("objects = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectWriterAbort(t *testing.T) {
+	store := &closingStore{MemoryObjectStore: etlutil.NewMemoryObjectStore()}
+	w := NewObjectWriter(store, "a")
+	w.KeyMetadata = "table"
+	w.CloseOnFinish = true
+	outputChan, killChan := make(chan etldata.Payload, 10), make(chan error, 1)
+	w.ProcessData(etldata.JSON("a"), outputChan, killChan)
+	w.ProcessData(etldata.WithMetadata(etldata.JSON("b"), etldata.Metadata{"table": "b"}), outputChan, killChan)
+	w.Abort(errors.New("failed"))
+	var keys []string
+	objects, _ := store.List("")
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+	if len(keys) != 0 || store.closed != 1 {
+		t.Errorf("objects %v left, store closed %d times", keys, store.closed)
+	}
+}
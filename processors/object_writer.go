@@ -0,0 +1,152 @@
+package processors
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+	"github.com/teambenny/goetl/logger"
+)
+
+// ObjectWriter writes the data it receives to the object named Key in an
+// etlutil.ObjectStore, as it arrives, with LineSeparator between payloads.
+// It writes to a directory, S3 or SFTP alike, depending on the store it is
+// given. The object is only complete once Finish has been called.
+//
+// As with S3Writer, the data can be split over several objects by setting
+// KeyMetadata, and compressed by setting Compression (and CompressionLevel),
+// in which case the codec's extension, such as ".gz", is appended to keys
+// that do not already end with it.
+// Set CloseOnFinish to close the store, if it is an io.Closer (such as
+// etlutil.SftpObjectStore), in Finish.
+type ObjectWriter struct {
+	Store            etlutil.ObjectStore
+	Key              string
+	KeyMetadata      string
+	LineSeparator    string
+	Compression      string
+	CompressionLevel int
+	CloseOnFinish    bool
+
+	objects map[string]*openObject
+	keys    []string // the keys in objects, in the order they were first seen
+}
+
+// openObject is an object being written.
+type openObject struct {
+	file       io.WriteCloser
+	compressor io.WriteCloser
+	written    bool
+}
+
+// NewObjectWriter returns a new ObjectWriter writing to the given key of
+// store.
+func NewObjectWriter(store etlutil.ObjectStore, key string) *ObjectWriter {
+	return &ObjectWriter{Store: store, Key: key, LineSeparator: "\n"}
+}
+
+// ProcessData writes the data to its object, creating it if need be.
+func (w *ObjectWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	key := w.Key
+	if w.KeyMetadata != "" {
+		if k := etldata.MetadataOf(d)[w.KeyMetadata]; k != "" {
+			key = k
+		}
+	}
+	o, err := w.object(key)
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	writer, err := compressedWriter(&o.compressor, o.file, w.Compression, w.CompressionLevel)
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if o.written && w.LineSeparator != "" {
+		if _, err := io.WriteString(writer, w.LineSeparator); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	o.written = true
+	bytesWritten, err := writer.Write(d.Bytes())
+	etlutil.KillPipelineIfErr(err, killChan)
+	logger.Debug("ObjectWriter:", bytesWritten, "bytes written to", key)
+}
+
+// Finish completes all of the objects, and optionally closes the store.
+func (w *ObjectWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	for _, key := range w.keys {
+		o := w.objects[key]
+		err := closeCompressor(&o.compressor)
+		if cerr := o.file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	w.objects, w.keys = nil, nil
+	if w.CloseOnFinish {
+		etlutil.KillPipelineIfErr(closeStore(w.Store), killChan)
+	}
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that KeyMetadata
+// can name the object of each payload.
+func (w *ObjectWriter) ReadsMetadata() bool {
+	return true
+}
+
+// Abort abandons the objects being written when the pipeline fails before
+// Finish is called, where the store allows it (S3 and memory stores do not
+// create them), and closes the store if CloseOnFinish is set. See
+// AbortableProcessor.
+func (w *ObjectWriter) Abort(err error) {
+	for _, key := range w.keys {
+		if a, ok := w.objects[key].file.(interface{ CloseWithError(error) error }); ok {
+			a.CloseWithError(err)
+		} else {
+			w.objects[key].file.Close()
+		}
+	}
+	w.objects, w.keys = nil, nil
+	if w.CloseOnFinish {
+		closeStore(w.Store)
+	}
+}
+
+func (w *ObjectWriter) String() string {
+	return "ObjectWriter"
+}
+
+// object returns the object being written to the given key, creating it
+// the first time.
+func (w *ObjectWriter) object(key string) (*openObject, error) {
+	if o, ok := w.objects[key]; ok {
+		return o, nil
+	}
+	name := key
+	if c, err := etlutil.LookupCodec(w.Compression); err != nil {
+		return nil, err
+	} else if c != nil && c.NewWriter == nil {
+		return nil, fmt.Errorf("ObjectWriter: %v cannot be written", c.Name)
+	} else if c != nil && !strings.HasSuffix(strings.ToLower(key), c.Extension) {
+		name += c.Extension
+	}
+	file, err := w.Store.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if w.objects == nil {
+		w.objects = make(map[string]*openObject)
+	}
+	o := &openObject{file: file}
+	w.objects[key] = o
+	w.keys = append(w.keys, key)
+	return o, nil
+}
@@ -0,0 +1,139 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// ParquetReader decodes the Parquet files it receives, and sends their
+// records on as JSON arrays, one row group at a time (split into batches
+// of BatchSize records). It is meant to follow a reader sending the raw
+// contents of files, such as FileReader, or an IoReader, SftpReader or
+// S3Reader with LineByLine set to false. The payloads from each source
+// (told apart by their etldata.Metadata) are joined back together, and
+// since the metadata of a Parquet file is at its end, each file is held in
+// memory and decoded once all of the data has been received.
+//
+// Only flat schemas are supported (see etlutil.ParquetReader). Dates and
+// timestamps are sent as etldata.SQLTime, or as time.Time if TypedRecords
+// is set.
+type ParquetReader struct {
+	BatchSize    int  // defaults to 1000, and each row group is sent as one batch if 0
+	TypedRecords bool // send etldata.Records instead of etldata.JSON, see SQLReader.TypedRecords
+
+	sources map[string]*parquetSource
+	order   []string // sources in the order they were first seen
+}
+
+// parquetSource holds what has been received from a single source.
+type parquetSource struct {
+	data []byte
+	md   etldata.Metadata
+}
+
+// NewParquetReader returns a new ParquetReader.
+func NewParquetReader() *ParquetReader {
+	return &ParquetReader{BatchSize: 1000}
+}
+
+// ProcessData holds on to the data until the whole file has been received.
+func (r *ParquetReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	md := etldata.MetadataOf(d)
+	key := sourceKey(md)
+	if r.sources == nil {
+		r.sources = make(map[string]*parquetSource)
+	}
+	src, ok := r.sources[key]
+	if !ok {
+		src = &parquetSource{}
+		r.sources[key] = src
+		r.order = append(r.order, key)
+	}
+	if md != nil {
+		src.md = md.Clone()
+		delete(src.md, etldata.MetadataLine)
+		delete(src.md, etldata.MetadataLineByLine)
+	}
+	src.data = append(src.data, d.Bytes()...)
+}
+
+// Finish decodes each file, and sends its records.
+func (r *ParquetReader) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	for _, key := range r.order {
+		if err := r.read(r.sources[key], outputChan); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		delete(r.sources, key)
+	}
+	r.sources, r.order = nil, nil
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that the data of
+// each file is decoded on its own.
+func (r *ParquetReader) ReadsMetadata() bool {
+	return true
+}
+
+func (r *ParquetReader) String() string {
+	return "ParquetReader"
+}
+
+func (r *ParquetReader) read(src *parquetSource, outputChan chan etldata.Payload) error {
+	pr, err := etlutil.NewParquetReader(bytes.NewReader(src.data), int64(len(src.data)))
+	if err != nil {
+		return fmt.Errorf("ParquetReader: %v", err)
+	}
+	for i := 0; i < pr.NumRowGroups(); i++ {
+		rows, err := pr.ReadRowGroup(i)
+		if err != nil {
+			return fmt.Errorf("ParquetReader: %v", err)
+		}
+		if !r.TypedRecords {
+			for _, row := range rows {
+				for k, v := range row {
+					if t, ok := v.(time.Time); ok {
+						row[k] = etldata.SQLTime{Time: t}
+					}
+				}
+			}
+		}
+		size := r.BatchSize
+		if size <= 0 {
+			size = len(rows)
+		}
+		for len(rows) > 0 {
+			n := size
+			if n > len(rows) {
+				n = len(rows)
+			}
+			if err := r.send(rows[:n], src.md, outputChan); err != nil {
+				return err
+			}
+			rows = rows[n:]
+		}
+	}
+	return nil
+}
+
+func (r *ParquetReader) send(rows []map[string]interface{}, md etldata.Metadata, outputChan chan etldata.Payload) error {
+	var d etldata.Payload
+	if r.TypedRecords {
+		d = etldata.NewRecords(rows)
+	} else {
+		js, err := etldata.NewJSON(rows)
+		if err != nil {
+			return err
+		}
+		d = js
+	}
+	if md != nil {
+		d = etldata.WithMetadata(d, md)
+	}
+	outputChan <- d
+	return nil
+}
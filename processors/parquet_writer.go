@@ -0,0 +1,95 @@
+package processors
+
+import (
+	"io"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// ParquetWriter writes the objects it receives (see Payload.Objects) to an
+// io.Writer as a Parquet file, such as a local file or an
+// etlutil.S3ObjectWriter. Records are written in row groups of
+// RowGroupSize, and the file is completed in Finish.
+//
+// The columns are the fields of Schema (see etlutil.ParquetWriter for how
+// they are mapped to Parquet types). If Schema is nil, it is inferred
+// from the records of the first row group with etldata.InferSchema, with
+// every field made nullable.
+type ParquetWriter struct {
+	Writer       io.Writer
+	Schema       *etldata.Schema
+	Compression  etlutil.ParquetCompression // defaults to etlutil.ParquetSnappy
+	RowGroupSize int                        // defaults to 10000
+
+	writer *etlutil.ParquetWriter
+	rows   []map[string]interface{}
+}
+
+// NewParquetWriter returns a new ParquetWriter wrapping the given io.Writer
+// object.
+func NewParquetWriter(w io.Writer) *ParquetWriter {
+	return &ParquetWriter{Writer: w, Compression: etlutil.ParquetSnappy, RowGroupSize: 10000}
+}
+
+// ProcessData adds the objects to the current row group, writing it once
+// it is full.
+func (w *ParquetWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	objects, err := d.Objects()
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	w.rows = append(w.rows, objects...)
+	if len(w.rows) >= w.RowGroupSize {
+		etlutil.KillPipelineIfErr(w.flush(), killChan)
+	}
+}
+
+// Finish writes the last row group and the footer of the file.
+func (w *ParquetWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	if err := w.flush(); err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if w.writer != nil {
+		etlutil.KillPipelineIfErr(w.writer.Close(), killChan)
+	}
+}
+
+func (w *ParquetWriter) flush() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	if w.writer == nil {
+		pw, err := newParquetFileWriter(w.Writer, w.Schema, w.rows)
+		if err != nil {
+			return err
+		}
+		pw.Compression = w.Compression
+		w.writer = pw
+	}
+	err := w.writer.WriteRowGroup(w.rows)
+	w.rows = nil
+	return err
+}
+
+func (w *ParquetWriter) String() string {
+	return "ParquetWriter"
+}
+
+// newParquetFileWriter returns an etlutil.ParquetWriter for the Schema, or
+// for one inferred from the sample records if it is nil.
+func newParquetFileWriter(out io.Writer, schema *etldata.Schema, sample []map[string]interface{}) (*etlutil.ParquetWriter, error) {
+	if schema == nil {
+		inferred, err := etldata.InferSchema(etldata.NewRecords(sample))
+		if err != nil {
+			return nil, err
+		}
+		for i := range inferred.Fields {
+			inferred.Fields[i].Nullable = true
+		}
+		schema = inferred
+	}
+	return etlutil.NewParquetWriter(out, schema)
+}
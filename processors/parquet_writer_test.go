@@ -0,0 +1,106 @@
+package processors
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+func TestParquetWriterAndReader(t *testing.T) {
+	input := []etldata.Payload{
+		etldata.JSON(`[{"id":1,"name":"a","at":"2024-01-02 03:04:05"},{"id":2,"name":null}]`),
+		etldata.NewRecords([]map[string]interface{}{{"id": int64(3), "name": "c", "at": "2024-01-03 00:00:00"}}),
+	}
+	tests := []struct {
+		name         string
+		schema       *etldata.Schema
+		rowGroupSize int
+		batchSize    int
+		typedRecords bool
+		want         []string
+	}{
+		{
+			name:         "inferred schema",
+			rowGroupSize: 10000,
+			batchSize:    1000,
+			want:         []string{`[{"at":"2024-01-02 03:04:05","id":1,"name":"a"},{"at":null,"id":2,"name":null},{"at":"2024-01-03 00:00:00","id":3,"name":"c"}]`},
+		},
+		{
+			name: "schema",
+			schema: etldata.NewSchema(
+				etldata.Field{Name: "id", Type: etldata.FieldInteger},
+				etldata.Field{Name: "at", Type: etldata.FieldTimestamp, Format: "2006-01-02 15:04:05", Nullable: true},
+			),
+			rowGroupSize: 2,
+			batchSize:    1000,
+			want:         []string{`[{"at":"2024-01-02 03:04:05","id":1},{"at":null,"id":2}]`, `[{"at":"2024-01-03 00:00:00","id":3}]`},
+		},
+		{
+			name:         "batches",
+			schema:       etldata.NewSchema(etldata.Field{Name: "id", Type: etldata.FieldInteger}),
+			rowGroupSize: 10000,
+			batchSize:    2,
+			want:         []string{`[{"id":1},{"id":2}]`, `[{"id":3}]`},
+		},
+		{
+			name:         "row groups as batches",
+			schema:       etldata.NewSchema(etldata.Field{Name: "id", Type: etldata.FieldInteger}),
+			rowGroupSize: 2,
+			want:         []string{`[{"id":1},{"id":2}]`, `[{"id":3}]`},
+		},
+		{
+			name:         "typed records",
+			schema:       etldata.NewSchema(etldata.Field{Name: "at", Type: etldata.FieldTimestamp, Nullable: true}),
+			rowGroupSize: 10000,
+			batchSize:    1000,
+			typedRecords: true,
+			want:         []string{`[{"at":"2024-01-02T03:04:05Z"},{"at":null},{"at":"2024-01-03T00:00:00Z"}]`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewParquetWriter(&buf)
+			w.Schema = tt.schema
+			w.RowGroupSize = tt.rowGroupSize
+			w.Compression = etlutil.ParquetGzip
+			if _, err := processAll(w, input...); err != nil {
+				t.Fatal(err)
+			}
+
+			// The file arrives in two pieces, as from an IoReader.
+			md := etldata.Metadata{etldata.MetadataFileName: "data.parquet"}
+			data := buf.Bytes()
+			r := NewParquetReader()
+			r.BatchSize = tt.batchSize
+			r.TypedRecords = tt.typedRecords
+			sent, err := processAll(r, etldata.WithMetadata(etldata.JSON(data[:10]), md), etldata.WithMetadata(etldata.JSON(data[10:]), md))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range sent {
+				got = append(got, string(d.Bytes()))
+				if _, ok := d.(*etldata.Records); ok != tt.typedRecords {
+					t.Errorf("sent a %T", d)
+				}
+				if etldata.MetadataOf(d)[etldata.MetadataFileName] != "data.parquet" {
+					t.Errorf("metadata = %v", etldata.MetadataOf(d))
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParquetReaderNotParquet(t *testing.T) {
+	_, err := processAll(NewParquetReader(), etldata.JSON("id\n1\n"))
+	if err == nil || err.Error() != "ParquetReader: "+etlutil.ErrParquetFile.Error() {
+		t.Errorf("error = %v", err)
+	}
+}
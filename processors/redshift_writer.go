@@ -1,12 +1,17 @@
 package processors
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/teambenny/goetl/etldata"
 	"github.com/teambenny/goetl/etlutil"
+	"github.com/teambenny/goetl/logger"
 )
 
 type redshiftManifest struct {
@@ -14,8 +19,14 @@ type redshiftManifest struct {
 }
 
 type redshiftManifestEntry struct {
-	URL       string `json:"url"`
-	Mandatory bool   `json:"mandatory"`
+	URL       string                `json:"url"`
+	Mandatory bool                  `json:"mandatory"`
+	Meta      *redshiftManifestMeta `json:"meta,omitempty"`
+}
+
+// redshiftManifestMeta is required in manifests of Parquet files.
+type redshiftManifestMeta struct {
+	ContentLength int64 `json:"content_length"`
 }
 
 // RedshiftWriter gets data into a Redshift table by first uploading data batches to S3.
@@ -25,18 +36,42 @@ type redshiftManifestEntry struct {
 // This processor is not set up to do any fancy merging; rather, it writes every row received
 // to the table defined. An ideal use case is writing data to a temporary table that is later
 // merged into your production dataset.
+//
+// Batches are staged as gzipped JSON by default. Set Compression to "zstd" to
+// stage them with zstd instead (the only other codec both etlutil can write and
+// COPY can load), or Compress to false to stage them uncompressed. Set Parquet
+// to stage them as Parquet files instead (compressed with snappy, so Compress
+// and Compression are ignored).
+// Redshift loads Parquet columns by position, so the fields of Schema must be
+// in the order of the table's columns. If Schema is nil, it is inferred from
+// the first batch, with the fields sorted by name.
+//
+// RedshiftWriter implements goetl.Checkpointer, so a failed run can be
+// resumed without uploading or loading any row twice. The checkpoint holds
+// the files already uploaded and the number of rows in them, and a resumed
+// RedshiftWriter skips that many of the first rows it receives. The rows must
+// therefore be sent in the same order on every run, such as by a SQLReader
+// with an ORDER BY (and no ConcurrencyLevel).
 type RedshiftWriter struct {
-	bucket          string
-	config          *aws.Config
-	tx              *sql.Tx
-	prefix          string
-	tableName       string
-	manifestEntries []redshiftManifestEntry
-	data            []string
-	BatchSize       int
-	Compress        bool
-	manifestPath    string
-	S3IamRole       string
+	bucket           string
+	config           *aws.Config
+	tx               *sql.Tx
+	prefix           string
+	tableName        string
+	manifestEntries  []redshiftManifestEntry
+	manifestMutex    sync.Mutex
+	stagedRows       int // rows in the files of manifestEntries
+	skipRows         int // rows staged before the checkpoint, still to be skipped
+	data             []string
+	rows             []map[string]interface{} // the batch, when staging Parquet
+	BatchSize        int
+	Compress         bool
+	Compression      string // overrides Compress, see S3Writer
+	CompressionLevel int
+	manifestPath     string
+	S3IamRole        string
+	Parquet          bool
+	Schema           *etldata.Schema
 
 	// If the file name should be a fixed width, specify that here.
 	// Files uploaded to S3 will be zero-padded to this width.
@@ -65,7 +100,17 @@ func NewRedshiftWriter(tx *sql.Tx, config *aws.Config, tableName, bucket, prefix
 func (r *RedshiftWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
 	objects, err := d.Objects()
 	etlutil.KillPipelineIfErr(err, killChan)
+	objects = r.skipStaged(objects)
 
+	if r.Parquet {
+		for _, obj := range objects {
+			r.rows = append(r.rows, obj)
+			if r.BatchSize > 0 && len(r.rows) >= r.BatchSize {
+				r.flushFiles(killChan)
+			}
+		}
+		return
+	}
 	for _, obj := range objects {
 		dd, err := etldata.NewJSON(obj)
 		etlutil.KillPipelineIfErr(err, killChan)
@@ -88,26 +133,140 @@ func (r *RedshiftWriter) Finish(outputChan chan etldata.Payload, killChan chan e
 
 func (r *RedshiftWriter) flushFiles(killChan chan error) {
 	formatString := fmt.Sprintf("%%0%vv", r.FileNameWidth)
-	fileSuffix := fmt.Sprintf(formatString, len(r.manifestEntries))
+	fileSuffix := fmt.Sprintf(formatString, len(r.entries()))
 	fileName := fmt.Sprintf("%vfile.%v", r.prefix, fileSuffix)
-	_, err := etlutil.WriteS3Object(r.data, r.config, r.bucket, fileName, "\n", r.Compress)
-	etlutil.KillPipelineIfErr(err, killChan)
-
-	if r.Compress {
-		fileName += ".gz"
+	if r.Parquet {
+		r.flushParquet(fileName+".parquet", killChan)
+		return
+	}
+	codec := r.codec()
+	if codec != "" && codec != etlutil.CodecGzip && codec != etlutil.CodecZstd {
+		etlutil.KillPipelineIfErr(fmt.Errorf("RedshiftWriter: cannot stage files with %v, only gzip or zstd", codec), killChan)
+		return
 	}
+	_, err := etlutil.WriteCompressedS3Object(r.data, r.config, r.bucket, fileName, "\n", codec, r.CompressionLevel)
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	fileName = etlutil.CompressedName(fileName, codec)
 
 	entry := redshiftManifestEntry{
 		URL:       fmt.Sprintf("s3://%v/%v", r.bucket, fileName),
 		Mandatory: true,
 	}
+	r.addEntry(entry, len(r.data))
+	r.data = nil
+}
+
+// flushParquet uploads the batch as a Parquet file.
+func (r *RedshiftWriter) flushParquet(fileName string, killChan chan error) {
+	if len(r.rows) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	pw, err := newParquetFileWriter(&buf, r.Schema, r.rows)
+	if err == nil {
+		err = pw.WriteRowGroup(r.rows)
+	}
+	if err == nil {
+		err = pw.Close()
+	}
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if r.Schema == nil {
+		// Every file must have the same columns.
+		r.Schema = pw.Schema()
+	}
+
+	size := int64(buf.Len())
+	_, err = etlutil.UploadS3Object(&buf, r.config, r.bucket, fileName)
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	r.addEntry(redshiftManifestEntry{
+		URL:       fmt.Sprintf("s3://%v/%v", r.bucket, fileName),
+		Mandatory: true,
+		Meta:      &redshiftManifestMeta{ContentLength: size},
+	}, len(r.rows))
+	r.rows = nil
+}
+
+func (r *RedshiftWriter) addEntry(entry redshiftManifestEntry, rows int) {
+	r.manifestMutex.Lock()
 	r.manifestEntries = append(r.manifestEntries, entry)
+	r.stagedRows += rows
+	r.manifestMutex.Unlock()
+}
 
-	r.data = nil
+// skipStaged drops the rows that were already staged before the
+// checkpoint the RedshiftWriter was restored from.
+func (r *RedshiftWriter) skipStaged(objects []map[string]interface{}) []map[string]interface{} {
+	if r.skipRows == 0 {
+		return objects
+	}
+	n := r.skipRows
+	if n > len(objects) {
+		n = len(objects)
+	}
+	r.skipRows -= n
+	return objects[n:]
+}
+
+// redshiftCheckpoint is the state saved by RedshiftWriter.Checkpoint.
+type redshiftCheckpoint struct {
+	Entries []redshiftManifestEntry `json:"entries"`
+	Rows    int                     `json:"rows"`
+}
+
+// Checkpoint saves the manifest entries for the files already uploaded
+// to S3, and the number of rows in them. Records that have not been flushed
+// to a file yet are not included. It implements goetl.Checkpointer.
+func (r *RedshiftWriter) Checkpoint() ([]byte, error) {
+	r.manifestMutex.Lock()
+	defer r.manifestMutex.Unlock()
+	return json.Marshal(redshiftCheckpoint{Entries: r.manifestEntries, Rows: r.stagedRows})
+}
+
+// Restore picks up the manifest entries saved by Checkpoint, so that the
+// files uploaded before are included in the COPY, and new files are
+// numbered after them. The rows in those files are skipped when they are
+// received again. It implements goetl.Checkpointer.
+func (r *RedshiftWriter) Restore(state []byte) error {
+	var checkpoint redshiftCheckpoint
+	if err := json.Unmarshal(state, &checkpoint); err != nil {
+		return err
+	}
+	r.manifestMutex.Lock()
+	defer r.manifestMutex.Unlock()
+	r.manifestEntries = checkpoint.Entries
+	r.stagedRows = checkpoint.Rows
+	r.skipRows = checkpoint.Rows
+	return nil
+}
+
+// Abort rolls back the transaction the RedshiftWriter was given, so that
+// nothing is loaded by a failed run. It implements goetl.AbortableProcessor.
+func (r *RedshiftWriter) Abort(err error) {
+	if r.tx == nil {
+		return
+	}
+	if rerr := r.tx.Rollback(); rerr != nil && rerr != sql.ErrTxDone {
+		logger.Error("RedshiftWriter: rolling back:", rerr)
+	}
+}
+
+func (r *RedshiftWriter) entries() []redshiftManifestEntry {
+	r.manifestMutex.Lock()
+	defer r.manifestMutex.Unlock()
+	return append([]redshiftManifestEntry(nil), r.manifestEntries...)
 }
 
 func (r *RedshiftWriter) createManifest(killChan chan error) {
-	manifest := redshiftManifest{Entries: r.manifestEntries}
+	manifest := redshiftManifest{Entries: r.entries()}
 	manifestData, err := etldata.NewJSON(manifest)
 	etlutil.KillPipelineIfErr(err, killChan)
 
@@ -122,10 +281,28 @@ func (r *RedshiftWriter) copyToRedshift(killChan chan error) {
 	etlutil.KillPipelineIfErr(err, killChan)
 }
 
+// codec returns the name of the codec batches are staged with, if any.
+func (r *RedshiftWriter) codec() string {
+	if r.Compression != "" {
+		if r.Compression == "none" {
+			return ""
+		}
+		return strings.ToLower(r.Compression)
+	}
+	if r.Compress {
+		return etlutil.CodecGzip
+	}
+	return ""
+}
+
 func (r *RedshiftWriter) copyQuery() string {
 	compression := ""
-	if r.Compress {
-		compression = "GZIP"
+	if !r.Parquet {
+		compression = strings.ToUpper(r.codec())
+	}
+	format := "JSON 'auto'"
+	if r.Parquet {
+		format = "FORMAT AS PARQUET"
 	}
 
 	var credentials string
@@ -149,11 +326,11 @@ func (r *RedshiftWriter) copyQuery() string {
                 REGION '%v'
                 %v
                 MANIFEST
-				JSON 'auto'
+				%v
 				COMPUPDATE OFF
 				STATUPDATE OFF
                 %v
-        `, r.tableName, r.bucket, r.manifestPath, *r.config.Region, credentials, compression)
+        `, r.tableName, r.bucket, r.manifestPath, *r.config.Region, credentials, format, compression)
 
 	return query
 }
@@ -0,0 +1,66 @@
+package processors
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.LogLevel = logger.LevelSilent
+	os.Exit(m.Run())
+}
+
+func TestRedshiftWriterRestore(t *testing.T) {
+	state := `{"entries":[{"url":"s3://bucket/prefix/0000000001","mandatory":true}],"rows":3}`
+	tests := []struct {
+		name     string
+		payloads []string
+		want     []string
+	}{
+		{
+			name:     "skipped within a payload",
+			payloads: []string{`[{"a":1},{"a":2},{"a":3},{"a":4}]`},
+			want:     []string{`{"a":4}`},
+		},
+		{
+			name:     "skipped across payloads",
+			payloads: []string{`[{"a":1},{"a":2}]`, `{"a":3}`, `[{"a":4},{"a":5}]`},
+			want:     []string{`{"a":4}`, `{"a":5}`},
+		},
+		{
+			name:     "fewer rows than staged",
+			payloads: []string{`{"a":1}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewRedshiftWriter(nil, nil, "table", "bucket", "prefix")
+			w.BatchSize = 0
+			if err := w.Restore([]byte(state)); err != nil {
+				t.Fatal(err)
+			}
+			killChan := make(chan error, 1)
+			for _, p := range tt.payloads {
+				w.ProcessData(etldata.JSON(p), nil, killChan)
+			}
+			if len(killChan) > 0 {
+				t.Fatal(<-killChan)
+			}
+			if !reflect.DeepEqual(w.data, tt.want) {
+				t.Errorf("data = %v, want %v", w.data, tt.want)
+			}
+			// Rows that have not been staged yet are not part of the state.
+			checkpoint, err := w.Checkpoint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(checkpoint) != state {
+				t.Errorf("Checkpoint = %s, want %s", checkpoint, state)
+			}
+		})
+	}
+}
@@ -0,0 +1,1331 @@
+package processors
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+	"github.com/teambenny/goetl/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// The built-in processors are registered for use in pipeline configs
+// (see goetl.PipelineConfig) under their type names. Each factory decodes
+// the parameters documented on its config struct below.
+func init() {
+	goetl.RegisterProcessor("Passthrough", newPassthroughFromConfig)
+	goetl.RegisterProcessor("RegexpMatcher", newRegexpMatcherFromConfig)
+	goetl.RegisterProcessor("CSVTransformer", newCSVTransformerFromConfig)
+	goetl.RegisterProcessor("CSVReader", newCSVReaderFromConfig)
+	goetl.RegisterProcessor("FileReader", newFileReaderFromConfig)
+	goetl.RegisterProcessor("IoReader", newIoReaderFromConfig)
+	goetl.RegisterProcessor("JSONStreamReader", newJSONStreamReaderFromConfig)
+	goetl.RegisterProcessor("XMLReader", newXMLReaderFromConfig)
+	goetl.RegisterProcessor("ParquetReader", newParquetReaderFromConfig)
+	goetl.RegisterProcessor("AvroReader", newAvroReaderFromConfig)
+	goetl.RegisterProcessor("XLSXReader", newXLSXReaderFromConfig)
+	goetl.RegisterProcessor("FixedWidthReader", newFixedWidthReaderFromConfig)
+	goetl.RegisterProcessor("FixedWidthTransformer", newFixedWidthTransformerFromConfig)
+	goetl.RegisterProcessor("IoWriter", newIoWriterFromConfig)
+	goetl.RegisterProcessor("CSVWriter", newCSVWriterFromConfig)
+	goetl.RegisterProcessor("ParquetWriter", newParquetWriterFromConfig)
+	goetl.RegisterProcessor("AvroWriter", newAvroWriterFromConfig)
+	goetl.RegisterProcessor("XLSXWriter", newXLSXWriterFromConfig)
+	goetl.RegisterProcessor("FixedWidthWriter", newFixedWidthWriterFromConfig)
+	goetl.RegisterProcessor("XMLWriter", newXMLWriterFromConfig)
+	goetl.RegisterProcessor("SQLReader", newSQLReaderFromConfig)
+	goetl.RegisterProcessor("SQLExecutor", newSQLExecutorFromConfig)
+	goetl.RegisterProcessor("MySQLWriter", newMySQLWriterFromConfig)
+	goetl.RegisterProcessor("PostgreSQLWriter", newPostgreSQLWriterFromConfig)
+	goetl.RegisterProcessor("S3Reader", newS3ReaderFromConfig)
+	goetl.RegisterProcessor("S3Writer", newS3WriterFromConfig)
+	goetl.RegisterProcessor("SftpReader", newSftpReaderFromConfig)
+	goetl.RegisterProcessor("SftpWriter", newSftpWriterFromConfig)
+	goetl.RegisterProcessor("FtpWriter", newFtpWriterFromConfig)
+	goetl.RegisterProcessor("ObjectReader", newObjectReaderFromConfig)
+	goetl.RegisterProcessor("ObjectWriter", newObjectWriterFromConfig)
+	goetl.RegisterProcessor("HTTPRequest", newHTTPRequestFromConfig)
+	goetl.RegisterProcessor("LogWriter", newLogWriterFromConfig)
+	goetl.RegisterProcessor("SchemaValidator", newSchemaValidatorFromConfig)
+}
+
+// sqlConfig opens a database connection. The driver must be registered
+// with database/sql by the program running the pipeline.
+type sqlConfig struct {
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+}
+
+func (c sqlConfig) open() (*sql.DB, error) {
+	if c.Driver == "" || c.DSN == "" {
+		return nil, errors.New("driver and dsn are required")
+	}
+	return sql.Open(c.Driver, c.DSN)
+}
+
+// awsConfig holds the S3 credentials and location.
+type awsConfig struct {
+	AwsID     string `json:"aws_id"`
+	AwsSecret string `json:"aws_secret"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+}
+
+// sftpConfig holds the SFTP server and credentials. Either a password or
+// a private key file can be used.
+type sftpConfig struct {
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	KeyFile  string `json:"key_file"`
+	Path     string `json:"path"`
+}
+
+func (c sftpConfig) authMethods() ([]ssh.AuthMethod, error) {
+	if c.Server == "" || c.Path == "" {
+		return nil, errors.New("server and path are required")
+	}
+	methods := []ssh.AuthMethod{}
+	if c.KeyFile != "" {
+		key, err := ioutil.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if c.Password != "" {
+		methods = append(methods, ssh.Password(c.Password))
+	}
+	return methods, nil
+}
+
+// objectStoreConfig picks an etlutil.ObjectStore: "local" (the default) for
+// the directory at path, "s3" for a bucket, or "sftp" for the directory at
+// path on a server. Only the options of the chosen type are used.
+type objectStoreConfig struct {
+	Type string `json:"type"`
+	awsConfig
+	sftpConfig
+}
+
+func (c objectStoreConfig) open() (etlutil.ObjectStore, error) {
+	switch c.Type {
+	case "", "local":
+		if c.Path == "" {
+			return nil, errors.New("path is required")
+		}
+		return etlutil.NewLocalObjectStore(c.Path), nil
+	case "s3":
+		if c.Bucket == "" {
+			return nil, errors.New("bucket is required")
+		}
+		creds := credentials.NewStaticCredentials(c.AwsID, c.AwsSecret, "")
+		conf := aws.NewConfig().WithRegion(c.Region).WithDisableSSL(true).WithCredentials(creds)
+		return etlutil.NewS3ObjectStore(conf, c.Bucket), nil
+	case "sftp":
+		auth, err := c.authMethods()
+		if err != nil {
+			return nil, err
+		}
+		return etlutil.NewSftpObjectStore(c.Server, c.Username, c.Path, auth...), nil
+	}
+	return nil, fmt.Errorf("unknown store type %q", c.Type)
+}
+
+// csvConfig holds the CSVParameters that can be configured.
+type csvConfig struct {
+	Header      []string `json:"header"`
+	WriteHeader *bool    `json:"write_header"`
+	Comma       string   `json:"comma"`
+	QuoteEscape string   `json:"quote_escape"`
+}
+
+func (c csvConfig) apply(params *etlutil.CSVParameters) error {
+	if c.Header != nil {
+		params.Header = c.Header
+	}
+	if c.WriteHeader != nil {
+		params.WriteHeader = *c.WriteHeader
+	}
+	if c.Comma != "" {
+		r := []rune(c.Comma)
+		if len(r) != 1 {
+			return fmt.Errorf("comma must be a single character, got %q", c.Comma)
+		}
+		params.Comma = r[0]
+	}
+	if c.QuoteEscape != "" {
+		params.Writer.QuoteEscape = c.QuoteEscape
+	}
+	return nil
+}
+
+func newPassthroughFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	if err := c.Decode(&struct{}{}); err != nil {
+		return nil, err
+	}
+	return NewPassthrough(), nil
+}
+
+func newRegexpMatcherFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Pattern  string `json:"pattern"`
+		DebugLog bool   `json:"debug_log"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if params.Pattern == "" {
+		return nil, errors.New("pattern is required")
+	}
+	m := NewRegexpMatcher(params.Pattern)
+	m.DebugLog = params.DebugLog
+	return m, nil
+}
+
+func newCSVTransformerFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params csvConfig
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	t := NewCSVTransformer()
+	return t, params.apply(&t.Parameters)
+}
+
+func newCSVReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Comma        string            `json:"comma"`
+		Quote        string            `json:"quote"`
+		QuoteEscape  string            `json:"quote_escape"`
+		Header       []string          `json:"header"`
+		Rename       map[string]string `json:"rename"`
+		InferTypes   bool              `json:"infer_types"`
+		BatchSize    *int              `json:"batch_size"`
+		TypedRecords bool              `json:"typed_records"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	r := NewCSVReader()
+	for _, opt := range []struct {
+		name  string
+		value string
+		dest  *rune
+	}{{"comma", params.Comma, &r.Parser.Comma}, {"quote", params.Quote, &r.Parser.Quote}} {
+		if opt.value == "" {
+			continue
+		}
+		chars := []rune(opt.value)
+		if len(chars) != 1 {
+			return nil, fmt.Errorf("%v must be a single character, got %q", opt.name, opt.value)
+		}
+		*opt.dest = chars[0]
+	}
+	if params.QuoteEscape != "" {
+		r.Parser.QuoteEscape = params.QuoteEscape
+	}
+	r.Header = params.Header
+	r.Rename = params.Rename
+	r.InferTypes = params.InferTypes
+	if params.BatchSize != nil {
+		r.BatchSize = *params.BatchSize
+	}
+	r.TypedRecords = params.TypedRecords
+	return r, nil
+}
+
+func newFileReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Filename    string `json:"filename"`
+		Compression string `json:"compression"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if params.Filename == "" {
+		return nil, errors.New("filename is required")
+	}
+	if err := checkCompression(params.Compression); err != nil {
+		return nil, err
+	}
+	r := NewFileReader(params.Filename)
+	r.Compression = params.Compression
+	return r, nil
+}
+
+func newIoReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	params := struct {
+		Path        string `json:"path"`
+		LineByLine  bool   `json:"line_by_line"`
+		LineNumbers bool   `json:"line_numbers"`
+		BufferSize  int    `json:"buffer_size"`
+		Gzipped     bool   `json:"gzipped"`
+		Compression string `json:"compression"`
+	}{LineByLine: true}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if err := checkCompression(params.Compression); err != nil {
+		return nil, err
+	}
+	f, err := openInput(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewIoReader(f)
+	if params.Path != "-" {
+		r.Metadata = etldata.Metadata{etldata.MetadataFileName: params.Path}
+	}
+	r.LineByLine = params.LineByLine
+	r.LineNumbers = params.LineNumbers
+	r.Gzipped = params.Gzipped
+	r.Compression = params.Compression
+	if params.BufferSize > 0 {
+		r.BufferSize = params.BufferSize
+	}
+	return closeOnFinish(r, f), nil
+}
+
+func newJSONStreamReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Path        string `json:"path"`
+		BatchSize   *int   `json:"batch_size"`
+		Gzipped     bool   `json:"gzipped"`
+		Compression string `json:"compression"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if err := checkCompression(params.Compression); err != nil {
+		return nil, err
+	}
+	f, err := openInput(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewJSONStreamReader(f)
+	if params.Path != "-" {
+		r.Metadata = etldata.Metadata{etldata.MetadataFileName: params.Path}
+	}
+	if params.BatchSize != nil {
+		r.BatchSize = *params.BatchSize
+	}
+	r.Gzipped = params.Gzipped
+	r.Compression = params.Compression
+	return closeOnFinish(r, f), nil
+}
+
+func newXMLReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Path            string   `json:"path"`
+		ElementPath     string   `json:"element_path"`
+		AttributePrefix *string  `json:"attribute_prefix"`
+		TextKey         string   `json:"text_key"`
+		Arrays          []string `json:"arrays"`
+		BatchSize       *int     `json:"batch_size"`
+		Gzipped         bool     `json:"gzipped"`
+		Compression     string   `json:"compression"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if params.ElementPath == "" {
+		return nil, errors.New("element_path is required")
+	}
+	if err := checkCompression(params.Compression); err != nil {
+		return nil, err
+	}
+	f, err := openInput(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewXMLReader(f, params.ElementPath)
+	if params.Path != "-" {
+		r.Metadata = etldata.Metadata{etldata.MetadataFileName: params.Path}
+	}
+	if params.AttributePrefix != nil {
+		r.AttributePrefix = *params.AttributePrefix
+	}
+	if params.TextKey != "" {
+		r.TextKey = params.TextKey
+	}
+	r.Arrays = params.Arrays
+	if params.BatchSize != nil {
+		r.BatchSize = *params.BatchSize
+	}
+	r.Gzipped = params.Gzipped
+	r.Compression = params.Compression
+	return closeOnFinish(r, f), nil
+}
+
+func newParquetReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		BatchSize    *int `json:"batch_size"`
+		TypedRecords bool `json:"typed_records"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	r := NewParquetReader()
+	if params.BatchSize != nil {
+		r.BatchSize = *params.BatchSize
+	}
+	r.TypedRecords = params.TypedRecords
+	return r, nil
+}
+
+func newAvroReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		BatchSize    *int `json:"batch_size"`
+		TypedRecords bool `json:"typed_records"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	r := NewAvroReader()
+	if params.BatchSize != nil {
+		r.BatchSize = *params.BatchSize
+	}
+	r.TypedRecords = params.TypedRecords
+	return r, nil
+}
+
+func newXLSXReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Sheet        string   `json:"sheet"`
+		Header       []string `json:"header"`
+		BatchSize    *int     `json:"batch_size"`
+		TypedRecords bool     `json:"typed_records"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	r := NewXLSXReader()
+	r.Sheet = params.Sheet
+	r.Header = params.Header
+	if params.BatchSize != nil {
+		r.BatchSize = *params.BatchSize
+	}
+	r.TypedRecords = params.TypedRecords
+	return r, nil
+}
+
+func newFixedWidthReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		fixedWidthConfig
+		Types         []string `json:"types"`
+		RecordTypeKey string   `json:"record_type_key"`
+		BatchSize     *int     `json:"batch_size"`
+		TypedRecords  bool     `json:"typed_records"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	layout, err := params.load()
+	if err != nil {
+		return nil, err
+	}
+	r := NewFixedWidthReader(layout)
+	r.Types = params.Types
+	if params.RecordTypeKey != "" {
+		r.RecordTypeKey = params.RecordTypeKey
+	}
+	if params.BatchSize != nil {
+		r.BatchSize = *params.BatchSize
+	}
+	r.TypedRecords = params.TypedRecords
+	return r, nil
+}
+
+func newFixedWidthTransformerFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		fixedWidthConfig
+		Types         []string `json:"types"`
+		RecordTypeKey string   `json:"record_type_key"`
+		TypedRecords  bool     `json:"typed_records"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	layout, err := params.load()
+	if err != nil {
+		return nil, err
+	}
+	t := NewFixedWidthTransformer(layout)
+	t.Types = params.Types
+	if params.RecordTypeKey != "" {
+		t.RecordTypeKey = params.RecordTypeKey
+	}
+	t.TypedRecords = params.TypedRecords
+	return t, nil
+}
+
+func newIoWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Path       string `json:"path"`
+		AddNewline bool   `json:"add_newline"`
+		compressionConfig
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	f, err := params.openOutput(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	w := NewIoWriter(f)
+	w.AddNewline = params.AddNewline
+	return closeOnFinish(w, f), nil
+}
+
+func newCSVWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Path string `json:"path"`
+		csvConfig
+		compressionConfig
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	f, err := params.openOutput(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	w := NewCSVWriter(f)
+	if err := params.apply(&w.Parameters); err != nil {
+		return nil, err
+	}
+	return closeOnFinish(w, f), nil
+}
+
+func newParquetWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Path         string `json:"path"`
+		Compression  string `json:"compression"`
+		RowGroupSize int    `json:"row_group_size"`
+		schemaConfig
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	schema, err := params.load()
+	if err != nil {
+		return nil, err
+	}
+	f, err := openOutput(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	w := NewParquetWriter(f)
+	w.Schema = schema
+	if params.Compression != "" {
+		if w.Compression, err = etlutil.ParseParquetCompression(params.Compression); err != nil {
+			return nil, err
+		}
+	}
+	if params.RowGroupSize > 0 {
+		w.RowGroupSize = params.RowGroupSize
+	}
+	return closeOnFinish(w, f), nil
+}
+
+// newAvroWriterFromConfig sends the file on when no path is given, to be
+// written by an IoWriter, SftpWriter or S3Writer.
+func newAvroWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Path           string          `json:"path"`
+		AvroSchema     json.RawMessage `json:"avro_schema"`
+		AvroSchemaFile string          `json:"avro_schema_file"`
+		Name           string          `json:"name"`
+		Codec          string          `json:"codec"`
+		BlockSize      int             `json:"block_size"`
+		schemaConfig
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	schema, err := params.load()
+	if err != nil {
+		return nil, err
+	}
+	if params.AvroSchemaFile != "" {
+		if len(params.AvroSchema) > 0 {
+			return nil, errors.New("only one of avro_schema or avro_schema_file can be given")
+		}
+		if params.AvroSchema, err = ioutil.ReadFile(params.AvroSchemaFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(params.AvroSchema) > 0 && schema != nil {
+		return nil, errors.New("only one of avro_schema or schema can be given")
+	}
+	w := NewAvroWriter(nil)
+	w.AvroSchema = string(params.AvroSchema)
+	w.Schema = schema
+	if params.Name != "" {
+		w.Name = params.Name
+	}
+	if params.Codec != "" {
+		if w.Codec, err = etlutil.ParseAvroCodec(params.Codec); err != nil {
+			return nil, err
+		}
+	}
+	if params.BlockSize > 0 {
+		w.BlockSize = params.BlockSize
+	}
+	if params.Path == "" {
+		return w, nil
+	}
+	f, err := openOutput(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	w.Writer = f
+	return closeOnFinish(w, f), nil
+}
+
+// newXLSXWriterFromConfig sends the workbook on when no path is given, to
+// be written by an IoWriter, SftpWriter or S3Writer.
+func newXLSXWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Path          string   `json:"path"`
+		Sheet         string   `json:"sheet"`
+		SheetMetadata string   `json:"sheet_metadata"`
+		Header        []string `json:"header"`
+		WriteHeader   *bool    `json:"write_header"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	w := NewXLSXWriter(nil)
+	if params.Sheet != "" {
+		w.Sheet = params.Sheet
+	}
+	w.SheetMetadata = params.SheetMetadata
+	w.Header = params.Header
+	if params.WriteHeader != nil {
+		w.WriteHeader = *params.WriteHeader
+	}
+	if params.Path == "" {
+		return w, nil
+	}
+	f, err := openOutput(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	w.Writer = f
+	return closeOnFinish(w, f), nil
+}
+
+func newFixedWidthWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Path string `json:"path"`
+		fixedWidthConfig
+		RecordTypeKey string  `json:"record_type_key"`
+		LineSeparator *string `json:"line_separator"`
+		compressionConfig
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	layout, err := params.load()
+	if err != nil {
+		return nil, err
+	}
+	w := NewFixedWidthWriter(nil, layout)
+	if params.RecordTypeKey != "" {
+		w.RecordTypeKey = params.RecordTypeKey
+	}
+	if params.LineSeparator != nil {
+		w.LineSeparator = *params.LineSeparator
+	}
+	if params.Path == "" {
+		return w, nil
+	}
+	f, err := params.openOutput(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	w.Writer = f
+	return closeOnFinish(w, f), nil
+}
+
+func newXMLWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Path            string  `json:"path"`
+		Root            string  `json:"root"`
+		Row             string  `json:"row"`
+		AttributePrefix *string `json:"attribute_prefix"`
+		TextKey         string  `json:"text_key"`
+		Indent          string  `json:"indent"`
+		compressionConfig
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	w := NewXMLWriter(nil)
+	if params.Root != "" {
+		w.Root = params.Root
+	}
+	if params.Row != "" {
+		w.Row = params.Row
+	}
+	if params.AttributePrefix != nil {
+		w.AttributePrefix = *params.AttributePrefix
+	}
+	if params.TextKey != "" {
+		w.TextKey = params.TextKey
+	}
+	w.Indent = params.Indent
+	if params.Path == "" {
+		return w, nil
+	}
+	f, err := params.openOutput(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	w.Writer = f
+	return closeOnFinish(w, f), nil
+}
+
+func newSQLReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		sqlConfig
+		Query            string `json:"query"`
+		BatchSize        int    `json:"batch_size"`
+		ConcurrencyLevel int    `json:"concurrency_level"`
+		TypedRecords     bool   `json:"typed_records"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if params.Query == "" {
+		return nil, errors.New("query is required")
+	}
+	db, err := params.open()
+	if err != nil {
+		return nil, err
+	}
+	r := NewSQLReader(db, params.Query)
+	if params.BatchSize > 0 {
+		r.BatchSize = params.BatchSize
+	}
+	r.ConcurrencyLevel = params.ConcurrencyLevel
+	r.TypedRecords = params.TypedRecords
+	return r, nil
+}
+
+func newSQLExecutorFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		sqlConfig
+		Query string `json:"query"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if params.Query == "" {
+		return nil, errors.New("query is required")
+	}
+	db, err := params.open()
+	if err != nil {
+		return nil, err
+	}
+	return NewSQLExecutor(db, params.Query), nil
+}
+
+// schemaConfig gives an etldata.Schema either inline, or as a JSON Schema
+// document in a file.
+type schemaConfig struct {
+	Schema     *etldata.Schema `json:"schema"`
+	SchemaFile string          `json:"schema_file"`
+}
+
+// load returns the configured Schema, or nil if there is none.
+func (c schemaConfig) load() (*etldata.Schema, error) {
+	switch {
+	case c.Schema != nil && c.SchemaFile != "":
+		return nil, errors.New("only one of schema or schema_file can be given")
+	case c.Schema != nil:
+		return c.Schema, c.Schema.Check()
+	case c.SchemaFile != "":
+		data, err := ioutil.ReadFile(c.SchemaFile)
+		if err != nil {
+			return nil, err
+		}
+		return etldata.SchemaFromJSONSchema(data)
+	}
+	return nil, nil
+}
+
+// fixedWidthConfig gives an etlutil.FixedWidthLayout either inline, or as
+// JSON in a file.
+type fixedWidthConfig struct {
+	Layout     *etlutil.FixedWidthLayout `json:"layout"`
+	LayoutFile string                    `json:"layout_file"`
+}
+
+// load returns the configured layout, which is required.
+func (c fixedWidthConfig) load() (*etlutil.FixedWidthLayout, error) {
+	switch {
+	case c.Layout != nil && c.LayoutFile != "":
+		return nil, errors.New("only one of layout or layout_file can be given")
+	case c.LayoutFile != "":
+		data, err := ioutil.ReadFile(c.LayoutFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Layout = &etlutil.FixedWidthLayout{}
+		if err := json.Unmarshal(data, c.Layout); err != nil {
+			return nil, fmt.Errorf("%v: %v", c.LayoutFile, err)
+		}
+	case c.Layout == nil:
+		return nil, errors.New("layout or layout_file is required")
+	}
+	return c.Layout, c.Layout.Check()
+}
+
+// sqlWriterConfig holds the options shared by MySQLWriter and PostgreSQLWriter.
+type sqlWriterConfig struct {
+	sqlConfig
+	Table            string   `json:"table"`
+	OnDupKeyUpdate   *bool    `json:"on_dup_key_update"`
+	OnDupKeyFields   []string `json:"on_dup_key_fields"`
+	ConcurrencyLevel int      `json:"concurrency_level"`
+	BatchSize        int      `json:"batch_size"`
+	Transaction      bool     `json:"transaction"`
+	schemaConfig
+}
+
+func (c sqlWriterConfig) open() (*sql.DB, error) {
+	if c.Table == "" {
+		return nil, errors.New("table is required")
+	}
+	return c.sqlConfig.open()
+}
+
+func newMySQLWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params sqlWriterConfig
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	db, err := params.open()
+	if err != nil {
+		return nil, err
+	}
+	schema, err := params.load()
+	if err != nil {
+		return nil, err
+	}
+	w := NewMySQLWriter(db, params.Table)
+	w.Schema = schema
+	if params.OnDupKeyUpdate != nil {
+		w.OnDupKeyUpdate = *params.OnDupKeyUpdate
+	}
+	w.OnDupKeyFields = params.OnDupKeyFields
+	w.ConcurrencyLevel = params.ConcurrencyLevel
+	w.BatchSize = params.BatchSize
+	w.Transaction = params.Transaction
+	return w, nil
+}
+
+func newPostgreSQLWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		sqlWriterConfig
+		OnDupKeyIndex string `json:"on_dup_key_index"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	db, err := params.open()
+	if err != nil {
+		return nil, err
+	}
+	schema, err := params.load()
+	if err != nil {
+		return nil, err
+	}
+	w := NewPostgreSQLWriter(db, params.Table)
+	w.Schema = schema
+	if params.OnDupKeyUpdate != nil {
+		w.OnDupKeyUpdate = *params.OnDupKeyUpdate
+	}
+	w.OnDupKeyIndex = params.OnDupKeyIndex
+	w.OnDupKeyFields = params.OnDupKeyFields
+	w.ConcurrencyLevel = params.ConcurrencyLevel
+	w.BatchSize = params.BatchSize
+	w.Transaction = params.Transaction
+	return w, nil
+}
+
+func newS3ReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		awsConfig
+		Object        string `json:"object"`
+		Prefix        string `json:"prefix"`
+		DeleteObjects bool   `json:"delete_objects"`
+		Compression   string `json:"compression"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if (params.Object == "") == (params.Prefix == "") {
+		return nil, errors.New("exactly one of object or prefix is required")
+	}
+	if err := checkCompression(params.Compression); err != nil {
+		return nil, err
+	}
+	var r *S3Reader
+	if params.Prefix != "" {
+		r = NewS3PrefixReader(params.AwsID, params.AwsSecret, params.Region, params.Bucket, params.Prefix)
+	} else {
+		r = NewS3ObjectReader(params.AwsID, params.AwsSecret, params.Region, params.Bucket, params.Object)
+	}
+	r.DeleteObjects = params.DeleteObjects
+	r.Compression = params.Compression
+	return r, nil
+}
+
+func newS3WriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		awsConfig
+		Key           string  `json:"key"`
+		KeyMetadata   string  `json:"key_metadata"`
+		Compress      bool    `json:"compress"`
+		LineSeparator *string `json:"line_separator"`
+		compressionConfig
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if params.Key == "" {
+		return nil, errors.New("key is required")
+	}
+	if params.Compression == etlutil.CompressionAuto {
+		return nil, errors.New(`compression cannot be "auto", as key names the object before compression`)
+	}
+	if err := checkCompression(params.Compression); err != nil {
+		return nil, err
+	}
+	w := NewS3Writer(params.AwsID, params.AwsSecret, params.Region, params.Bucket, params.Key)
+	w.Compress = params.Compress
+	w.Compression = params.Compression
+	w.CompressionLevel = params.CompressionLevel
+	w.KeyMetadata = params.KeyMetadata
+	if params.LineSeparator != nil {
+		w.LineSeparator = *params.LineSeparator
+	}
+	return w, nil
+}
+
+func newSftpReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		sftpConfig
+		DeleteObjects bool   `json:"delete_objects"`
+		Walk          bool   `json:"walk"`
+		FileNamesOnly bool   `json:"file_names_only"`
+		Compression   string `json:"compression"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if err := checkCompression(params.Compression); err != nil {
+		return nil, err
+	}
+	auth, err := params.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	r := NewSftpReader(params.Server, params.Username, params.Path, auth...)
+	r.DeleteObjects = params.DeleteObjects
+	r.Walk = params.Walk
+	r.FileNamesOnly = params.FileNamesOnly
+	r.Compression = params.Compression
+	return r, nil
+}
+
+func newSftpWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		sftpConfig
+		compressionConfig
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	codec, err := params.codec(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := params.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	w := NewSftpWriter(params.Server, params.Username, params.Path, auth...)
+	w.Compression = codec
+	w.CompressionLevel = params.CompressionLevel
+	return w, nil
+}
+
+func newFtpWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Host     string `json:"host"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Path     string `json:"path"`
+		compressionConfig
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if params.Host == "" || params.Path == "" {
+		return nil, errors.New("host and path are required")
+	}
+	codec, err := params.codec(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	w := NewFtpWriter(params.Host, params.Username, params.Password, params.Path)
+	w.Compression = codec
+	w.CompressionLevel = params.CompressionLevel
+	return w, nil
+}
+
+func newObjectReaderFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	params := struct {
+		Store         objectStoreConfig `json:"store"`
+		Pattern       string            `json:"pattern"`
+		DeleteObjects bool              `json:"delete_objects"`
+		LineByLine    bool              `json:"line_by_line"`
+		LineNumbers   bool              `json:"line_numbers"`
+		BufferSize    int               `json:"buffer_size"`
+		Compression   string            `json:"compression"`
+	}{LineByLine: true}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if err := checkCompression(params.Compression); err != nil {
+		return nil, err
+	}
+	store, err := params.Store.open()
+	if err != nil {
+		return nil, fmt.Errorf("store: %v", err)
+	}
+	r := NewObjectReader(store, params.Pattern)
+	r.DeleteObjects = params.DeleteObjects
+	r.CloseOnFinish = true
+	r.LineByLine = params.LineByLine
+	r.LineNumbers = params.LineNumbers
+	if params.BufferSize > 0 {
+		r.BufferSize = params.BufferSize
+	}
+	r.Compression = params.Compression
+	return r, nil
+}
+
+func newObjectWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Store         objectStoreConfig `json:"store"`
+		Key           string            `json:"key"`
+		KeyMetadata   string            `json:"key_metadata"`
+		LineSeparator *string           `json:"line_separator"`
+		compressionConfig
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if params.Key == "" {
+		return nil, errors.New("key is required")
+	}
+	codec, err := params.codec(params.Key)
+	if err != nil {
+		return nil, err
+	}
+	store, err := params.Store.open()
+	if err != nil {
+		return nil, fmt.Errorf("store: %v", err)
+	}
+	w := NewObjectWriter(store, params.Key)
+	w.KeyMetadata = params.KeyMetadata
+	if params.LineSeparator != nil {
+		w.LineSeparator = *params.LineSeparator
+	}
+	w.Compression = codec
+	w.CompressionLevel = params.CompressionLevel
+	w.CloseOnFinish = true
+	return w, nil
+}
+
+func newHTTPRequestFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Body    string            `json:"body"`
+		Headers map[string]string `json:"headers"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	if params.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	if params.Method == "" {
+		params.Method = "GET"
+	}
+	var body io.Reader
+	if params.Body != "" {
+		body = strings.NewReader(params.Body)
+	}
+	r, err := NewHTTPRequest(params.Method, params.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range params.Headers {
+		r.Request.Header.Set(k, v)
+	}
+	return r, nil
+}
+
+func newLogWriterFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		Prefix string `json:"prefix"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	return NewLogWriter(params.Prefix), nil
+}
+
+func newSchemaValidatorFromConfig(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+	var params struct {
+		schemaConfig
+		Invalid *goetl.ProcessorConfig `json:"invalid"`
+	}
+	if err := c.Decode(&params); err != nil {
+		return nil, err
+	}
+	schema, err := params.load()
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		return nil, errors.New("schema or schema_file is required")
+	}
+	v := NewSchemaValidator(schema)
+	if params.Invalid != nil {
+		v.Invalid, err = goetl.NewProcessorFromConfig(params.Invalid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid: %v", err)
+		}
+	}
+	return v, nil
+}
+
+// checkCompression checks that readers know the given codec.
+func checkCompression(codec string) error {
+	if codec == etlutil.CompressionAuto {
+		return nil
+	}
+	_, err := etlutil.LookupCodec(codec)
+	return err
+}
+
+// compressionConfig gives the codec a writer compresses its output with,
+// which can be "auto" to pick it by the extension of the output's path.
+type compressionConfig struct {
+	Compression      string `json:"compression"`
+	CompressionLevel int    `json:"compression_level"`
+}
+
+// codec returns the name of the codec to write the given path with, if any.
+func (c compressionConfig) codec(path string) (string, error) {
+	if c.Compression == etlutil.CompressionAuto {
+		if codec := etlutil.CodecForFile(path); codec != nil {
+			return codec.Name, nil
+		}
+		return "", nil
+	}
+	codec, err := etlutil.LookupCodec(c.Compression)
+	if err != nil || codec == nil {
+		return "", err
+	}
+	if codec.NewWriter == nil {
+		return "", fmt.Errorf("%v cannot be written", codec.Name)
+	}
+	return codec.Name, nil
+}
+
+// openOutput is the same as the openOutput function, but compresses what is
+// written to the file.
+func (c compressionConfig) openOutput(path string) (io.WriteCloser, error) {
+	codec, err := c.codec(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := openOutput(path)
+	if err != nil || codec == "" {
+		return f, err
+	}
+	return &compressedFile{file: f, codec: codec, level: c.CompressionLevel}, nil
+}
+
+// compressedFile compresses what is written to it into file. Closing it
+// ends the compressed stream, then closes the file.
+type compressedFile struct {
+	file       io.WriteCloser
+	codec      string
+	level      int
+	compressor io.WriteCloser
+}
+
+func (f *compressedFile) Write(p []byte) (int, error) {
+	w, err := compressedWriter(&f.compressor, f.file, f.codec, f.level)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(p)
+}
+
+func (f *compressedFile) Close() error {
+	err := closeCompressor(&f.compressor)
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// openInput returns a reader for the given file, or stdin for "-".
+func openInput(path string) (io.ReadCloser, error) {
+	switch path {
+	case "":
+		return nil, errors.New("path is required")
+	case "-":
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return &lazyFile{open: func() (*os.File, error) { return os.Open(path) }}, nil
+}
+
+// openOutput returns a writer for the given file, or stdout for "-".
+func openOutput(path string) (io.WriteCloser, error) {
+	switch path {
+	case "":
+		return nil, errors.New("path is required")
+	case "-":
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return &lazyFile{open: func() (*os.File, error) { return os.Create(path) }}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// lazyFile only opens its file once it is first read from or written to,
+// so that building (or validating) a pipeline config has no side effects.
+type lazyFile struct {
+	open func() (*os.File, error)
+	file *os.File
+	err  error
+}
+
+func (f *lazyFile) ensureOpen() error {
+	if f.file == nil && f.err == nil {
+		f.file, f.err = f.open()
+	}
+	return f.err
+}
+
+func (f *lazyFile) Read(p []byte) (int, error) {
+	if err := f.ensureOpen(); err != nil {
+		return 0, err
+	}
+	return f.file.Read(p)
+}
+
+func (f *lazyFile) Write(p []byte) (int, error) {
+	if err := f.ensureOpen(); err != nil {
+		return 0, err
+	}
+	return f.file.Write(p)
+}
+
+func (f *lazyFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// fileProcessor closes the file a configured Processor reads from or
+// writes to once it is finished, or aborted. The goetl interfaces of the
+// wrapped Processor are found through Unwrap.
+type fileProcessor struct {
+	goetl.Processor
+	file   io.Closer
+	closed bool
+}
+
+func closeOnFinish(p goetl.Processor, file io.Closer) goetl.Processor {
+	return &fileProcessor{Processor: p, file: file}
+}
+
+// Unwrap returns the wrapped Processor, so that the Pipeline finds the
+// goetl interfaces it implements, such as goetl.Checkpointer.
+func (p *fileProcessor) Unwrap() goetl.Processor {
+	return p.Processor
+}
+
+// ProcessDataContext keeps the wrapped Processor cancellable, if it is a
+// goetl.ContextProcessor.
+func (p *fileProcessor) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	if cp, ok := p.Processor.(goetl.ContextProcessor); ok {
+		cp.ProcessDataContext(ctx, d, outputChan, killChan)
+		return
+	}
+	p.Processor.ProcessData(d, outputChan, killChan)
+}
+
+func (p *fileProcessor) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	p.Processor.Finish(outputChan, killChan)
+	if err := p.close(); err != nil {
+		killChan <- err
+	}
+}
+
+// Abort passes the error on to the wrapped Processor, if it is a
+// goetl.AbortableProcessor, and closes the file if Finish did not.
+func (p *fileProcessor) Abort(err error) {
+	if ap, ok := p.Processor.(goetl.AbortableProcessor); ok {
+		ap.Abort(err)
+	}
+	if cerr := p.close(); cerr != nil {
+		logger.Error(p, "closing file:", cerr)
+	}
+}
+
+func (p *fileProcessor) close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	return p.file.Close()
+}
+
+func (p *fileProcessor) String() string {
+	return fmt.Sprintf("%v", p.Processor)
+}
@@ -0,0 +1,220 @@
+package processors
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+)
+
+func TestPipelineConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goetl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.json"), filepath.Join(dir, "out.json")
+
+	tests := []struct {
+		name    string
+		config  string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "YAML",
+			config: `
+name: orders
+processors:
+  - name: read
+    type: IoReader
+    config: {path: ` + in + `}
+    outputs: [filter, archive]
+  - name: filter
+    type: RegexpMatcher
+    config: {pattern: shipped}
+    outputs: [write]
+  - name: write
+    type: IoWriter
+    config: {path: ` + out + `}
+  - name: archive
+    type: Passthrough
+`,
+			want: "stage 1: read -> filter, archive\nstage 2: filter -> write\nstage 3: write, archive",
+		},
+		{
+			name: "JSON",
+			config: `{"processors": [
+				{"name": "read", "type": "IoReader", "config": {"path": "` + in + `"}, "outputs": ["write"]},
+				{"name": "write", "type": "IoWriter", "config": {"path": "` + out + `", "add_newline": true}}
+			]}`,
+			want: "stage 1: read -> write\nstage 2: write",
+		},
+		{
+			name:    "unknown processor type",
+			config:  `{"processors": [{"name": "read", "type": "TapeReader"}]}`,
+			wantErr: `pipeline config: processor "read": unknown processor type "TapeReader"`,
+		},
+		{
+			name: "missing required option",
+			config: `{"processors": [
+				{"name": "read", "type": "IoReader", "config": {"path": "` + in + `"}, "outputs": ["filter"]},
+				{"name": "filter", "type": "RegexpMatcher", "config": {"debug_log": true}}
+			]}`,
+			wantErr: `pipeline config: processor "filter" (RegexpMatcher): pattern is required`,
+		},
+		{
+			name:    "unknown option",
+			config:  `{"processors": [{"name": "pass", "type": "Passthrough", "config": {"pattern": "x"}}]}`,
+			wantErr: `pipeline config: processor "pass" (Passthrough): invalid config: json: unknown field "pattern"`,
+		},
+		{
+			name: "cycle",
+			config: `{"processors": [
+				{"name": "a", "type": "Passthrough", "outputs": ["b"]},
+				{"name": "b", "type": "Passthrough", "outputs": ["a"]}
+			]}`,
+			wantErr: `pipeline config: processor "a": outputs form a cycle`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := goetl.NewPipelineLayoutFromConfig([]byte(tt.config))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := layout.String(); got != tt.want {
+				t.Errorf("layout:\n%s\nwant:\n%s", got, tt.want)
+			}
+			// Files are only opened once the Pipeline runs.
+			if _, err := os.Stat(out); !os.IsNotExist(err) {
+				t.Errorf("building the layout created %v: %v", out, err)
+			}
+		})
+	}
+}
+
+func TestConfiguredProcessorsLayout(t *testing.T) {
+	config, err := goetl.ParsePipelineConfig([]byte(`{"processors": [
+		{"name": "read", "type": "IoReader", "config": {"path": "-"}, "outputs": ["write"]},
+		{"name": "write", "type": "IoWriter", "config": {"path": "-"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var built []goetl.Processor
+	for _, pc := range config.Processors {
+		p, err := goetl.NewProcessorFromConfig(pc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		built = append(built, p)
+	}
+	// The outputs are only connected by the config's own Layout.
+	_, err = goetl.NewPipelineLayout(
+		goetl.NewPipelineStage(goetl.Do(built[0])),
+		goetl.NewPipelineStage(goetl.Do(built[1])),
+	)
+	if err == nil || !strings.Contains(err.Error(), "must have Outputs set in non-final PipelineStage #1") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+// wrappedSource sends its lines, routing them to route, and implements the
+// goetl interfaces that fileProcessor must not hide.
+type wrappedSource struct {
+	lines   []string
+	route   goetl.Processor
+	aborted error
+}
+
+func (s *wrappedSource) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	for _, line := range s.lines {
+		outputChan <- etldata.JSON(line)
+	}
+}
+
+func (s *wrappedSource) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (s *wrappedSource) Route(d etldata.Payload) []goetl.Processor {
+	return []goetl.Processor{s.route}
+}
+
+func (s *wrappedSource) Abort(err error) { s.aborted = err }
+
+func (s *wrappedSource) Checkpoint() ([]byte, error) { return []byte(`"read"`), nil }
+
+func (s *wrappedSource) Restore(state []byte) error { return nil }
+
+func (s *wrappedSource) Concurrency() int { return 2 }
+
+// collector keeps the data it receives, and fails on Finish if err is set.
+type collector struct {
+	got []string
+	err error
+}
+
+func (c *collector) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	c.got = append(c.got, string(d.Bytes()))
+}
+
+func (c *collector) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	if c.err != nil {
+		killChan <- c.err
+	}
+}
+
+type countingCloser struct {
+	closed int
+}
+
+func (c *countingCloser) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestFileProcessor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goetl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	routed, skipped := &collector{err: errors.New("failed")}, &collector{}
+	source := &wrappedSource{lines: []string{"1", "2"}, route: routed}
+	file := &countingCloser{}
+	read := closeOnFinish(source, file)
+	layout, err := goetl.NewGraph().Connect(read, routed).Connect(read, skipped).Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := goetl.NewFileCheckpointStore(dir)
+	p := goetl.NewBranchingPipeline(layout)
+	p.Name = "wrapped"
+	p.CheckpointStore = store
+	if result := p.Execute(); result.Err == nil {
+		t.Fatal("the Pipeline did not fail")
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(routed.got, want) || len(skipped.got) != 0 {
+		t.Errorf("routed %v and %v, want %v and nothing", routed.got, skipped.got, want)
+	}
+	if source.aborted == nil || file.closed != 1 {
+		t.Errorf("aborted with %v, file closed %d times", source.aborted, file.closed)
+	}
+	checkpoint, err := store.Load("wrapped")
+	if err != nil || len(checkpoint) != 1 {
+		t.Errorf("checkpoint = %q, %v", checkpoint, err)
+	}
+}
@@ -3,6 +3,9 @@ package processors
 // http://docs.aws.amazon.com/sdk-for-go/api/service/s3/S3.html
 
 import (
+	"encoding/json"
+	"sync"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -16,7 +19,8 @@ import (
 // a single object, or NewS3PrefixReader to read all objects matching the same
 // prefix in your bucket.
 // S3Reader embeds an IoReeader, so it will support the same configuration
-// options as IoReader.
+// options as IoReader. The bucket, key and content type of each object are
+// added to the etldata.Metadata of the payloads read from it.
 type S3Reader struct {
 	IoReader            // embeds IoReader
 	bucket              string
@@ -24,6 +28,7 @@ type S3Reader struct {
 	prefix              string
 	DeleteObjects       bool
 	processedObjectKeys []string
+	keysMutex           sync.Mutex
 	client              *s3.S3
 }
 
@@ -59,20 +64,32 @@ func (r *S3Reader) ProcessData(d etldata.Payload, outputChan chan etldata.Payloa
 		logger.Debug("S3Reader: list =", objects)
 		etlutil.KillPipelineIfErr(err, killChan)
 		for _, o := range objects {
+			if r.isProcessed(o) {
+				logger.Debug("S3Reader: skipping object processed before checkpoint", o)
+				continue
+			}
 			obj, err := etlutil.GetS3Object(r.client, r.bucket, o)
-			etlutil.KillPipelineIfErr(err, killChan)
-			r.processObject(obj, outputChan, killChan)
-			r.processedObjectKeys = append(r.processedObjectKeys, o)
+			if err != nil {
+				etlutil.KillPipelineIfErr(err, killChan)
+				return
+			}
+			r.processObject(o, obj, outputChan, killChan)
+			r.addProcessed(o)
 		}
+	} else if r.isProcessed(r.object) {
+		logger.Debug("S3Reader: skipping object processed before checkpoint", r.object)
 	} else {
 		logger.Debug("S3Reader: process data for object", r.object)
 		obj, err := etlutil.GetS3Object(r.client, r.bucket, r.object)
-		etlutil.KillPipelineIfErr(err, killChan)
-		r.processObject(obj, outputChan, killChan)
-		r.processedObjectKeys = append(r.processedObjectKeys, r.object)
+		if err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		r.processObject(r.object, obj, outputChan, killChan)
+		r.addProcessed(r.object)
 	}
 	if r.DeleteObjects {
-		_, err := etlutil.DeleteS3Objects(r.client, r.bucket, r.processedObjectKeys)
+		_, err := etlutil.DeleteS3Objects(r.client, r.bucket, r.processedKeys())
 		etlutil.KillPipelineIfErr(err, killChan)
 	}
 }
@@ -81,10 +98,57 @@ func (r *S3Reader) ProcessData(d etldata.Payload, outputChan chan etldata.Payloa
 func (r *S3Reader) Finish(outputChan chan etldata.Payload, killChan chan error) {
 }
 
-func (r *S3Reader) processObject(obj *s3.GetObjectOutput, outputChan chan etldata.Payload, killChan chan error) {
+// Checkpoint saves the keys of the objects that have been read so far.
+// It implements goetl.Checkpointer.
+func (r *S3Reader) Checkpoint() ([]byte, error) {
+	return json.Marshal(r.processedKeys())
+}
+
+// Restore skips reading the objects saved by Checkpoint. They are
+// still deleted along with the other objects if DeleteObjects is set.
+// It implements goetl.Checkpointer.
+func (r *S3Reader) Restore(state []byte) error {
+	var keys []string
+	if err := json.Unmarshal(state, &keys); err != nil {
+		return err
+	}
+	r.keysMutex.Lock()
+	defer r.keysMutex.Unlock()
+	r.processedObjectKeys = keys
+	return nil
+}
+
+func (r *S3Reader) isProcessed(key string) bool {
+	r.keysMutex.Lock()
+	defer r.keysMutex.Unlock()
+	for _, k := range r.processedObjectKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *S3Reader) addProcessed(key string) {
+	r.keysMutex.Lock()
+	defer r.keysMutex.Unlock()
+	r.processedObjectKeys = append(r.processedObjectKeys, key)
+}
+
+func (r *S3Reader) processedKeys() []string {
+	r.keysMutex.Lock()
+	defer r.keysMutex.Unlock()
+	return append([]string(nil), r.processedObjectKeys...)
+}
+
+func (r *S3Reader) processObject(key string, obj *s3.GetObjectOutput, outputChan chan etldata.Payload, killChan chan error) {
 	// Use IoReader for actual data handling
 	r.IoReader.Reader = obj.Body
-	r.IoReader.ProcessData(nil, outputChan, killChan)
+	r.IoReader.read(etldata.Metadata{
+		etldata.MetadataS3Bucket:    r.bucket,
+		etldata.MetadataS3Key:       key,
+		etldata.MetadataContentType: aws.StringValue(obj.ContentType),
+	}, outputChan, killChan)
 	obj.Body.Close()
 }
 
@@ -9,18 +9,29 @@ import (
 
 // S3Writer sends data upstream to S3. By default, we will not compress data before sending it.
 // Set the `Compress` flag to true to use gzip compression before storing in S3 (if this flag is
-// set to true, ".gz" will automatically be appended to the key name specified).
+// set to true, ".gz" will automatically be appended to the key name specified). To use another
+// codec, such as "zstd", set `Compression` to its name (see etlutil.Codec) and optionally
+// `CompressionLevel`; the codec's extension is then appended to the key instead.
 //
 // By default, we will separate each iteration of data sent to `ProcessData` with a new line
 // when we piece back together to send to S3. Change the `LineSeparator` attribute to change
 // this behavior.
+//
+// To split the data over several objects, set `KeyMetadata` to an etldata.Metadata key
+// (such as etldata.MetadataS3Key or etldata.MetadataFileName): each payload is then written
+// to the object named by that key's value, or to the key given to NewS3Writer if the
+// payload does not have it.
 type S3Writer struct {
-	data          []string
-	Compress      bool
-	LineSeparator string
-	config        *aws.Config
-	bucket        string
-	key           string
+	data             map[string][]string
+	keys             []string // the keys in data, in the order they were first seen
+	Compress         bool
+	Compression      string
+	CompressionLevel int
+	LineSeparator    string
+	KeyMetadata      string
+	config           *aws.Config
+	bucket           string
+	key              string
 }
 
 // NewS3Writer instaniates a new S3Writer
@@ -36,12 +47,40 @@ func NewS3Writer(awsID, awsSecret, awsRegion, bucket, key string) *S3Writer {
 
 // ProcessData enqueues all received data
 func (w *S3Writer) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
-	w.data = append(w.data, string(d.Bytes()))
+	key := w.key
+	if w.KeyMetadata != "" {
+		if k := etldata.MetadataOf(d)[w.KeyMetadata]; k != "" {
+			key = k
+		}
+	}
+	if w.data == nil {
+		w.data = make(map[string][]string)
+	}
+	if _, ok := w.data[key]; !ok {
+		w.keys = append(w.keys, key)
+	}
+	w.data[key] = append(w.data[key], string(d.Bytes()))
 }
 
 // Finish writes all enqueued data to S3, defering to etlutil.WriteS3Object
 func (w *S3Writer) Finish(outputChan chan etldata.Payload, killChan chan error) {
-	etlutil.WriteS3Object(w.data, w.config, w.bucket, w.key, w.LineSeparator, w.Compress)
+	if len(w.keys) == 0 {
+		w.keys = []string{w.key}
+	}
+	codec := w.Compression
+	if codec == "" && w.Compress {
+		codec = etlutil.CodecGzip
+	}
+	for _, key := range w.keys {
+		_, err := etlutil.WriteCompressedS3Object(w.data[key], w.config, w.bucket, key, w.LineSeparator, codec, w.CompressionLevel)
+		etlutil.KillPipelineIfErr(err, killChan)
+	}
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that KeyMetadata
+// can name the object of each payload.
+func (w *S3Writer) ReadsMetadata() bool {
+	return true
 }
 
 func (w *S3Writer) String() string {
@@ -0,0 +1,110 @@
+package processors
+
+import (
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// SchemaValidator checks that the records it receives (JSON objects, or
+// arrays of objects) conform to an etldata.Schema, so that bad data is
+// caught before it reaches a writer rather than failing halfway through a
+// load.
+//
+// By default, the first payload holding a record that does not conform
+// halts the pipeline with an *etldata.SchemaError. Use an ErrorPolicy on the
+// SchemaValidator to skip or dead-letter those payloads instead. If Invalid
+// is set, only the conforming records are sent on, and each other record
+// is sent to Invalid as an InvalidRecord, for example to write them to a
+// file with an IoWriter.
+type SchemaValidator struct {
+	Schema  *etldata.Schema
+	Invalid goetl.Processor
+}
+
+// InvalidRecord is the payload sent to a SchemaValidator's Invalid Processor.
+type InvalidRecord struct {
+	Errors []string               `json:"errors"`
+	Record map[string]interface{} `json:"record"`
+}
+
+// NewSchemaValidator returns a new SchemaValidator for the given Schema.
+func NewSchemaValidator(schema *etldata.Schema) *SchemaValidator {
+	return &SchemaValidator{Schema: schema}
+}
+
+// ProcessData sends the payload on if all of its records conform to the
+// Schema. See SchemaValidator for what happens otherwise.
+func (v *SchemaValidator) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	if v.Invalid == nil {
+		if err := v.Schema.Validate(d); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		outputChan <- d
+		return
+	}
+
+	objects, err := d.Objects()
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	valid := []map[string]interface{}{}
+	for _, o := range objects {
+		errs := v.Schema.ValidateObject(o)
+		if errs == nil {
+			valid = append(valid, o)
+			continue
+		}
+		ir := InvalidRecord{Record: o}
+		for _, fe := range errs {
+			ir.Errors = append(ir.Errors, fe.Error())
+		}
+		js, err := etldata.NewJSON(ir)
+		if err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		var dd etldata.Payload = js
+		if md := etldata.MetadataOf(d); md != nil {
+			dd = etldata.WithMetadata(dd, md)
+		}
+		etlutil.CallDetached(func(outputChan chan etldata.Payload) {
+			v.Invalid.ProcessData(dd, outputChan, killChan)
+		})
+	}
+
+	switch {
+	case len(valid) == len(objects):
+		outputChan <- d
+	case len(valid) == 0:
+	default:
+		if _, ok := d.(*etldata.Records); ok {
+			outputChan <- etldata.NewRecords(valid)
+			return
+		}
+		dd, err := etldata.NewJSON(valid)
+		etlutil.KillPipelineIfErr(err, killChan)
+		outputChan <- dd
+	}
+}
+
+// Finish calls Finish on the Invalid Processor, if there is one.
+func (v *SchemaValidator) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	if v.Invalid != nil {
+		etlutil.CallDetached(func(outputChan chan etldata.Payload) {
+			v.Invalid.Finish(outputChan, killChan)
+		})
+	}
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that invalid records
+// are sent to Invalid with the Metadata of their payload.
+func (v *SchemaValidator) ReadsMetadata() bool {
+	return true
+}
+
+func (v *SchemaValidator) String() string {
+	return "SchemaValidator"
+}
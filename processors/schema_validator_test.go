@@ -0,0 +1,138 @@
+package processors
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+)
+
+func testSchema() *etldata.Schema {
+	return etldata.NewSchema(
+		etldata.Field{Name: "id", Type: etldata.FieldInteger},
+		etldata.Field{Name: "status", Type: etldata.FieldString, Nullable: true},
+	)
+}
+
+func TestSchemaValidator(t *testing.T) {
+	tests := []struct {
+		name        string
+		inputs      []etldata.Payload
+		invalid     bool
+		want        []string
+		wantInvalid []string
+		wantErr     string
+	}{
+		{
+			name:   "conforming records",
+			inputs: []etldata.Payload{etldata.JSON(`{"id":1,"status":"new"}`), etldata.JSON(`[{"id":2},{"id":3,"status":null}]`)},
+			want:   []string{`{"id":1,"status":"new"}`, `[{"id":2},{"id":3,"status":null}]`},
+		},
+		{
+			name:    "malformed input",
+			inputs:  []etldata.Payload{etldata.JSON(`{"id":1}`), etldata.JSON(`{"id":`)},
+			want:    []string{`{"id":1}`},
+			wantErr: "unexpected end of JSON input",
+		},
+		{
+			name:    "malformed input with Invalid",
+			inputs:  []etldata.Payload{etldata.JSON(`"id"`)},
+			invalid: true,
+			wantErr: "unsupported data type: string",
+		},
+		{
+			name: "error partway through the stream",
+			inputs: []etldata.Payload{
+				etldata.JSON(`{"id":1}`),
+				etldata.JSON(`[{"id":2},{"id":"3"}]`),
+				etldata.JSON(`{"id":4}`),
+			},
+			want:    []string{`{"id":1}`},
+			wantErr: `record 1 does not match schema: field "id" should be integer, got string`,
+		},
+		{
+			name: "invalid records sent to Invalid",
+			inputs: []etldata.Payload{
+				etldata.JSON(`{"id":1}`),
+				etldata.JSON(`[{"id":2},{"id":"3"},{"id":4,"extra":true}]`),
+				etldata.JSON(`{"status":"new"}`),
+				etldata.NewRecords([]map[string]interface{}{{"id": 5}, {"id": 6.5}}),
+			},
+			invalid: true,
+			want:    []string{`{"id":1}`, `[{"id":2}]`, `[{"id":5}]`},
+			wantInvalid: []string{
+				`{"errors":["field \"id\" should be integer, got string"],"record":{"id":"3"}}`,
+				`{"errors":["field \"extra\" is not in the schema"],"record":{"extra":true,"id":4}}`,
+				`{"errors":["field \"id\" is missing"],"record":{"status":"new"}}`,
+				`{"errors":["field \"id\" should be integer, got number"],"record":{"id":6.5}}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewSchemaValidator(testSchema())
+			invalid := &collector{}
+			if tt.invalid {
+				v.Invalid = invalid
+			}
+			sent, err := processAll(v, tt.inputs...)
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			var got []string
+			for _, d := range sent {
+				got = append(got, string(d.Bytes()))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(invalid.got, tt.wantInvalid) {
+				t.Errorf("sent to Invalid %q, want %q", invalid.got, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+// endlessSource sends conforming records until its context is cancelled.
+type endlessSource struct{}
+
+func (s *endlessSource) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+}
+
+func (s *endlessSource) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	for {
+		select {
+		case outputChan <- etldata.JSON(`{"id":1}`):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *endlessSource) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func TestSchemaValidatorCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	sink := &collector{}
+	p := goetl.NewPipeline(&endlessSource{}, NewSchemaValidator(testSchema()), sink)
+	p.RunContext(ctx)
+	if r := p.Wait(); r.Err != context.DeadlineExceeded {
+		t.Fatalf("Err = %v, want %v", r.Err, context.DeadlineExceeded)
+	}
+	if len(sink.got) == 0 {
+		t.Fatal("nothing was validated before the run was cancelled")
+	}
+	for _, d := range sink.got {
+		if d != `{"id":1}` {
+			t.Fatalf("sent %q", d)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package processors
 
 import (
+	"context"
+
 	"github.com/pkg/sftp"
 	"github.com/teambenny/goetl/etldata"
 	"github.com/teambenny/goetl/etlutil"
@@ -12,6 +14,9 @@ import (
 //
 // To only send full paths (and not file contents), set FileNamesOnly to true.
 // If FileNamesOnly is set to true, DeleteObjects will be ignored.
+//
+// The path of each file is added to the etldata.Metadata of the payloads
+// read from it.
 type SftpReader struct {
 	IoReader      // embeds IoReader
 	parameters    *etlutil.SftpParameters
@@ -62,11 +67,20 @@ func NewSftpReaderByClient(client *sftp.Client, path string) *SftpReader {
 // ProcessData optionally walks through the tree to send each object separately, or sends the single
 // object upstream
 func (r *SftpReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	r.ProcessDataContext(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataContext is the same as ProcessData, but stops walking and reading
+// remote files once the pipeline's context is done. See ContextProcessor.
+func (r *SftpReader) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
 	r.ensureInitialized(killChan)
+	if !r.initialized {
+		return
+	}
 	if r.Walk {
-		r.walk(outputChan, killChan)
+		r.walk(ctx, outputChan, killChan)
 	} else {
-		r.sendObject(r.parameters.Path, outputChan, killChan)
+		r.sendObject(ctx, r.parameters.Path, outputChan, killChan)
 	}
 }
 
@@ -77,6 +91,14 @@ func (r *SftpReader) Finish(outputChan chan etldata.Payload, killChan chan error
 	}
 }
 
+// Abort closes the connection to the remote server (if CloseOnFinish is set)
+// when the pipeline fails before Finish is called. See AbortableProcessor.
+func (r *SftpReader) Abort(err error) {
+	if r.CloseOnFinish && r.client != nil {
+		r.CloseClient()
+	}
+}
+
 // CloseClient allows you to manually close the connection to the remote client (as the remote client
 // itself is not exported)
 func (r *SftpReader) CloseClient() {
@@ -93,27 +115,33 @@ func (r *SftpReader) ensureInitialized(killChan chan error) {
 	}
 
 	client, err := etlutil.SftpClient(r.parameters.Server, r.parameters.Username, r.parameters.AuthMethods)
-	etlutil.KillPipelineIfErr(err, killChan)
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
 
 	r.client = client
 	r.initialized = true
 }
 
-func (r *SftpReader) walk(outputChan chan etldata.Payload, killChan chan error) {
+func (r *SftpReader) walk(ctx context.Context, outputChan chan etldata.Payload, killChan chan error) {
 	walker := r.client.Walk(r.parameters.Path)
 	for walker.Step() {
+		if ctx.Err() != nil {
+			return
+		}
 		etlutil.KillPipelineIfErr(walker.Err(), killChan)
 		if !walker.Stat().IsDir() {
-			r.sendObject(walker.Path(), outputChan, killChan)
+			r.sendObject(ctx, walker.Path(), outputChan, killChan)
 		}
 	}
 }
 
-func (r *SftpReader) sendObject(path string, outputChan chan etldata.Payload, killChan chan error) {
+func (r *SftpReader) sendObject(ctx context.Context, path string, outputChan chan etldata.Payload, killChan chan error) {
 	if r.FileNamesOnly {
 		r.sendFilePath(path, outputChan, killChan)
 	} else {
-		r.sendFile(path, outputChan, killChan)
+		r.sendFile(ctx, path, outputChan, killChan)
 	}
 }
 
@@ -121,17 +149,28 @@ func (r *SftpReader) sendFilePath(path string, outputChan chan etldata.Payload,
 	sftpPath := etlutil.SftpPath{Path: path}
 	d, err := etldata.NewJSON(sftpPath)
 	etlutil.KillPipelineIfErr(err, killChan)
-	outputChan <- d
+	outputChan <- etldata.WithMetadata(d, etldata.Metadata{
+		etldata.MetadataSftpPath:   path,
+		etldata.MetadataIngestedAt: ingestedAt(),
+	})
 }
 
-func (r *SftpReader) sendFile(path string, outputChan chan etldata.Payload, killChan chan error) {
+func (r *SftpReader) sendFile(ctx context.Context, path string, outputChan chan etldata.Payload, killChan chan error) {
 	file, err := r.client.Open(path)
 
 	etlutil.KillPipelineIfErr(err, killChan)
 	defer file.Close()
 
-	r.IoReader.Reader = file
-	r.IoReader.ProcessData(nil, outputChan, killChan)
+	r.IoReader.Reader = etlutil.NewContextReader(ctx, file)
+	r.IoReader.read(etldata.Metadata{
+		etldata.MetadataSftpPath:    path,
+		etldata.MetadataContentType: contentTypeOf(path),
+	}, outputChan, killChan)
+
+	// Never delete a file that may have only been partially read.
+	if ctx.Err() != nil {
+		return
+	}
 
 	if r.DeleteObjects {
 		err = r.client.Remove(path)
@@ -1,6 +1,9 @@
 package processors
 
 import (
+	"context"
+	"io"
+
 	"golang.org/x/crypto/ssh"
 
 	"github.com/pkg/sftp"
@@ -9,13 +12,17 @@ import (
 	"github.com/teambenny/goetl/logger"
 )
 
-// SftpWriter is an inline writer to remote sftp server
+// SftpWriter is an inline writer to remote sftp server.
+// Set Compression (and CompressionLevel) to compress the file, as with IoWriter.
 type SftpWriter struct {
-	client        *sftp.Client
-	file          *sftp.File
-	parameters    *etlutil.SftpParameters
-	initialized   bool
-	CloseOnFinish bool
+	client           *sftp.Client
+	file             *sftp.File
+	compressor       io.WriteCloser
+	parameters       *etlutil.SftpParameters
+	initialized      bool
+	CloseOnFinish    bool
+	Compression      string
+	CompressionLevel int
 }
 
 // NewSftpWriter instantiates a new sftp writer, a connection to the remote server is delayed until data is recv'd by the writer
@@ -44,20 +51,50 @@ func NewSftpWriterByFile(file *sftp.File) *SftpWriter {
 
 // ProcessData writes data as is directly to the output file
 func (w *SftpWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	w.ProcessDataContext(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataContext is the same as ProcessData, but nothing more is written
+// once the pipeline's context is done. See ContextProcessor.
+func (w *SftpWriter) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	if ctx.Err() != nil {
+		return
+	}
 	logger.Debug("SftpWriter Process data:", string(d.Bytes()))
 	w.ensureInitialized(killChan)
-	_, e := w.file.Write(d.Bytes())
+	writer, e := compressedWriter(&w.compressor, w.file, w.Compression, w.CompressionLevel)
+	if e != nil {
+		etlutil.KillPipelineIfErr(e, killChan)
+		return
+	}
+	_, e = writer.Write(d.Bytes())
 	etlutil.KillPipelineIfErr(e, killChan)
 }
 
-// Finish optionally closes open references to the remote file and server
+// Finish ends the compressed stream, if any, and optionally closes open references to the
+// remote file and server
 func (w *SftpWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	etlutil.KillPipelineIfErr(closeCompressor(&w.compressor), killChan)
 	if w.CloseOnFinish {
 		w.file.Close()
 		w.client.Close()
 	}
 }
 
+// Abort closes open references to the remote file and server (if CloseOnFinish
+// is set) when the pipeline fails before Finish is called. See AbortableProcessor.
+func (w *SftpWriter) Abort(err error) {
+	if !w.CloseOnFinish {
+		return
+	}
+	if w.file != nil {
+		w.file.Close()
+	}
+	if w.client != nil {
+		w.client.Close()
+	}
+}
+
 func (w *SftpWriter) String() string {
 	return "SftpWriter"
 }
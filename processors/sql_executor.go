@@ -1,6 +1,7 @@
 package processors
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 
@@ -36,6 +37,12 @@ func NewDynamicSQLExecutor(dbConn *sql.DB, sqlGenerator func(etldata.Payload) (s
 
 // ProcessData runs the SQL statements, deferring to etlutil.ExecuteSQLQuery
 func (s *SQLExecutor) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	s.ProcessDataContext(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataContext runs the SQL statements bound to the pipeline's context,
+// deferring to etlutil.ExecuteSQLQueryContext. See ContextProcessor.
+func (s *SQLExecutor) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
 	// handle panics a bit more gracefully
 	defer func() {
 		if err := recover(); err != nil {
@@ -47,16 +54,23 @@ func (s *SQLExecutor) ProcessData(d etldata.Payload, outputChan chan etldata.Pay
 	var err error
 	if s.query == "" && s.sqlGenerator != nil {
 		sql, err = s.sqlGenerator(d)
-		etlutil.KillPipelineIfErr(err, killChan)
+		if err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
 	} else if s.query != "" {
 		sql = s.query
 	} else {
 		killChan <- errors.New("SQLExecutor: must have either static query or sqlGenerator func")
+		return
 	}
 
 	logger.Debug("SQLExecutor: Running - ", sql)
 	// See sql.go
-	err = etlutil.ExecuteSQLQuery(s.readDB, sql)
+	err = etlutil.ExecuteSQLQueryContext(ctx, s.readDB, sql)
+	if ctx.Err() != nil {
+		return
+	}
 	etlutil.KillPipelineIfErr(err, killChan)
 	logger.Info("SQLExecutor: Query complete")
 }
@@ -1,8 +1,12 @@
 package processors
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"sync"
 
 	"github.com/teambenny/goetl/etldata"
 	"github.com/teambenny/goetl/etlutil"
@@ -19,6 +23,23 @@ import (
 // The dynamic SQL generation is implemented by passing in a "sqlGenerator"
 // function to NewDynamicSQLReader. This allows you to write whatever code is
 // needed to generate SQL based upon data flowing through the pipeline.
+//
+// Every payload sent carries etldata.Metadata with the query and the time
+// it was run.
+//
+// Set TypedRecords to send etldata.Records payloads, holding the values as
+// they were scanned, instead of etldata.JSON. This saves encoding and
+// parsing JSON when the next stages work with objects, such as MySQLWriter,
+// PostgreSQLWriter or CSVTransformer.
+//
+// Set KeyColumn and ResumeQuery on a static SQLReader to have it save the
+// last value of KeyColumn read in checkpoints (see goetl.Checkpointer). A
+// resumed run then runs ResumeQuery instead of the query, with the saved
+// value as its only argument, such as:
+//
+//	reader := processors.NewSQLReader(db, "SELECT * FROM orders ORDER BY id")
+//	reader.KeyColumn = "id"
+//	reader.ResumeQuery = "SELECT * FROM orders WHERE id > ? ORDER BY id"
 type SQLReader struct {
 	readDB            *sql.DB
 	query             string
@@ -26,6 +47,12 @@ type SQLReader struct {
 	BatchSize         int
 	StructDestination interface{}
 	ConcurrencyLevel  int // See ConcurrentProcessor
+	TypedRecords      bool
+	KeyColumn         string
+	ResumeQuery       string
+
+	mutex   sync.Mutex
+	lastKey interface{} // the last value of KeyColumn read, if any
 }
 
 type dataErr struct {
@@ -44,7 +71,13 @@ func NewDynamicSQLReader(dbConn *sql.DB, sqlGenerator func(etldata.Payload) (str
 
 // ProcessData - see interface for documentation.
 func (s *SQLReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
-	s.ForEachQueryData(d, killChan, func(d etldata.Payload) {
+	s.ProcessDataContext(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataContext runs the query bound to the pipeline's context,
+// so a cancelled pipeline also cancels the running query. See ContextProcessor.
+func (s *SQLReader) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	s.ForEachQueryDataContext(ctx, d, killChan, func(d etldata.Payload) {
 		outputChan <- d
 	})
 }
@@ -53,32 +86,156 @@ func (s *SQLReader) ProcessData(d etldata.Payload, outputChan chan etldata.Paylo
 // running the query and retrieving the data in etldata.JSON format, and then
 // passing the results back witih the function call to forEach.
 func (s *SQLReader) ForEachQueryData(d etldata.Payload, killChan chan error, forEach func(d etldata.Payload)) {
+	s.ForEachQueryDataContext(context.Background(), d, killChan, forEach)
+}
+
+// ForEachQueryDataContext is the same as ForEachQueryData, but the query
+// is cancelled once the given context is done.
+func (s *SQLReader) ForEachQueryDataContext(ctx context.Context, d etldata.Payload, killChan chan error, forEach func(d etldata.Payload)) {
 	sql := ""
+	var args []interface{}
 	var err error
 	if s.query == "" && s.sqlGenerator != nil {
 		sql, err = s.sqlGenerator(d)
-		etlutil.KillPipelineIfErr(err, killChan)
+		if err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
 	} else if s.query != "" {
 		sql = s.query
+		if key := s.resumeKey(); key != nil {
+			sql = s.ResumeQuery
+			args = append(args, key)
+		}
 	} else {
 		killChan <- errors.New("SQLReader: must have either static query or sqlGenerator func")
+		return
 	}
 
 	logger.Debug("SQLReader: Running - ", sql)
 	// See sql.go
-	dataChan, err := etlutil.GetDataFromSQLQuery(s.readDB, sql, s.BatchSize, s.StructDestination)
-	etlutil.KillPipelineIfErr(err, killChan)
+	query := etlutil.GetDataFromSQLQueryContext
+	if s.TypedRecords {
+		query = etlutil.GetRecordsFromSQLQueryContext
+	}
+	dataChan, err := query(ctx, s.readDB, sql, s.BatchSize, s.StructDestination, args...)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		// There is no data to wait on, so don't block on the nil dataChan.
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
 
+	md := etldata.Metadata{
+		etldata.MetadataQuery:       sql,
+		etldata.MetadataIngestedAt:  ingestedAt(),
+		etldata.MetadataContentType: "application/json",
+	}
 	for d := range dataChan {
+		if _, ok := d.(*etldata.Records); ok {
+			s.read(d)
+			forEach(etldata.WithMetadata(d, md))
+			continue
+		}
 		// First check if an error was returned back from the SQL processing
 		// helper, then if not call forEach with the received data.
 		var derr dataErr
 		if err := d.ParseSilent(&derr); err == nil {
-			etlutil.KillPipelineIfErr(errors.New(derr.Error), killChan)
+			// Errors caused by cancelling the query are expected.
+			if ctx.Err() == nil {
+				etlutil.KillPipelineIfErr(errors.New(derr.Error), killChan)
+			}
 		} else {
-			forEach(d)
+			s.read(d)
+			forEach(etldata.WithMetadata(d, md))
+		}
+	}
+}
+
+// checkpointed returns true if the SQLReader saves its position in
+// checkpoints.
+func (s *SQLReader) checkpointed() bool {
+	return s.KeyColumn != "" && s.ResumeQuery != "" && s.query != ""
+}
+
+// resumeKey returns the key to resume reading after, or nil to read from
+// the start.
+func (s *SQLReader) resumeKey() interface{} {
+	if !s.checkpointed() {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastKey
+}
+
+// read records the value of KeyColumn in the last row of a payload read.
+func (s *SQLReader) read(d etldata.Payload) {
+	if !s.checkpointed() {
+		return
+	}
+	var rows []map[string]interface{}
+	if r, ok := d.(*etldata.Records); ok {
+		rows, _ = r.Objects()
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(d.Bytes()))
+		dec.UseNumber()
+		dec.Decode(&rows)
+	}
+	if len(rows) == 0 {
+		return
+	}
+	key, ok := rows[len(rows)-1][s.KeyColumn]
+	if !ok || key == nil {
+		return
+	}
+	if b, ok := key.([]byte); ok {
+		key = string(b)
+	}
+	s.mutex.Lock()
+	s.lastKey = key
+	s.mutex.Unlock()
+}
+
+// Checkpoint saves the last value of KeyColumn read, or nothing if
+// KeyColumn and ResumeQuery are not set. It implements goetl.Checkpointer.
+func (s *SQLReader) Checkpoint() ([]byte, error) {
+	if !s.checkpointed() {
+		return nil, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.lastKey == nil {
+		return nil, nil
+	}
+	return json.Marshal(s.lastKey)
+}
+
+// Restore makes the SQLReader run ResumeQuery with the value saved by
+// Checkpoint. It implements goetl.Checkpointer.
+func (s *SQLReader) Restore(state []byte) error {
+	if state == nil {
+		return nil
+	}
+	var key interface{}
+	dec := json.NewDecoder(bytes.NewReader(state))
+	dec.UseNumber()
+	if err := dec.Decode(&key); err != nil {
+		return err
+	}
+	if n, ok := key.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			key = i
+		} else if key, err = n.Float64(); err != nil {
+			return err
 		}
 	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastKey = key
+	return nil
 }
 
 // Finish - see interface for documentation.
@@ -1,6 +1,7 @@
 package processors
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/teambenny/goetl/etldata"
@@ -37,14 +38,22 @@ func NewDynamicSQLReaderMySQLWriter(readConn *sql.DB, writeConn *sql.DB, sqlGene
 
 // ProcessData uses SQLReader methods for processing data - this works via composition
 func (s *SQLReaderMySQLWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
-	s.ForEachQueryData(d, killChan, func(d etldata.Payload) {
+	s.ProcessDataContext(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataContext is the same as ProcessData, but the query is cancelled
+// along with the pipeline's context. See ContextProcessor.
+func (s *SQLReaderMySQLWriter) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	s.ForEachQueryDataContext(ctx, d, killChan, func(d etldata.Payload) {
 		s.MySQLWriter.ProcessData(d, outputChan, killChan)
 		outputChan <- d
 	})
 }
 
-// Finish - see interface for documentation.
+// Finish commits the MySQLWriter's transaction, if its Transaction is set.
+// Abort is also that of the MySQLWriter.
 func (s *SQLReaderMySQLWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	s.MySQLWriter.Finish(outputChan, killChan)
 }
 
 func (s *SQLReaderMySQLWriter) String() string {
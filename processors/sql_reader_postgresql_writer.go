@@ -1,6 +1,7 @@
 package processors
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/teambenny/goetl/etldata"
@@ -37,14 +38,22 @@ func NewDynamicSQLReaderPostgreSQLWriter(readConn *sql.DB, writeConn *sql.DB, sq
 
 // ProcessData uses SQLReader methods for processing data - this works via composition
 func (s *SQLReaderPostgreSQLWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
-	s.ForEachQueryData(d, killChan, func(d etldata.Payload) {
+	s.ProcessDataContext(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataContext is the same as ProcessData, but the query is cancelled
+// along with the pipeline's context. See ContextProcessor.
+func (s *SQLReaderPostgreSQLWriter) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	s.ForEachQueryDataContext(ctx, d, killChan, func(d etldata.Payload) {
 		s.PostgreSQLWriter.ProcessData(d, outputChan, killChan)
 		outputChan <- d
 	})
 }
 
-// Finish - see interface for documentation.
+// Finish commits the PostgreSQLWriter's transaction, if its Transaction is set.
+// Abort is also that of the PostgreSQLWriter.
 func (s *SQLReaderPostgreSQLWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	s.PostgreSQLWriter.Finish(outputChan, killChan)
 }
 
 func (s *SQLReaderPostgreSQLWriter) String() string {
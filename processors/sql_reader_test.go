@@ -0,0 +1,81 @@
+package processors
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/teambenny/goetl/etldata"
+)
+
+func TestSQLReaderCheckpoint(t *testing.T) {
+	for _, typed := range []bool{false, true} {
+		name := "JSON"
+		if typed {
+			name = "Records"
+		}
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			mock.ExpectPrepare("SELECT id FROM orders ORDER BY id").ExpectQuery().
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+			mock.ExpectPrepare("SELECT id FROM orders WHERE id > \\? ORDER BY id").ExpectQuery().WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+
+			newReader := func() *SQLReader {
+				r := NewSQLReader(db, "SELECT id FROM orders ORDER BY id")
+				r.BatchSize = 2
+				r.TypedRecords = typed
+				r.KeyColumn = "id"
+				r.ResumeQuery = "SELECT id FROM orders WHERE id > ? ORDER BY id"
+				return r
+			}
+			r := newReader()
+			if state, err := r.Checkpoint(); state != nil || err != nil {
+				t.Errorf("Checkpoint before reading = %s, %v", state, err)
+			}
+			if _, err := readAll(r); err != nil {
+				t.Fatal(err)
+			}
+			state, err := r.Checkpoint()
+			if err != nil || string(state) != "3" {
+				t.Fatalf("Checkpoint = %s, %v", state, err)
+			}
+
+			r = newReader()
+			if err := r.Restore(state); err != nil {
+				t.Fatal(err)
+			}
+			sent, err := readAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range sent {
+				got = append(got, string(etldata.JSON(d.Bytes())))
+			}
+			if want := []string{`[{"id":4}]`}; !reflect.DeepEqual(got, want) {
+				t.Errorf("sent %q, want %q", got, want)
+			}
+			if state, _ := r.Checkpoint(); string(state) != "4" {
+				t.Errorf("Checkpoint = %s, want 4", state)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Without a ResumeQuery, nothing is saved.
+	r := NewSQLReader(nil, "SELECT id FROM orders")
+	r.KeyColumn = "id"
+	if state, err := r.Checkpoint(); state != nil || err != nil {
+		t.Errorf("Checkpoint = %s, %v", state, err)
+	}
+	if err := r.Restore([]byte("{")); err == nil {
+		t.Error("no error restoring an invalid checkpoint")
+	}
+}
@@ -0,0 +1,88 @@
+package processors
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// sqlWriterTx is the transaction a SQL writer writes within when its
+// Transaction option is set. It is begun by the first write, and ended by
+// Finish (commit) or Abort (rollback). See MySQLWriter.Transaction.
+//
+// It also counts the payloads written, for the writer's Acknowledged: those
+// written within the transaction only count once it is committed, and none
+// count after a write has failed.
+type sqlWriterTx struct {
+	mutex   sync.Mutex
+	tx      *sql.Tx
+	pending int
+	written int
+	failed  bool
+}
+
+// begin returns the transaction, beginning it on the first call.
+func (t *sqlWriterTx) begin(db *sql.DB) (*sql.Tx, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.tx == nil {
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		t.tx = tx
+	}
+	return t.tx, nil
+}
+
+// commit commits the transaction, if one was begun.
+func (t *sqlWriterTx) commit() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.tx == nil {
+		return nil
+	}
+	err := t.tx.Commit()
+	t.tx = nil
+	if err != nil {
+		t.failed = true
+	} else if !t.failed {
+		t.written += t.pending
+	}
+	t.pending = 0
+	return err
+}
+
+// rollback rolls the transaction back, if one was begun.
+func (t *sqlWriterTx) rollback() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.tx == nil {
+		return nil
+	}
+	err := t.tx.Rollback()
+	t.tx = nil
+	t.pending = 0
+	return err
+}
+
+// wrote counts a payload written, or not written if err is not nil.
+func (t *sqlWriterTx) wrote(inTx bool, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	switch {
+	case err != nil:
+		t.failed = true
+	case t.failed:
+	case inTx:
+		t.pending++
+	default:
+		t.written++
+	}
+}
+
+// acknowledged returns the number of payloads written for good.
+func (t *sqlWriterTx) acknowledged() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.written
+}
@@ -0,0 +1,142 @@
+package processors
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/teambenny/goetl/etldata"
+)
+
+// sqlTxWriter is a SQL writer that can write within a transaction.
+type sqlTxWriter interface {
+	ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error)
+	Finish(outputChan chan etldata.Payload, killChan chan error)
+	Abort(err error)
+	Acknowledged() int
+}
+
+func TestSQLWriterTransaction(t *testing.T) {
+	writers := []struct {
+		name   string
+		writer func(db *sql.DB, transaction bool) sqlTxWriter
+	}{
+		{
+			name: "MySQLWriter",
+			writer: func(db *sql.DB, transaction bool) sqlTxWriter {
+				w := NewMySQLWriter(db, "orders")
+				w.Transaction = transaction
+				return w
+			},
+		},
+		{
+			name: "PostgreSQLWriter",
+			writer: func(db *sql.DB, transaction bool) sqlTxWriter {
+				w := NewPostgreSQLWriter(db, "orders")
+				w.Transaction = transaction
+				return w
+			},
+		},
+	}
+	tests := []struct {
+		name        string
+		transaction bool
+		abort       bool
+		expect      func(mock sqlmock.Sqlmock)
+		wantAcked   int
+		wantErr     bool
+	}{
+		{
+			name:        "committed by Finish",
+			transaction: true,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectPrepare("INSERT INTO orders").ExpectExec().WillReturnResult(sqlmock.NewResult(1, 2))
+				mock.ExpectPrepare("INSERT INTO orders").ExpectExec().WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+			},
+			wantAcked: 2,
+		},
+		{
+			name:        "rolled back by Abort",
+			transaction: true,
+			abort:       true,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectPrepare("INSERT INTO orders").ExpectExec().WillReturnResult(sqlmock.NewResult(1, 2))
+				mock.ExpectPrepare("INSERT INTO orders").ExpectExec().WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:  "without a transaction",
+			abort: true,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPrepare("INSERT INTO orders").ExpectExec().WillReturnResult(sqlmock.NewResult(1, 2))
+				mock.ExpectPrepare("INSERT INTO orders").ExpectExec().WillReturnResult(sqlmock.NewResult(2, 1))
+			},
+			wantAcked: 2,
+		},
+		{
+			name: "failing a write",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPrepare("INSERT INTO orders").ExpectExec().WillReturnError(errors.New("failed"))
+				mock.ExpectPrepare("INSERT INTO orders").ExpectExec().WillReturnResult(sqlmock.NewResult(2, 1))
+			},
+			wantErr: true,
+		},
+	}
+	for _, wt := range writers {
+		for _, tt := range tests {
+			t.Run(wt.name+" "+tt.name, func(t *testing.T) {
+				db, mock, err := sqlmock.New()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer db.Close()
+				tt.expect(mock)
+				w := wt.writer(db, tt.transaction)
+				killChan := make(chan error, 1)
+				w.ProcessData(etldata.JSON(`[{"id":1},{"id":2}]`), nil, killChan)
+				w.ProcessData(etldata.JSON(`{"id":3}`), nil, killChan)
+				if tt.abort {
+					w.Abort(errors.New("failed"))
+				} else {
+					w.Finish(nil, killChan)
+				}
+				if len(killChan) > 0 != tt.wantErr {
+					t.Fatalf("%d errors", len(killChan))
+				}
+				if acked := w.Acknowledged(); acked != tt.wantAcked {
+					t.Errorf("Acknowledged = %d, want %d", acked, tt.wantAcked)
+				}
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+func TestRedshiftWriterAbort(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewRedshiftWriter(tx, nil, "orders", "bucket", "prefix")
+	w.Abort(errors.New("failed"))
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	// A transaction that has already ended is left alone.
+	w.Abort(errors.New("failed"))
+	NewRedshiftWriter(nil, nil, "orders", "bucket", "prefix").Abort(errors.New("failed"))
+}
@@ -0,0 +1,36 @@
+package processors
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// tableSchemaCheck checks an etldata.Schema against each table a SQL writer
+// writes to, the first time it writes to it. See MySQLWriter.Schema.
+type tableSchemaCheck struct {
+	mutex   sync.Mutex
+	checked map[string]error
+}
+
+func (c *tableSchemaCheck) check(db *sql.DB, schema *etldata.Schema, tableName string, columns func(*sql.DB, string) ([]etlutil.TableColumn, error)) error {
+	if schema == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err, ok := c.checked[tableName]; ok {
+		return err
+	}
+	cols, err := columns(db, tableName)
+	if err == nil {
+		err = etlutil.CheckTableSchema(schema, tableName, cols)
+	}
+	if c.checked == nil {
+		c.checked = make(map[string]error)
+	}
+	c.checked[tableName] = err
+	return err
+}
@@ -0,0 +1,143 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// XLSXReader reads the rows of a sheet of the Excel workbooks (.xlsx files)
+// it receives into JSON objects, and sends them on in batches of up to
+// BatchSize objects (as JSON arrays). It is meant to follow a reader
+// sending the raw contents of files, such as FileReader, or an IoReader,
+// SftpReader or S3Reader with LineByLine set to false. The payloads from
+// each source (told apart by their etldata.Metadata) are joined back
+// together, and since a workbook is a zip file, whose directory is at its
+// end, each workbook is held in memory and read once all of the data has
+// been received. The rows of the sheet are then streamed.
+//
+// The keys of the objects are the values of the first row of the sheet,
+// unless Header is set, in which case every row is data. Columns with no
+// key are skipped, as are empty rows. Empty cells are null, numbers are
+// sent as they are written in the workbook, and dates and times as
+// etldata.SQLTime, or as time.Time if TypedRecords is set.
+type XLSXReader struct {
+	Sheet        string // the name of the sheet to read, defaults to the first one
+	Header       []string
+	BatchSize    int  // defaults to 1000, and if 0 each object is sent on its own (as Records of one row with TypedRecords)
+	TypedRecords bool // send etldata.Records instead of etldata.JSON, see SQLReader.TypedRecords
+
+	sources map[string]*xlsxSource
+	order   []string // sources in the order they were first seen
+}
+
+// xlsxSource holds what has been received from a single source.
+type xlsxSource struct {
+	data  []byte
+	md    etldata.Metadata
+	batch []map[string]interface{}
+}
+
+// NewXLSXReader returns a new XLSXReader reading the first sheet of each
+// workbook, with a header row.
+func NewXLSXReader() *XLSXReader {
+	return &XLSXReader{BatchSize: 1000}
+}
+
+// ProcessData holds on to the data until the whole workbook has been
+// received.
+func (r *XLSXReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	md := etldata.MetadataOf(d)
+	key := sourceKey(md)
+	if r.sources == nil {
+		r.sources = make(map[string]*xlsxSource)
+	}
+	src, ok := r.sources[key]
+	if !ok {
+		src = &xlsxSource{}
+		r.sources[key] = src
+		r.order = append(r.order, key)
+	}
+	if md != nil {
+		src.md = md.Clone()
+		delete(src.md, etldata.MetadataLine)
+		delete(src.md, etldata.MetadataLineByLine)
+	}
+	src.data = append(src.data, d.Bytes()...)
+}
+
+// Finish reads each workbook, and sends its rows.
+func (r *XLSXReader) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	for _, key := range r.order {
+		if err := r.read(r.sources[key], outputChan); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+		delete(r.sources, key)
+	}
+	r.sources, r.order = nil, nil
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that the data of
+// each workbook is read on its own.
+func (r *XLSXReader) ReadsMetadata() bool {
+	return true
+}
+
+func (r *XLSXReader) String() string {
+	return "XLSXReader"
+}
+
+func (r *XLSXReader) read(src *xlsxSource, outputChan chan etldata.Payload) error {
+	xr, err := etlutil.NewXLSXReader(bytes.NewReader(src.data), int64(len(src.data)))
+	if err != nil {
+		return fmt.Errorf("XLSXReader: %v", err)
+	}
+	header := r.Header
+	err = xr.ReadRows(r.Sheet, func(row []interface{}) error {
+		if header == nil {
+			header = make([]string, len(row))
+			for i, v := range row {
+				if v != nil {
+					header[i] = strings.TrimSpace(fmt.Sprint(v))
+				}
+			}
+			return nil
+		}
+		o := make(map[string]interface{}, len(header))
+		for i, k := range header {
+			if k == "" {
+				continue
+			}
+			var v interface{}
+			if i < len(row) {
+				v = row[i]
+			}
+			if t, ok := v.(time.Time); ok && !r.TypedRecords {
+				v = etldata.SQLTime{Time: t}
+			}
+			o[k] = v
+		}
+		src.batch = append(src.batch, o)
+		if len(src.batch) >= r.BatchSize {
+			return r.send(src, outputChan)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("XLSXReader: %v", err)
+	}
+	src.data = nil
+	return r.send(src, outputChan)
+}
+
+// send sends the batch of objects read so far.
+func (r *XLSXReader) send(src *xlsxSource, outputChan chan etldata.Payload) error {
+	err := sendObjects(src.batch, src.md, r.BatchSize, r.TypedRecords, outputChan)
+	src.batch = nil
+	return err
+}
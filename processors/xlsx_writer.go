@@ -0,0 +1,128 @@
+package processors
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// XLSXWriter writes the objects it receives (see Payload.Objects) as the
+// rows of an Excel workbook (an .xlsx file), which is written in Finish.
+// The workbook is written to Writer, such as a local file or an
+// etlutil.S3ObjectWriter, or if Writer is nil it is sent on, so that it can
+// be written by an IoWriter, SftpWriter or S3Writer (with its LineSeparator
+// set to "").
+//
+// Objects are written to the sheet named Sheet, or to split them over
+// several sheets, set SheetMetadata to an etldata.Metadata key: each
+// payload is then written to the sheet named by that key's value, or to
+// Sheet if the payload does not have it. Like CSVParameters.Header, Header
+// gives the order of the columns, and defaults to the sorted keys of the
+// first object written to each sheet. The header row is written at the
+// top of each sheet unless WriteHeader is false.
+type XLSXWriter struct {
+	Writer        io.Writer
+	Sheet         string // defaults to "Sheet1"
+	SheetMetadata string
+	Header        []string
+	WriteHeader   bool
+
+	workbook *etlutil.XLSXWriter
+	buf      bytes.Buffer        // what is sent on if Writer is nil
+	headers  map[string][]string // the header of each sheet
+}
+
+// NewXLSXWriter returns a new XLSXWriter wrapping the given io.Writer
+// object, which can be nil.
+func NewXLSXWriter(w io.Writer) *XLSXWriter {
+	return &XLSXWriter{Writer: w, Sheet: "Sheet1", WriteHeader: true}
+}
+
+// ProcessData adds the objects to their sheet.
+func (w *XLSXWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	objects, err := d.Objects()
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if len(objects) == 0 {
+		return
+	}
+	sheet := w.Sheet
+	if w.SheetMetadata != "" {
+		if s := etldata.MetadataOf(d)[w.SheetMetadata]; s != "" {
+			sheet = s
+		}
+	}
+	w.open()
+	header, ok := w.headers[sheet]
+	if !ok {
+		header = w.Header
+		if header == nil {
+			for k := range objects[0] {
+				header = append(header, k)
+			}
+			sort.Strings(header)
+		}
+		w.headers[sheet] = header
+		if w.WriteHeader {
+			row := make([]interface{}, len(header))
+			for i, k := range header {
+				row[i] = k
+			}
+			if err := w.workbook.WriteRow(sheet, row); err != nil {
+				etlutil.KillPipelineIfErr(err, killChan)
+				return
+			}
+		}
+	}
+	row := make([]interface{}, len(header))
+	for _, o := range objects {
+		for i, k := range header {
+			row[i] = o[k]
+		}
+		if err := w.workbook.WriteRow(sheet, row); err != nil {
+			etlutil.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+}
+
+// Finish writes the workbook.
+func (w *XLSXWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	w.open()
+	if err := w.workbook.Close(); err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if w.buf.Len() > 0 {
+		outputChan <- etldata.JSON(append([]byte(nil), w.buf.Bytes()...))
+		w.buf.Reset()
+	}
+	w.workbook, w.headers = nil, nil
+}
+
+// ReadsMetadata implements goetl.MetadataProcessor, so that SheetMetadata
+// can name the sheet of each payload.
+func (w *XLSXWriter) ReadsMetadata() bool {
+	return true
+}
+
+func (w *XLSXWriter) open() {
+	if w.workbook != nil {
+		return
+	}
+	out := w.Writer
+	if out == nil {
+		out = &w.buf
+	}
+	w.workbook = etlutil.NewXLSXWriter(out)
+	w.headers = make(map[string][]string)
+}
+
+func (w *XLSXWriter) String() string {
+	return "XLSXWriter"
+}
@@ -0,0 +1,110 @@
+package processors
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+func TestXLSXWriterAndReader(t *testing.T) {
+	returns := etldata.Metadata{"sheet": "Returns"}
+	input := []etldata.Payload{
+		etldata.JSON(`[{"id":1,"name":"a","at":"x"},{"id":2,"name":null}]`),
+		etldata.WithMetadata(etldata.JSON(`{"id":3,"reason":"broken"}`), returns),
+		etldata.NewRecords([]map[string]interface{}{{"id": 4, "name": "d", "at": etldata.SQLTime{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}}}),
+	}
+	tests := []struct {
+		name  string
+		setup func(w *XLSXWriter, r *XLSXReader)
+		want  []string
+	}{
+		{
+			name: "first sheet",
+			want: []string{`[{"at":"x","id":1,"name":"a"},{"at":null,"id":2,"name":null},{"at":"2024-01-02 03:04:05","id":4,"name":"d"}]`},
+		},
+		{
+			name:  "sheet from metadata",
+			setup: func(w *XLSXWriter, r *XLSXReader) { r.Sheet = "Returns" },
+			want:  []string{`[{"id":3,"reason":"broken"}]`},
+		},
+		{
+			name: "header, in batches",
+			setup: func(w *XLSXWriter, r *XLSXReader) {
+				w.Header = []string{"name", "id"}
+				r.BatchSize = 2
+			},
+			want: []string{`[{"id":1,"name":"a"},{"id":2,"name":null}]`, `[{"id":4,"name":"d"}]`},
+		},
+		{
+			name: "no header row",
+			setup: func(w *XLSXWriter, r *XLSXReader) {
+				w.Header = []string{"id"}
+				w.WriteHeader = false
+				r.Header = []string{"n", ""}
+				r.BatchSize = 0
+			},
+			want: []string{`{"n":1}`, `{"n":2}`, `{"n":4}`},
+		},
+		{
+			// The row of the object without "at" is empty, and is skipped.
+			name:  "typed records",
+			setup: func(w *XLSXWriter, r *XLSXReader) { w.Header = []string{"at"}; r.TypedRecords = true },
+			want:  []string{`[{"at":"x"},{"at":"2024-01-02T03:04:05Z"}]`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, r := NewXLSXWriter(nil), NewXLSXReader()
+			w.SheetMetadata = "sheet"
+			if tt.setup != nil {
+				tt.setup(w, r)
+			}
+			workbook, err := processAll(w, input...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(workbook) != 1 {
+				t.Fatalf("XLSXWriter sent %d payloads", len(workbook))
+			}
+			sent, err := processAll(r, workbook...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range sent {
+				got = append(got, string(d.Bytes()))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXLSXReaderErrors(t *testing.T) {
+	workbook, err := processAll(NewXLSXWriter(nil), etldata.JSON(`{"id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		sheet   string
+		d       etldata.Payload
+		wantErr string
+	}{
+		{name: "not a workbook", d: etldata.JSON("id,name\n"), wantErr: "XLSXReader: xlsx: zip: not a valid zip file"},
+		{name: "missing sheet", sheet: "Other", d: workbook[0], wantErr: "XLSXReader: xlsx: no such sheet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewXLSXReader()
+			r.Sheet = tt.sheet
+			_, err := processAll(r, tt.d)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// XMLReader reads the elements at Path, such as "/Orders/Order", from an
+// XML document in an io.Reader, and sends them on as JSON objects in
+// batches of up to BatchSize objects (as JSON arrays). The document is
+// decoded as a stream, so only one batch is held in memory at a time.
+//
+// Each path segment is the name of an element, or "*" for any element.
+// Namespaces are ignored, so elements and attributes are known by their
+// local names.
+//
+// The attributes of an element are keyed by their name after
+// AttributePrefix, and its child elements by their name. A child with no
+// attributes or children of its own is its text, or null if it is empty,
+// and any other child is an object in turn. Children that are repeated
+// become arrays, as do those named in Arrays, even when they appear once.
+// Text next to attributes or children is keyed by TextKey. All values are
+// strings: XML does not tell numbers from text.
+//
+// Compressed documents are read as by IoReader, and each file of a zip
+// archive is read as a separate document. Every payload sent carries
+// etldata.Metadata with the time it was read, and anything set in Metadata.
+type XMLReader struct {
+	Reader          io.Reader
+	Path            string
+	AttributePrefix string           // defaults to "@"
+	TextKey         string           // defaults to "#text"
+	Arrays          []string         // child elements that are always arrays
+	BatchSize       int              // defaults to 1000, and if 0 each object is sent on its own, not in an array
+	Gzipped         bool             // the same as setting Compression to "gzip"
+	Compression     string           // a codec name, or "auto", see IoReader
+	Metadata        etldata.Metadata // added to the Metadata of every payload
+}
+
+// NewXMLReader returns a new XMLReader reading the elements at the given
+// path from reader.
+func NewXMLReader(reader io.Reader, path string) *XMLReader {
+	return &XMLReader{Reader: reader, Path: path, AttributePrefix: "@", TextKey: "#text", BatchSize: 1000}
+}
+
+// ProcessData reads all of the elements, sending them in batches.
+func (r *XMLReader) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	r.ProcessDataContext(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataContext is the same as ProcessData, but stops reading once the
+// pipeline's context is done. See ContextProcessor.
+func (r *XMLReader) ProcessDataContext(ctx context.Context, d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	err := r.read(etlutil.NewContextReader(ctx, r.Reader), outputChan)
+	if err != nil && ctx.Err() == nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+	}
+}
+
+func (r *XMLReader) read(reader io.Reader, outputChan chan etldata.Payload) error {
+	if !strings.HasPrefix(r.Path, "/") || strings.HasSuffix(r.Path, "/") {
+		return fmt.Errorf("XMLReader: path %q must be the absolute path of an element, such as /Orders/Order", r.Path)
+	}
+	path := strings.Split(r.Path[1:], "/")
+	md := r.Metadata.Clone()
+	if md == nil {
+		md = etldata.Metadata{}
+	}
+	md[etldata.MetadataIngestedAt] = ingestedAt()
+	return forEachStream(reader, r.Compression, r.Gzipped, md, func(reader io.Reader, md etldata.Metadata) error {
+		return r.readStream(reader, path, md, outputChan)
+	})
+}
+
+// readStream reads the elements of a single document.
+func (r *XMLReader) readStream(reader io.Reader, path []string, md etldata.Metadata, outputChan chan etldata.Payload) error {
+	batch := &jsonBatch{name: r.String(), size: r.BatchSize, md: md, outputChan: outputChan}
+
+	dec := xml.NewDecoder(reader)
+	dec.CharsetReader = xmlCharsetReader
+	var stack []string // the names of the open elements
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("XMLReader: after element %d: %v", batch.count, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if !matchXMLPath(path, stack) {
+				continue
+			}
+			o, text, err := r.element(dec, t)
+			if err != nil {
+				return fmt.Errorf("XMLReader: element %d: %v", batch.count+1, err)
+			}
+			if text = strings.TrimSpace(text); text != "" {
+				o[r.TextKey] = text
+			}
+			js, err := json.Marshal(o)
+			if err != nil {
+				return err
+			}
+			batch.count++
+			batch.add(js)
+			stack = stack[:len(stack)-1]
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	batch.flush()
+	return nil
+}
+
+// Finish - see interface for documentation.
+func (r *XMLReader) Finish(outputChan chan etldata.Payload, killChan chan error) {
+}
+
+func (r *XMLReader) String() string {
+	return "XMLReader"
+}
+
+func matchXMLPath(path, stack []string) bool {
+	if len(path) != len(stack) {
+		return false
+	}
+	for i, name := range path {
+		if name != "*" && name != stack[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// element decodes the rest of the element that start opens, returning its
+// attributes and children, and its text.
+func (r *XMLReader) element(dec *xml.Decoder, start xml.StartElement) (map[string]interface{}, string, error) {
+	o := make(map[string]interface{})
+	for _, a := range start.Attr {
+		if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+			continue
+		}
+		o[r.AttributePrefix+a.Name.Local] = a.Value
+	}
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, "", io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, childText, err := r.element(dec, t)
+			if err != nil {
+				return nil, "", err
+			}
+			v := r.value(child, childText)
+			name := t.Name.Local
+			if existing, ok := o[name]; ok {
+				if list, ok := existing.([]interface{}); ok {
+					o[name] = append(list, v)
+				} else {
+					o[name] = []interface{}{existing, v}
+				}
+			} else if containsString(r.Arrays, name) {
+				o[name] = []interface{}{v}
+			} else {
+				o[name] = v
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			return o, text.String(), nil
+		}
+	}
+}
+
+// value returns the value of a child element.
+func (r *XMLReader) value(o map[string]interface{}, text string) interface{} {
+	if len(o) == 0 {
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		return text
+	}
+	if text = strings.TrimSpace(text); text != "" {
+		o[r.TextKey] = text
+	}
+	return o
+}
+
+// xmlCharsetReader decodes the documents that are not in UTF-8 but in
+// Latin-1, which is all that encoding/xml needs help with for most feeds.
+func xmlCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1", "us-ascii", "ascii":
+		return &latin1Reader{r: input}, nil
+	}
+	return nil, errors.New("unsupported charset " + charset)
+}
+
+// latin1Reader converts Latin-1 text to UTF-8.
+type latin1Reader struct {
+	r       io.Reader
+	pending []byte // converted text that has not been read yet
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	if len(l.pending) == 0 {
+		buf := make([]byte, len(p)/2+1)
+		n, err := l.r.Read(buf)
+		if n == 0 {
+			return 0, err
+		}
+		for _, c := range buf[:n] {
+			l.pending = append(l.pending, string(rune(c))...)
+		}
+	}
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,219 @@
+package processors
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+func TestXMLReader(t *testing.T) {
+	const orders = `<?xml version="1.0"?>
+<Orders xmlns="urn:orders" xmlns:x="urn:x">
+  <Order id="1" x:status="new">
+    <Customer vip="yes">Ann</Customer>
+    <Note/>
+    <Item><Sku>A</Sku></Item>
+    <Item><Sku>B</Sku><Qty>2</Qty></Item>
+    <Tag>gift</Tag>
+  </Order>
+  <Order id="2">paid<Item><Sku>C</Sku></Item></Order>
+  <Other><Order id="3"/></Other>
+</Orders>`
+	tests := []struct {
+		name    string
+		input   string
+		path    string
+		setup   func(r *XMLReader)
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "elements at path",
+			input: orders,
+			path:  "/Orders/Order",
+			want: []string{
+				`[{"@id":"1","@status":"new","Customer":{"#text":"Ann","@vip":"yes"},"Item":[{"Sku":"A"},{"Qty":"2","Sku":"B"}],"Note":null,"Tag":"gift"},` +
+					`{"#text":"paid","@id":"2","Item":{"Sku":"C"}}]`,
+			},
+		},
+		{
+			name:  "wildcard, arrays and keys",
+			input: orders,
+			path:  "/Orders/*/Order",
+			setup: func(r *XMLReader) {
+				r.AttributePrefix = "_"
+				r.Arrays = []string{"Item"}
+			},
+			want: []string{`[{"_id":"3"}]`},
+		},
+		{
+			name:  "arrays, each element on its own",
+			input: orders,
+			path:  "/Orders/Order",
+			setup: func(r *XMLReader) {
+				r.Arrays = []string{"Item", "Tag"}
+				r.TextKey = "value"
+				r.BatchSize = 0
+			},
+			want: []string{
+				`{"@id":"1","@status":"new","Customer":{"@vip":"yes","value":"Ann"},"Item":[{"Sku":"A"},{"Qty":"2","Sku":"B"}],"Note":null,"Tag":["gift"]}`,
+				`{"@id":"2","Item":[{"Sku":"C"}],"value":"paid"}`,
+			},
+		},
+		{
+			name:  "batches",
+			input: "<a><b>1</b><b>2</b><b>3</b></a>",
+			path:  "/a/b",
+			setup: func(r *XMLReader) { r.BatchSize = 2 },
+			want:  []string{`[{"#text":"1"},{"#text":"2"}]`, `[{"#text":"3"}]`},
+		},
+		{
+			name:  "Latin-1",
+			input: "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a><b>caf\xe9</b></a>",
+			path:  "/a",
+			want:  []string{`[{"b":"café"}]`},
+		},
+		{
+			name:  "no match",
+			input: orders,
+			path:  "/Order",
+		},
+		{
+			name:    "invalid path",
+			input:   orders,
+			path:    "Orders/Order",
+			wantErr: `XMLReader: path "Orders/Order" must be the absolute path of an element, such as /Orders/Order`,
+		},
+		{
+			name:    "unterminated element",
+			input:   "<a><b>1</b><b>2",
+			path:    "/a/b",
+			wantErr: "XMLReader: element 2: XML syntax error on line 1: unexpected EOF",
+		},
+		{
+			name:    "invalid XML",
+			input:   "<a><b>1</b></c>",
+			path:    "/a/b",
+			wantErr: "XMLReader: after element 1: XML syntax error on line 1: element <a> closed by </c>",
+		},
+		{
+			name:    "unsupported charset",
+			input:   `<?xml version="1.0" encoding="EBCDIC"?><a/>`,
+			path:    "/a",
+			wantErr: `XMLReader: after element 0: xml: opening charset "EBCDIC": unsupported charset EBCDIC`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewXMLReader(strings.NewReader(tt.input), tt.path)
+			r.Metadata = etldata.Metadata{etldata.MetadataTable: "orders"}
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			sent, err := readAll(r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range sent {
+				got = append(got, string(d.Bytes()))
+				if md := etldata.MetadataOf(d); md[etldata.MetadataTable] != "orders" || md[etldata.MetadataIngestedAt] == "" {
+					t.Errorf("metadata = %v", md)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXMLWriter(t *testing.T) {
+	input := []etldata.Payload{
+		etldata.JSON(`[{"@id":"1","Customer":{"@vip":"yes","#text":"A & B"},"Item":[{"Sku":"A"},{"Sku":"B"}],"Note":null,"@skip":null}]`),
+		etldata.JSON(`{"@id":2,"#text":"paid","Empty":{}}`),
+	}
+	tests := []struct {
+		name  string
+		setup func(w *XMLWriter)
+		want  string
+	}{
+		{
+			name: "defaults",
+			want: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<Rows><Row id="1"><Customer vip="yes">A &amp; B</Customer><Item><Sku>A</Sku></Item><Item><Sku>B</Sku></Item><Note/></Row>` +
+				`<Row id="2">paid<Empty/></Row></Rows>` + "\n",
+		},
+		{
+			name: "names and indent",
+			setup: func(w *XMLWriter) {
+				w.Root, w.Row, w.Indent = "Orders", "Order", "  "
+			},
+			want: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				"<Orders>\n" +
+				"  <Order id=\"1\">\n    <Customer vip=\"yes\">A &amp; B</Customer>\n    <Item>\n      <Sku>A</Sku>\n    </Item>\n    <Item>\n      <Sku>B</Sku>\n    </Item>\n    <Note/>\n  </Order>\n" +
+				"  <Order id=\"2\">paid\n    <Empty/>\n  </Order>\n" +
+				"</Orders>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Sent on, and written.
+			w := NewXMLWriter(nil)
+			if tt.setup != nil {
+				tt.setup(w)
+			}
+			sent, err := processAll(w, input...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			for _, d := range sent {
+				got.Write(d.Bytes())
+			}
+			if got.String() != tt.want {
+				t.Errorf("sent\n%s\nwant\n%s", got.String(), tt.want)
+			}
+
+			var buf bytes.Buffer
+			w.Writer = &buf
+			if _, err := processAll(w, input...); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("wrote\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+
+	// What is written can be read back.
+	var buf bytes.Buffer
+	if _, err := processAll(NewXMLWriter(&buf), input...); err != nil {
+		t.Fatal(err)
+	}
+	r := NewXMLReader(&buf, "/Rows/Row")
+	r.Arrays = []string{"Item"}
+	sent, err := readAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"@id":"1","Customer":{"#text":"A \u0026 B","@vip":"yes"},"Item":[{"Sku":"A"},{"Sku":"B"}],"Note":null},{"#text":"paid","@id":"2","Empty":null}]`
+	if len(sent) != 1 || string(sent[0].Bytes()) != want {
+		t.Errorf("read back %s, want %s", sent[0].Bytes(), want)
+	}
+
+	for _, d := range []string{`{"1a":"x"}`, `{"@a b":"x"}`} {
+		if _, err := processAll(NewXMLWriter(nil), etldata.JSON(d)); err == nil || !strings.HasPrefix(err.Error(), "XMLWriter: ") {
+			t.Errorf("error for %s = %v", d, err)
+		}
+	}
+}
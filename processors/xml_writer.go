@@ -0,0 +1,213 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/etlutil"
+)
+
+// XMLWriter writes the objects it receives (see Payload.Objects) as an XML
+// document, the reverse of XMLReader: each object is a Row element inside
+// a single Root element. The document is written to Writer, or if Writer
+// is nil the XML of each payload is sent on, so that it can be written by
+// an IoWriter, SftpWriter or S3Writer (with its LineSeparator set to "").
+//
+// Keys starting with AttributePrefix are written as attributes of their
+// element, and the value of TextKey as its text. Other keys are child
+// elements, in sorted order: objects are written as elements in turn, each
+// value of an array as an element with the array's name, and null as an
+// empty element. Every key must be a valid XML name.
+type XMLWriter struct {
+	Writer          io.Writer
+	Root            string // defaults to "Rows"
+	Row             string // defaults to "Row"
+	AttributePrefix string // defaults to "@"
+	TextKey         string // defaults to "#text"
+	Indent          string // indents each level of elements, which are all on one line if empty
+
+	started bool
+}
+
+// NewXMLWriter returns a new XMLWriter wrapping the given io.Writer object,
+// which can be nil.
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	return &XMLWriter{Writer: w, Root: "Rows", Row: "Row", AttributePrefix: "@", TextKey: "#text"}
+}
+
+// ProcessData writes the objects, starting the document if need be.
+func (w *XMLWriter) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	objects, err := d.Objects()
+	if err != nil {
+		etlutil.KillPipelineIfErr(err, killChan)
+		return
+	}
+	var buf bytes.Buffer
+	w.start(&buf)
+	for _, o := range objects {
+		if err := w.element(&buf, w.Row, o, 1); err != nil {
+			etlutil.KillPipelineIfErr(fmt.Errorf("XMLWriter: %v", err), killChan)
+			return
+		}
+	}
+	etlutil.KillPipelineIfErr(w.write(buf.Bytes(), outputChan), killChan)
+}
+
+// Finish ends the document.
+func (w *XMLWriter) Finish(outputChan chan etldata.Payload, killChan chan error) {
+	var buf bytes.Buffer
+	w.start(&buf)
+	w.newline(&buf, 0)
+	fmt.Fprintf(&buf, "</%s>\n", w.Root)
+	w.started = false
+	etlutil.KillPipelineIfErr(w.write(buf.Bytes(), outputChan), killChan)
+}
+
+func (w *XMLWriter) String() string {
+	return "XMLWriter"
+}
+
+func (w *XMLWriter) start(buf *bytes.Buffer) {
+	if w.started {
+		return
+	}
+	w.started = true
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(buf, "<%s>", w.Root)
+}
+
+func (w *XMLWriter) write(data []byte, outputChan chan etldata.Payload) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if w.Writer == nil {
+		outputChan <- etldata.JSON(data)
+		return nil
+	}
+	_, err := w.Writer.Write(data)
+	return err
+}
+
+// newline starts a new line at the given depth, if indenting.
+func (w *XMLWriter) newline(buf *bytes.Buffer, depth int) {
+	if w.Indent != "" {
+		buf.WriteByte('\n')
+		buf.WriteString(strings.Repeat(w.Indent, depth))
+	}
+}
+
+// element writes an element with the given name and value.
+func (w *XMLWriter) element(buf *bytes.Buffer, name string, v interface{}, depth int) error {
+	if !isXMLName(name) {
+		return fmt.Errorf("%q is not a valid element name", name)
+	}
+	if list, ok := v.([]interface{}); ok {
+		for _, item := range list {
+			if err := w.element(buf, name, item, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w.newline(buf, depth)
+	o, ok := v.(map[string]interface{})
+	if !ok {
+		if v == nil {
+			fmt.Fprintf(buf, "<%s/>", name)
+			return nil
+		}
+		fmt.Fprintf(buf, "<%s>", name)
+		xml.EscapeText(buf, []byte(xmlText(v)))
+		fmt.Fprintf(buf, "</%s>", name)
+		return nil
+	}
+
+	keys := make([]string, 0, len(o))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(buf, "<%s", name)
+	var children []string
+	for _, k := range keys {
+		if w.AttributePrefix == "" || !strings.HasPrefix(k, w.AttributePrefix) {
+			if k != w.TextKey {
+				children = append(children, k)
+			}
+			continue
+		}
+		attr := strings.TrimPrefix(k, w.AttributePrefix)
+		if !isXMLName(attr) {
+			return fmt.Errorf("%q is not a valid attribute name", attr)
+		}
+		if o[k] == nil {
+			continue
+		}
+		fmt.Fprintf(buf, ` %s="`, attr)
+		xml.EscapeText(buf, []byte(xmlText(o[k])))
+		buf.WriteByte('"')
+	}
+	text, hasText := o[w.TextKey]
+	if len(children) == 0 && (!hasText || text == nil) {
+		buf.WriteString("/>")
+		return nil
+	}
+	buf.WriteByte('>')
+	if hasText && text != nil {
+		xml.EscapeText(buf, []byte(xmlText(text)))
+	}
+	for _, k := range children {
+		if err := w.element(buf, k, o[k], depth+1); err != nil {
+			return err
+		}
+	}
+	if len(children) > 0 {
+		w.newline(buf, depth)
+	}
+	fmt.Fprintf(buf, "</%s>", name)
+	return nil
+}
+
+// xmlText returns the text of a value.
+func xmlText(v interface{}) string {
+	switch vv := v.(type) {
+	case string:
+		return vv
+	case json.Number:
+		return string(vv)
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	case time.Time:
+		return vv.Format(time.RFC3339Nano)
+	case []byte:
+		return string(vv)
+	}
+	return fmt.Sprint(v)
+}
+
+// isXMLName reports whether s can be used as the name of an element or
+// attribute.
+func isXMLName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c == '_' || c == ':' || unicode.IsLetter(c) {
+			continue
+		}
+		if i > 0 && (c == '-' || c == '.' || unicode.IsDigit(c)) {
+			continue
+		}
+		return false
+	}
+	return true
+}
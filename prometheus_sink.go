@@ -0,0 +1,236 @@
+package goetl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds (in seconds) of the processing time
+// histogram buckets used by NewPrometheusSink.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// PrometheusSink is a MetricsSink that keeps the latest value of every
+// metric in memory, and serves them in the Prometheus text exposition
+// format, or in the OpenMetrics text format to scrapers that ask for it. It
+// is an http.Handler, so it can be mounted on any server:
+//
+//     sink := goetl.NewPrometheusSink()
+//     http.Handle("/metrics", sink)
+//     go http.ListenAndServe(":9100", nil)
+//
+//     pipeline.Metrics = sink
+//
+// A single PrometheusSink can be shared by several Pipelines, since every
+// series is labelled with the Pipeline's Name.
+type PrometheusSink struct {
+	// Buckets are the histogram bucket upper bounds, in increasing order.
+	// They must not be changed once metrics have been recorded.
+	Buckets []float64
+
+	mutex    sync.Mutex
+	families map[string]*promFamily
+}
+
+type promFamily struct {
+	kind   string // counter, gauge or histogram
+	series map[string]*promSeries
+}
+
+type promSeries struct {
+	labels  string
+	value   float64  // counter or gauge value
+	buckets []uint64 // histogram counts, one per bucket
+	sum     float64
+	count   uint64
+}
+
+// NewPrometheusSink returns a new PrometheusSink using DefaultBuckets.
+func NewPrometheusSink() *PrometheusSink {
+	return &PrometheusSink{
+		Buckets:  DefaultBuckets,
+		families: make(map[string]*promFamily),
+	}
+}
+
+// Counter implements MetricsSink.
+func (s *PrometheusSink) Counter(name string, labels Labels, delta float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.series(name, "counter", labels).value += delta
+}
+
+// Gauge implements MetricsSink.
+func (s *PrometheusSink) Gauge(name string, labels Labels, value float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.series(name, "gauge", labels).value = value
+}
+
+// Histogram implements MetricsSink.
+func (s *PrometheusSink) Histogram(name string, labels Labels, value float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	series := s.series(name, "histogram", labels)
+	if series.buckets == nil {
+		series.buckets = make([]uint64, len(s.Buckets))
+	}
+	for i, le := range s.Buckets {
+		if value <= le {
+			series.buckets[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+// series returns the series for the given labels, creating it if needed.
+// It must be called with the mutex held.
+func (s *PrometheusSink) series(name, kind string, labels Labels) *promSeries {
+	f, ok := s.families[name]
+	if !ok {
+		f = &promFamily{kind: kind, series: make(map[string]*promSeries)}
+		s.families[name] = f
+	}
+	key := formatLabels(labels)
+	series, ok := f.series[key]
+	if !ok {
+		series = &promSeries{labels: key}
+		f.series[key] = series
+	}
+	return series
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format.
+func (s *PrometheusSink) WriteTo(w io.Writer) (int64, error) {
+	return s.write(w, false)
+}
+
+// WriteOpenMetricsTo writes every metric in the OpenMetrics text format,
+// which names counter families without their "_total" suffix and ends with
+// "# EOF".
+func (s *PrometheusSink) WriteOpenMetricsTo(w io.Writer) (int64, error) {
+	return s.write(w, true)
+}
+
+func (s *PrometheusSink) write(w io.Writer, openMetrics bool) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	names := make([]string, 0, len(s.families))
+	for name := range s.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := s.families[name]
+		family := name
+		if openMetrics && f.kind == "counter" {
+			family = strings.TrimSuffix(name, "_total")
+		}
+		if help, ok := metricHelp[name]; ok {
+			fmt.Fprintf(cw, "# HELP %s %s\n", family, help)
+		}
+		fmt.Fprintf(cw, "# TYPE %s %s\n", family, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			series := f.series[key]
+			if f.kind != "histogram" {
+				fmt.Fprintf(cw, "%s%s %s\n", name, braces(series.labels), formatFloat(series.value))
+				continue
+			}
+			for i, le := range s.Buckets {
+				fmt.Fprintf(cw, "%s_bucket%s %d\n", name, braces(joinLabels(series.labels, `le="`+formatFloat(le)+`"`)), series.buckets[i])
+			}
+			fmt.Fprintf(cw, "%s_bucket%s %d\n", name, braces(joinLabels(series.labels, `le="+Inf"`)), series.count)
+			fmt.Fprintf(cw, "%s_sum%s %s\n", name, braces(series.labels), formatFloat(series.sum))
+			fmt.Fprintf(cw, "%s_count%s %d\n", name, braces(series.labels), series.count)
+		}
+	}
+	if openMetrics {
+		fmt.Fprint(cw, "# EOF\n")
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.(*bufio.Writer).Flush()
+}
+
+// ServeHTTP serves the metrics for a Prometheus scrape, in the OpenMetrics
+// text format if the scraper accepts it.
+func (s *PrometheusSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		s.WriteOpenMetricsTo(w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.WriteTo(w)
+}
+
+// formatLabels returns the labels sorted by name, as name="value" pairs.
+func formatLabels(labels Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(labels[name]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,127 @@
+package goetl_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/teambenny/goetl"
+)
+
+func TestPrometheusSinkExposition(t *testing.T) {
+	sink := goetl.NewPrometheusSink()
+	sink.Buckets = []float64{0.1, 1}
+	read := goetl.Labels{"pipeline": "a\"b\\c\nd", "processor": "read"}
+	sink.Counter(goetl.MetricPayloadsReceived, read, 2)
+	sink.Counter(goetl.MetricPayloadsReceived, read, 1.5)
+	sink.Counter(goetl.MetricPayloadsReceived, goetl.Labels{"pipeline": "p", "processor": "filter"}, 1)
+	sink.Gauge(goetl.MetricQueueDepth, goetl.Labels{"from": "read", "to": "write"}, 3)
+	sink.Gauge("custom_gauge", nil, -1)
+	for _, v := range []float64{0.05, 0.5, 5} {
+		sink.Histogram(goetl.MetricProcessingSeconds, goetl.Labels{"processor": "read"}, v)
+	}
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+		want            string
+	}{
+		{
+			name:            "Prometheus",
+			accept:          "text/plain",
+			wantContentType: "text/plain; version=0.0.4; charset=utf-8",
+			want: `# TYPE custom_gauge gauge
+custom_gauge -1
+# HELP goetl_payloads_received_total Payloads received by a processor.
+# TYPE goetl_payloads_received_total counter
+goetl_payloads_received_total{pipeline="a\"b\\c\nd",processor="read"} 3.5
+goetl_payloads_received_total{pipeline="p",processor="filter"} 1
+# HELP goetl_processing_seconds Time spent processing a payload.
+# TYPE goetl_processing_seconds histogram
+goetl_processing_seconds_bucket{processor="read",le="0.1"} 1
+goetl_processing_seconds_bucket{processor="read",le="1"} 2
+goetl_processing_seconds_bucket{processor="read",le="+Inf"} 3
+goetl_processing_seconds_sum{processor="read"} 5.55
+goetl_processing_seconds_count{processor="read"} 3
+# HELP goetl_queue_depth Payloads waiting in the channel between two processors.
+# TYPE goetl_queue_depth gauge
+goetl_queue_depth{from="read",to="write"} 3
+`,
+		},
+		{
+			name:            "OpenMetrics",
+			accept:          "application/openmetrics-text; version=1.0.0,text/plain;q=0.5",
+			wantContentType: "application/openmetrics-text; version=1.0.0; charset=utf-8",
+			want: `# TYPE custom_gauge gauge
+custom_gauge -1
+# HELP goetl_payloads_received Payloads received by a processor.
+# TYPE goetl_payloads_received counter
+goetl_payloads_received_total{pipeline="a\"b\\c\nd",processor="read"} 3.5
+goetl_payloads_received_total{pipeline="p",processor="filter"} 1
+# HELP goetl_processing_seconds Time spent processing a payload.
+# TYPE goetl_processing_seconds histogram
+goetl_processing_seconds_bucket{processor="read",le="0.1"} 1
+goetl_processing_seconds_bucket{processor="read",le="1"} 2
+goetl_processing_seconds_bucket{processor="read",le="+Inf"} 3
+goetl_processing_seconds_sum{processor="read"} 5.55
+goetl_processing_seconds_count{processor="read"} 3
+# HELP goetl_queue_depth Payloads waiting in the channel between two processors.
+# TYPE goetl_queue_depth gauge
+goetl_queue_depth{from="read",to="write"} 3
+# EOF
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			sink.ServeHTTP(rec, req)
+			if ct := rec.Header().Get("Content-Type"); ct != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantContentType)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrometheusSinkConcurrency(t *testing.T) {
+	sink := goetl.NewPrometheusSink()
+	const workers, increments = 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			labels := goetl.Labels{"processor": fmt.Sprint("p", w%2)}
+			for i := 0; i < increments; i++ {
+				sink.Counter(goetl.MetricPayloadsSent, labels, 1)
+				sink.Gauge(goetl.MetricWorkersBusy, labels, float64(i))
+				sink.Histogram(goetl.MetricProcessingSeconds, labels, 0.01)
+				if i%100 == 0 {
+					sink.WriteTo(&strings.Builder{})
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	sink.WriteTo(&b)
+	for _, want := range []string{
+		fmt.Sprintf(`goetl_payloads_sent_total{processor="p0"} %d`, workers/2*increments),
+		fmt.Sprintf(`goetl_payloads_sent_total{processor="p1"} %d`, workers/2*increments),
+		fmt.Sprintf(`goetl_processing_seconds_count{processor="p1"} %d`, workers/2*increments),
+		fmt.Sprintf(`goetl_workers_busy{processor="p0"} %d`, increments-1),
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("no %q in:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package goetl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ProcessorFactory builds a Processor from its configuration. See
+// RegisterProcessor.
+type ProcessorFactory func(config *ProcessorConfig) (Processor, error)
+
+var (
+	factoriesMutex sync.RWMutex
+	factories      = make(map[string]ProcessorFactory)
+)
+
+// RegisterProcessor makes a Processor available to pipeline configs (see
+// PipelineConfig) under the given type name. The built-in Processors are
+// registered by importing the processors package. Custom Processors can be
+// registered the same way, typically from an init function:
+//
+//     func init() {
+//             goetl.RegisterProcessor("Uppercase", func(c *goetl.ProcessorConfig) (goetl.Processor, error) {
+//                     var params struct {
+//                             Field string `json:"field"`
+//                     }
+//                     if err := c.Decode(&params); err != nil {
+//                             return nil, err
+//                     }
+//                     return NewUppercase(params.Field), nil
+//             })
+//     }
+//
+// RegisterProcessor panics if the type name is already registered, or if
+// the factory is nil.
+func RegisterProcessor(typeName string, factory ProcessorFactory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	if factory == nil {
+		panic("goetl: RegisterProcessor factory is nil")
+	}
+	if _, dup := factories[typeName]; dup {
+		panic("goetl: RegisterProcessor called twice for " + typeName)
+	}
+	factories[typeName] = factory
+}
+
+// RegisteredProcessors returns the sorted type names of all registered
+// Processors.
+func RegisteredProcessors() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProcessorFromConfig builds a Processor using the factory registered
+// for config.Type.
+func NewProcessorFromConfig(config *ProcessorConfig) (Processor, error) {
+	factoriesMutex.RLock()
+	factory, ok := factories[config.Type]
+	factoriesMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown processor type %q", config.Type)
+	}
+	return factory(config)
+}
+
+// ProcessorConfig is the configuration of a single Processor within a
+// PipelineConfig.
+type ProcessorConfig struct {
+	// Name identifies the Processor within the pipeline config, and is
+	// used to refer to it in Outputs.
+	Name string `json:"name"`
+	// Type is the name the Processor was registered under.
+	Type string `json:"type"`
+	// Config holds the Processor specific parameters, see Decode.
+	Config json.RawMessage `json:"config,omitempty"`
+	// Outputs lists the names of the Processors receiving this
+	// Processor's data.
+	Outputs []string `json:"outputs,omitempty"`
+}
+
+// Decode decodes the Processor specific parameters into v, which is
+// typically a pointer to a struct with json tags. Unknown parameters
+// are reported as errors, to catch typos in the config.
+func (c *ProcessorConfig) Decode(v interface{}) error {
+	if len(c.Config) == 0 || string(c.Config) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(c.Config))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	return nil
+}
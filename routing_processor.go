@@ -0,0 +1,70 @@
+package goetl
+
+import (
+	"fmt"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+// RoutingProcessor is a Processor that chooses which of its Outputs receive
+// each payload it sends, instead of every Output receiving a copy. Route is
+// called for every payload sent on the outputChan, and must return a subset
+// of the Processors given to Outputs. Returning no Processors drops the
+// payload.
+//
+// For example, a RoutingProcessor could send order records to one writer
+// and refund records to another, without each writer needing a filter.
+// See also DataProcessor.Route, for routing the data of any Processor.
+type RoutingProcessor interface {
+	Processor
+	Route(d etldata.Payload) []Processor
+}
+
+// Route sets a function that chooses which of the Outputs receive each
+// payload sent by the Processor. See RoutingProcessor. A payload is only
+// copied for the Outputs that are chosen.
+func (dp *DataProcessor) Route(router func(d etldata.Payload) []Processor) *DataProcessor {
+	dp.router = router
+	return dp
+}
+
+// routingProcessorOf returns the given Processor, or the one it wraps, if it
+// implements RoutingProcessor, or nil.
+func routingProcessorOf(p Processor) RoutingProcessor {
+	for _, p := range unwrapProcessor(p) {
+		if rp, ok := p.(RoutingProcessor); ok {
+			return rp
+		}
+	}
+	return nil
+}
+
+// routeChans returns the branchOutChans that the given payload should be
+// sent to.
+func (dp *DataProcessor) routeChans(d etldata.Payload) []chan etldata.Payload {
+	var route []Processor
+	if dp.router != nil {
+		route = dp.router(d)
+	} else if rp := routingProcessorOf(dp.Processor); rp != nil {
+		route = rp.Route(d)
+	} else {
+		return dp.branchOutChans
+	}
+
+	// branchOutChans are set up in the same order as the outputs.
+	chans := []chan etldata.Payload{}
+	for _, p := range route {
+		found := false
+		for i := range dp.outputs {
+			if dp.outputs[i] == p {
+				chans = append(chans, dp.branchOutChans[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			dp.killChan <- fmt.Errorf("Processor (%v) routed data to Processor (%v) which is not one of its Outputs", dp, p)
+		}
+	}
+	return chans
+}
@@ -0,0 +1,93 @@
+package goetl_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+)
+
+// typeRouter sends its data like a testSource, routing it by its "type".
+type typeRouter struct {
+	testSource
+	routes map[string][]goetl.Processor
+}
+
+func (r *typeRouter) Route(d etldata.Payload) []goetl.Processor {
+	var v struct{ Type string }
+	d.Parse(&v)
+	return r.routes[v.Type]
+}
+
+func TestRouting(t *testing.T) {
+	data := []string{`{"type":"order"}`, `{"type":"refund"}`, `{"type":"both"}`, `{"type":"other"}`}
+	tests := []struct {
+		name        string
+		router      bool // use DataProcessor.Route rather than RoutingProcessor
+		route       func(orders, refunds, unknown goetl.Processor) map[string][]goetl.Processor
+		wantOrders  []string
+		wantRefunds []string
+		wantErr     string
+	}{
+		{
+			name: "RoutingProcessor",
+			route: func(orders, refunds, unknown goetl.Processor) map[string][]goetl.Processor {
+				return map[string][]goetl.Processor{"order": {orders}, "refund": {refunds}, "both": {refunds, orders}}
+			},
+			wantOrders:  []string{`{"type":"order"}`, `{"type":"both"}`},
+			wantRefunds: []string{`{"type":"refund"}`, `{"type":"both"}`},
+		},
+		{
+			name:   "DataProcessor.Route",
+			router: true,
+			route: func(orders, refunds, unknown goetl.Processor) map[string][]goetl.Processor {
+				return map[string][]goetl.Processor{"order": {orders}, "both": {orders, refunds}}
+			},
+			wantOrders:  []string{`{"type":"order"}`, `{"type":"both"}`},
+			wantRefunds: []string{`{"type":"both"}`},
+		},
+		{
+			name: "not an output",
+			route: func(orders, refunds, unknown goetl.Processor) map[string][]goetl.Processor {
+				return map[string][]goetl.Processor{"other": {unknown}}
+			},
+			wantErr: "routed data to Processor (unknown) which is not one of its Outputs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders, refunds := &testSink{}, &testSink{}
+			routes := tt.route(orders, refunds, &testSource{name: "unknown"})
+			source := &typeRouter{testSource: testSource{name: "source", data: data}, routes: routes}
+			dp := goetl.Do(source).Outputs(orders, refunds)
+			if tt.router {
+				dp = goetl.Do(&testSource{name: "source", data: data}).Outputs(orders, refunds).Route(source.Route)
+			}
+			layout, err := goetl.NewPipelineLayout(
+				goetl.NewPipelineStage(dp),
+				goetl.NewPipelineStage(goetl.Do(orders).Named("orders"), goetl.Do(refunds).Named("refunds")),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := goetl.NewBranchingPipeline(layout).Execute()
+			if tt.wantErr != "" {
+				if r.Err == nil || !strings.Contains(r.Err.Error(), tt.wantErr) {
+					t.Fatalf("Err = %v, want %q", r.Err, tt.wantErr)
+				}
+				return
+			}
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			if !reflect.DeepEqual(orders.got, tt.wantOrders) {
+				t.Errorf("orders got %v, want %v", orders.got, tt.wantOrders)
+			}
+			if !reflect.DeepEqual(refunds.got, tt.wantRefunds) {
+				t.Errorf("refunds got %v, want %v", refunds.got, tt.wantRefunds)
+			}
+		})
+	}
+}
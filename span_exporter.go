@@ -0,0 +1,170 @@
+package goetl
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// InMemorySpanExporter is a SpanExporter that keeps every Span in memory,
+// which is mostly useful in tests.
+type InMemorySpanExporter struct {
+	mutex sync.Mutex
+	spans []*Span
+}
+
+// NewInMemorySpanExporter returns a new InMemorySpanExporter.
+func NewInMemorySpanExporter() *InMemorySpanExporter {
+	return &InMemorySpanExporter{}
+}
+
+// ExportSpans implements SpanExporter.
+func (e *InMemorySpanExporter) ExportSpans(spans []*Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Spans returns the Spans exported so far.
+func (e *InMemorySpanExporter) Spans() []*Span {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset forgets the Spans exported so far.
+func (e *InMemorySpanExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = nil
+}
+
+// OTLPFileExporter is a SpanExporter that appends Spans to a file in the
+// OTLP/JSON format, one ExportTraceServiceRequest per line, as written by
+// the OpenTelemetry Collector's file exporter. The file can be replayed
+// into a collector (with its otlpjsonfile receiver) or read directly.
+type OTLPFileExporter struct {
+	// ServiceName is reported as the service.name resource attribute.
+	// Defaults to "goetl".
+	ServiceName string
+
+	mutex sync.Mutex
+	file  io.WriteCloser
+}
+
+// NewOTLPFileExporter returns a new OTLPFileExporter appending to the named
+// file, which is created if needed. Close it once the Pipeline has finished.
+func NewOTLPFileExporter(filename string) (*OTLPFileExporter, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &OTLPFileExporter{ServiceName: "goetl", file: f}, nil
+}
+
+// ExportSpans implements SpanExporter.
+func (e *OTLPFileExporter) ExportSpans(spans []*Span) error {
+	serviceName := e.ServiceName
+	if serviceName == "" {
+		serviceName = "goetl"
+	}
+	otlpSpans := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		otlpSpans[i] = otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Processor,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes: []otlpAttribute{
+				otlpString("goetl.pipeline", s.Pipeline),
+				otlpInt("goetl.stage", s.Stage),
+				otlpString("goetl.processor", s.Processor),
+				otlpInt("goetl.payload.bytes", s.Bytes),
+			},
+		}
+		if !s.ParentID.IsZero() {
+			otlpSpans[i].ParentSpanID = s.ParentID.String()
+		}
+	}
+	request := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{otlpString("service.name", serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/teambenny/goetl"}, Spans: otlpSpans}},
+	}}}
+	line, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, err = e.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (e *OTLPFileExporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.file.Close()
+}
+
+// The OTLP/JSON encoding of an ExportTraceServiceRequest. 64 bit integers
+// are encoded as strings, and IDs as hex.
+const otlpSpanKindInternal = 1
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int) otlpAttribute {
+	v := strconv.Itoa(value)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &v}}
+}
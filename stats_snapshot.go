@@ -0,0 +1,178 @@
+package goetl
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+)
+
+// StatsSnapshot holds the stats gathered for each stage and Processor of a
+// Pipeline, in a form that can be marshalled to JSON and kept as a history
+// of runs. See Pipeline.StatsSnapshot.
+type StatsSnapshot struct {
+	Pipeline        string          `json:"pipeline"`
+	StartedAt       *time.Time      `json:"started_at,omitempty"`
+	FinishedAt      *time.Time      `json:"finished_at,omitempty"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	Stages          []StageSnapshot `json:"stages"`
+}
+
+// StageSnapshot holds the stats for the Processors in a stage.
+type StageSnapshot struct {
+	Stage      int                 `json:"stage"`
+	Processors []ProcessorSnapshot `json:"processors"`
+}
+
+// ProcessorSnapshot holds the stats for a single Processor.
+//
+// Records are counted without decoding the payloads: a JSON object is one
+// record, and a JSON array holds one record per top-level element, whatever
+// its type, so both [{"a":1},{"a":2}] and [1,2] count as 2 records. An
+// etldata.Records payload holds one record per row, and anything else holds
+// none. The bytes of an etldata.Records payload are only counted once it has
+// been encoded. The throughput is measured from the
+// first ProcessData call until Finish returns (or until now, while the
+// Processor is still running).
+//
+// BlockedSeconds is the time the Processor's output spent waiting for the
+// next stage to take it, and WorkingSeconds estimates the rest of the time
+// spent in ProcessData. Working time is summed over every ProcessData call,
+// so it can add up to more than the run duration for a ConcurrentProcessor.
+type ProcessorSnapshot struct {
+	Processor                string           `json:"processor"`
+	StartedAt                *time.Time       `json:"started_at,omitempty"`
+	FinishedAt               *time.Time       `json:"finished_at,omitempty"`
+	Executions               int              `json:"executions"`
+	PayloadsReceived         int              `json:"payloads_received"`
+	PayloadsSent             int              `json:"payloads_sent"`
+	RecordsReceived          int              `json:"records_received"`
+	RecordsSent              int              `json:"records_sent"`
+	RecordsReceivedPerSecond float64          `json:"records_received_per_second"`
+	RecordsSentPerSecond     float64          `json:"records_sent_per_second"`
+	BytesReceived            PayloadSizeStats `json:"bytes_received"`
+	BytesSent                PayloadSizeStats `json:"bytes_sent"`
+	Latency                  LatencyStats     `json:"latency"`
+	WorkingSeconds           float64          `json:"working_seconds"`
+	BlockedSeconds           float64          `json:"blocked_seconds"`
+	Retries                  int              `json:"retries"`
+	Skipped                  int              `json:"skipped"`
+	DeadLettered             int              `json:"dead_lettered"`
+}
+
+// PayloadSizeStats holds the total, smallest and largest payload sizes in
+// bytes.
+type PayloadSizeStats struct {
+	Total int `json:"total"`
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+}
+
+// LatencyStats holds the ProcessData call durations in seconds. The
+// percentiles are estimated from a random sample of the calls once there
+// are more than a thousand of them.
+type LatencyStats struct {
+	Min float64 `json:"min_seconds"`
+	P50 float64 `json:"p50_seconds"`
+	P95 float64 `json:"p95_seconds"`
+	P99 float64 `json:"p99_seconds"`
+	Max float64 `json:"max_seconds"`
+}
+
+// StatsSnapshot returns the stats gathered so far for each stage and
+// Processor. It can be called while the Pipeline is running, as well as
+// once it has finished.
+func (p *Pipeline) StatsSnapshot() *StatsSnapshot {
+	s := &StatsSnapshot{Pipeline: p.Name, Stages: []StageSnapshot{}}
+	if p.timer != nil {
+		started := p.timer.StartTime()
+		s.StartedAt = &started
+		p.resultMutex.Lock()
+		if p.finished {
+			finished := p.timer.EndTime()
+			s.FinishedAt = &finished
+			s.DurationSeconds = finished.Sub(started).Seconds()
+		} else {
+			s.DurationSeconds = time.Since(started).Seconds()
+		}
+		p.resultMutex.Unlock()
+	}
+	for n, stage := range p.layout.stages {
+		ss := StageSnapshot{Stage: n + 1, Processors: []ProcessorSnapshot{}}
+		for _, dp := range stage.processors {
+			ps := dp.executionStat.processorSnapshot()
+			if ps.Processor == "" {
+				// The Pipeline has not been run yet.
+				ps.Processor = dp.String()
+			}
+			ss.Processors = append(ss.Processors, ps)
+		}
+		s.Stages = append(s.Stages, ss)
+	}
+	return s
+}
+
+// recordCount returns the number of records in d. It is called for every
+// payload sent, so it never decodes JSON: a JSON object is one record, and
+// the top-level elements of a JSON array are counted by scanning its bytes
+// (see countArrayElements). Anything else holds no records.
+func recordCount(d etldata.Payload) int {
+	if r, ok := unwrapped(d).(*etldata.Records); ok {
+		return r.Len()
+	}
+	b := bytes.TrimSpace(d.Bytes())
+	switch {
+	case len(b) == 0:
+		return 0
+	case b[0] == '{':
+		return 1
+	case b[0] == '[':
+		return countArrayElements(b)
+	}
+	return 0
+}
+
+// countArrayElements counts the elements of the JSON array b, by counting
+// the commas that are not nested in another value or in a string.
+func countArrayElements(b []byte) int {
+	if rest := bytes.TrimSpace(b[1:]); len(rest) == 0 || rest[0] == ']' {
+		return 0
+	}
+	depth, count := 0, 1
+	inString, escaped := false, false
+	for _, c := range b {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 1 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// payloadSize returns the size of d in bytes, without encoding Records
+// just to measure them (see etldata.Records.Size).
+func payloadSize(d etldata.Payload) int {
+	if r, ok := unwrapped(d).(*etldata.Records); ok {
+		return r.Size()
+	}
+	return len(d.Bytes())
+}
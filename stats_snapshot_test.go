@@ -0,0 +1,55 @@
+package goetl_test
+
+import (
+	"testing"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+)
+
+// payloadSource sends the given payload.
+type payloadSource struct {
+	d etldata.Payload
+}
+
+func (s *payloadSource) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	outputChan <- s.d
+}
+
+func (s *payloadSource) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func TestStatsSnapshotRecords(t *testing.T) {
+	tests := []struct {
+		name        string
+		d           etldata.Payload
+		wantRecords int
+		wantBytes   int
+	}{
+		{name: "Records", d: etldata.NewRecords([]map[string]interface{}{{"a": 1}, {"a": 2}}), wantRecords: 2},
+		{name: "array", d: etldata.JSON(`[{"a":1},{"a":2}]`), wantRecords: 2, wantBytes: 17},
+		{name: "object", d: etldata.JSON(`{"a":[1,2]}`), wantRecords: 1, wantBytes: 11},
+		{name: "empty array", d: etldata.JSON(` [ ] `), wantBytes: 5},
+		{name: "nested values", d: etldata.JSON(`[{"s":"a,]\"b"},[1,2],{"o":{"x":[1,{}]}}]`), wantRecords: 3, wantBytes: 41},
+		{name: "array of values", d: etldata.JSON(`[1,2]`), wantRecords: 2, wantBytes: 5},
+		{name: "not JSON", d: etldata.JSON(`a,b`), wantBytes: 3},
+		{name: "with metadata", d: etldata.WithMetadata(etldata.JSON(`[{},{}]`), etldata.Metadata{"k": "v"}), wantRecords: 2, wantBytes: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := goetl.NewPipeline(&payloadSource{d: tt.d}, &testSink{})
+			p.Tracing = goetl.NewInMemorySpanExporter()
+			if r := p.Execute(); r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			s := p.StatsSnapshot()
+			source, sink := s.Stages[0].Processors[0], s.Stages[1].Processors[0]
+			if source.RecordsSent != tt.wantRecords || sink.RecordsReceived != tt.wantRecords {
+				t.Errorf("records sent/received = %d/%d, want %d", source.RecordsSent, sink.RecordsReceived, tt.wantRecords)
+			}
+			// Records are not encoded just to measure them.
+			if source.BytesSent.Total != tt.wantBytes {
+				t.Errorf("bytes sent = %d, want %d", source.BytesSent.Total, tt.wantBytes)
+			}
+		})
+	}
+}
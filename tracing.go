@@ -0,0 +1,186 @@
+package goetl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/teambenny/goetl/etldata"
+	"github.com/teambenny/goetl/logger"
+)
+
+// SpanExporter receives the Spans recorded by a Pipeline with tracing
+// enabled (see Pipeline.Tracing). Spans are exported in batches as the
+// Pipeline runs, and the last batch once it has finished. ExportSpans may
+// be called from several goroutines at once. Export errors are logged, and
+// do not fail the Pipeline.
+type SpanExporter interface {
+	ExportSpans(spans []*Span) error
+}
+
+// TraceID identifies the path of a payload through a Pipeline.
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsZero returns true if the TraceID is not set.
+func (t TraceID) IsZero() bool {
+	return t == TraceID{}
+}
+
+// SpanID identifies a Span within a trace.
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsZero returns true if the SpanID is not set.
+func (s SpanID) IsZero() bool {
+	return s == SpanID{}
+}
+
+// Span records a single ProcessData call. Every payload sent by the first
+// stage (or from a Finish call) starts a new trace, and the payloads sent
+// while processing it carry the same TraceID on through the later stages,
+// with ParentID set to the Span of the call that sent them.
+type Span struct {
+	TraceID   TraceID
+	SpanID    SpanID
+	ParentID  SpanID // zero for the first Span of a trace
+	Pipeline  string
+	Stage     int
+	Processor string
+	Bytes     int // the size of the payload received
+	Start     time.Time
+	End       time.Time
+
+	continued bool // whether the payload processed was traced
+}
+
+// spanBatchSize is how many Spans are buffered before they are exported.
+const spanBatchSize = 128
+
+// tracer records the Spans for a Pipeline.
+type tracer struct {
+	exporter SpanExporter
+	pipeline string
+	mutex    sync.Mutex
+	spans    []*Span
+}
+
+// setupTracing points every DataProcessor at a tracer, if the Pipeline has
+// tracing enabled.
+func (p *Pipeline) setupTracing() {
+	p.tracer = nil
+	if p.Tracing != nil {
+		p.tracer = &tracer{exporter: p.Tracing, pipeline: p.Name}
+	}
+	for n, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			dp.tracer = p.tracer
+			dp.stage = n + 1
+		}
+	}
+}
+
+func (t *tracer) record(span *Span) {
+	t.mutex.Lock()
+	t.spans = append(t.spans, span)
+	if len(t.spans) < spanBatchSize {
+		t.mutex.Unlock()
+		return
+	}
+	spans := t.spans
+	t.spans = nil
+	t.mutex.Unlock()
+	t.export(spans)
+}
+
+// flush exports any buffered Spans.
+func (t *tracer) flush() {
+	t.mutex.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mutex.Unlock()
+	if len(spans) > 0 {
+		t.export(spans)
+	}
+}
+
+func (t *tracer) export(spans []*Span) {
+	if err := t.exporter.ExportSpans(spans); err != nil {
+		logger.Error(t.pipeline, ": exporting spans:", err)
+	}
+}
+
+// startSpan returns the Span for processing d, continuing its trace if it
+// has one. It returns nil if tracing is not enabled.
+func (dp *DataProcessor) startSpan(d etldata.Payload) *Span {
+	if dp.tracer == nil {
+		return nil
+	}
+	span := &Span{
+		SpanID:    newSpanID(),
+		Pipeline:  dp.tracer.pipeline,
+		Stage:     dp.stage,
+		Processor: dp.statName,
+		Bytes:     payloadSize(d),
+		Start:     time.Now(),
+	}
+	if e := envelopeOf(d); e != nil && !e.traceID.IsZero() {
+		span.TraceID = e.traceID
+		span.ParentID = e.spanID
+		span.continued = true
+	} else {
+		span.TraceID = newTraceID()
+	}
+	return span
+}
+
+// endSpan records a Span returned by startSpan, which may be nil.
+func (dp *DataProcessor) endSpan(span *Span) {
+	if span == nil {
+		return
+	}
+	span.End = time.Now()
+	dp.tracer.record(span)
+}
+
+// traceOutput tags the payloads sent while processing a traced payload
+// with its Span. Payloads sent for an untraced one (such as the
+// StartSignal) are left for branchOut to start new traces.
+func traceOutput(span *Span, d etldata.Payload) etldata.Payload {
+	if span == nil || !span.continued {
+		return d
+	}
+	e := rewrap(d)
+	e.traceID, e.spanID = span.TraceID, span.SpanID
+	return e
+}
+
+// startTrace gives a payload sent without a trace a new one.
+func (dp *DataProcessor) startTrace(d etldata.Payload) etldata.Payload {
+	if dp.tracer == nil {
+		return d
+	}
+	if e := envelopeOf(d); e != nil && !e.traceID.IsZero() {
+		return d
+	}
+	e := rewrap(d)
+	e.traceID = newTraceID()
+	return e
+}
+
+func newTraceID() (t TraceID) {
+	rand.Read(t[:])
+	return t
+}
+
+func newSpanID() (s SpanID) {
+	rand.Read(s[:])
+	return s
+}
@@ -0,0 +1,163 @@
+package goetl_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/teambenny/goetl"
+	"github.com/teambenny/goetl/etldata"
+)
+
+// concurrentPass passes its data on, handling several payloads at once.
+type concurrentPass struct{}
+
+func (c *concurrentPass) ProcessData(d etldata.Payload, outputChan chan etldata.Payload, killChan chan error) {
+	outputChan <- d
+}
+
+func (c *concurrentPass) Finish(outputChan chan etldata.Payload, killChan chan error) {}
+
+func (c *concurrentPass) Concurrency() int {
+	return 4
+}
+
+func (c *concurrentPass) String() string {
+	return "concurrentPass"
+}
+
+func TestTracing(t *testing.T) {
+	tests := []struct {
+		name     string
+		payloads int
+		pass     goetl.Processor
+		sinks    int
+	}{
+		{name: "branching", payloads: 2, pass: &flakyProcessor{}, sinks: 2},
+		{name: "concurrent", payloads: 200, pass: &concurrentPass{}, sinks: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]string, tt.payloads)
+			for i := range data {
+				data[i] = fmt.Sprintf(`{"i":%d}`, i)
+			}
+			var sinks []goetl.Processor
+			var last []*goetl.DataProcessor
+			for i := 0; i < tt.sinks; i++ {
+				s := &testSink{}
+				sinks = append(sinks, s)
+				last = append(last, goetl.Do(s).Named(fmt.Sprint("sink", i)))
+			}
+			layout, err := goetl.NewPipelineLayout(
+				goetl.NewPipelineStage(goetl.Do(&testSource{name: "source", data: data}).Outputs(tt.pass)),
+				goetl.NewPipelineStage(goetl.Do(tt.pass).Outputs(sinks...)),
+				goetl.NewPipelineStage(last...),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exporter := goetl.NewInMemorySpanExporter()
+			p := goetl.NewBranchingPipeline(layout)
+			p.Tracing = exporter
+			if r := p.Execute(); r.Err != nil {
+				t.Fatal(r.Err)
+			}
+
+			byStage := map[int][]*goetl.Span{}
+			byID := map[goetl.SpanID]*goetl.Span{}
+			for _, s := range exporter.Spans() {
+				byStage[s.Stage] = append(byStage[s.Stage], s)
+				byID[s.SpanID] = s
+			}
+			if n := [3]int{len(byStage[1]), len(byStage[2]), len(byStage[3])}; n != [3]int{1, tt.payloads, tt.payloads * tt.sinks} {
+				t.Fatalf("spans per stage = %v", n)
+			}
+			if s := byStage[1][0]; s.Processor != "source" || s.TraceID.IsZero() || !s.ParentID.IsZero() {
+				t.Errorf("first stage span = %+v", s)
+			}
+			// Every payload sent by the first stage starts its own trace.
+			traces := map[goetl.TraceID]bool{}
+			for _, s := range byStage[2] {
+				if traces[s.TraceID] || s.TraceID == byStage[1][0].TraceID || !s.ParentID.IsZero() {
+					t.Errorf("second stage span does not start a new trace: %+v", s)
+				}
+				traces[s.TraceID] = true
+				if s.Processor != tt.pass.(fmt.Stringer).String() || s.Bytes < len(`{"i":0}`) {
+					t.Errorf("second stage span = %+v", s)
+				}
+			}
+			for _, s := range byStage[3] {
+				parent := byID[s.ParentID]
+				if parent == nil || parent.Stage != 2 || parent.TraceID != s.TraceID {
+					t.Fatalf("span %+v does not continue the trace of its parent %+v", s, parent)
+				}
+				if s.End.Before(s.Start) {
+					t.Errorf("span ends before it starts: %+v", s)
+				}
+			}
+		})
+	}
+}
+
+func TestOTLPFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goetl-otlp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "spans.json")
+
+	start := time.Unix(1, 0)
+	spans := []*goetl.Span{
+		{TraceID: goetl.TraceID{1}, SpanID: goetl.SpanID{2}, Pipeline: "p", Stage: 1, Processor: "read", Start: start, End: start.Add(time.Second)},
+		{TraceID: goetl.TraceID{1}, SpanID: goetl.SpanID{3}, ParentID: goetl.SpanID{2}, Pipeline: "p", Stage: 2, Processor: "write", Bytes: 10, Start: start, End: start},
+	}
+	e, err := goetl.NewOTLPFileExporter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ExportSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(d, &request); err != nil {
+		t.Fatal(err)
+	}
+	got := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(got) != 2 {
+		t.Fatalf("got %d spans", len(got))
+	}
+	want := []map[string]interface{}{
+		{"traceId": "01000000000000000000000000000000", "spanId": "0200000000000000", "name": "read", "startTimeUnixNano": "1000000000", "endTimeUnixNano": "2000000000"},
+		{"traceId": "01000000000000000000000000000000", "spanId": "0300000000000000", "parentSpanId": "0200000000000000", "name": "write"},
+	}
+	for i, w := range want {
+		for k, v := range w {
+			if got[i][k] != v {
+				t.Errorf("span %d %v = %v, want %v", i, k, got[i][k], v)
+			}
+		}
+	}
+	if _, ok := got[0]["parentSpanId"]; ok {
+		t.Error("root span has a parentSpanId")
+	}
+}